@@ -0,0 +1,378 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alexisbouchez/ai/budget"
+	"github.com/alexisbouchez/ai/cost"
+	"github.com/alexisbouchez/ai/internal/logging"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/store"
+	"github.com/alexisbouchez/ai/tool"
+)
+
+const defaultMaxSteps = 10
+
+var (
+	ErrMaxSteps  = errors.New("agent exceeded its step limit")
+	ErrNotPaused = errors.New("run is not paused")
+)
+
+// Agent runs a model in a loop, executing the tools it calls until it
+// answers without tool calls.
+type Agent struct {
+	provider  provider.Provider
+	system    string
+	tools     *tool.Registry
+	approver  Approver
+	configure func(*provider.ChatRequest)
+	maxSteps  int
+	runOpts   tool.RunOptions
+	budget    budget.Budget
+	hooks     Hooks
+	store     store.Store
+}
+
+func New(p provider.Provider) *Agent {
+	return &Agent{
+		provider: p,
+		tools:    tool.NewRegistry(),
+		maxSteps: defaultMaxSteps,
+	}
+}
+
+func (a *Agent) System(prompt string) *Agent {
+	a.system = prompt
+	return a
+}
+
+func (a *Agent) Tools(tools ...*tool.Tool) *Agent {
+	a.tools.Register(tools...)
+	return a
+}
+
+// Approver sets the approver consulted before every tool call. Without one
+// every call is allowed.
+func (a *Agent) Approver(approver Approver) *Agent {
+	a.approver = approver
+	return a
+}
+
+// Configure registers a function applied to every outgoing request.
+func (a *Agent) Configure(fn func(*provider.ChatRequest)) *Agent {
+	a.configure = fn
+	return a
+}
+
+// MaxSteps bounds the number of model calls in a run.
+func (a *Agent) MaxSteps(n int) *Agent {
+	a.maxSteps = n
+	return a
+}
+
+// RunOptions sets the options tools are executed with.
+func (a *Agent) RunOptions(opts tool.RunOptions) *Agent {
+	a.runOpts = opts
+	return a
+}
+
+// Budget limits every call of Run and Resume. When a limit is hit the call
+// fails with a *budget.ExceededError holding the transcript so far, and the
+// partial result is returned alongside it.
+func (a *Agent) Budget(b budget.Budget) *Agent {
+	a.budget = b
+	return a
+}
+
+// Result is the state of a run. A paused result can be stored and handed to
+// Resume later, in the same process or another one.
+type Result struct {
+	Messages []provider.Message `json:"messages"`
+	// Pending lists the calls awaiting a decision when the run is paused
+	Pending []Call `json:"pending,omitempty"`
+	Steps   int    `json:"steps"`
+	// Response is the last model response
+	Response *provider.ChatResponse `json:"response,omitempty"`
+	// Usage totals the model calls of the run, across resumes
+	Usage cost.Totals `json:"usage"`
+}
+
+func (r *Result) Paused() bool {
+	return len(r.Pending) > 0
+}
+
+// Text returns the content of the final answer.
+func (r *Result) Text() string {
+	if r.Response == nil || len(r.Response.Choices) == 0 {
+		return ""
+	}
+	return r.Response.Choices[0].Message.Content
+}
+
+// Run starts a run with input as the user message.
+func (a *Agent) Run(ctx context.Context, input string) (*Result, error) {
+	result := &Result{
+		Messages: []provider.Message{{Role: provider.RoleUser, Content: input}},
+	}
+	return a.loop(ctx, result, nil, nil)
+}
+
+// Resume continues a paused run with decisions for its pending calls, keyed
+// by call ID. Calls without a decision are submitted to the approver again.
+func (a *Agent) Resume(ctx context.Context, paused *Result, decisions map[string]Approval) (*Result, error) {
+	if !paused.Paused() {
+		return nil, ErrNotPaused
+	}
+	if decisions == nil {
+		decisions = make(map[string]Approval)
+	}
+	result := &Result{
+		Messages: append([]provider.Message(nil), paused.Messages...),
+		Steps:    paused.Steps,
+		Response: paused.Response,
+		Usage:    paused.Usage,
+	}
+	return a.loop(ctx, result, decisions, nil)
+}
+
+// loop runs steps until the run answers, pauses or fails. A durable run is
+// checkpointed after every model call and every batch of tool calls.
+func (a *Agent) loop(ctx context.Context, result *Result, decisions map[string]Approval, durable *checkpoint) (*Result, error) {
+	run := a.budget.Start()
+	save := func() error { return nil }
+	if durable != nil {
+		run = a.budget.Resume(durable.Usage)
+		save = func() error {
+			return a.save(ctx, durable.update(result, run, nil))
+		}
+	}
+
+	result, err := a.steps(ctx, run, result, decisions, save, durable != nil)
+	if durable != nil {
+		if saveErr := a.save(ctx, durable.update(result, run, err)); saveErr != nil {
+			err = errors.Join(err, saveErr)
+		}
+	}
+	a.hooks.end(ctx, result, err)
+	logEnd(ctx, result, err)
+	return result, err
+}
+
+func logEnd(ctx context.Context, result *Result, err error) {
+	log := logging.For(logging.Agent)
+	attrs := []any{"steps", result.Steps, "prompt_tokens", result.Usage.PromptTokens, "completion_tokens", result.Usage.CompletionTokens}
+	switch {
+	case err != nil:
+		log.ErrorContext(ctx, "agent run failed", append(attrs, "error", err)...)
+	case result.Paused():
+		log.DebugContext(ctx, "agent run paused", append(attrs, "pending", len(result.Pending))...)
+	default:
+		log.DebugContext(ctx, "agent run finished", attrs...)
+	}
+}
+
+func (a *Agent) steps(ctx context.Context, run *budget.Run, result *Result, decisions map[string]Approval, save func() error, durable bool) (*Result, error) {
+	ctx, cancel := run.Context(ctx)
+	defer cancel()
+
+	// a run stopping before it ran the tool calls of the last message
+	// answers them with errors, so that its transcript can be sent again,
+	// unless it is durable and ResumeRun settles them
+	abandon := func(reason string) {
+		if !durable {
+			abandonTools(result, reason)
+		}
+	}
+	exceeded := func(err error) error {
+		return budget.WithMessages(run.Err(err), result.Messages)
+	}
+
+	// a resumed run first settles the tool calls it paused on
+	if decisions != nil {
+		done, err := a.runTools(ctx, run, result, decisions)
+		if err != nil {
+			abandon(err.Error())
+		}
+		if err != nil || !done {
+			return result, exceeded(err)
+		}
+		if err := save(); err != nil {
+			return result, err
+		}
+	}
+
+	for {
+		if result.Steps >= a.maxSteps {
+			return result, ErrMaxSteps
+		}
+		if err := run.Check(); err != nil {
+			return result, exceeded(err)
+		}
+
+		req := a.request(result.Messages)
+		a.hooks.llmStart(ctx, result.Steps+1, req)
+		resp, err := a.provider.Chat(ctx, req)
+		if err != nil {
+			return result, exceeded(err)
+		}
+		result.Steps++
+		result.Response = resp
+		a.hooks.llmEnd(ctx, result.Steps, resp)
+
+		model := resp.Model
+		if model == "" {
+			model = req.Model
+		}
+		logging.For(logging.Agent).DebugContext(ctx, "agent step", "step", result.Steps, "model", model, "tool_calls", toolCalls(resp), "total_tokens", resp.Usage.TotalTokens)
+		result.Usage.Add(model, resp.Usage)
+		budgetErr := run.AddUsage(model, resp.Usage)
+		if len(resp.Choices) == 0 {
+			return result, nil
+		}
+
+		msg := resp.Choices[0].Message
+		result.Messages = append(result.Messages, msg)
+		if len(msg.ToolCalls) == 0 {
+			return result, nil
+		}
+		if a.tools.Len() == 0 {
+			abandon("no tool is registered")
+			return result, nil
+		}
+		if budgetErr != nil {
+			abandon(budgetErr.Error())
+			return result, exceeded(budgetErr)
+		}
+		if err := save(); err != nil {
+			return result, err
+		}
+
+		done, err := a.runTools(ctx, run, result, nil)
+		if err != nil {
+			abandon(err.Error())
+		}
+		if err != nil || !done {
+			return result, exceeded(err)
+		}
+		if err := save(); err != nil {
+			return result, err
+		}
+	}
+}
+
+// runTools decides and executes the tool calls of the last message. It
+// reports false when the run paused on deferred calls, which are then
+// listed in result.Pending.
+func (a *Agent) runTools(ctx context.Context, run *budget.Run, result *Result, decisions map[string]Approval) (bool, error) {
+	calls := result.Messages[len(result.Messages)-1].ToolCalls
+
+	approved := make([]provider.ToolCall, 0, len(calls))
+	denied := make(map[string]string)
+	result.Pending = nil
+
+	for _, tc := range calls {
+		approval, ok := decisions[tc.ID]
+		if !ok {
+			var err error
+			approval, err = a.approve(ctx, tc)
+			if err != nil {
+				return false, fmt.Errorf("failed to approve tool call %s: %w", tc.ID, err)
+			}
+		}
+
+		switch approval.Decision {
+		case Allow:
+			approved = append(approved, tc)
+		case Modify:
+			tc.Function.Arguments = approval.Arguments
+			approved = append(approved, tc)
+		case Deny:
+			denied[tc.ID] = approval.Reason
+		case Defer:
+			result.Pending = append(result.Pending, newCall(tc))
+		}
+	}
+	if result.Paused() {
+		return false, nil
+	}
+	if err := run.AddToolCalls(len(approved)); err != nil {
+		return false, err
+	}
+
+	executed, _ := tool.RunAll(ctx, a.tools, approved, a.hooks.runOptions(a.runOpts))
+	byID := make(map[string]provider.Message, len(executed))
+	for _, msg := range executed {
+		byID[msg.ToolCallID] = msg
+	}
+
+	for _, tc := range calls {
+		msg, ok := byID[tc.ID]
+		if !ok {
+			msg = provider.Message{
+				Role:       provider.RoleTool,
+				ToolCallID: tc.ID,
+				Name:       tc.Function.Name,
+				Content:    deniedContent(denied[tc.ID]),
+			}
+		}
+		result.Messages = append(result.Messages, msg)
+	}
+	return true, nil
+}
+
+// abandonTools answers the tool calls of the last message, when it has
+// some, with errors giving the reason they were not run.
+func abandonTools(result *Result, reason string) {
+	if !hasToolCalls(result) {
+		return
+	}
+	result.Pending = nil
+	for _, tc := range result.Messages[len(result.Messages)-1].ToolCalls {
+		result.Messages = append(result.Messages, provider.Message{
+			Role:       provider.RoleTool,
+			ToolCallID: tc.ID,
+			Name:       tc.Function.Name,
+			Content:    "error: the tool call was not run: " + reason,
+		})
+	}
+}
+
+func (a *Agent) approve(ctx context.Context, tc provider.ToolCall) (Approval, error) {
+	if a.approver == nil {
+		return Approval{Decision: Allow}, nil
+	}
+	return a.approver.Approve(ctx, newCall(tc))
+}
+
+func toolCalls(resp *provider.ChatResponse) int {
+	if len(resp.Choices) == 0 {
+		return 0
+	}
+	return len(resp.Choices[0].Message.ToolCalls)
+}
+
+func deniedContent(reason string) string {
+	if reason == "" {
+		return "error: the tool call was denied"
+	}
+	return "error: the tool call was denied: " + reason
+}
+
+func (a *Agent) request(history []provider.Message) *provider.ChatRequest {
+	var messages []provider.Message
+	if a.system != "" {
+		messages = append(messages, provider.Message{Role: provider.RoleSystem, Content: a.system})
+	}
+	messages = append(messages, history...)
+
+	req := &provider.ChatRequest{Messages: messages}
+	if a.tools.Len() > 0 {
+		req.Tools = a.tools.ToProvider()
+	}
+	if a.configure != nil {
+		a.configure(req)
+	}
+	return req
+}
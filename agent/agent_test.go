@@ -0,0 +1,104 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alexisbouchez/ai/agent"
+	"github.com/alexisbouchez/ai/budget"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/provider/openai"
+	"github.com/alexisbouchez/ai/providertest"
+	"github.com/alexisbouchez/ai/store"
+	"github.com/alexisbouchez/ai/tool"
+)
+
+// toolCallResponse is a chat completion calling the weather tool, using
+// 100 tokens.
+var toolCallResponse = providertest.Script{
+	Headers: map[string]string{"Content-Type": "application/json"},
+	Body: `{"id":"chatcmpl-test","object":"chat.completion","model":"test","choices":[{"index":0,` +
+		`"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{}"}}]},` +
+		`"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":90,"completion_tokens":10,"total_tokens":100}}`,
+}
+
+func weather() *tool.Tool {
+	return tool.New("weather").Execute(func(ctx context.Context, args tool.Args) (string, error) {
+		return "sunny", nil
+	})
+}
+
+// last returns the last message of messages.
+func last(t *testing.T, messages []provider.Message) provider.Message {
+	t.Helper()
+	if len(messages) == 0 {
+		t.Fatal("no messages")
+	}
+	return messages[len(messages)-1]
+}
+
+func TestUnansweredToolCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		agent   func(a *agent.Agent) *agent.Agent
+		reason  string
+		limited bool
+	}{
+		{
+			name:   "no tools",
+			agent:  func(a *agent.Agent) *agent.Agent { return a },
+			reason: "no tool is registered",
+		},
+		{
+			name: "budget",
+			agent: func(a *agent.Agent) *agent.Agent {
+				return a.Tools(weather()).Budget(budget.Budget{MaxTokens: 50})
+			},
+			reason:  "budget exceeded",
+			limited: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := providertest.NewServer(toolCallResponse)
+			defer srv.Close()
+			p := openai.New().WithAPIKey("test").WithBaseURL(srv.URL)
+
+			t.Run("run", func(t *testing.T) {
+				result, err := tt.agent(agent.New(p)).Run(context.Background(), "Weather in Paris?")
+				messages := result.Messages
+				var exceeded *budget.ExceededError
+				if tt.limited {
+					if !errors.As(err, &exceeded) {
+						t.Fatalf("err = %v, want a budget error", err)
+					}
+					messages = exceeded.Messages
+				} else if err != nil {
+					t.Fatal(err)
+				}
+
+				msg := last(t, messages)
+				if msg.Role != provider.RoleTool || msg.ToolCallID != "call_1" {
+					t.Fatalf("last message = %+v, want the result of call_1", msg)
+				}
+				if !strings.HasPrefix(msg.Content, "error: the tool call was not run: "+tt.reason) {
+					t.Errorf("content = %q", msg.Content)
+				}
+			})
+
+			t.Run("durable", func(t *testing.T) {
+				a := tt.agent(agent.New(p)).Store(store.NewMemory())
+				result, err := a.Start(context.Background(), "run-1", "Weather in Paris?")
+				if tt.limited != (err != nil) {
+					t.Fatalf("err = %v", err)
+				}
+				if msg := last(t, result.Messages); len(msg.ToolCalls) != 1 {
+					t.Errorf("last message = %+v, want the unanswered tool call", msg)
+				}
+			})
+		})
+	}
+}
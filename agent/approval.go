@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type Decision int
+
+const (
+	// Allow runs the call as requested.
+	Allow Decision = iota
+	// Deny skips the call and reports the reason to the model.
+	Deny
+	// Modify runs the call with replacement arguments.
+	Modify
+	// Defer pauses the run until the call is decided with Resume.
+	Defer
+)
+
+type Approval struct {
+	Decision Decision `json:"decision"`
+	// Arguments replace the call arguments when Decision is Modify
+	Arguments string `json:"arguments,omitempty"`
+	// Reason is reported to the model when Decision is Deny
+	Reason string `json:"reason,omitempty"`
+}
+
+// Call is a tool call awaiting approval.
+type Call struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Arguments string         `json:"arguments"`
+	Args      map[string]any `json:"args,omitempty"`
+}
+
+func newCall(tc provider.ToolCall) Call {
+	call := Call{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments}
+	json.Unmarshal([]byte(tc.Function.Arguments), &call.Args)
+	return call
+}
+
+// Approver decides whether a tool call may run. It is invoked before every
+// call, so implementations can let safe tools through and hold back
+// destructive ones.
+type Approver interface {
+	Approve(ctx context.Context, call Call) (Approval, error)
+}
+
+type ApproverFunc func(ctx context.Context, call Call) (Approval, error)
+
+func (f ApproverFunc) Approve(ctx context.Context, call Call) (Approval, error) {
+	return f(ctx, call)
+}
+
+// Require defers calls to the named tools for asynchronous approval and
+// allows every other call.
+func Require(tools ...string) Approver {
+	return ApproverFunc(func(ctx context.Context, call Call) (Approval, error) {
+		for _, name := range tools {
+			if call.Name == name {
+				return Approval{Decision: Defer}, nil
+			}
+		}
+		return Approval{Decision: Allow}, nil
+	})
+}
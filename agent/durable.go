@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/alexisbouchez/ai/budget"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/store"
+)
+
+var (
+	ErrNoStore     = errors.New("agent has no store")
+	ErrRunExists   = errors.New("run already exists")
+	ErrRunNotFound = errors.New("run not found")
+)
+
+// checkpoint is the saved state of a durable run.
+type checkpoint struct {
+	ID     string       `json:"id"`
+	Result *Result      `json:"result"`
+	Usage  budget.Usage `json:"usage"`
+	// Done is set once the run has answered
+	Done bool `json:"done,omitempty"`
+	// Error is the error the run last stopped with
+	Error string `json:"error,omitempty"`
+}
+
+func (c *checkpoint) update(result *Result, run *budget.Run, err error) *checkpoint {
+	c.Result = result
+	c.Usage = run.Usage()
+	c.Done = err == nil && !result.Paused() && !hasToolCalls(result)
+	c.Error = ""
+	if err != nil {
+		c.Error = err.Error()
+	}
+	return c
+}
+
+// Store makes the runs begun with Start durable: their full state, with the
+// messages, the pending tool calls and the budget used, is saved to s after
+// every step, so that ResumeRun continues them after a crash or a restart.
+// Tool calls a durable run stops before running are left unanswered for
+// ResumeRun to settle, where other runs answer them with errors.
+func (a *Agent) Store(s store.Store) *Agent {
+	a.store = s
+	return a
+}
+
+// Start begins a durable run with input as the user message, under an ID
+// unique to the run.
+func (a *Agent) Start(ctx context.Context, runID, input string) (*Result, error) {
+	if a.store == nil {
+		return nil, ErrNoStore
+	}
+	if _, err := a.store.Get(ctx, runKey(runID)); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRunExists, runID)
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load run: %w", err)
+	}
+
+	durable := &checkpoint{
+		ID: runID,
+		Result: &Result{
+			Messages: []provider.Message{{Role: provider.RoleUser, Content: input}},
+		},
+	}
+	if err := a.save(ctx, durable); err != nil {
+		return nil, err
+	}
+	return a.loop(ctx, durable.Result, nil, durable)
+}
+
+// ResumeRun continues a durable run from its last checkpoint, within what
+// remains of the budget. A paused run goes on with decisions for its pending
+// calls, as with Resume; a run interrupted or failed goes on from its last
+// step, submitting unsettled tool calls to the approver again. A run that
+// has answered is returned as it is.
+func (a *Agent) ResumeRun(ctx context.Context, runID string, decisions map[string]Approval) (*Result, error) {
+	durable, err := a.load(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if durable.Done {
+		return durable.Result, nil
+	}
+
+	// tool calls left without results are settled first
+	switch {
+	case !hasToolCalls(durable.Result):
+		decisions = nil
+	case decisions == nil:
+		decisions = make(map[string]Approval)
+	}
+	return a.loop(ctx, durable.Result, decisions, durable)
+}
+
+func (a *Agent) load(ctx context.Context, runID string) (*checkpoint, error) {
+	if a.store == nil {
+		return nil, ErrNoStore
+	}
+	data, err := a.store.Get(ctx, runKey(runID))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load run: %w", err)
+	}
+
+	var durable checkpoint
+	if err := json.Unmarshal(data, &durable); err != nil {
+		return nil, fmt.Errorf("failed to decode run: %w", err)
+	}
+	if durable.Result == nil {
+		return nil, fmt.Errorf("run %s has no state", runID)
+	}
+	return &durable, nil
+}
+
+func (a *Agent) save(ctx context.Context, durable *checkpoint) error {
+	data, err := json.Marshal(durable)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	if err := a.store.Put(ctx, runKey(durable.ID), data); err != nil {
+		return fmt.Errorf("failed to checkpoint run: %w", err)
+	}
+	return nil
+}
+
+func runKey(runID string) string {
+	return "agent/" + runID
+}
+
+// hasToolCalls reports whether the last message is a tool call request
+// awaiting its results.
+func hasToolCalls(result *Result) bool {
+	if len(result.Messages) == 0 {
+		return false
+	}
+	return len(result.Messages[len(result.Messages)-1].ToolCalls) > 0
+}
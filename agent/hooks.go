@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tool"
+)
+
+// Hooks are called as a run progresses, to render live progress or record
+// it. Every hook is optional. The tool hooks are called concurrently when
+// the calls of a step run in parallel.
+type Hooks struct {
+	// OnLLMStart is called before every model call, step counting from 1
+	OnLLMStart func(ctx context.Context, step int, req *provider.ChatRequest)
+	OnLLMEnd   func(ctx context.Context, step int, resp *provider.ChatResponse)
+	// OnToolStart is called before every approved tool call
+	OnToolStart func(ctx context.Context, call provider.ToolCall)
+	// OnToolEnd is called with the tool message sent back to the model and
+	// the error of the call, if it failed
+	OnToolEnd func(ctx context.Context, call provider.ToolCall, result provider.Message, err error)
+	// OnError is called when a run fails
+	OnError func(ctx context.Context, err error)
+	// OnFinish is called when a run answers or pauses
+	OnFinish func(ctx context.Context, result *Result)
+}
+
+// Hooks sets the hooks called during Run and Resume.
+func (a *Agent) Hooks(hooks Hooks) *Agent {
+	a.hooks = hooks
+	return a
+}
+
+func (h Hooks) llmStart(ctx context.Context, step int, req *provider.ChatRequest) {
+	if h.OnLLMStart != nil {
+		h.OnLLMStart(ctx, step, req)
+	}
+}
+
+func (h Hooks) llmEnd(ctx context.Context, step int, resp *provider.ChatResponse) {
+	if h.OnLLMEnd != nil {
+		h.OnLLMEnd(ctx, step, resp)
+	}
+}
+
+func (h Hooks) end(ctx context.Context, result *Result, err error) {
+	switch {
+	case err != nil && h.OnError != nil:
+		h.OnError(ctx, err)
+	case err == nil && h.OnFinish != nil:
+		h.OnFinish(ctx, result)
+	}
+}
+
+// runOptions adds the tool hooks to opts, after the callbacks opts already
+// has.
+func (h Hooks) runOptions(opts tool.RunOptions) tool.RunOptions {
+	if start := opts.OnStart; h.OnToolStart != nil {
+		opts.OnStart = func(ctx context.Context, call provider.ToolCall) {
+			if start != nil {
+				start(ctx, call)
+			}
+			h.OnToolStart(ctx, call)
+		}
+	}
+	if end := opts.OnEnd; h.OnToolEnd != nil {
+		opts.OnEnd = func(ctx context.Context, call provider.ToolCall, result provider.Message, err error) {
+			if end != nil {
+				end(ctx, call, result, err)
+			}
+			h.OnToolEnd(ctx, call, result, err)
+		}
+	}
+	return opts
+}
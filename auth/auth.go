@@ -0,0 +1,226 @@
+// Package auth authenticates provider requests for gateways expecting
+// credentials other than the provider's own, such as IBM watsonx or a
+// corporate LLM proxy. Point a provider at the gateway and send its
+// requests with a client of this package:
+//
+//	p := openai.New().
+//		WithBaseURL("https://llm.example.com/v1").
+//		WithHTTPClient(auth.Client(auth.OAuth2(&auth.ClientCredentials{
+//			TokenURL:     "https://login.example.com/oauth2/token",
+//			ClientID:     id,
+//			ClientSecret: secret,
+//		})))
+//
+// Leave the API key of the provider empty, so that it doesn't send its own.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ibmTokenURL = "https://iam.cloud.ibm.com/identity/token"
+
+// defaultTokenLifetime is assumed for tokens issued without expires_in,
+// which would otherwise expire at once and be fetched on every request.
+const defaultTokenLifetime = 15 * time.Minute
+
+// Strategy authenticates HTTP requests.
+type Strategy interface {
+	Authenticate(req *http.Request) error
+}
+
+// StrategyFunc adapts a function to Strategy.
+type StrategyFunc func(req *http.Request) error
+
+func (f StrategyFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// Bearer sends token in the Authorization header.
+func Bearer(token string) Strategy {
+	return APIKey("Authorization", "Bearer "+token)
+}
+
+// APIKey sends key in header, such as X-API-Key or api-key.
+func APIKey(header, key string) Strategy {
+	return StrategyFunc(func(req *http.Request) error {
+		req.Header.Set(header, key)
+		return nil
+	})
+}
+
+// Transport returns a RoundTripper authenticating requests with s before
+// sending them with base, http.DefaultTransport when nil.
+func Transport(s Strategy, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{strategy: s, base: base}
+}
+
+// Client returns an HTTP client authenticating with s, to pass to
+// provider.Provider.WithHTTPClient.
+func Client(s Strategy) *http.Client {
+	return &http.Client{Transport: Transport(s, nil)}
+}
+
+type transport struct {
+	strategy Strategy
+	base     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if err := t.strategy.Authenticate(req); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("failed to authenticate request: %w", err)
+	}
+	return t.base.RoundTrip(req)
+}
+
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+}
+
+// TokenSource provides OAuth2 access tokens.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// OAuth2 sends the tokens of source as bearer tokens, reusing each until
+// shortly before it expires.
+func OAuth2(source TokenSource) Strategy {
+	c := &cachingSource{source: source}
+	return StrategyFunc(func(req *http.Request) error {
+		token, err := c.Token(req.Context())
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		return nil
+	})
+}
+
+// ClientCredentials is a TokenSource using the OAuth2 client credentials
+// grant.
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Params are added to the token request, such as audience or resource
+	Params url.Values
+	// HTTPClient fetches the tokens, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+func (c *ClientCredentials) Token(ctx context.Context) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+	}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	for k, v := range c.Params {
+		form[k] = v
+	}
+	return exchange(ctx, c.HTTPClient, c.TokenURL, form)
+}
+
+// IBMCloud returns a TokenSource exchanging an IBM Cloud API key for IAM
+// tokens, as watsonx expects.
+func IBMCloud(apiKey string) TokenSource {
+	return ibmSource(apiKey)
+}
+
+type ibmSource string
+
+func (s ibmSource) Token(ctx context.Context) (*Token, error) {
+	return exchange(ctx, nil, ibmTokenURL, url.Values{
+		"grant_type": {"urn:ibm:params:oauth:grant-type:apikey"},
+		"apikey":     {string(s)},
+	})
+}
+
+// cachingSource reuses a token until shortly before it expires.
+type cachingSource struct {
+	mu     sync.Mutex
+	source TokenSource
+	token  *Token
+}
+
+func (c *cachingSource) Token(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != nil && time.Until(c.token.Expiry) > time.Minute {
+		return c.token, nil
+	}
+
+	token, err := c.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+	return token, nil
+}
+
+func exchange(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (*Token, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response has no access token")
+	}
+
+	lifetime := time.Duration(tokenResp.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultTokenLifetime
+	}
+	return &Token{
+		AccessToken: tokenResp.AccessToken,
+		Expiry:      time.Now().Add(lifetime),
+	}, nil
+}
@@ -0,0 +1,138 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+var ErrUnsupported = errors.New("provider does not support batches")
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+	StatusExpired   Status = "expired"
+)
+
+type Job struct {
+	ID        string
+	Status    Status
+	Total     int
+	Succeeded int
+	Failed    int
+	CreatedAt time.Time
+}
+
+// Done reports whether the job reached a final status.
+func (j *Job) Done() bool {
+	switch j.Status {
+	case StatusCompleted, StatusFailed, StatusCancelled, StatusExpired:
+		return true
+	}
+	return false
+}
+
+// Result is the outcome of the request at Index in the submitted batch.
+type Result struct {
+	Index    int
+	CustomID string
+	Response *provider.ChatResponse
+	Err      error
+}
+
+// Batcher is implemented by providers with an asynchronous batch API.
+type Batcher interface {
+	SubmitBatch(ctx context.Context, reqs []provider.ChatRequest) (*Job, error)
+	PollBatch(ctx context.Context, id string) (*Job, error)
+	BatchResults(ctx context.Context, id string) ([]Result, error)
+	CancelBatch(ctx context.Context, id string) (*Job, error)
+}
+
+// CustomID is the identifier given to the request at index i of a batch.
+func CustomID(i int) string {
+	return fmt.Sprintf("request-%d", i)
+}
+
+// Index parses an identifier produced by CustomID.
+func Index(customID string) int {
+	var i int
+	if _, err := fmt.Sscanf(customID, "request-%d", &i); err != nil {
+		return -1
+	}
+	return i
+}
+
+type Client struct {
+	batcher Batcher
+}
+
+// New returns a batch client for p, which must be an unwrapped OpenAI,
+// Anthropic or Mistral provider.
+func New(p provider.Provider) (*Client, error) {
+	b, ok := p.(Batcher)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return &Client{batcher: b}, nil
+}
+
+func (c *Client) Submit(ctx context.Context, reqs []provider.ChatRequest) (*Job, error) {
+	if len(reqs) == 0 {
+		return nil, errors.New("batch has no requests")
+	}
+	return c.batcher.SubmitBatch(ctx, reqs)
+}
+
+func (c *Client) Poll(ctx context.Context, id string) (*Job, error) {
+	return c.batcher.PollBatch(ctx, id)
+}
+
+func (c *Client) Cancel(ctx context.Context, id string) (*Job, error) {
+	return c.batcher.CancelBatch(ctx, id)
+}
+
+// Results returns the results of a completed job, ordered by request index.
+func (c *Client) Results(ctx context.Context, id string) ([]Result, error) {
+	return c.batcher.BatchResults(ctx, id)
+}
+
+// Wait polls the job every interval until it is done.
+func (c *Client) Wait(ctx context.Context, id string, interval time.Duration) (*Job, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid poll interval %s", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job, err := c.Poll(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Done() {
+			return job, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SortResults orders results by request index.
+func SortResults(results []Result) {
+	slices.SortFunc(results, func(a, b Result) int {
+		return a.Index - b.Index
+	})
+}
@@ -0,0 +1,150 @@
+// Package budget bounds the resources a conversation or agent run may use.
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alexisbouchez/ai/cost"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Budget limits a single run. Zero fields are unlimited.
+type Budget struct {
+	MaxTokens    int
+	MaxCost      float64
+	MaxToolCalls int
+	MaxDuration  time.Duration
+}
+
+type Limit string
+
+const (
+	Tokens    Limit = "tokens"
+	Cost      Limit = "cost"
+	ToolCalls Limit = "tool calls"
+	Duration  Limit = "duration"
+)
+
+// ExceededError reports the limit a run hit. Messages holds the transcript
+// up to that point.
+type ExceededError struct {
+	Limit    Limit
+	Used     float64
+	Max      float64
+	Messages []provider.Message
+}
+
+func (e *ExceededError) Error() string {
+	if e.Limit == Duration {
+		return fmt.Sprintf("budget exceeded: %s %s of %s", e.Limit, time.Duration(e.Used), time.Duration(e.Max))
+	}
+	return fmt.Sprintf("budget exceeded: %s %g of %g", e.Limit, e.Used, e.Max)
+}
+
+// Run accounts the resources used by one run against a budget.
+type Run struct {
+	budget    Budget
+	start     time.Time
+	tokens    int
+	cost      float64
+	toolCalls int
+}
+
+func (b Budget) Start() *Run {
+	return &Run{budget: b, start: time.Now()}
+}
+
+// Usage is what a run has used so far. It can be saved and handed to
+// Resume to go on with the same run later, possibly in another process.
+type Usage struct {
+	Tokens    int           `json:"tokens"`
+	Cost      float64       `json:"cost"`
+	ToolCalls int           `json:"tool_calls"`
+	Elapsed   time.Duration `json:"elapsed"`
+}
+
+// Resume starts a run that has already used used. The time between the
+// snapshot and Resume does not count towards MaxDuration.
+func (b Budget) Resume(used Usage) *Run {
+	return &Run{
+		budget:    b,
+		start:     time.Now().Add(-used.Elapsed),
+		tokens:    used.Tokens,
+		cost:      used.Cost,
+		toolCalls: used.ToolCalls,
+	}
+}
+
+func (r *Run) Usage() Usage {
+	return Usage{
+		Tokens:    r.tokens,
+		Cost:      r.cost,
+		ToolCalls: r.toolCalls,
+		Elapsed:   time.Since(r.start),
+	}
+}
+
+// Context bounds ctx by the remaining duration of the run.
+func (r *Run) Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.budget.MaxDuration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, r.start.Add(r.budget.MaxDuration))
+}
+
+// AddUsage records the usage of a model call.
+func (r *Run) AddUsage(model string, usage provider.Usage) error {
+	r.tokens += usage.TotalTokens
+	if c, ok := cost.Estimate(model, usage); ok {
+		r.cost += c
+	}
+	return r.Check()
+}
+
+// AddToolCalls reserves n tool calls, failing without recording them when
+// they do not fit.
+func (r *Run) AddToolCalls(n int) error {
+	if limit := r.budget.MaxToolCalls; limit > 0 && r.toolCalls+n > limit {
+		return &ExceededError{Limit: ToolCalls, Used: float64(r.toolCalls + n), Max: float64(limit)}
+	}
+	r.toolCalls += n
+	return nil
+}
+
+// Check fails once any limit is reached.
+func (r *Run) Check() error {
+	b := r.budget
+	if b.MaxTokens > 0 && r.tokens >= b.MaxTokens {
+		return &ExceededError{Limit: Tokens, Used: float64(r.tokens), Max: float64(b.MaxTokens)}
+	}
+	if b.MaxCost > 0 && r.cost >= b.MaxCost {
+		return &ExceededError{Limit: Cost, Used: r.cost, Max: b.MaxCost}
+	}
+	if elapsed := time.Since(r.start); b.MaxDuration > 0 && elapsed >= b.MaxDuration {
+		return &ExceededError{Limit: Duration, Used: float64(elapsed), Max: float64(b.MaxDuration)}
+	}
+	return nil
+}
+
+// Err converts an error caused by the run deadline into an ExceededError.
+func (r *Run) Err(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		if budgetErr := r.Check(); budgetErr != nil {
+			return budgetErr
+		}
+	}
+	return err
+}
+
+// WithMessages attaches the transcript to an ExceededError and returns
+// other errors unchanged.
+func WithMessages(err error, messages []provider.Message) error {
+	var exceeded *ExceededError
+	if errors.As(err, &exceeded) {
+		exceeded.Messages = messages
+	}
+	return err
+}
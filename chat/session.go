@@ -0,0 +1,317 @@
+package chat
+
+import (
+	"context"
+	"errors"
+
+	"github.com/alexisbouchez/ai/budget"
+	"github.com/alexisbouchez/ai/cost"
+	"github.com/alexisbouchez/ai/memory"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tool"
+)
+
+const defaultMaxToolRounds = 10
+
+var ErrTooManyToolRounds = errors.New("too many tool call rounds")
+
+// Session is a conversation with a provider. It records every user,
+// assistant and tool message and runs registered tools when the model asks
+// for them. A Session is not safe for concurrent use.
+type Session struct {
+	provider      provider.Provider
+	memory        memory.Memory
+	system        string
+	tools         *tool.Registry
+	configure     func(*provider.ChatRequest)
+	maxToolRounds int
+	budget        budget.Budget
+	usage         cost.Totals
+}
+
+func New(p provider.Provider) *Session {
+	return &Session{
+		provider:      p,
+		memory:        memory.NewBuffer(),
+		tools:         tool.NewRegistry(),
+		maxToolRounds: defaultMaxToolRounds,
+	}
+}
+
+func (s *Session) System(prompt string) *Session {
+	s.system = prompt
+	return s
+}
+
+func (s *Session) Memory(m memory.Memory) *Session {
+	s.memory = m
+	return s
+}
+
+func (s *Session) Tools(tools ...*tool.Tool) *Session {
+	s.tools.Register(tools...)
+	return s
+}
+
+// Configure registers a function applied to every outgoing request, e.g. to
+// set the model or sampling parameters.
+func (s *Session) Configure(fn func(*provider.ChatRequest)) *Session {
+	s.configure = fn
+	return s
+}
+
+func (s *Session) MaxToolRounds(n int) *Session {
+	s.maxToolRounds = n
+	return s
+}
+
+// Budget limits every Send. When a limit is hit the call fails with a
+// *budget.ExceededError holding the transcript so far.
+func (s *Session) Budget(b budget.Budget) *Session {
+	s.budget = b
+	return s
+}
+
+func (s *Session) Messages() []provider.Message {
+	return s.memory.Messages()
+}
+
+// Fork returns a session continuing the conversation independently: it has
+// the same provider, tools and settings, and a copy of the messages in a
+// Buffer memory.
+func (s *Session) Fork() *Session {
+	fork := *s
+	fork.memory = memory.NewBuffer()
+	fork.memory.Add(context.Background(), s.memory.Messages()...)
+	fork.tools = tool.NewRegistry(s.tools.Tools()...)
+	fork.usage = cost.Totals{}
+	return &fork
+}
+
+// Usage returns the totals of the model calls of the session, tool rounds
+// included. A fork counts its own calls only. After SendStream, call it
+// once the stream is consumed.
+func (s *Session) Usage() cost.Totals {
+	return s.usage
+}
+
+func (s *Session) Reset() {
+	s.memory.Clear()
+}
+
+// Send adds text as a user message and returns the model's reply. When the
+// model calls tools, their results are added and the model is asked again
+// until it answers without tool calls.
+func (s *Session) Send(ctx context.Context, text string) (*provider.ChatResponse, error) {
+	if err := s.memory.Add(ctx, provider.Message{Role: provider.RoleUser, Content: text}); err != nil {
+		return nil, err
+	}
+
+	run := s.budget.Start()
+	ctx, cancel := run.Context(ctx)
+	defer cancel()
+
+	for round := 0; ; round++ {
+		req := s.request()
+		resp, err := s.provider.Chat(ctx, req)
+		if err != nil {
+			return nil, s.exceeded(run.Err(err))
+		}
+		s.usage.Add(responseModel(resp.Model, req), resp.Usage)
+		budgetErr := run.AddUsage(responseModel(resp.Model, req), resp.Usage)
+		if len(resp.Choices) == 0 {
+			return resp, nil
+		}
+
+		msg := resp.Choices[0].Message
+		if err := s.memory.Add(ctx, msg); err != nil {
+			return nil, err
+		}
+
+		if !s.wantsTools(msg) {
+			return resp, s.abandonTools(ctx, msg, "no tool is registered", nil)
+		}
+		if round >= s.maxToolRounds {
+			return resp, s.abandonTools(ctx, msg, ErrTooManyToolRounds.Error(), ErrTooManyToolRounds)
+		}
+		if budgetErr == nil {
+			budgetErr = run.AddToolCalls(len(msg.ToolCalls))
+		}
+		if budgetErr != nil {
+			return resp, s.exceeded(s.abandonTools(ctx, msg, budgetErr.Error(), budgetErr))
+		}
+		if err := s.runTools(ctx, msg.ToolCalls); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SendStream is the streaming variant of Send. The assistant message is
+// added to the history once the stream completes; tool rounds are streamed
+// back to back on the same reader.
+func (s *Session) SendStream(ctx context.Context, text string) (*provider.StreamReader, error) {
+	if err := s.memory.Add(ctx, provider.Message{Role: provider.RoleUser, Content: text}); err != nil {
+		return nil, err
+	}
+
+	// ctx ends when the reader is closed, runCtx also when the budget runs out
+	ctx, cancel := context.WithCancel(ctx)
+	run := s.budget.Start()
+	runCtx, stop := run.Context(ctx)
+
+	req := s.request()
+	stream, err := s.provider.Stream(runCtx, req)
+	if err != nil {
+		stop()
+		cancel()
+		return nil, s.exceeded(run.Err(err))
+	}
+
+	events := make(chan provider.StreamEvent)
+
+	go func() {
+		defer close(events)
+		defer cancel()
+		defer stop()
+
+		send := func(event provider.StreamEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for round := 0; ; round++ {
+			var acc provider.Accumulator
+			for {
+				event, err := stream.Recv()
+				if errors.Is(err, provider.ErrStreamClosed) {
+					break
+				}
+				if err != nil {
+					stream.Close()
+					event.Err = s.exceeded(run.Err(err))
+					send(event)
+					return
+				}
+				acc.Add(event)
+				if !send(event) {
+					stream.Close()
+					return
+				}
+			}
+			stream.Close()
+
+			var budgetErr error
+			if usage := acc.Usage(); usage != nil {
+				s.usage.Add(responseModel("", req), *usage)
+				budgetErr = run.AddUsage(responseModel("", req), *usage)
+			} else {
+				s.usage.Add(responseModel("", req), provider.Usage{})
+			}
+
+			msg := acc.Message()
+			if err := s.memory.Add(runCtx, msg); err != nil {
+				send(provider.StreamEvent{Err: err})
+				return
+			}
+
+			if !s.wantsTools(msg) {
+				if err := s.abandonTools(runCtx, msg, "no tool is registered", nil); err != nil {
+					send(provider.StreamEvent{Err: err})
+				}
+				return
+			}
+			if round >= s.maxToolRounds {
+				send(provider.StreamEvent{Err: s.abandonTools(runCtx, msg, ErrTooManyToolRounds.Error(), ErrTooManyToolRounds)})
+				return
+			}
+			if budgetErr == nil {
+				budgetErr = run.AddToolCalls(len(msg.ToolCalls))
+			}
+			if budgetErr != nil {
+				send(provider.StreamEvent{Err: s.exceeded(s.abandonTools(runCtx, msg, budgetErr.Error(), budgetErr))})
+				return
+			}
+			if err := s.runTools(runCtx, msg.ToolCalls); err != nil {
+				send(provider.StreamEvent{Err: err})
+				return
+			}
+
+			req = s.request()
+			stream, err = s.provider.Stream(runCtx, req)
+			if err != nil {
+				send(provider.StreamEvent{Err: s.exceeded(run.Err(err))})
+				return
+			}
+		}
+	}()
+
+	return provider.NewStreamReader(events, cancel), nil
+}
+
+func (s *Session) request() *provider.ChatRequest {
+	var messages []provider.Message
+	if s.system != "" {
+		messages = append(messages, provider.Message{Role: provider.RoleSystem, Content: s.system})
+	}
+	messages = append(messages, s.memory.Messages()...)
+
+	req := &provider.ChatRequest{Messages: messages}
+	if s.tools.Len() > 0 {
+		req.Tools = s.tools.ToProvider()
+	}
+	if s.configure != nil {
+		s.configure(req)
+	}
+	return req
+}
+
+func (s *Session) wantsTools(msg provider.Message) bool {
+	return len(msg.ToolCalls) > 0 && s.tools.Len() > 0
+}
+
+// runTools adds the results of calls to the history. Tool failures are
+// reported to the model rather than aborting the conversation.
+func (s *Session) runTools(ctx context.Context, calls []provider.ToolCall) error {
+	results, _ := tool.RunAll(ctx, s.tools, calls, tool.RunOptions{})
+	return s.memory.Add(ctx, results...)
+}
+
+// abandonTools answers the tool calls of msg, which will not run, with an
+// error result each, so that the history stays valid for the next request.
+// It returns err, joined with the error of adding the results if any.
+func (s *Session) abandonTools(ctx context.Context, msg provider.Message, reason string, err error) error {
+	if len(msg.ToolCalls) == 0 {
+		return err
+	}
+	results := make([]provider.Message, len(msg.ToolCalls))
+	for i, call := range msg.ToolCalls {
+		results[i] = provider.Message{
+			Role:       provider.RoleTool,
+			ToolCallID: call.ID,
+			Name:       call.Function.Name,
+			Content:    "error: the tool call was not run: " + reason,
+		}
+	}
+	if addErr := s.memory.Add(ctx, results...); addErr != nil {
+		return errors.Join(err, addErr)
+	}
+	return err
+}
+
+// exceeded attaches the transcript to budget errors.
+func (s *Session) exceeded(err error) error {
+	return budget.WithMessages(err, s.memory.Messages())
+}
+
+// responseModel returns the model a response reports, falling back to the
+// requested model for cost accounting.
+func responseModel(model string, req *provider.ChatRequest) string {
+	if model != "" {
+		return model
+	}
+	return req.Model
+}
@@ -0,0 +1,106 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const defaultSampleTemperature = 0.7
+
+// Vote is the outcome of SelfConsistent.
+type Vote struct {
+	// Answer is the answer extracted from the most samples
+	Answer string
+	Count  int
+	// Counts is the number of samples per extracted answer
+	Counts map[string]int
+	// Samples are the completions in the order they were requested
+	Samples []string
+	Usage   provider.Usage
+}
+
+// SelfConsistent samples k completions of req in parallel and returns the
+// majority answer, as extracted from each completion by extract. Samples
+// extracted to "" do not vote, and ties go to the answer reaching the count
+// first. Requests without a nonzero temperature are sampled at 0.7.
+func SelfConsistent(ctx context.Context, p provider.Provider, req *provider.ChatRequest, k int, extract func(string) string) (*Vote, error) {
+	sample := *req
+	sample.IdempotencyKey = ""
+	if sample.Temperature == nil || *sample.Temperature == 0 {
+		temperature := defaultSampleTemperature
+		sample.Temperature = &temperature
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resps := make([]*provider.ChatResponse, k)
+	errs := make([]error, k)
+	var wg sync.WaitGroup
+	for i := range k {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resps[i], errs[i] = p.Chat(ctx, &sample)
+			if errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	if i, err := firstError(errs); err != nil {
+		return nil, fmt.Errorf("failed to sample completion %d: %w", i, err)
+	}
+
+	vote := &Vote{Counts: make(map[string]int)}
+	for _, resp := range resps {
+		vote.Usage.PromptTokens += resp.Usage.PromptTokens
+		vote.Usage.CompletionTokens += resp.Usage.CompletionTokens
+		vote.Usage.TotalTokens += resp.Usage.TotalTokens
+
+		var content string
+		if len(resp.Choices) > 0 {
+			content = resp.Choices[0].Message.Content
+		}
+		vote.Samples = append(vote.Samples, content)
+
+		answer := extract(content)
+		if answer == "" {
+			continue
+		}
+		vote.Counts[answer]++
+		if vote.Counts[answer] > vote.Count {
+			vote.Answer = answer
+			vote.Count = vote.Counts[answer]
+		}
+	}
+	if vote.Count == 0 {
+		return vote, errors.New("no sample produced an answer")
+	}
+	return vote, nil
+}
+
+// firstError returns the first of errs that is not a cancellation, as a
+// failing sample cancels the others, or the first error when all are.
+func firstError(errs []error) (int, error) {
+	first := -1
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, context.Canceled) {
+			return i, err
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return 0, nil
+	}
+	return first, errs[first]
+}
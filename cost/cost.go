@@ -0,0 +1,152 @@
+package cost
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Price is the list price of a model in USD per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+	// CachedInput is the price of prompt tokens read from the cache, Input
+	// when zero
+	CachedInput float64 `json:"cached_input,omitempty"`
+	// CacheWrite is the price of prompt tokens written to the cache, Input
+	// when zero
+	CacheWrite float64 `json:"cache_write,omitempty"`
+}
+
+// Table maps model names, or prefixes of them, to prices. Its JSON form is
+// an object of prices keyed by model.
+type Table map[string]Price
+
+//go:embed prices.json
+var defaultPrices []byte
+
+var (
+	mu        sync.RWMutex
+	prices    = mustParse(defaultPrices)
+	overrides = make(Table)
+)
+
+func mustParse(data []byte) Table {
+	table, err := ParseTable(data)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// ParseTable parses a price table from JSON.
+func ParseTable(data []byte) (Table, error) {
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("invalid price table: %w", err)
+	}
+	return table, nil
+}
+
+// Lookup returns the price of model, matching the longest known prefix so
+// that dated snapshots ("gpt-4o-2024-08-06") resolve to their family. An
+// override wins over a price table entry of the same length.
+func Lookup(model string) (Price, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	override, overrideLen := lookup(overrides, model)
+	price, priceLen := lookup(prices, model)
+	if overrideLen >= 0 && overrideLen >= priceLen {
+		return override, true
+	}
+	return price, priceLen >= 0
+}
+
+// lookup returns the price of the longest prefix of model in table, and
+// the length of the prefix, -1 when there is none.
+func lookup(table Table, model string) (Price, int) {
+	best := -1
+	var price Price
+	for prefix, p := range table {
+		if strings.HasPrefix(model, prefix) && len(prefix) > best {
+			best, price = len(prefix), p
+		}
+	}
+	return price, best
+}
+
+// SetPrice sets the price of model in the price table, until a loaded
+// table replaces it.
+func SetPrice(model string, price Price) {
+	mu.Lock()
+	defer mu.Unlock()
+	prices[model] = price
+}
+
+// Override sets the price of model over any loaded table, such as a
+// negotiated rate or the cost of a self-hosted model.
+func Override(model string, price Price) {
+	mu.Lock()
+	defer mu.Unlock()
+	overrides[model] = price
+}
+
+// Load merges table into the price table, replacing the prices of the
+// models it has.
+func Load(table Table) {
+	mu.Lock()
+	defer mu.Unlock()
+	maps.Copy(prices, table)
+}
+
+// LoadFile merges the JSON price table at path into the price table.
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read price table: %w", err)
+	}
+	table, err := ParseTable(data)
+	if err != nil {
+		return err
+	}
+	Load(table)
+	return nil
+}
+
+// ResetPrices restores the embedded price table and removes the overrides.
+func ResetPrices() {
+	mu.Lock()
+	defer mu.Unlock()
+	prices = mustParse(defaultPrices)
+	overrides = make(Table)
+}
+
+// Estimate returns the USD cost of usage on model. It reports false when
+// the model has no known price.
+func Estimate(model string, usage provider.Usage) (float64, bool) {
+	price, ok := Lookup(model)
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(usage), true
+}
+
+func (p Price) Cost(usage provider.Usage) float64 {
+	cached := p.CachedInput
+	if cached == 0 {
+		cached = p.Input
+	}
+	write := p.CacheWrite
+	if write == 0 {
+		write = p.Input
+	}
+	uncached := usage.PromptTokens - usage.CachedTokens - usage.CacheWriteTokens
+	return (float64(uncached)*p.Input + float64(usage.CachedTokens)*cached + float64(usage.CacheWriteTokens)*write + float64(usage.CompletionTokens)*p.Output) / 1e6
+}
@@ -0,0 +1,143 @@
+package cost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Remote is a price table published at a URL. Loading it merges it into
+// the price table.
+type Remote struct {
+	URL string
+	// CacheFile keeps the last table fetched. It is used instead of the URL
+	// while younger than MaxAge, and when the URL cannot be fetched.
+	CacheFile string
+	MaxAge    time.Duration
+	// HTTPClient fetches the table, http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	mu   sync.Mutex
+	etag string
+}
+
+// Load fetches the table, or reads it from the cache file when fresh, and
+// merges it into the price table.
+func (r *Remote) Load(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.CacheFile != "" && r.MaxAge > 0 {
+		if info, err := os.Stat(r.CacheFile); err == nil && time.Since(info.ModTime()) < r.MaxAge {
+			return LoadFile(r.CacheFile)
+		}
+	}
+
+	data, err := r.fetch(ctx)
+	if err != nil {
+		if r.CacheFile != "" {
+			if cacheErr := LoadFile(r.CacheFile); cacheErr == nil {
+				return nil
+			}
+		}
+		return err
+	}
+	if data == nil {
+		// not modified since the last fetch, which was loaded then
+		return nil
+	}
+
+	table, err := ParseTable(data)
+	if err != nil {
+		return err
+	}
+	Load(table)
+	if r.CacheFile != "" {
+		if err := writeCache(r.CacheFile, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Refresh loads the table, then reloads it every interval until ctx ends.
+// Failed reloads keep the prices loaded before.
+func (r *Remote) Refresh(ctx context.Context, interval time.Duration) error {
+	if err := r.Load(ctx); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Load(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// fetch returns the table at the URL, or nil when it has not changed since
+// the last fetch.
+func (r *Remote) fetch(ctx context.Context) ([]byte, error) {
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch price table: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch price table (status %d): %s", resp.StatusCode, string(data))
+	}
+	r.etag = resp.Header.Get("ETag")
+	return data, nil
+}
+
+// writeCache replaces path atomically, so that concurrent readers never
+// see a partial table.
+func writeCache(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to cache price table: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to cache price table: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to cache price table: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to cache price table: %w", err)
+	}
+	return nil
+}
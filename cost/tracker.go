@@ -0,0 +1,124 @@
+package cost
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type Entry struct {
+	Model   string
+	Session string
+	Usage   provider.Usage
+	Cost    float64
+	Time    time.Time
+}
+
+type Totals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Add accounts a request to model using usage, at the price of model.
+func (t *Totals) Add(model string, usage provider.Usage) {
+	c, _ := Estimate(model, usage)
+	t.add(Entry{Model: model, Usage: usage, Cost: c})
+}
+
+func (t *Totals) add(e Entry) {
+	t.Requests++
+	t.PromptTokens += e.Usage.PromptTokens
+	t.CompletionTokens += e.Usage.CompletionTokens
+	t.CachedTokens += e.Usage.CachedTokens
+	t.CacheWriteTokens += e.Usage.CacheWriteTokens
+	t.Cost += e.Cost
+}
+
+type sessionKey struct{}
+
+// WithSession tags the requests made with ctx so their cost is accounted
+// to session.
+func WithSession(ctx context.Context, session string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+func SessionFromContext(ctx context.Context) string {
+	session, _ := ctx.Value(sessionKey{}).(string)
+	return session
+}
+
+// Tracker accumulates cost totals in memory. It is safe for concurrent use.
+type Tracker struct {
+	mu        sync.Mutex
+	total     Totals
+	byModel   map[string]Totals
+	bySession map[string]Totals
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		byModel:   make(map[string]Totals),
+		bySession: make(map[string]Totals),
+	}
+}
+
+func (t *Tracker) Record(ctx context.Context, e Entry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total.add(e)
+
+	m := t.byModel[e.Model]
+	m.add(e)
+	t.byModel[e.Model] = m
+
+	if e.Session != "" {
+		s := t.bySession[e.Session]
+		s.add(e)
+		t.bySession[e.Session] = s
+	}
+}
+
+func (t *Tracker) Total() Totals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+func (t *Tracker) Model(model string) Totals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.byModel[model]
+}
+
+func (t *Tracker) Session(session string) Totals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.bySession[session]
+}
+
+func (t *Tracker) Models() map[string]Totals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]Totals, len(t.byModel))
+	for k, v := range t.byModel {
+		result[k] = v
+	}
+	return result
+}
+
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total = Totals{}
+	t.byModel = make(map[string]Totals)
+	t.bySession = make(map[string]Totals)
+}
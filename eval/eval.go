@@ -0,0 +1,179 @@
+// Package eval runs a dataset of prompts against one or more models and
+// scores the outputs with graders, reporting latency and cost alongside.
+package eval
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alexisbouchez/ai/cost"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const defaultConcurrency = 4
+
+// Case is one prompt of a dataset. Messages, when set, are sent instead of
+// Prompt.
+type Case struct {
+	Name     string             `json:"name"`
+	Prompt   string             `json:"prompt,omitempty"`
+	Messages []provider.Message `json:"messages,omitempty"`
+	// Expected is the reference output used by graders that compare
+	Expected string `json:"expected,omitempty"`
+}
+
+func (c Case) messages() []provider.Message {
+	if len(c.Messages) > 0 {
+		return c.Messages
+	}
+	return []provider.Message{{Role: provider.RoleUser, Content: c.Prompt}}
+}
+
+// Target is a provider and model under evaluation.
+type Target struct {
+	Name     string
+	Provider provider.Provider
+	Model    string
+}
+
+// Score is the grade of one output. Value is between 0 and 1.
+type Score struct {
+	Value  float64 `json:"value"`
+	Pass   bool    `json:"pass"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+type Grader interface {
+	Grade(ctx context.Context, c Case, output string) (Score, error)
+}
+
+type GraderFunc func(ctx context.Context, c Case, output string) (Score, error)
+
+func (f GraderFunc) Grade(ctx context.Context, c Case, output string) (Score, error) {
+	return f(ctx, c, output)
+}
+
+// Result is the outcome of one case on one target.
+type Result struct {
+	Case    string           `json:"case"`
+	Target  string           `json:"target"`
+	Model   string           `json:"model"`
+	Output  string           `json:"output"`
+	Scores  map[string]Score `json:"scores"`
+	Latency time.Duration    `json:"latency_ns"`
+	Usage   provider.Usage   `json:"usage"`
+	// Cost is the estimated USD cost, zero for models without a known price
+	Cost  float64 `json:"cost"`
+	Error string  `json:"error,omitempty"`
+}
+
+type namedGrader struct {
+	name   string
+	grader Grader
+}
+
+type Runner struct {
+	targets     []Target
+	graders     []namedGrader
+	concurrency int
+	configure   func(*provider.ChatRequest)
+}
+
+func New(targets ...Target) *Runner {
+	return &Runner{targets: targets, concurrency: defaultConcurrency}
+}
+
+// Grader adds a grader, reported under name.
+func (r *Runner) Grader(name string, g Grader) *Runner {
+	r.graders = append(r.graders, namedGrader{name, g})
+	return r
+}
+
+// Concurrency bounds the number of requests in flight.
+func (r *Runner) Concurrency(n int) *Runner {
+	r.concurrency = max(n, 1)
+	return r
+}
+
+// Configure registers a function applied to every request, for instance to
+// set the temperature.
+func (r *Runner) Configure(fn func(*provider.ChatRequest)) *Runner {
+	r.configure = fn
+	return r
+}
+
+// Run sends every case to every target and grades the outputs. Request and
+// grader failures are recorded in the results; Run only fails when ctx is
+// done.
+func (r *Runner) Run(ctx context.Context, cases []Case) (*Report, error) {
+	results := make([]Result, len(cases)*len(r.targets))
+	sem := make(chan struct{}, r.concurrency)
+	var wg sync.WaitGroup
+
+	for i, c := range cases {
+		for j, target := range r.targets {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				wg.Wait()
+				return nil, ctx.Err()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i*len(r.targets)+j] = r.run(ctx, c, target)
+			}()
+		}
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &Report{Results: results}, nil
+}
+
+func (r *Runner) run(ctx context.Context, c Case, target Target) Result {
+	name := target.Name
+	if name == "" {
+		name = target.Model
+	}
+	result := Result{Case: c.Name, Target: name, Model: target.Model}
+
+	req := &provider.ChatRequest{Messages: c.messages(), Model: target.Model}
+	if r.configure != nil {
+		r.configure(req)
+	}
+
+	start := time.Now()
+	resp, err := target.Provider.Chat(ctx, req)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(resp.Choices) == 0 {
+		result.Error = "no choices in response"
+		return result
+	}
+
+	if resp.Model != "" {
+		result.Model = resp.Model
+	}
+	result.Output = resp.Choices[0].Message.Content
+	result.Usage = resp.Usage
+	result.Cost, _ = cost.Estimate(result.Model, resp.Usage)
+
+	result.Scores = make(map[string]Score, len(r.graders))
+	for _, g := range r.graders {
+		score, err := g.grader.Grade(ctx, c, result.Output)
+		if err != nil {
+			score = Score{Reason: fmt.Sprintf("grader failed: %v", err)}
+		}
+		result.Scores[g.name] = score
+	}
+	return result
+}
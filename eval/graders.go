@@ -0,0 +1,109 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/alexisbouchez/ai"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/rag"
+)
+
+const judgeInstructions = "You are grading the output of an AI model. Score the output from 1 (worst) to 5 (best) against the criteria, and explain the score in one sentence."
+
+func boolScore(pass bool, reason string) Score {
+	if pass {
+		return Score{Value: 1, Pass: true}
+	}
+	return Score{Reason: reason}
+}
+
+// ExactMatch passes outputs equal to the expected output, ignoring
+// surrounding whitespace.
+func ExactMatch() Grader {
+	return GraderFunc(func(ctx context.Context, c Case, output string) (Score, error) {
+		return boolScore(strings.TrimSpace(output) == strings.TrimSpace(c.Expected), "output differs from expected"), nil
+	})
+}
+
+// Contains passes outputs containing the expected output, ignoring case.
+func Contains() Grader {
+	return GraderFunc(func(ctx context.Context, c Case, output string) (Score, error) {
+		found := strings.Contains(strings.ToLower(output), strings.ToLower(c.Expected))
+		return boolScore(found, "expected output not found"), nil
+	})
+}
+
+// Regex passes outputs matching re.
+func Regex(re *regexp.Regexp) Grader {
+	return GraderFunc(func(ctx context.Context, c Case, output string) (Score, error) {
+		return boolScore(re.MatchString(output), fmt.Sprintf("output does not match %s", re)), nil
+	})
+}
+
+// Similarity scores the cosine similarity between the embeddings of the
+// output and the expected output, passing at threshold and above.
+func Similarity(e rag.Embedder, threshold float64) Grader {
+	return GraderFunc(func(ctx context.Context, c Case, output string) (Score, error) {
+		vectors, err := e.Embed(ctx, []string{output, c.Expected})
+		if err != nil {
+			return Score{}, fmt.Errorf("failed to embed output: %w", err)
+		}
+		if len(vectors) != 2 {
+			return Score{}, fmt.Errorf("expected 2 embeddings, got %d", len(vectors))
+		}
+
+		similarity := max(cosine(vectors[0], vectors[1]), 0)
+		score := Score{Value: similarity, Pass: similarity >= threshold}
+		if !score.Pass {
+			score.Reason = fmt.Sprintf("similarity %.3f is below %.3f", similarity, threshold)
+		}
+		return score, nil
+	})
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+type judgment struct {
+	Score  int    `json:"score" description:"from 1 to 5"`
+	Reason string `json:"reason"`
+}
+
+// Judge asks the model behind p to score outputs from 1 to 5 against
+// criteria, passing at 4 and above. The expected output, when the case has
+// one, is given to the judge as a reference.
+func Judge(p provider.Provider, criteria string) Grader {
+	return GraderFunc(func(ctx context.Context, c Case, output string) (Score, error) {
+		var prompt strings.Builder
+		fmt.Fprintf(&prompt, "Criteria:\n%s\n\n", criteria)
+		if c.Prompt != "" {
+			fmt.Fprintf(&prompt, "Prompt:\n%s\n\n", c.Prompt)
+		}
+		if c.Expected != "" {
+			fmt.Fprintf(&prompt, "Reference answer:\n%s\n\n", c.Expected)
+		}
+		fmt.Fprintf(&prompt, "Output:\n%s", output)
+
+		j, err := ai.Extract[judgment](ctx, p, prompt.String(), ai.WithInstructions(judgeInstructions))
+		if err != nil {
+			return Score{}, fmt.Errorf("failed to judge output: %w", err)
+		}
+
+		value := min(max(float64(j.Score-1)/4, 0), 1)
+		return Score{Value: value, Pass: j.Score >= 4, Reason: j.Reason}, nil
+	})
+}
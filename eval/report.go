@@ -0,0 +1,132 @@
+package eval
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Summary aggregates the results of one target. Failed requests count as
+// failures of every grader.
+type Summary struct {
+	Target      string             `json:"target"`
+	Cases       int                `json:"cases"`
+	Errors      int                `json:"errors"`
+	PassRate    map[string]float64 `json:"pass_rate"`
+	MeanScore   map[string]float64 `json:"mean_score"`
+	MeanLatency time.Duration      `json:"mean_latency_ns"`
+	Cost        float64            `json:"cost"`
+}
+
+// Summaries returns one summary per target, in the order targets appear.
+func (r *Report) Summaries() []Summary {
+	graders := r.graders()
+	var summaries []Summary
+	index := make(map[string]int)
+	var latency []time.Duration
+
+	for _, result := range r.Results {
+		i, ok := index[result.Target]
+		if !ok {
+			i = len(summaries)
+			index[result.Target] = i
+			summaries = append(summaries, Summary{
+				Target:    result.Target,
+				PassRate:  make(map[string]float64),
+				MeanScore: make(map[string]float64),
+			})
+			latency = append(latency, 0)
+		}
+
+		s := &summaries[i]
+		s.Cases++
+		s.Cost += result.Cost
+		latency[i] += result.Latency
+		if result.Error != "" {
+			s.Errors++
+		}
+		for _, name := range graders {
+			score := result.Scores[name]
+			s.MeanScore[name] += score.Value
+			if score.Pass {
+				s.PassRate[name]++
+			}
+		}
+	}
+
+	for i := range summaries {
+		s := &summaries[i]
+		s.MeanLatency = latency[i] / time.Duration(s.Cases)
+		for _, name := range graders {
+			s.PassRate[name] /= float64(s.Cases)
+			s.MeanScore[name] /= float64(s.Cases)
+		}
+	}
+	return summaries
+}
+
+func (r *Report) graders() []string {
+	names := make(map[string]bool)
+	for _, result := range r.Results {
+		for name := range result.Scores {
+			names[name] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(names))
+}
+
+// WriteJSON writes the results and summaries as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Results   []Result  `json:"results"`
+		Summaries []Summary `json:"summaries"`
+	}{r.Results, r.Summaries()})
+}
+
+// WriteCSV writes one row per result, with a score and a pass column per
+// grader.
+func (r *Report) WriteCSV(w io.Writer) error {
+	graders := r.graders()
+	header := []string{"case", "target", "model", "latency_ms", "prompt_tokens", "completion_tokens", "cost_usd", "error"}
+	for _, name := range graders {
+		header = append(header, name+"_score", name+"_pass")
+	}
+	header = append(header, "output")
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, result := range r.Results {
+		row := []string{
+			result.Case,
+			result.Target,
+			result.Model,
+			strconv.FormatInt(result.Latency.Milliseconds(), 10),
+			strconv.Itoa(result.Usage.PromptTokens),
+			strconv.Itoa(result.Usage.CompletionTokens),
+			strconv.FormatFloat(result.Cost, 'f', -1, 64),
+			result.Error,
+		}
+		for _, name := range graders {
+			score := result.Scores[name]
+			row = append(row, strconv.FormatFloat(score.Value, 'f', -1, 64), strconv.FormatBool(score.Pass))
+		}
+		row = append(row, result.Output)
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
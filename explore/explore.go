@@ -0,0 +1,226 @@
+// Package explore searches over multi-step answers with a beam: at every
+// step each kept trajectory is forked into several continuations, sampled
+// in parallel, an evaluator scores them and only the best are kept for the
+// next step.
+package explore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alexisbouchez/ai/chat"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const (
+	defaultBranches    = 3
+	defaultBeam        = 2
+	defaultDepth       = 3
+	defaultConcurrency = 4
+	defaultStepPrompt  = `Continue with the next step. When you reach the final answer, start it with "Final answer:".`
+	finalAnswer        = "Final answer:"
+)
+
+// Evaluator scores a trajectory, higher being better. It is called once
+// per new trajectory, after its last step.
+type Evaluator func(ctx context.Context, t *Trajectory) (float64, error)
+
+// Trajectory is one path through the search.
+type Trajectory struct {
+	// Steps are the replies of the model along the path, in order
+	Steps []string
+	Score float64
+	// Done reports whether the path reached a final answer
+	Done  bool
+	Usage provider.Usage
+
+	session *chat.Session
+}
+
+// Messages returns the conversation of the trajectory.
+func (t *Trajectory) Messages() []provider.Message {
+	return t.session.Messages()
+}
+
+// Last returns the last step, or "" before the first one.
+func (t *Trajectory) Last() string {
+	if len(t.Steps) == 0 {
+		return ""
+	}
+	return t.Steps[len(t.Steps)-1]
+}
+
+type Explorer struct {
+	session     *chat.Session
+	evaluate    Evaluator
+	branches    int
+	beam        int
+	depth       int
+	concurrency int
+	stepPrompt  string
+	done        func(step string) bool
+}
+
+// New explores from session, which is forked and left unchanged. Configure
+// the session with a nonzero temperature so that the continuations differ.
+func New(session *chat.Session, evaluate Evaluator) *Explorer {
+	return &Explorer{
+		session:     session,
+		evaluate:    evaluate,
+		branches:    defaultBranches,
+		beam:        defaultBeam,
+		depth:       defaultDepth,
+		concurrency: defaultConcurrency,
+		stepPrompt:  defaultStepPrompt,
+		done: func(step string) bool {
+			return strings.Contains(step, finalAnswer)
+		},
+	}
+}
+
+// Branches sets the number of continuations sampled per trajectory and step.
+func (e *Explorer) Branches(n int) *Explorer {
+	e.branches = n
+	return e
+}
+
+// Beam sets the number of trajectories kept after each step.
+func (e *Explorer) Beam(n int) *Explorer {
+	e.beam = n
+	return e
+}
+
+// Depth sets the maximum number of steps.
+func (e *Explorer) Depth(n int) *Explorer {
+	e.depth = n
+	return e
+}
+
+func (e *Explorer) Concurrency(n int) *Explorer {
+	e.concurrency = n
+	return e
+}
+
+// StepPrompt sets the message sent to ask for every step after the first.
+func (e *Explorer) StepPrompt(prompt string) *Explorer {
+	e.stepPrompt = prompt
+	return e
+}
+
+// Done sets how to tell that a step ends its trajectory. By default, a
+// step containing "Final answer:" does.
+func (e *Explorer) Done(fn func(step string) bool) *Explorer {
+	e.done = fn
+	return e
+}
+
+// Run explores from task, sent as the first message, and returns the
+// highest scoring trajectory once every kept trajectory is done or the
+// depth is reached.
+func (e *Explorer) Run(ctx context.Context, task string) (*Trajectory, error) {
+	beam := []*Trajectory{{session: e.session.Fork()}}
+	for step := range max(e.depth, 1) {
+		prompt := e.stepPrompt
+		if step == 0 {
+			prompt = task
+		}
+
+		var candidates, open []*Trajectory
+		for _, t := range beam {
+			if t.Done {
+				candidates = append(candidates, t)
+			} else {
+				open = append(open, t)
+			}
+		}
+		if len(open) == 0 {
+			break
+		}
+
+		expanded, err := e.expand(ctx, open, prompt)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, expanded...)
+
+		slices.SortStableFunc(candidates, func(a, b *Trajectory) int {
+			switch {
+			case a.Score > b.Score:
+				return -1
+			case a.Score < b.Score:
+				return 1
+			}
+			return 0
+		})
+		beam = candidates[:min(max(e.beam, 1), len(candidates))]
+	}
+	return beam[0], nil
+}
+
+// expand samples the continuations of trajectories in parallel and scores
+// them.
+func (e *Explorer) expand(ctx context.Context, trajectories []*Trajectory, prompt string) ([]*Trajectory, error) {
+	var children []*Trajectory
+	for _, parent := range trajectories {
+		for range max(e.branches, 1) {
+			children = append(children, &Trajectory{
+				Steps:   slices.Clone(parent.Steps),
+				Usage:   parent.Usage,
+				session: parent.session.Fork(),
+			})
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(children))
+	sem := make(chan struct{}, max(e.concurrency, 1))
+	var wg sync.WaitGroup
+	for i, t := range children {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if errs[i] = e.step(ctx, t, prompt); errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to explore branch %d: %w", i, err)
+		}
+	}
+	return children, nil
+}
+
+func (e *Explorer) step(ctx context.Context, t *Trajectory, prompt string) error {
+	resp, err := t.session.Send(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	t.Usage.PromptTokens += resp.Usage.PromptTokens
+	t.Usage.CompletionTokens += resp.Usage.CompletionTokens
+	t.Usage.TotalTokens += resp.Usage.TotalTokens
+
+	var content string
+	if len(resp.Choices) > 0 {
+		content = resp.Choices[0].Message.Content
+	}
+	t.Steps = append(t.Steps, content)
+	t.Done = e.done(content)
+
+	t.Score, err = e.evaluate(ctx, t)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate trajectory: %w", err)
+	}
+	return nil
+}
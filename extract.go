@@ -0,0 +1,178 @@
+// Package ai holds the high-level helpers built on top of the provider
+// interface.
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/schema"
+	"github.com/alexisbouchez/ai/tool"
+)
+
+const (
+	extractTool           = "extract"
+	defaultExtractRetries = 2
+	defaultInstructions   = "Extract the requested information from the user's text by calling the extract tool. Leave optional fields out when the text does not state them."
+)
+
+type extractConfig struct {
+	instructions string
+	model        string
+	retries      int
+}
+
+type ExtractOption func(*extractConfig)
+
+// WithInstructions replaces the default system prompt.
+func WithInstructions(instructions string) ExtractOption {
+	return func(c *extractConfig) {
+		c.instructions = instructions
+	}
+}
+
+func WithExtractModel(model string) ExtractOption {
+	return func(c *extractConfig) {
+		c.model = model
+	}
+}
+
+// WithRetries sets how many times the model is asked to correct output that
+// does not match the schema.
+func WithRetries(n int) ExtractOption {
+	return func(c *extractConfig) {
+		c.retries = n
+	}
+}
+
+// ExtractError reports output that still failed validation after the last
+// retry.
+type ExtractError struct {
+	Output string
+	Err    error
+}
+
+func (e *ExtractError) Error() string {
+	return fmt.Sprintf("failed to extract: %v", e.Err)
+}
+
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// Extract asks the model to fill T from text. The JSON schema of T, derived
+// with tool.SchemaOf, is offered as a forced tool call; output that fails to
+// parse or violates the schema is sent back with the violations until it
+// validates or the retries run out. When T implements Validate() error, it
+// is called on the result as well.
+func Extract[T any](ctx context.Context, p provider.Provider, text string, opts ...ExtractOption) (T, error) {
+	var zero T
+
+	config := extractConfig{
+		instructions: defaultInstructions,
+		retries:      defaultExtractRetries,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	params := tool.SchemaOf[T]()
+	validator, err := schema.New(params)
+	if err != nil {
+		return zero, err
+	}
+	req := &provider.ChatRequest{
+		Model: config.model,
+		Messages: []provider.Message{
+			{Role: provider.RoleSystem, Content: config.instructions},
+			{Role: provider.RoleUser, Content: text},
+		},
+		Tools: []provider.Tool{{
+			Type: "function",
+			Function: provider.Function{
+				Name:        extractTool,
+				Description: "Record the extracted information.",
+				Parameters:  params,
+			},
+		}},
+		ToolChoice: provider.ForceTool(extractTool),
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := p.Chat(ctx, req)
+		if err != nil {
+			return zero, err
+		}
+		if len(resp.Choices) == 0 {
+			return zero, errors.New("failed to extract: empty response")
+		}
+
+		msg := resp.Choices[0].Message
+		output, callID := extractOutput(msg)
+
+		result, err := decodeExtracted[T](output, validator)
+		if err == nil {
+			return result, nil
+		}
+		if attempt >= config.retries {
+			return zero, &ExtractError{Output: output, Err: err}
+		}
+
+		feedback := fmt.Sprintf("The output is invalid: %v. Call %s again with corrected arguments.", err, extractTool)
+		req.Messages = append(req.Messages, msg)
+		if callID != "" {
+			req.Messages = append(req.Messages, provider.Message{
+				Role:       provider.RoleTool,
+				ToolCallID: callID,
+				Name:       extractTool,
+				Content:    feedback,
+			})
+		} else {
+			req.Messages = append(req.Messages, provider.Message{Role: provider.RoleUser, Content: feedback})
+		}
+	}
+}
+
+// extractOutput returns the extract tool arguments, or the message content
+// for providers that answered in text.
+func extractOutput(msg provider.Message) (string, string) {
+	for _, tc := range msg.ToolCalls {
+		if tc.Function.Name == extractTool {
+			return tc.Function.Arguments, tc.ID
+		}
+	}
+	content := strings.TrimSpace(msg.Content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	return strings.TrimSpace(content), ""
+}
+
+func decodeExtracted[T any](output string, validator *schema.Schema) (T, error) {
+	var result T
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(output), &fields); err != nil {
+		return result, fmt.Errorf("output is not a JSON object: %w", err)
+	}
+	if err := validator.ValidateJSON([]byte(output)); err != nil {
+		return result, err
+	}
+
+	dec := json.NewDecoder(strings.NewReader(output))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&result); err != nil {
+		return result, err
+	}
+
+	if v, ok := any(&result).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,370 @@
+// Package flow runs workflows: graphs of steps, such as model calls, tools,
+// branches, maps over lists and human approvals, where each step runs once
+// the steps it depends on are done. The state of a run is checkpointed to a
+// store.Store after every step, so that a run paused for approval or
+// interrupted by a crash resumes where it stopped.
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/alexisbouchez/ai/store"
+)
+
+var (
+	ErrRunExists   = errors.New("run already exists")
+	ErrRunNotFound = errors.New("run not found")
+	ErrNotPending  = errors.New("step is not awaiting approval")
+)
+
+type Status string
+
+const (
+	Running   Status = "running"
+	Paused    Status = "paused"
+	Completed Status = "completed"
+	Failed    Status = "failed"
+)
+
+// Run is the state of a workflow run, as checkpointed to the store.
+type Run struct {
+	ID     string          `json:"id"`
+	Status Status          `json:"status"`
+	Input  json.RawMessage `json:"input,omitempty"`
+	// Outputs are the JSON-encoded outputs of the completed steps
+	Outputs map[string]json.RawMessage `json:"outputs"`
+	// Skipped lists the steps left out by a branch
+	Skipped []string `json:"skipped,omitempty"`
+	// Pending lists the approvals the run is paused on
+	Pending []Pending `json:"pending,omitempty"`
+	// Error is the error the run failed with
+	Error string `json:"error,omitempty"`
+}
+
+// Pending is an approval step awaiting a decision.
+type Pending struct {
+	Step    string `json:"step"`
+	Message string `json:"message"`
+}
+
+// Input decodes the input of r.
+func Input[T any](r *Run) (T, error) {
+	var v T
+	if err := json.Unmarshal(r.Input, &v); err != nil {
+		return v, fmt.Errorf("failed to decode input: %w", err)
+	}
+	return v, nil
+}
+
+// Output decodes the output of step.
+func Output[T any](r *Run, step string) (T, error) {
+	var v T
+	data, ok := r.Outputs[step]
+	if !ok {
+		return v, fmt.Errorf("step %q has no output", step)
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("failed to decode output of step %q: %w", step, err)
+	}
+	return v, nil
+}
+
+func (r *Run) done(step string) bool {
+	_, ok := r.Outputs[step]
+	return ok
+}
+
+func (r *Run) pending(step string) bool {
+	return slices.ContainsFunc(r.Pending, func(p Pending) bool { return p.Step == step })
+}
+
+// Workflow is a graph of steps. Steps that do not depend on each other run
+// concurrently. A step may run again when a run resumes after a crash, so
+// steps with side effects should be idempotent.
+type Workflow struct {
+	name  string
+	steps []*Step
+	store store.Store
+}
+
+// New creates a workflow checkpointing its runs to an in-memory store. The
+// name prefixes the keys of its runs.
+func New(name string) *Workflow {
+	return &Workflow{name: name, store: store.NewMemory()}
+}
+
+func (w *Workflow) Steps(steps ...*Step) *Workflow {
+	w.steps = append(w.steps, steps...)
+	return w
+}
+
+// Store sets where runs are checkpointed. Use a persistent store to resume
+// runs after a restart.
+func (w *Workflow) Store(s store.Store) *Workflow {
+	w.store = s
+	return w
+}
+
+// Start runs the workflow with input, under an ID unique to the run. It
+// returns when the run completes, fails or pauses for approval.
+func (w *Workflow) Start(ctx context.Context, runID string, input any) (*Run, error) {
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := w.store.Get(ctx, w.key(runID)); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRunExists, runID)
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load run: %w", err)
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input: %w", err)
+	}
+	run := &Run{
+		ID:      runID,
+		Status:  Running,
+		Input:   data,
+		Outputs: make(map[string]json.RawMessage),
+	}
+	return w.execute(ctx, run)
+}
+
+// Load returns the last checkpoint of a run.
+func (w *Workflow) Load(ctx context.Context, runID string) (*Run, error) {
+	data, err := w.store.Get(ctx, w.key(runID))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load run: %w", err)
+	}
+
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to decode run: %w", err)
+	}
+	if run.Outputs == nil {
+		run.Outputs = make(map[string]json.RawMessage)
+	}
+	return &run, nil
+}
+
+// Resume continues a run from its last checkpoint: an interrupted run goes
+// on with the steps that were not done, and a failed run retries the step
+// that failed. Completed runs are returned as they are, and paused runs
+// stay paused until every pending step is decided with Approve.
+func (w *Workflow) Resume(ctx context.Context, runID string) (*Run, error) {
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	run, err := w.Load(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Status == Completed {
+		return run, nil
+	}
+	return w.execute(ctx, run)
+}
+
+// Approve records the decision on a pending approval step and resumes the
+// run.
+func (w *Workflow) Approve(ctx context.Context, runID, step string, approval Approval) (*Run, error) {
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	run, err := w.Load(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if !run.pending(step) {
+		return nil, fmt.Errorf("%w: %s", ErrNotPending, step)
+	}
+
+	data, err := json.Marshal(approval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode approval: %w", err)
+	}
+	run.Outputs[step] = data
+	run.Pending = slices.DeleteFunc(run.Pending, func(p Pending) bool { return p.Step == step })
+	return w.execute(ctx, run)
+}
+
+func (w *Workflow) key(runID string) string {
+	return "flow/" + w.name + "/" + runID
+}
+
+func (w *Workflow) save(ctx context.Context, run *Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	if err := w.store.Put(ctx, w.key(run.ID), data); err != nil {
+		return fmt.Errorf("failed to checkpoint run: %w", err)
+	}
+	return nil
+}
+
+// validate checks that step names are unique, dependencies exist and the
+// graph has no cycle.
+func (w *Workflow) validate() error {
+	byName := make(map[string]*Step, len(w.steps))
+	for _, s := range w.steps {
+		if _, ok := byName[s.name]; ok {
+			return fmt.Errorf("duplicate step %q", s.name)
+		}
+		byName[s.name] = s
+	}
+	for _, s := range w.steps {
+		for _, dep := range s.dependencies() {
+			if _, ok := byName[dep]; !ok {
+				return fmt.Errorf("step %q depends on unknown step %q", s.name, dep)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(w.steps))
+	var visit func(s *Step) error
+	visit = func(s *Step) error {
+		switch state[s.name] {
+		case visiting:
+			return fmt.Errorf("workflow has a cycle through step %q", s.name)
+		case visited:
+			return nil
+		}
+		state[s.name] = visiting
+		for _, dep := range s.dependencies() {
+			if err := visit(byName[dep]); err != nil {
+				return err
+			}
+		}
+		state[s.name] = visited
+		return nil
+	}
+	for _, s := range w.steps {
+		if err := visit(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execute runs the steps that are ready, in waves, checkpointing after
+// each, until the run completes, fails or waits on approvals.
+func (w *Workflow) execute(ctx context.Context, run *Run) (*Run, error) {
+	run.Status = Running
+	run.Error = ""
+
+	for {
+		ready, err := w.ready(run)
+		if err != nil {
+			return w.fail(ctx, run, err)
+		}
+		if len(ready) == 0 {
+			run.Status = Completed
+			if len(run.Pending) > 0 {
+				run.Status = Paused
+			}
+			return run, w.save(ctx, run)
+		}
+
+		outputs := make([]json.RawMessage, len(ready))
+		errs := make([]error, len(ready))
+		var wg sync.WaitGroup
+		for i, s := range ready {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				outputs[i], errs[i] = s.execute(ctx, run)
+			}()
+		}
+		wg.Wait()
+
+		var failed error
+		for i, s := range ready {
+			if errs[i] != nil {
+				failed = errors.Join(failed, fmt.Errorf("step %q failed: %w", s.name, errs[i]))
+				continue
+			}
+			run.Outputs[s.name] = outputs[i]
+		}
+		if failed != nil {
+			return w.fail(ctx, run, failed)
+		}
+		if err := w.save(ctx, run); err != nil {
+			return run, err
+		}
+	}
+}
+
+// ready settles the steps whose dependencies are done: steps cut off by a
+// branch are skipped, approvals without a decision become pending, and
+// the others are returned to be run.
+func (w *Workflow) ready(run *Run) ([]*Step, error) {
+	for {
+		var ready []*Step
+		settled := false
+		for _, s := range w.steps {
+			if run.done(s.name) || run.pending(s.name) || slices.Contains(run.Skipped, s.name) {
+				continue
+			}
+
+			waiting, skip := false, false
+			for _, dep := range s.dependencies() {
+				switch {
+				case slices.Contains(run.Skipped, dep):
+					skip = true
+				case !run.done(dep):
+					waiting = true
+				}
+			}
+			if waiting {
+				continue
+			}
+			if !skip && s.branch != "" {
+				label, err := Output[string](run, s.branch)
+				if err != nil {
+					return nil, err
+				}
+				skip = !slices.Contains(s.labels, label)
+			}
+
+			switch {
+			case skip:
+				run.Skipped = append(run.Skipped, s.name)
+				settled = true
+			case s.approval != nil:
+				message, err := s.approval(run)
+				if err != nil {
+					return nil, fmt.Errorf("step %q failed: %w", s.name, err)
+				}
+				run.Pending = append(run.Pending, Pending{Step: s.name, Message: message})
+			default:
+				ready = append(ready, s)
+			}
+		}
+		// skipping a step may settle the steps depending on it
+		if len(ready) > 0 || !settled {
+			return ready, nil
+		}
+	}
+}
+
+func (w *Workflow) fail(ctx context.Context, run *Run, err error) (*Run, error) {
+	run.Status = Failed
+	run.Error = err.Error()
+	if saveErr := w.save(ctx, run); saveErr != nil {
+		return run, errors.Join(err, saveErr)
+	}
+	return run, err
+}
@@ -0,0 +1,162 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tool"
+)
+
+const defaultMapConcurrency = 4
+
+// Step is a node of a workflow. Its output is encoded to JSON, and read by
+// the steps after it with Output. Steps get the run to read outputs from
+// and must not modify it.
+type Step struct {
+	name     string
+	after    []string
+	branch   string
+	labels   []string
+	run      func(ctx context.Context, r *Run) (any, error)
+	approval func(r *Run) (string, error)
+}
+
+// After makes the step wait for steps.
+func (s *Step) After(steps ...string) *Step {
+	s.after = append(s.after, steps...)
+	return s
+}
+
+// When runs the step only if branch, a step created with Branch, chose one
+// of labels. Otherwise the step is skipped, along with the steps depending
+// on it.
+func (s *Step) When(branch string, labels ...string) *Step {
+	s.branch = branch
+	s.labels = labels
+	return s
+}
+
+func (s *Step) dependencies() []string {
+	if s.branch == "" {
+		return s.after
+	}
+	return append([]string{s.branch}, s.after...)
+}
+
+func (s *Step) execute(ctx context.Context, r *Run) (json.RawMessage, error) {
+	out, err := s.run(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode output: %w", err)
+	}
+	return data, nil
+}
+
+// Func is a step running fn.
+func Func[Out any](name string, fn func(ctx context.Context, r *Run) (Out, error)) *Step {
+	return &Step{
+		name: name,
+		run: func(ctx context.Context, r *Run) (any, error) {
+			return fn(ctx, r)
+		},
+	}
+}
+
+// LLM is a step sending the request built by prompt to p. Its output is the
+// content of the response.
+func LLM(name string, p provider.Provider, prompt func(r *Run) (*provider.ChatRequest, error)) *Step {
+	return Func(name, func(ctx context.Context, r *Run) (string, error) {
+		req, err := prompt(r)
+		if err != nil {
+			return "", err
+		}
+		resp, err := p.Chat(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", errors.New("response has no choices")
+		}
+		return resp.Choices[0].Message.Content, nil
+	})
+}
+
+// Tool is a step running t with the arguments built by args, encoded to
+// JSON. Its output is the result of the tool.
+func Tool(name string, t *tool.Tool, args func(r *Run) (any, error)) *Step {
+	return Func(name, func(ctx context.Context, r *Run) (string, error) {
+		v, err := args(r)
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode arguments: %w", err)
+		}
+		return t.Run(ctx, string(data))
+	})
+}
+
+// Branch is a step choosing a label, which steps select with When.
+func Branch(name string, choose func(ctx context.Context, r *Run) (string, error)) *Step {
+	return Func(name, choose)
+}
+
+// Map is a step running fn on every item returned by items, four at a time.
+// Its output is the results, in the order of the items.
+func Map[In, Out any](name string, items func(r *Run) ([]In, error), fn func(ctx context.Context, item In) (Out, error)) *Step {
+	return Func(name, func(ctx context.Context, r *Run) ([]Out, error) {
+		list, err := items(r)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		results := make([]Out, len(list))
+		errs := make([]error, len(list))
+		sem := make(chan struct{}, defaultMapConcurrency)
+		var wg sync.WaitGroup
+		for i, item := range list {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				if results[i], errs[i] = fn(ctx, item); errs[i] != nil {
+					cancel()
+				}
+			}()
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("failed on item %d: %w", i, err)
+			}
+		}
+		return results, nil
+	})
+}
+
+// Approval is the decision on a Review step, and its output.
+type Approval struct {
+	Approved bool   `json:"approved"`
+	Note     string `json:"note,omitempty"`
+}
+
+// Review is a step pausing the run until a person decides on it with
+// Workflow.Approve. The message built by message is listed in Run.Pending,
+// and steps after it read the decision with Output[Approval].
+func Review(name string, message func(r *Run) (string, error)) *Step {
+	return &Step{name: name, approval: message}
+}
@@ -0,0 +1,325 @@
+package guard
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type Action int
+
+const (
+	Allow Action = iota
+	// Redact replaces the content with Result.Content and continues
+	Redact
+	// Reject fails the request with a ViolationError
+	Reject
+	// Retry asks the model again with Result.Reason as corrective feedback.
+	// It only applies to output; on input it behaves like Reject.
+	Retry
+)
+
+type Result struct {
+	Action  Action
+	Reason  string
+	Content string
+}
+
+type Validator interface {
+	Validate(ctx context.Context, content string) (Result, error)
+}
+
+type ValidatorFunc func(ctx context.Context, content string) (Result, error)
+
+func (f ValidatorFunc) Validate(ctx context.Context, content string) (Result, error) {
+	return f(ctx, content)
+}
+
+type Stage string
+
+const (
+	StageInput   Stage = "input"
+	StageContext Stage = "context"
+	StageOutput  Stage = "output"
+)
+
+type ViolationError struct {
+	Stage  Stage
+	Reason string
+}
+
+func (e *ViolationError) Error() string {
+	return fmt.Sprintf("guard rejected %s: %s", e.Stage, e.Reason)
+}
+
+const defaultMaxRetries = 1
+
+type Guard struct {
+	input      []Validator
+	context    []Validator
+	output     []Validator
+	maxRetries int
+
+	mu sync.Mutex
+	// redactions maps the hashes of the tool results redacted by Context
+	// validators to their redacted text
+	redactions map[[sha256.Size]byte]string
+}
+
+func New() *Guard {
+	return &Guard{maxRetries: defaultMaxRetries}
+}
+
+// Input adds validators run on every user message before it is sent.
+func (g *Guard) Input(validators ...Validator) *Guard {
+	g.input = append(g.input, validators...)
+	return g
+}
+
+// Context adds validators run on new tool results, those after the last
+// assistant message, to screen content the model did not get from the
+// user. They see the whole text of a result, and their redactions are
+// applied again when the result is sent with later requests.
+func (g *Guard) Context(validators ...Validator) *Guard {
+	g.context = append(g.context, validators...)
+	return g
+}
+
+// Output adds validators run on the assistant reply.
+func (g *Guard) Output(validators ...Validator) *Guard {
+	g.output = append(g.output, validators...)
+	return g
+}
+
+func (g *Guard) MaxRetries(n int) *Guard {
+	g.maxRetries = n
+	return g
+}
+
+// check runs validators in order and returns the possibly redacted content.
+// The returned action is Allow, Reject or Retry.
+func check(ctx context.Context, validators []Validator, content string) (string, Result, error) {
+	for _, v := range validators {
+		result, err := v.Validate(ctx, content)
+		if err != nil {
+			return "", Result{}, err
+		}
+		switch result.Action {
+		case Redact:
+			content = result.Content
+		case Reject, Retry:
+			return content, result, nil
+		}
+	}
+	return content, Result{Action: Allow}, nil
+}
+
+// Wrap returns a provider that applies the guard to every request.
+func (g *Guard) Wrap(p provider.Provider) provider.Provider {
+	return &guarded{Wrapper: provider.Wrapper{Next: p, Wrap: g.Wrap}, guard: g}
+}
+
+type guarded struct {
+	provider.Wrapper
+	guard *Guard
+}
+
+func (p *guarded) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	req, err := p.checkInput(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := p.Next.Chat(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry *Result
+		for i := range resp.Choices {
+			content, result, err := check(ctx, p.guard.output, resp.Choices[i].Message.Content)
+			if err != nil {
+				return nil, err
+			}
+			switch result.Action {
+			case Reject:
+				return nil, &ViolationError{Stage: StageOutput, Reason: result.Reason}
+			case Retry:
+				retry = &result
+			}
+			resp.Choices[i].Message.Content = content
+		}
+
+		if retry == nil {
+			return resp, nil
+		}
+		if attempt >= p.guard.maxRetries {
+			return nil, &ViolationError{Stage: StageOutput, Reason: retry.Reason}
+		}
+
+		r := *req
+		r.Messages = append(append([]provider.Message(nil), req.Messages...),
+			resp.Choices[0].Message,
+			provider.Message{
+				Role:    provider.RoleUser,
+				Content: fmt.Sprintf("Your previous answer was rejected: %s. Answer again and fix this.", retry.Reason),
+			},
+		)
+		req = &r
+	}
+}
+
+// Stream validates input like Chat. Output validators run once the stream
+// completes; since the content has already been delivered, any violation
+// ends the stream with a ViolationError.
+func (p *guarded) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	req, err := p.checkInput(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := p.Next.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.guard.output) == 0 {
+		return stream, nil
+	}
+
+	events := make(chan provider.StreamEvent)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(events)
+
+		send := func(event provider.StreamEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-done:
+				return false
+			}
+		}
+
+		var acc provider.Accumulator
+		for event, err := range stream.Events() {
+			acc.Add(event)
+			if !send(event) || err != nil {
+				return
+			}
+		}
+
+		_, result, err := check(ctx, p.guard.output, acc.Content())
+		if err != nil {
+			send(provider.StreamEvent{Err: err})
+		} else if result.Action != Allow {
+			send(provider.StreamEvent{Err: &ViolationError{Stage: StageOutput, Reason: result.Reason}})
+		}
+	}()
+
+	return provider.NewStreamReader(events, func() {
+		close(done)
+		stream.Close()
+	}), nil
+}
+
+func (p *guarded) checkInput(ctx context.Context, req *provider.ChatRequest) (*provider.ChatRequest, error) {
+	if len(p.guard.input) == 0 && len(p.guard.context) == 0 {
+		return req, nil
+	}
+
+	messages := make([]provider.Message, len(req.Messages))
+	copy(messages, req.Messages)
+
+	// Tool results before the last assistant message were screened by the
+	// request that added them; only their redactions are applied again
+	last := -1
+	for i, msg := range messages {
+		if msg.Role == provider.RoleAssistant {
+			last = i
+		}
+	}
+
+	for i, msg := range messages {
+		switch {
+		case msg.Role == provider.RoleUser && len(p.guard.input) > 0:
+			content, err := screen(ctx, p.guard.input, StageInput, msg.Content)
+			if err != nil {
+				return nil, err
+			}
+			messages[i].Content = content
+
+		case msg.Role == provider.RoleTool && len(p.guard.context) > 0:
+			// Tool results may also come as parts, so the whole text is
+			// screened
+			text := msg.Text()
+			if i < last {
+				if content, ok := p.guard.redaction(text); ok {
+					messages[i] = withText(msg, content)
+				}
+				continue
+			}
+			content, err := screen(ctx, p.guard.context, StageContext, text)
+			if err != nil {
+				return nil, err
+			}
+			if content != text {
+				p.guard.redacted(text, content)
+				messages[i] = withText(msg, content)
+			}
+		}
+	}
+
+	r := *req
+	r.Messages = messages
+	return &r, nil
+}
+
+// screen runs validators on content, failing with a ViolationError of
+// stage unless they allow it.
+func screen(ctx context.Context, validators []Validator, stage Stage, content string) (string, error) {
+	content, result, err := check(ctx, validators, content)
+	if err != nil {
+		return "", err
+	}
+	if result.Action != Allow {
+		return "", &ViolationError{Stage: stage, Reason: result.Reason}
+	}
+	return content, nil
+}
+
+// withText returns msg with its text replaced by text, keeping its parts
+// other than text and JSON.
+func withText(msg provider.Message, text string) provider.Message {
+	msg.Content = text
+	var parts []provider.Part
+	for _, part := range msg.Parts {
+		if part.Type != provider.PartText && part.Type != provider.PartJSON {
+			parts = append(parts, part)
+		}
+	}
+	msg.Parts = parts
+	return msg
+}
+
+// redacted remembers that the tool result text was redacted to content.
+func (g *Guard) redacted(text, content string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.redactions == nil {
+		g.redactions = make(map[[sha256.Size]byte]string)
+	}
+	g.redactions[sha256.Sum256([]byte(text))] = content
+}
+
+// redaction returns the content the tool result text was redacted to.
+func (g *Guard) redaction(text string) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	content, ok := g.redactions[sha256.Sum256([]byte(text))]
+	return content, ok
+}
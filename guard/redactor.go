@@ -0,0 +1,234 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+var placeholderPattern = regexp.MustCompile(`\[(?:EMAIL|SSN|CREDIT_CARD|PHONE)_\d+\]`)
+
+// maxPlaceholder bounds the length of a placeholder, so that streams only
+// hold back that much text while waiting for the end of one
+const maxPlaceholder = 24
+
+// PIIRedactor returns a middleware replacing the email addresses, phone
+// numbers, US social security numbers and credit card numbers of outgoing
+// messages with placeholders such as [EMAIL_1] before the request is sent,
+// and restoring the original values where the response uses the
+// placeholders, in text and tool call arguments. The same value gets the
+// same placeholder throughout a request.
+func PIIRedactor() provider.Middleware {
+	var mw provider.Middleware
+	mw = func(p provider.Provider) provider.Provider {
+		return &piiRedacted{provider.Wrapper{Next: p, Wrap: mw}}
+	}
+	return mw
+}
+
+type piiRedacted struct {
+	provider.Wrapper
+}
+
+func (p *piiRedacted) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	vault := newPIIVault()
+	resp, err := p.Next.Chat(ctx, vault.redactRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	for i := range resp.Choices {
+		msg := &resp.Choices[i].Message
+		msg.Content = vault.restore(msg.Content)
+		for j := range msg.ToolCalls {
+			msg.ToolCalls[j].Function.Arguments = vault.restore(msg.ToolCalls[j].Function.Arguments)
+		}
+		for j := range msg.Parts {
+			msg.Parts[j].Text = vault.restore(msg.Parts[j].Text)
+		}
+	}
+	return resp, nil
+}
+
+func (p *piiRedacted) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	vault := newPIIVault()
+	stream, err := p.Next.Stream(ctx, vault.redactRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	return vault.restoreStream(stream), nil
+}
+
+// piiVault maps the personal data of a request to placeholders and back.
+type piiVault struct {
+	placeholders map[string]string
+	values       map[string]string
+	counts       map[string]int
+}
+
+func newPIIVault() *piiVault {
+	return &piiVault{
+		placeholders: make(map[string]string),
+		values:       make(map[string]string),
+		counts:       make(map[string]int),
+	}
+}
+
+func (v *piiVault) redactRequest(req *provider.ChatRequest) *provider.ChatRequest {
+	messages := make([]provider.Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		msg.Content = v.redact(msg.Content)
+		if len(msg.Parts) > 0 {
+			parts := make([]provider.Part, len(msg.Parts))
+			copy(parts, msg.Parts)
+			for j := range parts {
+				parts[j].Text = v.redact(parts[j].Text)
+			}
+			msg.Parts = parts
+		}
+		if len(msg.ToolCalls) > 0 {
+			calls := make([]provider.ToolCall, len(msg.ToolCalls))
+			copy(calls, msg.ToolCalls)
+			for j := range calls {
+				calls[j].Function.Arguments = v.redact(calls[j].Function.Arguments)
+			}
+			msg.ToolCalls = calls
+		}
+		messages[i] = msg
+	}
+
+	r := *req
+	r.Messages = messages
+	return &r
+}
+
+func (v *piiVault) redact(text string) string {
+	for _, kind := range piiKinds {
+		text = kind.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if kind.valid != nil && !kind.valid(match) {
+				return match
+			}
+			if placeholder, ok := v.placeholders[match]; ok {
+				return placeholder
+			}
+			v.counts[kind.name]++
+			placeholder := fmt.Sprintf("[%s_%d]", kind.name, v.counts[kind.name])
+			v.placeholders[match] = placeholder
+			v.values[placeholder] = match
+			return placeholder
+		})
+	}
+	return text
+}
+
+func (v *piiVault) restore(text string) string {
+	if len(v.values) == 0 {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, ok := v.values[placeholder]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// restoreStream relays stream with placeholders restored. Text that may be
+// the start of a placeholder split across deltas is held back until the
+// next delta, or the end of the choice.
+func (v *piiVault) restoreStream(stream *provider.StreamReader) *provider.StreamReader {
+	events := make(chan provider.StreamEvent)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(events)
+
+		content := make(map[int]*restorer)
+		arguments := make(map[[2]int]*restorer)
+		send := func(event provider.StreamEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		// flush adds the text held back for choice index to event
+		flush := func(event *provider.StreamEvent, index int) {
+			if r := content[index]; r != nil {
+				event.Delta.Content += r.flush()
+			}
+			for key, r := range arguments {
+				if key[0] == index && r.pending != "" {
+					event.Delta.ToolCalls = append(event.Delta.ToolCalls, provider.ToolCall{
+						Index:    key[1],
+						Function: provider.FunctionCall{Arguments: r.flush()},
+					})
+				}
+			}
+		}
+
+		for event, err := range stream.Events() {
+			if content[event.Index] == nil {
+				content[event.Index] = &restorer{vault: v}
+			}
+			event.Delta.Content = content[event.Index].push(event.Delta.Content)
+			if len(event.Delta.ToolCalls) > 0 {
+				calls := make([]provider.ToolCall, len(event.Delta.ToolCalls))
+				for i, tc := range event.Delta.ToolCalls {
+					key := [2]int{event.Index, tc.Index}
+					if arguments[key] == nil {
+						arguments[key] = &restorer{vault: v}
+					}
+					tc.Function.Arguments = arguments[key].push(tc.Function.Arguments)
+					calls[i] = tc
+				}
+				event.Delta.ToolCalls = calls
+			}
+			if event.FinishReason != "" || err != nil {
+				flush(&event, event.Index)
+			}
+			if !send(event) || err != nil {
+				return
+			}
+		}
+
+		for index := range content {
+			var event provider.StreamEvent
+			event.Index = index
+			flush(&event, index)
+			if event.Delta.Content != "" || len(event.Delta.ToolCalls) > 0 {
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}()
+
+	return provider.NewStreamReader(events, func() {
+		close(done)
+		stream.Close()
+	})
+}
+
+type restorer struct {
+	vault   *piiVault
+	pending string
+}
+
+func (r *restorer) push(text string) string {
+	text = r.pending + text
+	r.pending = ""
+	if i := strings.LastIndexByte(text, '['); i >= 0 && !strings.Contains(text[i:], "]") && len(text)-i < maxPlaceholder {
+		text, r.pending = text[:i], text[i:]
+	}
+	return r.vault.restore(text)
+}
+
+func (r *restorer) flush() string {
+	text := r.pending
+	r.pending = ""
+	return r.vault.restore(text)
+}
@@ -0,0 +1,191 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Func adapts a predicate: content for which fn returns a non-empty reason
+// triggers action.
+func Func(action Action, fn func(content string) string) Validator {
+	return ValidatorFunc(func(ctx context.Context, content string) (Result, error) {
+		if reason := fn(content); reason != "" {
+			return Result{Action: action, Reason: reason, Content: content}, nil
+		}
+		return Result{Action: Allow}, nil
+	})
+}
+
+// Blocklist matches content against regular expressions. With Redact, the
+// matches are replaced by [REDACTED].
+func Blocklist(action Action, patterns ...string) Validator {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		compiled[i] = regexp.MustCompile(p)
+	}
+
+	return ValidatorFunc(func(ctx context.Context, content string) (Result, error) {
+		var matched []string
+		for _, re := range compiled {
+			if re.MatchString(content) {
+				matched = append(matched, re.String())
+				if action == Redact {
+					content = re.ReplaceAllString(content, "[REDACTED]")
+				}
+			}
+		}
+		if len(matched) == 0 {
+			return Result{Action: Allow}, nil
+		}
+		return Result{
+			Action:  action,
+			Reason:  fmt.Sprintf("content matches blocked pattern %s", strings.Join(matched, ", ")),
+			Content: content,
+		}, nil
+	})
+}
+
+// MaxLength limits content to n characters. With Redact, content is
+// truncated instead.
+func MaxLength(action Action, n int) Validator {
+	return ValidatorFunc(func(ctx context.Context, content string) (Result, error) {
+		length := utf8.RuneCountInString(content)
+		if length <= n {
+			return Result{Action: Allow}, nil
+		}
+		return Result{
+			Action:  action,
+			Reason:  fmt.Sprintf("content is %d characters long, the limit is %d", length, n),
+			Content: string([]rune(content)[:n]),
+		}, nil
+	})
+}
+
+type piiKind struct {
+	name    string
+	pattern *regexp.Regexp
+	valid   func(string) bool
+}
+
+var piiKinds = []piiKind{
+	{"EMAIL", regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), nil},
+	{"SSN", regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), nil},
+	{"CREDIT_CARD", regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), luhn},
+	{"PHONE", regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?(?:\(\d{2,4}\)[ .\-]?|\b\d{2,4}[ .\-])\d{3,4}[ .\-]?\d{3,4}\b`), nil},
+}
+
+// PII detects email addresses, phone numbers, US social security numbers
+// and credit card numbers. With Redact, each match is replaced by a
+// placeholder such as [EMAIL].
+func PII(action Action) Validator {
+	return ValidatorFunc(func(ctx context.Context, content string) (Result, error) {
+		var found []string
+		for _, kind := range piiKinds {
+			replaced := kind.pattern.ReplaceAllStringFunc(content, func(match string) string {
+				if kind.valid != nil && !kind.valid(match) {
+					return match
+				}
+				return "[" + kind.name + "]"
+			})
+			if replaced != content {
+				found = append(found, strings.ToLower(kind.name))
+				content = replaced
+			}
+		}
+		if len(found) == 0 {
+			return Result{Action: Allow}, nil
+		}
+		return Result{
+			Action:  action,
+			Reason:  "content contains personal data: " + strings.Join(found, ", "),
+			Content: content,
+		}, nil
+	})
+}
+
+func luhn(number string) bool {
+	var sum, n int
+	for i := len(number) - 1; i >= 0; i-- {
+		r := rune(number[i])
+		if !unicode.IsDigit(r) {
+			continue
+		}
+		d := int(r - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+const judgePrompt = `You are a content moderator. Decide whether the content below complies with this policy:
+
+%s
+
+Reply with ALLOW if it complies. Otherwise reply with BLOCK followed by a short reason.`
+
+// Judge asks a model whether content complies with policy.
+func Judge(p provider.Provider, action Action, policy string) Validator {
+	return ValidatorFunc(func(ctx context.Context, content string) (Result, error) {
+		temperature := 0.0
+		resp, err := p.Chat(ctx, &provider.ChatRequest{
+			Messages: []provider.Message{
+				{Role: provider.RoleSystem, Content: fmt.Sprintf(judgePrompt, policy)},
+				{Role: provider.RoleUser, Content: content},
+			},
+			Temperature: &temperature,
+		})
+		if err != nil {
+			return Result{}, fmt.Errorf("judge request failed: %w", err)
+		}
+		if len(resp.Choices) == 0 {
+			return Result{}, fmt.Errorf("judge returned no choices")
+		}
+
+		verdict := strings.TrimSpace(resp.Choices[0].Message.Content)
+		if strings.HasPrefix(strings.ToUpper(verdict), "ALLOW") {
+			return Result{Action: Allow}, nil
+		}
+
+		reason := strings.TrimSpace(strings.TrimLeft(verdict[min(len(verdict), len("BLOCK")):], ":-"))
+		if reason == "" {
+			reason = "content violates policy"
+		}
+		return Result{Action: action, Reason: reason, Content: content}, nil
+	})
+}
+
+// Moderation screens content with m, triggering action when it is flagged.
+// Use it as an input validator to reject abusive prompts before they reach
+// the chat model.
+func Moderation(m provider.Moderator, action Action) Validator {
+	return ValidatorFunc(func(ctx context.Context, content string) (Result, error) {
+		results, err := m.Moderate(ctx, content)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to moderate content: %w", err)
+		}
+		if len(results) == 0 || !results[0].Flagged {
+			return Result{Action: Allow}, nil
+		}
+
+		categories := results[0].FlaggedCategories()
+		slices.Sort(categories)
+		return Result{
+			Action:  action,
+			Reason:  fmt.Sprintf("content flagged for %s", strings.Join(categories, ", ")),
+			Content: content,
+		}, nil
+	})
+}
@@ -0,0 +1,64 @@
+// Package idle closes response bodies that stop sending data, so that
+// streams over a silently dead connection end instead of hanging.
+package idle
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Reader closes its body when no bytes are read for the timeout. Reads then
+// fail with an error wrapping provider.ErrStreamStalled.
+type Reader struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+}
+
+// Wrap returns body closing after timeout without data, or body itself when
+// timeout is not positive.
+func Wrap(body io.ReadCloser, timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 {
+		return body
+	}
+	return NewReader(body, timeout)
+}
+
+func NewReader(body io.ReadCloser, timeout time.Duration) *Reader {
+	r := &Reader{body: body, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.stalled.Store(true)
+		body.Close()
+	})
+	return r
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if r.stalled.Load() {
+		return n, r.Err()
+	}
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *Reader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
+
+// Err returns the stall error once the body has been closed for inactivity,
+// and nil before.
+func (r *Reader) Err() error {
+	if !r.stalled.Load() {
+		return nil
+	}
+	return fmt.Errorf("%w: no data received for %s", provider.ErrStreamStalled, r.timeout)
+}
@@ -0,0 +1,117 @@
+// Package logging holds the logger of the module, set with ai.SetLogger,
+// and the loggers of its components. Nothing is logged until a logger is
+// set.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// Component is a subsystem logging under its own level.
+type Component string
+
+const (
+	// Provider logs the HTTP requests sent to providers and their retries
+	Provider Component = "provider"
+	// Stream logs the streamed responses of providers
+	Stream Component = "stream"
+	Agent  Component = "agent"
+	Tool   Component = "tool"
+)
+
+var components = []Component{Provider, Stream, Agent, Tool}
+
+var (
+	mu      sync.Mutex
+	base    = slog.New(slog.DiscardHandler)
+	levels  = make(map[Component]slog.Leveler)
+	loggers atomic.Pointer[map[Component]*slog.Logger]
+	wire    atomic.Bool
+)
+
+func init() {
+	rebuild()
+}
+
+// SetLogger sets the logger every component logs to. A nil logger
+// disables logging.
+func SetLogger(logger *slog.Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	base = logger
+	rebuild()
+}
+
+// SetLevel sets the minimum level of the records of component, on top of
+// the level of the logger. A nil level removes it.
+func SetLevel(component Component, level slog.Leveler) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level == nil {
+		delete(levels, component)
+	} else {
+		levels[component] = level
+	}
+	rebuild()
+}
+
+// SetWire toggles the logging of request and response bodies and of stream
+// data, at debug level.
+func SetWire(on bool) {
+	wire.Store(on)
+}
+
+// Wire reports whether bodies are logged.
+func Wire() bool {
+	return wire.Load()
+}
+
+// For returns the logger of component.
+func For(component Component) *slog.Logger {
+	if logger, ok := (*loggers.Load())[component]; ok {
+		return logger
+	}
+	return base.With("component", string(component))
+}
+
+// Enabled reports whether component logs records of level.
+func Enabled(ctx context.Context, component Component, level slog.Level) bool {
+	return For(component).Enabled(ctx, level)
+}
+
+// rebuild derives the logger of every component. mu must be held.
+func rebuild() {
+	m := make(map[Component]*slog.Logger, len(components))
+	for _, c := range components {
+		handler := base.Handler()
+		if level, ok := levels[c]; ok {
+			handler = &levelHandler{Handler: handler, level: level}
+		}
+		m[c] = slog.New(handler).With("component", string(c))
+	}
+	loggers.Store(&m)
+}
+
+// levelHandler drops the records below level.
+type levelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
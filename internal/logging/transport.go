@@ -0,0 +1,176 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// secretHeaders are masked in wire logs.
+var secretHeaders = []string{"Authorization", "Proxy-Authorization", "X-Api-Key", "Api-Key", "X-Goog-Api-Key", "Cookie", "Set-Cookie"}
+
+// secretParams are masked in logged URLs.
+var secretParams = []string{"key", "api_key", "api-key"}
+
+// Client returns a copy of client logging its requests, responses and
+// streams. Providers call it when sending requests, so that a logger set
+// after a provider is created still applies.
+func Client(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if _, ok := client.Transport.(*Transport); ok {
+		return client
+	}
+	logged := *client
+	logged.Transport = &Transport{Base: client.Transport}
+	return &logged
+}
+
+// Transport logs the requests it sends at debug level, and those failing
+// at warn level. Streamed responses are logged by the stream component,
+// once they end.
+type Transport struct {
+	// Base defaults to http.DefaultTransport
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	log := For(Provider)
+	attrs := []any{"method", req.Method, "url", redactURL(req.URL)}
+
+	if Wire() && log.Enabled(ctx, slog.LevelDebug) {
+		wireAttrs := append(attrs, "headers", redactHeaders(req.Header))
+		if req.GetBody != nil {
+			if body, err := req.GetBody(); err == nil {
+				data, _ := io.ReadAll(body)
+				body.Close()
+				wireAttrs = append(wireAttrs, "body", string(data))
+			}
+		}
+		log.DebugContext(ctx, "sending request", wireAttrs...)
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	attrs = append(attrs, "duration", time.Since(start))
+	if err != nil {
+		log.WarnContext(ctx, "request failed", append(attrs, "error", err)...)
+		return nil, err
+	}
+	attrs = append(attrs, "status", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		log.WarnContext(ctx, "request failed", attrs...)
+	} else {
+		log.DebugContext(ctx, "request sent", attrs...)
+	}
+
+	if streaming(resp) {
+		resp.Body = &streamBody{body: resp.Body, ctx: ctx, url: redactURL(req.URL), start: start}
+	} else if Wire() && log.Enabled(ctx, slog.LevelDebug) {
+		data, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		if readErr != nil {
+			resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), errReader{readErr}))
+		}
+		log.DebugContext(ctx, "received response", "url", redactURL(req.URL), "status", resp.StatusCode, "headers", redactHeaders(resp.Header), "body", string(data))
+	}
+	return resp, nil
+}
+
+func streaming(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream" || mediaType == "application/x-ndjson"
+}
+
+// streamBody logs the data of a streamed response as it is read, when wire
+// logging is on, and a summary of the stream when it ends.
+type streamBody struct {
+	body  io.ReadCloser
+	ctx   context.Context
+	url   string
+	start time.Time
+	// bytes is read by end when the body is closed during a Read
+	bytes atomic.Int64
+	once  sync.Once
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.bytes.Add(int64(n))
+	if n > 0 && Wire() {
+		For(Stream).DebugContext(b.ctx, "stream data", "url", b.url, "data", string(p[:n]))
+	}
+	if err != nil {
+		b.end(err)
+	}
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	b.end(nil)
+	return b.body.Close()
+}
+
+// end logs the end of the stream once, with err unless it ended normally
+// or was closed by the reader.
+func (b *streamBody) end(err error) {
+	b.once.Do(func() {
+		attrs := []any{"url", b.url, "bytes", b.bytes.Load(), "duration", time.Since(b.start)}
+		switch {
+		case err == nil:
+			For(Stream).DebugContext(b.ctx, "stream closed", attrs...)
+		case errors.Is(err, io.EOF):
+			For(Stream).DebugContext(b.ctx, "stream ended", attrs...)
+		default:
+			For(Stream).WarnContext(b.ctx, "stream failed", append(attrs, "error", err)...)
+		}
+	})
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for _, param := range secretParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.String()
+	}
+	clone := *u
+	clone.RawQuery = query.Encode()
+	return clone.String()
+}
+
+func redactHeaders(header http.Header) http.Header {
+	header = header.Clone()
+	for _, key := range secretHeaders {
+		if header.Get(key) != "" {
+			header.Set(key, "REDACTED")
+		}
+	}
+	return header
+}
@@ -0,0 +1,428 @@
+// Package openaicompat implements the chat completions protocol shared by
+// OpenAI and the providers that mirror its API.
+package openaicompat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/alexisbouchez/ai/internal/idle"
+	"github.com/alexisbouchez/ai/internal/logging"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/sse"
+)
+
+// Quirks lists where a provider departs from the OpenAI API.
+type Quirks struct {
+	// StreamUsage requests usage in streams with stream_options.include_usage
+	StreamUsage bool
+	// SeedField is the name of the sampling seed field, empty when the
+	// provider has none
+	SeedField string
+	// LogitBias and User forward the fields of the same name
+	LogitBias bool
+	User      bool
+	// ParallelToolCalls forwards parallel_tool_calls
+	ParallelToolCalls bool
+	// ToolResultName sends the function name with tool results
+	ToolResultName bool
+	// IdempotencyKey sends ChatRequest.IdempotencyKey as the Idempotency-Key
+	// header
+	IdempotencyKey bool
+	// Logprobs forwards logprobs and top_logprobs
+	Logprobs bool
+	// WebSearch maps the hosted web search tool to web_search_options
+	WebSearch bool
+}
+
+type Config struct {
+	// System names the API for tracing, e.g. "openai"
+	System  string
+	BaseURL string
+	Model   string
+	// ChatPath defaults to /v1/chat/completions
+	ChatPath string
+	// AuthHeader defaults to Authorization, with AuthPrefix "Bearer "
+	AuthHeader string
+	AuthPrefix string
+	Quirks     Quirks
+	// EmbeddingModel enables Embed; empty when the provider has no
+	// embeddings endpoint
+	EmbeddingModel string
+	// Prepare, when set, adjusts every outgoing request body
+	Prepare func(req *provider.ChatRequest, body *ChatCompletionRequest)
+}
+
+// Client is a provider.Provider speaking the OpenAI chat completions API.
+// Adapters embed it and override the builder methods to return themselves.
+type Client struct {
+	config     Config
+	apiKey     string
+	baseURL    string
+	model      string
+	httpClient *http.Client
+	timeout    time.Duration
+	headers    map[string]string
+}
+
+func New(config Config) *Client {
+	if config.ChatPath == "" {
+		config.ChatPath = "/v1/chat/completions"
+	}
+	if config.AuthHeader == "" {
+		config.AuthHeader = "Authorization"
+		config.AuthPrefix = "Bearer "
+	}
+	return &Client{
+		config:     config,
+		baseURL:    config.BaseURL,
+		model:      config.Model,
+		httpClient: http.DefaultClient,
+	}
+}
+
+func (c *Client) WithAPIKey(key string) provider.Provider {
+	cp := *c
+	cp.apiKey = key
+	return &cp
+}
+
+func (c *Client) WithBaseURL(url string) provider.Provider {
+	cp := *c
+	cp.baseURL = url
+	return &cp
+}
+
+func (c *Client) WithModel(model string) provider.Provider {
+	cp := *c
+	cp.model = model
+	return &cp
+}
+
+func (c *Client) WithHTTPClient(client *http.Client) provider.Provider {
+	cp := *c
+	cp.httpClient = client
+	return &cp
+}
+
+// HTTPClient returns the client requests are sent with.
+func (c *Client) HTTPClient() *http.Client {
+	return c.httpClient
+}
+
+func (c *Client) System() string {
+	return c.config.System
+}
+
+func (c *Client) WithTimeout(timeout time.Duration) provider.Provider {
+	cp := *c
+	cp.timeout = timeout
+	return &cp
+}
+
+func (c *Client) WithHeaders(headers map[string]string) provider.Provider {
+	cp := *c
+	cp.headers = maps.Clone(headers)
+	return &cp
+}
+
+// Model returns the default model.
+func (c *Client) Model() string {
+	return c.model
+}
+
+// client returns the client of non-streaming requests, bounded by the
+// timeout.
+func (c *Client) client() *http.Client {
+	if c.timeout == 0 {
+		return logging.Client(c.httpClient)
+	}
+	client := *c.httpClient
+	client.Timeout = c.timeout
+	return logging.Client(&client)
+}
+
+// streamClient returns the client of streams, which the timeout would cut
+// off; ChatRequest.StreamTimeout bounds them instead.
+func (c *Client) streamClient() *http.Client {
+	return logging.Client(c.httpClient)
+}
+
+func (c *Client) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	start := time.Now()
+	model := req.Model
+	if model == "" {
+		model = c.model
+	}
+
+	chatReq, err := c.Request(req, model)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := c.newRequest(ctx, http.MethodPost, c.config.ChatPath, bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	c.setIdempotencyKey(httpReq, req)
+
+	respBody, header, err := c.send(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	chatResp := c.Response(&resp)
+	chatResp.Timing = provider.NewTiming(start, chatResp.Usage.CompletionTokens, 0)
+	chatResp.RateLimit = provider.ParseRateLimit(header)
+	return chatResp, nil
+}
+
+func (c *Client) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	return provider.ApplyStreamTimeouts(ctx, req, c.stream)
+}
+
+func (c *Client) stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	model := req.Model
+	if model == "" {
+		model = c.model
+	}
+
+	chatReq, err := c.Request(req, model)
+	if err != nil {
+		return nil, err
+	}
+	chatReq.Stream = true
+	if c.config.Quirks.StreamUsage {
+		chatReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := c.newRequest(ctx, http.MethodPost, c.config.ChatPath, bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+	c.setIdempotencyKey(httpReq, req)
+
+	resp, err := c.streamClient().Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, toAPIError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	events := make(chan provider.StreamEvent)
+	stream := provider.NewStreamReader(events, func() { resp.Body.Close() },
+		provider.Buffer(req.StreamBuffer, req.StreamOverflow),
+		provider.ReportRateLimit(provider.ParseRateLimit(resp.Header)),
+	)
+
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		send := func(event provider.StreamEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			case <-stream.Done():
+				return false
+			}
+		}
+
+		reader := sse.NewReader(idle.Wrap(resp.Body, req.StreamIdleTimeout))
+		for {
+			sseEvent, err := reader.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					send(provider.StreamEvent{Err: fmt.Errorf("failed to read stream: %w", err)})
+				}
+				return
+			}
+			if sseEvent.Data == "[DONE]" {
+				return
+			}
+
+			var chunk StreamChunk
+			if err := json.Unmarshal([]byte(sseEvent.Data), &chunk); err != nil {
+				send(provider.StreamEvent{Err: fmt.Errorf("failed to parse chunk: %w", err)})
+				return
+			}
+
+			if len(chunk.Choices) == 0 {
+				if chunk.Usage != nil && !send(provider.StreamEvent{Usage: chunk.Usage.toProvider()}) {
+					return
+				}
+				continue
+			}
+
+			for i, choice := range chunk.Choices {
+				event := provider.StreamEvent{
+					Index: choice.Index,
+					Delta: provider.Delta{
+						Content:   choice.Delta.Content,
+						ToolCalls: toProviderToolCalls(choice.Delta.ToolCalls),
+					},
+					FinishReason: choice.FinishReason,
+				}
+				if chunk.Usage != nil && i == len(chunk.Choices)-1 {
+					event.Usage = chunk.Usage.toProvider()
+				}
+
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}()
+
+	return stream, nil
+}
+
+// Do sends an authenticated request to path and returns the response body,
+// or an *provider.APIError for non-2xx statuses.
+func (c *Client) Do(ctx context.Context, method, path string, body io.Reader, contentType string) ([]byte, error) {
+	httpReq, err := c.newRequest(ctx, method, path, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	respBody, _, err := c.send(httpReq)
+	return respBody, err
+}
+
+// send returns the body and the headers of the response to httpReq.
+func (c *Client) send(httpReq *http.Request) ([]byte, http.Header, error) {
+	resp, err := c.client().Do(httpReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, toAPIError(resp.StatusCode, resp.Header, respBody)
+	}
+	return respBody, resp.Header, nil
+}
+
+func (c *Client) setIdempotencyKey(httpReq *http.Request, req *provider.ChatRequest) {
+	if c.config.Quirks.IdempotencyKey && req.IdempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", req.IdempotencyKey)
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		httpReq.Header.Set(c.config.AuthHeader, c.config.AuthPrefix+c.apiKey)
+	}
+	for k, v := range c.headers {
+		httpReq.Header.Set(k, v)
+	}
+	provider.ApplyContext(httpReq)
+	return httpReq, nil
+}
+
+// toAPIError parses both the OpenAI error envelope and the flat error
+// objects some compatible providers return.
+func toAPIError(statusCode int, header http.Header, body []byte) error {
+	apiErr := &provider.APIError{StatusCode: statusCode, Body: string(body), RateLimit: provider.ParseRateLimit(header)}
+
+	var errResp struct {
+		Error *struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	}
+	if json.Unmarshal(body, &errResp) != nil {
+		return apiErr
+	}
+	if errResp.Error != nil {
+		apiErr.Type = errResp.Error.Type
+		apiErr.Message = errResp.Error.Message
+	} else {
+		apiErr.Type = errResp.Type
+		apiErr.Message = errResp.Message
+	}
+	return apiErr
+}
+
+// Embed returns the embedding of every text, in order.
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if c.config.EmbeddingModel == "" {
+		return nil, errors.New("provider does not support embeddings")
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"model": c.config.EmbeddingModel,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := c.Do(ctx, http.MethodPost, "/v1/embeddings", bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index >= 0 && d.Index < len(embeddings) {
+			embeddings[d.Index] = d.Embedding
+		}
+	}
+	return embeddings, nil
+}
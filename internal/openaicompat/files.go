@@ -0,0 +1,113 @@
+package openaicompat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// fileObject covers the file objects of OpenAI and Mistral, which names the
+// size size_bytes.
+type fileObject struct {
+	ID        string `json:"id"`
+	Filename  string `json:"filename"`
+	Bytes     int64  `json:"bytes"`
+	SizeBytes int64  `json:"size_bytes"`
+	Purpose   string `json:"purpose"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func (f *fileObject) toProvider() provider.File {
+	size := f.Bytes
+	if size == 0 {
+		size = f.SizeBytes
+	}
+	return provider.File{
+		ID:        f.ID,
+		Filename:  f.Filename,
+		Bytes:     size,
+		Purpose:   f.Purpose,
+		CreatedAt: time.Unix(f.CreatedAt, 0),
+	}
+}
+
+// UploadFile, ListFiles, GetFile, DeleteFile and FileContent implement the
+// /v1/files endpoints. Adapters of providers that have them expose them as
+// a provider.FileStore.
+
+func (c *Client) UploadFile(ctx context.Context, filename, purpose string, content io.Reader) (*provider.File, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("purpose", purpose); err != nil {
+		return nil, fmt.Errorf("failed to build upload: %w", err)
+	}
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build upload: %w", err)
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return nil, fmt.Errorf("failed to build upload: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build upload: %w", err)
+	}
+
+	respBody, err := c.Do(ctx, http.MethodPost, "/v1/files", &body, w.FormDataContentType())
+	if err != nil {
+		return nil, err
+	}
+	return toFile(respBody)
+}
+
+func (c *Client) ListFiles(ctx context.Context) ([]provider.File, error) {
+	respBody, err := c.Do(ctx, http.MethodGet, "/v1/files", nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data []fileObject `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	files := make([]provider.File, len(resp.Data))
+	for i := range resp.Data {
+		files[i] = resp.Data[i].toProvider()
+	}
+	return files, nil
+}
+
+func (c *Client) GetFile(ctx context.Context, id string) (*provider.File, error) {
+	respBody, err := c.Do(ctx, http.MethodGet, "/v1/files/"+url.PathEscape(id), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return toFile(respBody)
+}
+
+func (c *Client) DeleteFile(ctx context.Context, id string) error {
+	_, err := c.Do(ctx, http.MethodDelete, "/v1/files/"+url.PathEscape(id), nil, "")
+	return err
+}
+
+func (c *Client) FileContent(ctx context.Context, id string) ([]byte, error) {
+	return c.Do(ctx, http.MethodGet, "/v1/files/"+url.PathEscape(id)+"/content", nil, "")
+}
+
+func toFile(data []byte) (*provider.File, error) {
+	var f fileObject
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	file := f.toProvider()
+	return &file, nil
+}
@@ -0,0 +1,483 @@
+package openaicompat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/alexisbouchez/ai/internal/passthrough"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/sse"
+)
+
+// responsesRequest is a request of the Responses API, which runs in the
+// background when Background is set.
+type responsesRequest struct {
+	Model             string           `json:"model"`
+	Input             []any            `json:"input"`
+	Tools             []map[string]any `json:"tools,omitempty"`
+	ToolChoice        any              `json:"tool_choice,omitempty"`
+	Temperature       *float64         `json:"temperature,omitempty"`
+	TopP              *float64         `json:"top_p,omitempty"`
+	MaxOutputTokens   *int             `json:"max_output_tokens,omitempty"`
+	ParallelToolCalls *bool            `json:"parallel_tool_calls,omitempty"`
+	User              string           `json:"user,omitempty"`
+	Background        bool             `json:"background,omitempty"`
+	Store             bool             `json:"store"`
+}
+
+type responseObject struct {
+	ID                string            `json:"id"`
+	Object            string            `json:"object"`
+	CreatedAt         int64             `json:"created_at"`
+	Model             string            `json:"model"`
+	Status            string            `json:"status"`
+	Output            []json.RawMessage `json:"output"`
+	Usage             *responseUsage    `json:"usage"`
+	Error             *responseError    `json:"error"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+}
+
+type responseItem struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Role      string `json:"role"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Content   []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+type responseUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	OutputTokens       int `json:"output_tokens"`
+	TotalTokens        int `json:"total_tokens"`
+	InputTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+}
+
+type responseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// responseEvent is an event of a Responses API stream.
+type responseEvent struct {
+	Type        string          `json:"type"`
+	OutputIndex int             `json:"output_index"`
+	Delta       string          `json:"delta"`
+	Item        json.RawMessage `json:"item"`
+	Response    *responseObject `json:"response"`
+	Code        string          `json:"code"`
+	Message     string          `json:"message"`
+}
+
+// BackgroundResponse submits req to the Responses API in background mode
+// and returns the handle of the job.
+func (c *Client) BackgroundResponse(ctx context.Context, req *provider.ChatRequest) (provider.JobHandle, error) {
+	model := req.Model
+	if model == "" {
+		model = c.model
+	}
+	if err := provider.ValidateParts(req.Messages); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(toResponsesRequest(req, model))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	if body, err = passthrough.Merge(body, req.ProviderOptions); err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := c.newRequest(ctx, http.MethodPost, "/v1/responses", bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	c.setIdempotencyKey(httpReq, req)
+	respBody, _, err := c.send(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp responseObject
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return c.ResponseJob(resp.ID), nil
+}
+
+// ResponseJob returns the handle of the background response id.
+func (c *Client) ResponseJob(id string) provider.JobHandle {
+	return &responseJob{client: c, id: id}
+}
+
+type responseJob struct {
+	client *Client
+	id     string
+}
+
+func (j *responseJob) ID() string {
+	return j.id
+}
+
+func (j *responseJob) Poll(ctx context.Context) (provider.JobStatus, *provider.ChatResponse, error) {
+	respBody, err := j.client.Do(ctx, http.MethodGet, "/v1/responses/"+j.id, nil, "")
+	if err != nil {
+		return "", nil, err
+	}
+	var resp responseObject
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	status := toJobStatus(resp.Status)
+	switch status {
+	case provider.JobCompleted:
+		return status, resp.toProvider(), nil
+	case provider.JobFailed:
+		return status, nil, resp.Error.toProvider()
+	case provider.JobCancelled:
+		return status, nil, provider.ErrJobCancelled
+	}
+	return status, nil, nil
+}
+
+func (j *responseJob) Cancel(ctx context.Context) error {
+	_, err := j.client.Do(ctx, http.MethodPost, "/v1/responses/"+j.id+"/cancel", nil, "")
+	return err
+}
+
+func (j *responseJob) Stream(ctx context.Context) (*provider.StreamReader, error) {
+	httpReq, err := j.client.newRequest(ctx, http.MethodGet, "/v1/responses/"+j.id+"?stream=true", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := j.client.streamClient().Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, toAPIError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	events := make(chan provider.StreamEvent)
+	stream := provider.NewStreamReader(events, func() { resp.Body.Close() },
+		provider.ReportRateLimit(provider.ParseRateLimit(resp.Header)),
+	)
+
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		send := func(event provider.StreamEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			case <-stream.Done():
+				return false
+			}
+		}
+
+		// function calls are indexed among the tool calls, not the output
+		toolIndex := make(map[int]int)
+		reader := sse.NewReader(resp.Body)
+		for {
+			sseEvent, err := reader.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					send(provider.StreamEvent{Err: fmt.Errorf("failed to read stream: %w", err)})
+				}
+				return
+			}
+
+			var event responseEvent
+			if err := json.Unmarshal([]byte(sseEvent.Data), &event); err != nil {
+				send(provider.StreamEvent{Err: fmt.Errorf("failed to parse event: %w", err)})
+				return
+			}
+
+			switch event.Type {
+			case "response.output_text.delta":
+				if !send(provider.StreamEvent{Delta: provider.Delta{Content: event.Delta}}) {
+					return
+				}
+			case "response.output_item.added":
+				var item responseItem
+				if json.Unmarshal(event.Item, &item) != nil || item.Type != "function_call" {
+					continue
+				}
+				index := len(toolIndex)
+				toolIndex[event.OutputIndex] = index
+				call := provider.ToolCall{
+					ID:       item.CallID,
+					Type:     "function",
+					Index:    index,
+					Function: provider.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+				}
+				if !send(provider.StreamEvent{Delta: provider.Delta{ToolCalls: []provider.ToolCall{call}}}) {
+					return
+				}
+			case "response.function_call_arguments.delta":
+				call := provider.ToolCall{
+					Index:    toolIndex[event.OutputIndex],
+					Function: provider.FunctionCall{Arguments: event.Delta},
+				}
+				if !send(provider.StreamEvent{Delta: provider.Delta{ToolCalls: []provider.ToolCall{call}}}) {
+					return
+				}
+			case "response.output_item.done":
+				hosted, ok := toHostedToolUse(event.Item)
+				if ok && !send(provider.StreamEvent{Delta: provider.Delta{HostedTools: []provider.HostedToolUse{hosted}}}) {
+					return
+				}
+			case "response.completed", "response.incomplete":
+				if event.Response == nil {
+					send(provider.StreamEvent{Err: fmt.Errorf("%s event has no response", event.Type)})
+					return
+				}
+				chatResp := event.Response.toProvider()
+				send(provider.StreamEvent{FinishReason: chatResp.Choices[0].FinishReason, Usage: &chatResp.Usage})
+				return
+			case "response.failed":
+				var respErr *responseError
+				if event.Response != nil {
+					respErr = event.Response.Error
+				}
+				send(provider.StreamEvent{Err: respErr.toProvider()})
+				return
+			case "response.cancelled":
+				send(provider.StreamEvent{Err: provider.ErrJobCancelled})
+				return
+			case "error":
+				send(provider.StreamEvent{Err: &provider.APIError{Type: event.Code, Message: event.Message}})
+				return
+			}
+		}
+	}()
+
+	return stream, nil
+}
+
+func toResponsesRequest(req *provider.ChatRequest, model string) *responsesRequest {
+	var input []any
+	for _, msg := range req.Messages {
+		switch {
+		case msg.Role == provider.RoleTool:
+			input = append(input, map[string]any{
+				"type":    "function_call_output",
+				"call_id": msg.ToolCallID,
+				"output":  msg.Text(),
+			})
+			continue
+		case len(msg.Parts) > 0:
+			input = append(input, map[string]any{"role": msg.Role, "content": toResponseParts(msg)})
+		case msg.Content != "":
+			input = append(input, map[string]any{"role": msg.Role, "content": msg.Content})
+		}
+		for _, tc := range msg.ToolCalls {
+			input = append(input, map[string]any{
+				"type":      "function_call",
+				"call_id":   tc.ID,
+				"name":      tc.Function.Name,
+				"arguments": tc.Function.Arguments,
+			})
+		}
+	}
+
+	var tools []map[string]any
+	for _, t := range req.Tools {
+		tool := map[string]any{"type": t.Type}
+		switch t.Type {
+		case "function":
+			tool["name"] = t.Function.Name
+			tool["parameters"] = t.Function.Parameters
+			tool["strict"] = t.Function.Strict
+			if t.Function.Description != "" {
+				tool["description"] = t.Function.Description
+			}
+		case provider.ToolCodeInterpreter:
+			tool["container"] = map[string]any{"type": "auto"}
+		}
+		for k, v := range t.Options {
+			tool[k] = v
+		}
+		tools = append(tools, tool)
+	}
+
+	var toolChoice any
+	if choice := req.ToolChoice; choice != nil {
+		switch choice.Type {
+		case "function":
+			toolChoice = map[string]any{"type": "function", "name": choice.Function}
+		case "any":
+			toolChoice = "required"
+		default:
+			toolChoice = choice.Type
+		}
+	}
+
+	responsesReq := &responsesRequest{
+		Model:           model,
+		Input:           input,
+		Tools:           tools,
+		ToolChoice:      toolChoice,
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+		MaxOutputTokens: req.MaxTokens,
+		User:            req.User,
+		Background:      true,
+		// background responses must be stored to be retrieved
+		Store: true,
+	}
+	if len(tools) > 0 {
+		responsesReq.ParallelToolCalls = req.ParallelToolCalls
+	}
+	return responsesReq
+}
+
+func toResponseParts(msg provider.Message) []map[string]any {
+	textType := "input_text"
+	if msg.Role == provider.RoleAssistant {
+		textType = "output_text"
+	}
+
+	var parts []map[string]any
+	if msg.Content != "" {
+		parts = append(parts, map[string]any{"type": textType, "text": msg.Content})
+	}
+	for _, part := range msg.Parts {
+		switch part.Type {
+		case provider.PartImage:
+			parts = append(parts, map[string]any{"type": "input_image", "image_url": part.Image.DataURL()})
+		case provider.PartDocument:
+			doc := part.Document
+			if doc.FileID != "" {
+				parts = append(parts, map[string]any{"type": "input_file", "file_id": doc.FileID})
+			} else {
+				parts = append(parts, map[string]any{"type": "input_file", "file_data": doc.DataURL(), "filename": documentFilename(doc)})
+			}
+		case provider.PartJSON:
+			parts = append(parts, map[string]any{"type": textType, "text": string(part.JSON)})
+		default:
+			parts = append(parts, map[string]any{"type": textType, "text": part.Text})
+		}
+	}
+	return parts
+}
+
+func toJobStatus(status string) provider.JobStatus {
+	switch status {
+	case "queued":
+		return provider.JobQueued
+	case "in_progress":
+		return provider.JobRunning
+	case "completed", "incomplete":
+		return provider.JobCompleted
+	case "failed":
+		return provider.JobFailed
+	case "cancelled":
+		return provider.JobCancelled
+	}
+	return provider.JobStatus(status)
+}
+
+func (r *responseObject) toProvider() *provider.ChatResponse {
+	msg := provider.Message{Role: provider.RoleAssistant}
+	var text strings.Builder
+	for _, raw := range r.Output {
+		var item responseItem
+		if err := json.Unmarshal(raw, &item); err != nil {
+			continue
+		}
+		switch item.Type {
+		case "message":
+			for _, content := range item.Content {
+				if content.Type == "output_text" {
+					text.WriteString(content.Text)
+				}
+			}
+		case "function_call":
+			msg.ToolCalls = append(msg.ToolCalls, provider.ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Index:    len(msg.ToolCalls),
+				Function: provider.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			})
+		default:
+			if hosted, ok := toHostedToolUse(raw); ok {
+				msg.HostedTools = append(msg.HostedTools, hosted)
+			}
+		}
+	}
+	msg.Content = text.String()
+
+	finishReason := provider.FinishReasonStop
+	switch {
+	case len(msg.ToolCalls) > 0:
+		finishReason = provider.FinishReasonToolCalls
+	case r.IncompleteDetails != nil && r.IncompleteDetails.Reason == "max_output_tokens":
+		finishReason = provider.FinishReasonLength
+	case r.IncompleteDetails != nil && r.IncompleteDetails.Reason == "content_filter":
+		finishReason = provider.FinishReasonContentFilter
+	}
+
+	resp := &provider.ChatResponse{
+		ID:      r.ID,
+		Object:  r.Object,
+		Created: r.CreatedAt,
+		Model:   r.Model,
+		Choices: []provider.Choice{{Message: msg, FinishReason: finishReason}},
+	}
+	if u := r.Usage; u != nil {
+		resp.Usage = provider.Usage{
+			PromptTokens:     u.InputTokens,
+			CompletionTokens: u.OutputTokens,
+			TotalTokens:      u.TotalTokens,
+		}
+		if u.InputTokensDetails != nil {
+			resp.Usage.CachedTokens = u.InputTokensDetails.CachedTokens
+		}
+	}
+	return resp
+}
+
+// toHostedToolUse returns the output item raw as the call of a hosted tool,
+// such as web_search_call or code_interpreter_call.
+func toHostedToolUse(raw json.RawMessage) (provider.HostedToolUse, bool) {
+	var item responseItem
+	if err := json.Unmarshal(raw, &item); err != nil || !strings.HasSuffix(item.Type, "_call") || item.Type == "function_call" {
+		return provider.HostedToolUse{}, false
+	}
+	return provider.HostedToolUse{
+		ID:     item.ID,
+		Name:   strings.TrimSuffix(item.Type, "_call"),
+		Result: raw,
+	}, true
+}
+
+func (e *responseError) toProvider() error {
+	if e == nil {
+		return &provider.APIError{Message: "response failed"}
+	}
+	return &provider.APIError{Type: e.Code, Message: e.Message}
+}
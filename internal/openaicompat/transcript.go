@@ -0,0 +1,144 @@
+package openaicompat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// nativeMessage is a message of a chat completions request, whose content
+// is a string or content parts.
+type nativeMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []ToolCall      `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+	Name       string          `json:"name"`
+	Audio      *Audio          `json:"audio"`
+}
+
+// ImportMessages converts the messages array of a chat completions
+// request, or a request holding one, to messages. Developer messages
+// become system messages.
+func ImportMessages(data []byte) ([]provider.Message, error) {
+	var native []nativeMessage
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &native); err != nil {
+			return nil, fmt.Errorf("invalid messages: %w", err)
+		}
+	} else {
+		var req struct {
+			Messages []nativeMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, fmt.Errorf("invalid messages: %w", err)
+		}
+		native = req.Messages
+	}
+
+	messages := make([]provider.Message, len(native))
+	for i, m := range native {
+		msg := provider.Message{
+			Role:       provider.Role(m.Role),
+			ToolCallID: m.ToolCallID,
+			Name:       m.Name,
+			ToolCalls:  toProviderToolCalls(m.ToolCalls),
+		}
+		if m.Role == "developer" {
+			msg.Role = provider.RoleSystem
+		}
+		if m.Audio != nil {
+			msg.Audio = &provider.Audio{ID: m.Audio.ID, Data: m.Audio.Data, Transcript: m.Audio.Transcript}
+		}
+		if err := parseNativeContent(&msg, m.Content); err != nil {
+			return nil, fmt.Errorf("invalid message %d: %w", i, err)
+		}
+		messages[i] = msg
+	}
+	return messages, nil
+}
+
+// ExportMessages converts messages to the messages array of a chat
+// completions request.
+func (c *Client) ExportMessages(messages []provider.Message) ([]byte, error) {
+	chatReq, err := c.Request(&provider.ChatRequest{Messages: messages}, "")
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(chatReq.Messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal messages: %w", err)
+	}
+	return data, nil
+}
+
+// parseNativeContent sets the content of msg from a string or content
+// parts, the first text part becoming its Content.
+func parseNativeContent(msg *provider.Message, raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if json.Unmarshal(raw, &msg.Content) == nil {
+		return nil
+	}
+	var parts []ContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		switch p.Type {
+		case "text":
+			if msg.Content == "" && len(msg.Parts) == 0 {
+				msg.Content = p.Text
+			} else {
+				msg.Parts = append(msg.Parts, provider.TextPart(p.Text))
+			}
+		case "image_url":
+			if p.ImageURL == nil {
+				return fmt.Errorf("image part without URL")
+			}
+			image := &provider.Image{URL: p.ImageURL.URL}
+			if mediaType, data, ok := parseDataURL(p.ImageURL.URL); ok {
+				image = &provider.Image{Data: data, MediaType: mediaType}
+			}
+			msg.Parts = append(msg.Parts, provider.Part{Type: provider.PartImage, Image: image})
+		case "input_audio":
+			if p.InputAudio == nil {
+				return fmt.Errorf("audio part without data")
+			}
+			msg.Parts = append(msg.Parts, provider.Part{
+				Type:  provider.PartAudio,
+				Audio: &provider.Audio{Data: p.InputAudio.Data, Format: p.InputAudio.Format},
+			})
+		case "file":
+			if p.File == nil {
+				return fmt.Errorf("file part without file")
+			}
+			doc := &provider.Document{FileID: p.File.FileID, Filename: p.File.Filename}
+			if mediaType, data, ok := parseDataURL(p.File.FileData); ok {
+				doc.Data, doc.MediaType = data, mediaType
+			}
+			msg.Parts = append(msg.Parts, provider.Part{Type: provider.PartDocument, Document: doc})
+		default:
+			return fmt.Errorf("unsupported content part: %s", p.Type)
+		}
+	}
+	return nil
+}
+
+// parseDataURL splits a base64 data URL into its media type and data.
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	header, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mediaType, ok = strings.CutSuffix(header, ";base64")
+	return mediaType, data, ok
+}
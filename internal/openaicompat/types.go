@@ -0,0 +1,524 @@
+package openaicompat
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+
+	"github.com/alexisbouchez/ai/internal/passthrough"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type ChatCompletionRequest struct {
+	Model             string         `json:"model,omitempty"`
+	Messages          []any          `json:"messages"`
+	Temperature       *float64       `json:"temperature,omitempty"`
+	TopP              *float64       `json:"top_p,omitempty"`
+	MaxTokens         *int           `json:"max_tokens,omitempty"`
+	Stream            bool           `json:"stream,omitempty"`
+	StreamOptions     *StreamOptions `json:"stream_options,omitempty"`
+	Stop              []string       `json:"stop,omitempty"`
+	Seed              *int           `json:"seed,omitempty"`
+	RandomSeed        *int           `json:"random_seed,omitempty"`
+	Tools             []Tool         `json:"tools,omitempty"`
+	ToolChoice        any            `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool          `json:"parallel_tool_calls,omitempty"`
+	PresencePenalty   *float64       `json:"presence_penalty,omitempty"`
+	FrequencyPenalty  *float64       `json:"frequency_penalty,omitempty"`
+	N                 *int           `json:"n,omitempty"`
+	LogitBias         map[string]int `json:"logit_bias,omitempty"`
+	User              string         `json:"user,omitempty"`
+	Logprobs          bool           `json:"logprobs,omitempty"`
+	TopLogprobs       *int           `json:"top_logprobs,omitempty"`
+	WebSearchOptions  any            `json:"web_search_options,omitempty"`
+	// Extra holds provider-specific fields merged into the request body
+	Extra map[string]any `json:"-"`
+	// Options holds ChatRequest.ProviderOptions, which replace any field
+	Options map[string]any `json:"-"`
+}
+
+func (r *ChatCompletionRequest) MarshalJSON() ([]byte, error) {
+	type plain ChatCompletionRequest
+	data, err := json.Marshal((*plain)(r))
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Extra) == 0 {
+		return passthrough.Merge(data, r.Options)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range r.Extra {
+		if _, ok := fields[k]; ok {
+			return nil, fmt.Errorf("extra field %q overrides a request field", k)
+		}
+		fields[k] = v
+	}
+	for k, v := range r.Options {
+		fields[k] = v
+	}
+	return json.Marshal(fields)
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type Message struct {
+	Role       string     `json:"role"`
+	Content    *string    `json:"content,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Audio      *Audio     `json:"audio,omitempty"`
+}
+
+// PartsMessage is a message with multimodal content.
+type PartsMessage struct {
+	Role    string        `json:"role"`
+	Content []ContentPart `json:"content"`
+	Name    string        `json:"name,omitempty"`
+}
+
+type ContentPart struct {
+	Type       string      `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	File       *FileInput  `json:"file,omitempty"`
+	// DocumentURL and DocumentName carry documents for Mistral
+	DocumentURL  string `json:"document_url,omitempty"`
+	DocumentName string `json:"document_name,omitempty"`
+}
+
+// FileInput is a document, inlined as a data URL or referencing an
+// uploaded file.
+type FileInput struct {
+	FileData string `json:"file_data,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+type ImageURL struct {
+	URL string `json:"url"`
+}
+
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+type Audio struct {
+	ID         string `json:"id"`
+	Data       string `json:"data,omitempty"`
+	ExpiresAt  int64  `json:"expires_at,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
+}
+
+type ToolResultMessage struct {
+	Role       string `json:"role"`
+	Content    string `json:"content"`
+	ToolCallID string `json:"tool_call_id"`
+	Name       string `json:"name,omitempty"`
+}
+
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+	Index    int          `json:"index,omitempty"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type Tool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+type Function struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters"`
+	Strict      bool           `json:"strict,omitempty"`
+}
+
+type ChatCompletionResponse struct {
+	ID                string   `json:"id"`
+	Provider          string   `json:"provider,omitempty"`
+	SystemFingerprint string   `json:"system_fingerprint,omitempty"`
+	Object            string   `json:"object"`
+	Created           int64    `json:"created"`
+	Model             string   `json:"model"`
+	Choices           []Choice `json:"choices"`
+	Usage             Usage    `json:"usage"`
+	// Metadata holds the response fields not declared above
+	Metadata map[string]any `json:"-"`
+}
+
+func (r *ChatCompletionResponse) UnmarshalJSON(data []byte) error {
+	type plain ChatCompletionResponse
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.Metadata = passthrough.Unknown(data, r)
+	return nil
+}
+
+type Choice struct {
+	Index        int                `json:"index"`
+	Message      Message            `json:"message"`
+	FinishReason string             `json:"finish_reason"`
+	Logprobs     *provider.Logprobs `json:"logprobs,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens        int                  `json:"prompt_tokens"`
+	CompletionTokens    int                  `json:"completion_tokens"`
+	TotalTokens         int                  `json:"total_tokens"`
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type StreamChunk struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []StreamChoice `json:"choices"`
+	Usage   *Usage         `json:"usage,omitempty"`
+}
+
+type StreamChoice struct {
+	Index        int          `json:"index"`
+	Delta        DeltaMessage `json:"delta"`
+	FinishReason string       `json:"finish_reason"`
+}
+
+type DeltaMessage struct {
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// Request converts req to the wire format, applying the client quirks. The
+// chat completions API hosts no tools besides web search, where the quirk
+// enables it, so other hosted tools are rejected.
+func (c *Client) Request(req *provider.ChatRequest, model string) (*ChatCompletionRequest, error) {
+	if err := provider.ValidateParts(req.Messages); err != nil {
+		return nil, err
+	}
+	quirks := c.config.Quirks
+
+	messages := make([]any, 0, len(req.Messages))
+	// Tool messages only take text, so images returned by tools follow the
+	// tool results of the turn in a user message
+	var toolImages []ContentPart
+	for i, msg := range req.Messages {
+		if msg.Role == provider.RoleTool {
+			result := ToolResultMessage{
+				Role:       string(msg.Role),
+				Content:    msg.Text(),
+				ToolCallID: msg.ToolCallID,
+			}
+			if quirks.ToolResultName {
+				result.Name = msg.Name
+			}
+			messages = append(messages, result)
+
+			for _, part := range msg.Parts {
+				if part.Type == provider.PartImage {
+					toolImages = append(toolImages, toContentPart(part))
+				}
+			}
+			next := i + 1
+			if len(toolImages) > 0 && (next == len(req.Messages) || req.Messages[next].Role != provider.RoleTool) {
+				messages = append(messages, PartsMessage{
+					Role:    string(provider.RoleUser),
+					Content: append([]ContentPart{{Type: "text", Text: "Images returned by the tools:"}}, toolImages...),
+				})
+				toolImages = nil
+			}
+			continue
+		}
+
+		if len(msg.Parts) > 0 {
+			messages = append(messages, PartsMessage{
+				Role:    string(msg.Role),
+				Content: toContentParts(msg),
+				Name:    msg.Name,
+			})
+			continue
+		}
+
+		var content *string
+		if msg.Content != "" {
+			content = &msg.Content
+		}
+
+		var audio *Audio
+		if msg.Audio != nil && msg.Audio.ID != "" {
+			audio = &Audio{ID: msg.Audio.ID}
+		}
+
+		messages = append(messages, Message{
+			Role:       string(msg.Role),
+			Content:    content,
+			ToolCalls:  toToolCalls(msg.ToolCalls),
+			ToolCallID: msg.ToolCallID,
+			Name:       msg.Name,
+			Audio:      audio,
+		})
+	}
+
+	var tools []Tool
+	var webSearch map[string]any
+	for _, t := range req.Tools {
+		if t.Type == provider.ToolWebSearch && quirks.WebSearch {
+			webSearch = t.Options
+			if webSearch == nil {
+				webSearch = map[string]any{}
+			}
+			continue
+		}
+		switch t.Type {
+		case provider.ToolWebSearch, provider.ToolFileSearch, provider.ToolCodeInterpreter:
+			return nil, fmt.Errorf("the %s tool is not supported by chat completions", t.Type)
+		}
+		tools = append(tools, Tool{
+			Type: t.Type,
+			Function: Function{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  t.Function.Parameters,
+				Strict:      t.Function.Strict,
+			},
+		})
+	}
+
+	var toolChoice any
+	if req.ToolChoice != nil {
+		toolChoice = toToolChoice(req.ToolChoice)
+	}
+
+	chatReq := &ChatCompletionRequest{
+		Model:            model,
+		Messages:         messages,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		MaxTokens:        req.MaxTokens,
+		Stream:           req.Stream,
+		Stop:             req.Stop,
+		Tools:            tools,
+		ToolChoice:       toolChoice,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		N:                req.N,
+		Options:          req.ProviderOptions,
+	}
+
+	// An empty object enables search, so only set the field when present
+	if webSearch != nil {
+		chatReq.WebSearchOptions = webSearch
+	}
+
+	switch quirks.SeedField {
+	case "seed":
+		chatReq.Seed = req.RandomSeed
+	case "random_seed":
+		chatReq.RandomSeed = req.RandomSeed
+	}
+	// parallel_tool_calls is rejected on requests without tools
+	if quirks.ParallelToolCalls && len(tools) > 0 {
+		chatReq.ParallelToolCalls = req.ParallelToolCalls
+	}
+	if quirks.LogitBias {
+		chatReq.LogitBias = req.LogitBias
+	}
+	if quirks.User {
+		chatReq.User = req.User
+	}
+	if quirks.Logprobs {
+		chatReq.Logprobs = req.Logprobs
+		chatReq.TopLogprobs = req.TopLogprobs
+	}
+	if c.config.Prepare != nil {
+		c.config.Prepare(req, chatReq)
+	}
+
+	return chatReq, nil
+}
+
+// Response converts a chat completion to the provider format.
+func (c *Client) Response(resp *ChatCompletionResponse) *provider.ChatResponse {
+	choices := make([]provider.Choice, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		var content string
+		if choice.Message.Content != nil {
+			content = *choice.Message.Content
+		}
+
+		toolCalls := toProviderToolCalls(choice.Message.ToolCalls)
+		for j := range toolCalls {
+			if toolCalls[j].Type == "" {
+				toolCalls[j].Type = "function"
+			}
+		}
+
+		var audio *provider.Audio
+		if a := choice.Message.Audio; a != nil {
+			audio = &provider.Audio{ID: a.ID, Data: a.Data, Transcript: a.Transcript}
+		}
+
+		choices[i] = provider.Choice{
+			Index: choice.Index,
+			Message: provider.Message{
+				Role:       provider.Role(choice.Message.Role),
+				Content:    content,
+				ToolCalls:  toolCalls,
+				ToolCallID: choice.Message.ToolCallID,
+				Name:       choice.Message.Name,
+				Audio:      audio,
+			},
+			FinishReason: choice.FinishReason,
+			Logprobs:     choice.Logprobs,
+		}
+	}
+
+	return &provider.ChatResponse{
+		ID:                resp.ID,
+		Provider:          resp.Provider,
+		SystemFingerprint: resp.SystemFingerprint,
+		Object:            resp.Object,
+		Created:           resp.Created,
+		Model:             resp.Model,
+		Choices:           choices,
+		Usage:             *resp.Usage.toProvider(),
+
+		ProviderMetadata: resp.Metadata,
+	}
+}
+
+func toContentParts(msg provider.Message) []ContentPart {
+	var parts []ContentPart
+	if msg.Content != "" {
+		parts = append(parts, ContentPart{Type: "text", Text: msg.Content})
+	}
+	for _, part := range msg.Parts {
+		parts = append(parts, toContentPart(part))
+	}
+	return parts
+}
+
+func toContentPart(part provider.Part) ContentPart {
+	switch part.Type {
+	case provider.PartAudio:
+		return ContentPart{
+			Type:       "input_audio",
+			InputAudio: &InputAudio{Data: part.Audio.Data, Format: part.Audio.Format},
+		}
+	case provider.PartImage:
+		return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: part.Image.DataURL()}}
+	case provider.PartJSON:
+		return ContentPart{Type: "text", Text: string(part.JSON)}
+	case provider.PartDocument:
+		doc := part.Document
+		if doc.FileID != "" {
+			return ContentPart{Type: "file", File: &FileInput{FileID: doc.FileID}}
+		}
+		return ContentPart{Type: "file", File: &FileInput{FileData: doc.DataURL(), Filename: documentFilename(doc)}}
+	default:
+		return ContentPart{Type: "text", Text: part.Text}
+	}
+}
+
+// documentFilename returns the filename of doc, which the API requires for
+// inline documents, deriving one from the media type when it has none.
+func documentFilename(doc *provider.Document) string {
+	if doc.Filename != "" {
+		return doc.Filename
+	}
+	switch doc.MediaType {
+	case "application/pdf":
+		return "document.pdf"
+	case "text/plain":
+		return "document.txt"
+	}
+	if exts, _ := mime.ExtensionsByType(doc.MediaType); len(exts) > 0 {
+		return "document" + exts[0]
+	}
+	return "document"
+}
+
+func toToolChoice(choice *provider.ToolChoice) any {
+	if choice.Type != "function" {
+		return choice.Type
+	}
+	return map[string]any{
+		"type":     "function",
+		"function": map[string]string{"name": choice.Function},
+	}
+}
+
+func toToolCalls(calls []provider.ToolCall) []ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	toolCalls := make([]ToolCall, len(calls))
+	for i, tc := range calls {
+		toolType := tc.Type
+		if toolType == "" {
+			toolType = "function"
+		}
+		toolCalls[i] = ToolCall{
+			ID:    tc.ID,
+			Type:  toolType,
+			Index: tc.Index,
+			Function: FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			},
+		}
+	}
+	return toolCalls
+}
+
+func toProviderToolCalls(calls []ToolCall) []provider.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	toolCalls := make([]provider.ToolCall, len(calls))
+	for i, tc := range calls {
+		toolCalls[i] = provider.ToolCall{
+			ID:    tc.ID,
+			Type:  tc.Type,
+			Index: tc.Index,
+			Function: provider.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			},
+		}
+	}
+	return toolCalls
+}
+
+func (u *Usage) toProvider() *provider.Usage {
+	usage := &provider.Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if u.PromptTokensDetails != nil {
+		usage.CachedTokens = u.PromptTokensDetails.CachedTokens
+	}
+	return usage
+}
@@ -0,0 +1,61 @@
+// Package passthrough merges provider-specific fields into request bodies and
+// collects the fields of response bodies that adapters do not map.
+package passthrough
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Merge sets the top-level fields of the JSON object data to fields,
+// replacing existing fields of the same name.
+func Merge(data []byte, fields map[string]any) ([]byte, error) {
+	if len(fields) == 0 {
+		return data, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		object[k] = raw
+	}
+	return json.Marshal(object)
+}
+
+// Unknown returns the top-level fields of the JSON object data that have no
+// matching field in the struct v, or nil when there are none.
+func Unknown(data []byte, v any) map[string]any {
+	var object map[string]any
+	if json.Unmarshal(data, &object) != nil {
+		return nil
+	}
+
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		for k := range object {
+			if strings.EqualFold(k, name) {
+				delete(object, k)
+			}
+		}
+	}
+
+	if len(object) == 0 {
+		return nil
+	}
+	return object
+}
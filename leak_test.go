@@ -0,0 +1,145 @@
+package ai_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/provider/anthropic"
+	"github.com/alexisbouchez/ai/provider/huggingface"
+	"github.com/alexisbouchez/ai/provider/llamacpp"
+	"github.com/alexisbouchez/ai/provider/mistral"
+	"github.com/alexisbouchez/ai/provider/ollama"
+	"github.com/alexisbouchez/ai/provider/openai"
+	"github.com/alexisbouchez/ai/provider/openrouter"
+	"github.com/alexisbouchez/ai/provider/vertexai"
+	"github.com/alexisbouchez/ai/providertest"
+)
+
+var streamProviders = []struct {
+	name   string
+	new    func() provider.Provider
+	stream func(deltas ...string) providertest.Script
+}{
+	{"openai", openai.New, providertest.OpenAIStream},
+	{"mistral", mistral.New, providertest.MistralStream},
+	{"openrouter", func() provider.Provider { return openrouter.New() }, providertest.OpenAIStream},
+	{"llamacpp", func() provider.Provider { return llamacpp.New() }, providertest.OpenAIStream},
+	{"huggingface", func() provider.Provider { return huggingface.New() }, providertest.OpenAIStream},
+	{"anthropic", func() provider.Provider { return anthropic.New() }, providertest.AnthropicStream},
+	{"vertexai", func() provider.Provider { return vertexai.New("", "") }, providertest.GeminiStream},
+	{"ollama", ollama.New, providertest.OllamaStream},
+}
+
+var deltas = []string{"one", " two", " three", " four", " five"}
+
+func TestStreamLeaks(t *testing.T) {
+	cases := []struct {
+		name string
+		// delay is waited before every chunk
+		delay time.Duration
+		// buffer is the StreamBuffer of the request
+		buffer int
+		run    func(t *testing.T, stream *provider.StreamReader, cancel context.CancelFunc)
+	}{
+		{
+			name: "consumed",
+			run: func(t *testing.T, stream *provider.StreamReader, cancel context.CancelFunc) {
+				for _, err := range stream.Events() {
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+		},
+		{
+			name: "closed unread",
+			run: func(t *testing.T, stream *provider.StreamReader, cancel context.CancelFunc) {
+				// let the producer block on its first send
+				time.Sleep(20 * time.Millisecond)
+				stream.Close()
+			},
+		},
+		{
+			name:  "closed midway",
+			delay: 10 * time.Millisecond,
+			run: func(t *testing.T, stream *provider.StreamReader, cancel context.CancelFunc) {
+				if _, err := stream.Recv(); err != nil {
+					t.Fatal(err)
+				}
+				stream.Close()
+				if _, err := stream.Recv(); !errors.Is(err, provider.ErrStreamClosed) {
+					t.Errorf("Recv after Close = %v, want ErrStreamClosed", err)
+				}
+			},
+		},
+		{
+			name:   "closed buffered",
+			buffer: 2,
+			run: func(t *testing.T, stream *provider.StreamReader, cancel context.CancelFunc) {
+				if _, err := stream.Recv(); err != nil {
+					t.Fatal(err)
+				}
+				time.Sleep(20 * time.Millisecond)
+				stream.Close()
+			},
+		},
+		{
+			name:  "canceled",
+			delay: 10 * time.Millisecond,
+			run: func(t *testing.T, stream *provider.StreamReader, cancel context.CancelFunc) {
+				if _, err := stream.Recv(); err != nil {
+					t.Fatal(err)
+				}
+				cancel()
+				// the stream ends by itself, with or without an error
+				for {
+					if _, err := stream.Recv(); err != nil {
+						break
+					}
+				}
+				stream.Close()
+			},
+		},
+		{
+			name: "closed concurrently",
+			run: func(t *testing.T, stream *provider.StreamReader, cancel context.CancelFunc) {
+				done := make(chan struct{})
+				for range 4 {
+					go func() {
+						stream.Close()
+						done <- struct{}{}
+					}()
+				}
+				for range 4 {
+					<-done
+				}
+			},
+		},
+	}
+
+	for _, p := range streamProviders {
+		for _, tc := range cases {
+			t.Run(p.name+"/"+tc.name, func(t *testing.T) {
+				providertest.VerifyNoLeaks(t)
+
+				srv := providertest.NewServer(p.stream(deltas...).Delay(tc.delay))
+				defer srv.Close()
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				stream, err := p.new().WithAPIKey("test").WithBaseURL(srv.URL).Stream(ctx, &provider.ChatRequest{
+					Model:        "test",
+					Messages:     []provider.Message{{Role: provider.RoleUser, Content: "Count to five"}},
+					StreamBuffer: tc.buffer,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				tc.run(t, stream, cancel)
+			})
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ai
+
+import (
+	"log/slog"
+
+	"github.com/alexisbouchez/ai/internal/logging"
+)
+
+// LogComponent is a subsystem of the module logging under its own level.
+type LogComponent = logging.Component
+
+const (
+	// LogProvider logs the HTTP requests sent to providers, at debug level,
+	// and failed requests and retries, at warn level
+	LogProvider LogComponent = logging.Provider
+	// LogStream logs the end of streamed responses
+	LogStream LogComponent = logging.Stream
+	// LogAgent logs the steps of agent runs and their outcome
+	LogAgent LogComponent = logging.Agent
+	// LogTool logs tool calls and their failures
+	LogTool LogComponent = logging.Tool
+)
+
+// SetLogger sets the logger of the module, silent by default. Records carry
+// a component attribute naming the subsystem they come from:
+//
+//	ai.SetLogger(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+//	ai.SetLogLevel(ai.LogAgent, slog.LevelInfo)
+//
+// A nil logger makes the module silent again.
+func SetLogger(logger *slog.Logger) {
+	logging.SetLogger(logger)
+}
+
+// SetLogLevel sets the minimum level of the records of component, on top of
+// the level of the logger. A *slog.LevelVar changes it at runtime, and nil
+// removes it.
+func SetLogLevel(component LogComponent, level slog.Leveler) {
+	logging.SetLevel(component, level)
+}
+
+// SetWireLogging toggles the logging of the requests and responses sent to
+// providers, with their headers and bodies, and of the data of streams, at
+// debug level. Credentials in headers and query parameters are masked, but
+// bodies hold prompts and completions as is.
+func SetWireLogging(on bool) {
+	logging.SetWire(on)
+}
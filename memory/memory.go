@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Memory stores a conversation and decides which messages are sent back to
+// the model on the next turn.
+type Memory interface {
+	Add(ctx context.Context, messages ...provider.Message) error
+	Messages() []provider.Message
+	Clear()
+}
+
+// Buffer keeps the full history.
+type Buffer struct {
+	messages []provider.Message
+}
+
+func NewBuffer() *Buffer {
+	return &Buffer{}
+}
+
+func (b *Buffer) Add(ctx context.Context, messages ...provider.Message) error {
+	b.messages = append(b.messages, messages...)
+	return nil
+}
+
+func (b *Buffer) Messages() []provider.Message {
+	return append([]provider.Message(nil), b.messages...)
+}
+
+func (b *Buffer) Clear() {
+	b.messages = nil
+}
+
+// Window keeps system messages and the most recent size messages.
+type Window struct {
+	size     int
+	messages []provider.Message
+}
+
+func NewWindow(size int) *Window {
+	return &Window{size: size}
+}
+
+func (w *Window) Add(ctx context.Context, messages ...provider.Message) error {
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *Window) Messages() []provider.Message {
+	system, rest := splitSystem(w.messages)
+	if len(rest) > w.size {
+		rest = trimOrphans(rest[len(rest)-w.size:])
+	}
+	return append(system, rest...)
+}
+
+func (w *Window) Clear() {
+	w.messages = nil
+}
+
+func splitSystem(messages []provider.Message) (system, rest []provider.Message) {
+	for _, msg := range messages {
+		if msg.Role == provider.RoleSystem {
+			system = append(system, msg)
+		} else {
+			rest = append(rest, msg)
+		}
+	}
+	return system, rest
+}
+
+// trimOrphans drops leading tool results whose assistant tool call was cut off.
+func trimOrphans(messages []provider.Message) []provider.Message {
+	for len(messages) > 0 && messages[0].Role == provider.RoleTool {
+		messages = messages[1:]
+	}
+	return messages
+}
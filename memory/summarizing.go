@@ -0,0 +1,221 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tokens"
+)
+
+const defaultSummaryPrompt = "Summarize the conversation so far in a few sentences. Keep names, facts, decisions and open questions."
+
+// Summarizing keeps the most recent messages verbatim and folds older ones
+// into a running summary produced by the model.
+type Summarizing struct {
+	provider    provider.Provider
+	threshold   int
+	keep        int
+	prompt      string
+	model       string
+	maxTokens   int
+	pin         func(provider.Message) bool
+	pinnedTools map[string]bool
+	summary     string
+	messages    []provider.Message
+}
+
+// NewSummarizing summarizes history once it holds more than threshold
+// non-system messages, keeping the last keep messages as they are. A zero
+// threshold only summarizes on the token threshold.
+func NewSummarizing(p provider.Provider, threshold, keep int) *Summarizing {
+	return &Summarizing{
+		provider:  p,
+		threshold: threshold,
+		keep:      keep,
+		prompt:    defaultSummaryPrompt,
+	}
+}
+
+func (s *Summarizing) Prompt(prompt string) *Summarizing {
+	s.prompt = prompt
+	return s
+}
+
+// TokenThreshold also summarizes history once its non-system messages
+// exceed n tokens, counted with the tokenizer of model.
+func (s *Summarizing) TokenThreshold(model string, n int) *Summarizing {
+	s.model = model
+	s.maxTokens = n
+	return s
+}
+
+// Pin keeps the messages matching fn verbatim instead of summarizing them.
+// Pinned messages do not count towards the thresholds. The tool calls and
+// results of a pinned message are kept together.
+func (s *Summarizing) Pin(fn func(provider.Message) bool) *Summarizing {
+	s.pin = fn
+	return s
+}
+
+// PinTools pins the results of the named tools.
+func (s *Summarizing) PinTools(names ...string) *Summarizing {
+	if s.pinnedTools == nil {
+		s.pinnedTools = make(map[string]bool)
+	}
+	for _, name := range names {
+		s.pinnedTools[name] = true
+	}
+	return s
+}
+
+func (s *Summarizing) Add(ctx context.Context, messages ...provider.Message) error {
+	s.messages = append(s.messages, messages...)
+
+	system, rest := splitSystem(s.messages)
+	pinnedIDs := s.pinnedCalls(rest)
+	if !s.exceeded(rest, pinnedIDs) {
+		return nil
+	}
+
+	cut := len(rest) - s.keep
+	// Never separate tool results from the assistant turn that requested them
+	for cut < len(rest) && rest[cut].Role == provider.RoleTool {
+		cut++
+	}
+	if cut <= 0 {
+		return nil
+	}
+
+	pinned, old := s.partition(rest[:cut], pinnedIDs)
+	if len(old) == 0 {
+		return nil
+	}
+
+	summary, err := s.summarize(ctx, old)
+	if err != nil {
+		return fmt.Errorf("failed to summarize history: %w", err)
+	}
+
+	s.summary = summary
+	s.messages = append(append(system, pinned...), rest[cut:]...)
+	return nil
+}
+
+// pinnedCalls returns the IDs of the tool calls whose call and result are
+// kept verbatim.
+func (s *Summarizing) pinnedCalls(messages []provider.Message) map[string]bool {
+	ids := make(map[string]bool)
+	names := make(map[string]string)
+	for _, msg := range messages {
+		for _, tc := range msg.ToolCalls {
+			names[tc.ID] = tc.Function.Name
+			if s.pinned(msg) {
+				ids[tc.ID] = true
+			}
+		}
+		if msg.Role != provider.RoleTool {
+			continue
+		}
+		name := msg.Name
+		if name == "" {
+			name = names[msg.ToolCallID]
+		}
+		if s.pinned(msg) || s.pinnedTools[name] {
+			ids[msg.ToolCallID] = true
+		}
+	}
+	return ids
+}
+
+func (s *Summarizing) pinned(msg provider.Message) bool {
+	return s.pin != nil && s.pin(msg)
+}
+
+func (s *Summarizing) exceeded(messages []provider.Message, pinnedIDs map[string]bool) bool {
+	var unpinned []provider.Message
+	for _, msg := range messages {
+		if !s.pinned(msg) && !(msg.Role == provider.RoleTool && pinnedIDs[msg.ToolCallID]) {
+			unpinned = append(unpinned, msg)
+		}
+	}
+	if s.threshold > 0 && len(unpinned) > s.threshold {
+		return true
+	}
+	return s.maxTokens > 0 && tokens.EstimateMessages(s.model, unpinned) > s.maxTokens
+}
+
+// partition splits messages into those kept verbatim and those to
+// summarize. Assistant turns with pinned tool calls are summarized, and kept
+// reduced to those calls so that pinned results still follow their call.
+func (s *Summarizing) partition(messages []provider.Message, pinnedIDs map[string]bool) (pinned, old []provider.Message) {
+	for _, msg := range messages {
+		switch {
+		case s.pinned(msg):
+			pinned = append(pinned, msg)
+		case msg.Role == provider.RoleTool && pinnedIDs[msg.ToolCallID]:
+			pinned = append(pinned, msg)
+		default:
+			old = append(old, msg)
+			var calls []provider.ToolCall
+			for _, tc := range msg.ToolCalls {
+				if pinnedIDs[tc.ID] {
+					calls = append(calls, tc)
+				}
+			}
+			if len(calls) > 0 {
+				pinned = append(pinned, provider.Message{Role: msg.Role, ToolCalls: calls})
+			}
+		}
+	}
+	return pinned, old
+}
+
+func (s *Summarizing) summarize(ctx context.Context, messages []provider.Message) (string, error) {
+	var transcript strings.Builder
+	if s.summary != "" {
+		fmt.Fprintf(&transcript, "Previous summary: %s\n\n", s.summary)
+	}
+	for _, msg := range messages {
+		content := msg.Text()
+		for _, tc := range msg.ToolCalls {
+			content += fmt.Sprintf(" [called %s(%s)]", tc.Function.Name, tc.Function.Arguments)
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, content)
+	}
+
+	resp, err := s.provider.Chat(ctx, &provider.ChatRequest{
+		Messages: []provider.Message{
+			{Role: provider.RoleSystem, Content: s.prompt},
+			{Role: provider.RoleUser, Content: transcript.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("empty summary response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+func (s *Summarizing) Summary() string {
+	return s.summary
+}
+
+func (s *Summarizing) Messages() []provider.Message {
+	system, rest := splitSystem(s.messages)
+	if s.summary != "" {
+		system = append(system, provider.Message{
+			Role:    provider.RoleSystem,
+			Content: "Summary of the earlier conversation: " + s.summary,
+		})
+	}
+	return append(system, rest...)
+}
+
+func (s *Summarizing) Clear() {
+	s.summary = ""
+	s.messages = nil
+}
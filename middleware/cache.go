@@ -0,0 +1,285 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Cache stores responses by request hash. A zero ttl means the entry uses
+// the cache's default expiry.
+type Cache interface {
+	Get(ctx context.Context, key string) (*provider.ChatResponse, bool)
+	Set(ctx context.Context, key string, resp *provider.ChatResponse, ttl time.Duration)
+}
+
+type CacheOption func(*cacheConfig)
+
+type cacheConfig struct {
+	ttl         time.Duration
+	cacheSample bool
+}
+
+func CacheTTL(ttl time.Duration) CacheOption {
+	return func(c *cacheConfig) {
+		c.ttl = ttl
+	}
+}
+
+// CacheSampled also caches requests that are not deterministic, i.e. that
+// do not set Temperature to 0.
+func CacheSampled() CacheOption {
+	return func(c *cacheConfig) {
+		c.cacheSample = true
+	}
+}
+
+type cache struct {
+	provider.Wrapper
+	cache   Cache
+	config  cacheConfig
+	model   string
+	baseURL string
+}
+
+// Caching returns a middleware serving repeated deterministic requests from
+// c instead of calling the wrapped provider again.
+func Caching(c Cache, opts ...CacheOption) provider.Middleware {
+	var config cacheConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return func(p provider.Provider) provider.Provider {
+		return newCache(p, c, config, "", "")
+	}
+}
+
+// WithCache serves repeated deterministic requests from cache instead of
+// calling p again.
+func WithCache(p provider.Provider, c Cache, opts ...CacheOption) provider.Provider {
+	return Caching(c, opts...)(p)
+}
+
+func newCache(p provider.Provider, c Cache, config cacheConfig, model, baseURL string) *cache {
+	m := &cache{cache: c, config: config, model: model, baseURL: baseURL}
+	m.Wrapper = provider.Wrapper{Next: p, Wrap: func(p provider.Provider) provider.Provider {
+		return newCache(p, m.cache, m.config, m.model, m.baseURL)
+	}}
+	return m
+}
+
+func (m *cache) WithBaseURL(url string) provider.Provider {
+	return newCache(m.Next.WithBaseURL(url), m.cache, m.config, m.model, url)
+}
+
+func (m *cache) WithModel(model string) provider.Provider {
+	return newCache(m.Next.WithModel(model), m.cache, m.config, model, m.baseURL)
+}
+
+func (m *cache) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	if !m.cacheable(req) {
+		return m.Next.Chat(ctx, req)
+	}
+
+	key, err := m.key(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp, ok := m.cache.Get(ctx, key); ok {
+		return resp, nil
+	}
+
+	resp, err := m.Next.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	m.cache.Set(ctx, key, resp, m.config.ttl)
+	return resp, nil
+}
+
+func (m *cache) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	if !m.cacheable(req) {
+		return m.Next.Stream(ctx, req)
+	}
+
+	key, err := m.key(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp, ok := m.cache.Get(ctx, key); ok {
+		return replay(resp), nil
+	}
+
+	stream, err := m.Next.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var acc provider.Accumulator
+	finish := func(err error) {
+		if err != nil || acc.FinishReason() == "" {
+			return
+		}
+		resp := &provider.ChatResponse{
+			Object:  "chat.completion",
+			Created: time.Now().Unix(),
+			Model:   req.Model,
+			Choices: acc.Choices(),
+		}
+		if usage := acc.Usage(); usage != nil {
+			resp.Usage = *usage
+		}
+		m.cache.Set(ctx, key, resp, m.config.ttl)
+	}
+	return relay(stream, acc.Add, finish), nil
+}
+
+func (m *cache) cacheable(req *provider.ChatRequest) bool {
+	return m.config.cacheSample || (req.Temperature != nil && *req.Temperature == 0)
+}
+
+func (m *cache) key(req *provider.ChatRequest) (string, error) {
+	normalized := *req
+	normalized.Stream = false
+	if normalized.Model == "" {
+		normalized.Model = m.model
+	}
+
+	// ProviderOptions are not marshaled with the request but change the
+	// response, as a seed or a response format does
+	data, err := json.Marshal(struct {
+		Provider string
+		BaseURL  string
+		Request  provider.ChatRequest
+		Options  map[string]any
+	}{fmt.Sprintf("%T", m.Next), m.baseURL, normalized, req.ProviderOptions})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// replay streams a cached response as a single delta per choice.
+func replay(resp *provider.ChatResponse) *provider.StreamReader {
+	events := make(chan provider.StreamEvent, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		event := provider.StreamEvent{
+			Index: choice.Index,
+			Delta: provider.Delta{
+				Content:   choice.Message.Content,
+				ToolCalls: choice.Message.ToolCalls,
+				Citations: choice.Citations,
+			},
+			FinishReason: choice.FinishReason,
+		}
+		if i == len(resp.Choices)-1 {
+			usage := resp.Usage
+			event.Usage = &usage
+		}
+		events <- event
+	}
+	close(events)
+	return provider.NewStreamReader(events, nil)
+}
+
+// LRU is an in-memory Cache holding at most size entries. Responses are
+// copied when set and when returned.
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	resp    *provider.ChatResponse
+	expires time.Time
+}
+
+// NewLRU creates an LRU cache. Entries set without a ttl expire after the
+// default ttl, or never if it is zero.
+func NewLRU(size int, ttl time.Duration) *LRU {
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) Get(ctx context.Context, key string) (*provider.ChatResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return cloneResponse(entry.resp), true
+}
+
+func (c *LRU) Set(ctx context.Context, key string, resp *provider.ChatResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	resp = cloneResponse(resp)
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = &lruEntry{key: key, resp: resp, expires: expires}
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, resp: resp, expires: expires})
+	for c.size > 0 && c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// cloneResponse returns a deep copy of resp, so that callers modifying a
+// response do not change the cached entry.
+func cloneResponse(resp *provider.ChatResponse) *provider.ChatResponse {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return resp
+	}
+	var clone provider.ChatResponse
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return resp
+	}
+	return &clone
+}
@@ -0,0 +1,51 @@
+package middleware_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alexisbouchez/ai/middleware"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/provider/openai"
+	"github.com/alexisbouchez/ai/providertest"
+)
+
+func TestCacheProviderOptions(t *testing.T) {
+	srv := providertest.NewServer(
+		providertest.OpenAIResponse("one"),
+		providertest.OpenAIResponse("two"),
+		providertest.OpenAIResponse("three"),
+	)
+	defer srv.Close()
+
+	p := middleware.WithCache(openai.New().WithBaseURL(srv.URL), middleware.NewLRU(8, 0))
+	temperature := 0.0
+	chat := func(options map[string]any) string {
+		t.Helper()
+		resp, err := p.Chat(context.Background(), &provider.ChatRequest{
+			Messages:        []provider.Message{{Role: provider.RoleUser, Content: "Hi"}},
+			Temperature:     &temperature,
+			ProviderOptions: options,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Choices[0].Message.Content
+	}
+
+	if got := chat(map[string]any{"seed": 1}); got != "one" {
+		t.Errorf("first reply = %q, want one", got)
+	}
+	if got := chat(map[string]any{"seed": 2}); got != "two" {
+		t.Errorf("reply with another seed = %q, want two", got)
+	}
+	if got := chat(map[string]any{"seed": 1}); got != "one" {
+		t.Errorf("repeated reply = %q, want the cached one", got)
+	}
+	if got := chat(nil); got != "three" {
+		t.Errorf("reply without options = %q, want three", got)
+	}
+	if n := len(srv.Requests()); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+}
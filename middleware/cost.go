@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexisbouchez/ai/cost"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// CostRecorder receives the cost of every request and answers queries about
+// the accumulated totals. cost.Tracker is an in-memory implementation.
+type CostRecorder interface {
+	Record(ctx context.Context, e cost.Entry)
+	Total() cost.Totals
+	Model(model string) cost.Totals
+	Session(session string) cost.Totals
+}
+
+type costTracking struct {
+	provider.Wrapper
+	recorder CostRecorder
+	model    string
+}
+
+// CostTracking returns a middleware recording the USD cost of every request.
+// Requests are attributed to the session set with cost.WithSession.
+func CostTracking(recorder CostRecorder) provider.Middleware {
+	return func(p provider.Provider) provider.Provider {
+		return newCostTracking(p, recorder, "")
+	}
+}
+
+// WithCostTracking records the USD cost of every request made through p.
+// Requests are attributed to the session set with cost.WithSession.
+func WithCostTracking(p provider.Provider, recorder CostRecorder) provider.Provider {
+	return CostTracking(recorder)(p)
+}
+
+func newCostTracking(p provider.Provider, recorder CostRecorder, model string) *costTracking {
+	c := &costTracking{recorder: recorder, model: model}
+	c.Wrapper = provider.Wrapper{Next: p, Wrap: func(p provider.Provider) provider.Provider {
+		return newCostTracking(p, recorder, c.model)
+	}}
+	return c
+}
+
+func (c *costTracking) WithModel(model string) provider.Provider {
+	return newCostTracking(c.Next.WithModel(model), c.recorder, model)
+}
+
+func (c *costTracking) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	resp, err := c.Next.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = c.requestModel(req)
+	}
+	c.record(ctx, model, resp.Usage)
+	return resp, nil
+}
+
+func (c *costTracking) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	stream, err := c.Next.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage *provider.Usage
+	observe := func(event provider.StreamEvent) {
+		if event.Usage != nil {
+			usage = event.Usage
+		}
+	}
+	finish := func(error) {
+		if usage != nil {
+			c.record(ctx, c.requestModel(req), *usage)
+		}
+	}
+	return relay(stream, observe, finish), nil
+}
+
+func (c *costTracking) requestModel(req *provider.ChatRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return c.model
+}
+
+func (c *costTracking) record(ctx context.Context, model string, usage provider.Usage) {
+	usd, _ := cost.Estimate(model, usage)
+	c.recorder.Record(ctx, cost.Entry{
+		Model:   model,
+		Session: cost.SessionFromContext(ctx),
+		Usage:   usage,
+		Cost:    usd,
+		Time:    time.Now(),
+	})
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// relay forwards the events of src to a new StreamReader, calling observe
+// for every event and finish exactly once when the stream ends.
+func relay(src *provider.StreamReader, observe func(provider.StreamEvent), finish func(error)) *provider.StreamReader {
+	events := make(chan provider.StreamEvent)
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer close(events)
+
+		var streamErr error
+		defer func() { finish(streamErr) }()
+
+		for {
+			event, err := src.Recv()
+			if errors.Is(err, provider.ErrStreamClosed) {
+				return
+			}
+			if err != nil {
+				streamErr = err
+			}
+			if observe != nil {
+				observe(event)
+			}
+
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return provider.NewStreamReader(events, func() {
+		once.Do(func() { close(done) })
+		src.Close()
+	})
+}
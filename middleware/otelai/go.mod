@@ -0,0 +1,11 @@
+module github.com/alexisbouchez/ai/middleware/otelai
+
+go 1.25.0
+
+require (
+	github.com/alexisbouchez/ai v0.0.0
+	go.opentelemetry.io/otel v1.37.0
+	go.opentelemetry.io/otel/trace v1.37.0
+)
+
+replace github.com/alexisbouchez/ai => ../..
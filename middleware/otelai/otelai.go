@@ -0,0 +1,80 @@
+// Package otelai adapts an OpenTelemetry tracer to middleware.Tracer, so
+// that model calls show up in an existing OpenTelemetry setup:
+//
+//	p = middleware.WithTracing(p, otelai.Tracer(otel.Tracer("ai")))
+//
+// It is a module of its own, keeping the OpenTelemetry dependency out of
+// the main module.
+package otelai
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/alexisbouchez/ai/middleware"
+)
+
+// Tracer returns a middleware.Tracer starting client spans with t.
+func Tracer(t trace.Tracer) middleware.Tracer {
+	return tracer{t}
+}
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+func (t tracer) Start(ctx context.Context, name string) (context.Context, middleware.Span) {
+	ctx, s := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, span{s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttributes(attrs ...middleware.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+func (s span) AddEvent(name string, attrs ...middleware.Attribute) {
+	s.span.AddEvent(name, trace.WithAttributes(convert(attrs)...))
+}
+
+// RecordError records err and marks the span failed, with the error.type
+// attribute of the semantic conventions.
+func (s span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+	s.span.SetAttributes(attribute.String("error.type", fmt.Sprintf("%T", err)))
+}
+
+func (s span) End() {
+	s.span.End()
+}
+
+func convert(attrs []middleware.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for i, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs[i] = attribute.String(a.Key, v)
+		case bool:
+			kvs[i] = attribute.Bool(a.Key, v)
+		case int:
+			kvs[i] = attribute.Int(a.Key, v)
+		case int64:
+			kvs[i] = attribute.Int64(a.Key, v)
+		case float64:
+			kvs[i] = attribute.Float64(a.Key, v)
+		case []string:
+			kvs[i] = attribute.StringSlice(a.Key, v)
+		default:
+			kvs[i] = attribute.String(a.Key, fmt.Sprint(v))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tokens"
+)
+
+// RateLimitError is returned by a rate limited provider configured with
+// RejectWhenLimited when a request does not fit the current budget.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("client-side rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+type RateLimitOption func(*rateLimiter)
+
+// RejectWhenLimited fails requests with a RateLimitError instead of waiting
+// for budget to become available.
+func RejectWhenLimited() RateLimitOption {
+	return func(l *rateLimiter) {
+		l.reject = true
+	}
+}
+
+type rateLimit struct {
+	provider.Wrapper
+	limiter *rateLimiter
+}
+
+// WithRateLimit limits p to rps requests per second and tpm tokens per
+// minute. Request tokens are estimated up front and corrected with the
+// reported usage. A zero or negative limit disables that budget.
+func WithRateLimit(p provider.Provider, rps float64, tpm int, opts ...RateLimitOption) provider.Provider {
+	return RateLimit(rps, tpm, opts...)(p)
+}
+
+// RateLimit returns a middleware limiting requests as described in
+// WithRateLimit. All providers wrapped by it share the same budget.
+func RateLimit(rps float64, tpm int, opts ...RateLimitOption) provider.Middleware {
+	limiter := &rateLimiter{
+		requests: newBucket(rps, max(rps, 1)),
+		tokens:   newBucket(float64(tpm)/60, float64(tpm)),
+	}
+	for _, opt := range opts {
+		opt(limiter)
+	}
+	var mw provider.Middleware
+	mw = func(p provider.Provider) provider.Provider {
+		return &rateLimit{Wrapper: provider.Wrapper{Next: p, Wrap: mw}, limiter: limiter}
+	}
+	return mw
+}
+
+func (r *rateLimit) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	estimate := estimateTokens(req)
+	if err := r.limiter.wait(ctx, estimate); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Next.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	r.limiter.adjust(resp.Usage.TotalTokens - estimate)
+	return resp, nil
+}
+
+func (r *rateLimit) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	estimate := estimateTokens(req)
+	if err := r.limiter.wait(ctx, estimate); err != nil {
+		return nil, err
+	}
+
+	stream, err := r.Next.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage *provider.Usage
+	observe := func(event provider.StreamEvent) {
+		if event.Usage != nil {
+			usage = event.Usage
+		}
+	}
+	finish := func(error) {
+		if usage != nil {
+			r.limiter.adjust(usage.TotalTokens - estimate)
+		}
+	}
+	return relay(stream, observe, finish), nil
+}
+
+func estimateTokens(req *provider.ChatRequest) int {
+	n := tokens.EstimateMessages(req.Model, req.Messages) + tokens.EstimateTools(req.Model, req.Tools)
+	if req.MaxTokens != nil {
+		n += *req.MaxTokens
+	}
+	return n
+}
+
+type rateLimiter struct {
+	mu       sync.Mutex
+	requests *bucket
+	tokens   *bucket
+	reject   bool
+}
+
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	delay := max(l.requests.delay(1, now), l.tokens.delay(float64(n), now))
+	if delay > 0 && l.reject {
+		l.mu.Unlock()
+		return &RateLimitError{RetryAfter: delay}
+	}
+	l.requests.take(1)
+	l.tokens.take(float64(n))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.requests.take(-1)
+		l.tokens.take(-float64(n))
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *rateLimiter) adjust(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.refill(time.Now())
+	l.tokens.take(float64(n))
+}
+
+// bucket is a token bucket that may go into debt: a request larger than the
+// available budget is admitted after waiting for the deficit to refill.
+type bucket struct {
+	rate     float64
+	capacity float64
+	level    float64
+	last     time.Time
+}
+
+func newBucket(rate, capacity float64) *bucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &bucket{rate: rate, capacity: capacity, level: capacity, last: time.Now()}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if b == nil {
+		return
+	}
+	b.level = min(b.capacity, b.level+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+func (b *bucket) delay(n float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.refill(now)
+	if b.level >= n {
+		return 0
+	}
+	return time.Duration((n - b.level) / b.rate * float64(time.Second))
+}
+
+func (b *bucket) take(n float64) {
+	if b != nil {
+		b.level -= n
+	}
+}
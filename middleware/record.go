@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/record"
+)
+
+// Recording returns a middleware sending the HTTP requests of the provider
+// through r. It wraps the transport of the provider's HTTP client, so that
+// custom transports such as those of auth, TLS settings or proxies keep
+// applying; timeouts set with WithTimeout still apply. Providers not
+// exposing their client, such as a Router, record through the transport of
+// r.
+func Recording(r *record.Recorder) provider.Middleware {
+	return func(p provider.Provider) provider.Provider {
+		client := provider.HTTPClient(p)
+		if client == nil {
+			return p.WithHTTPClient(r.Client())
+		}
+		recording := *client
+		recording.Transport = r.Wrap(client.Transport)
+		return p.WithHTTPClient(&recording)
+	}
+}
+
+// WithRecorder records the interactions of p to the cassette at
+// cassettePath, or replays them when the cassette exists.
+func WithRecorder(p provider.Provider, cassettePath string) provider.Provider {
+	return Recording(record.New(cassettePath))(p)
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type resume struct {
+	provider.Wrapper
+	maxResumes int
+}
+
+// WithResume resumes streams of p that fail midway with a retryable error,
+// a connection error such as a reset or a body cut short, or
+// ErrStreamStalled, up to maxResumes times.
+// The request is sent again with the text received so far as a partial
+// assistant message, and the stream continues with the new deltas only.
+// Streams that have sent tool calls or several choices are not resumed.
+func WithResume(p provider.Provider, maxResumes int) provider.Provider {
+	return Resume(maxResumes)(p)
+}
+
+// Resume returns a middleware resuming streams as described in WithResume.
+// Place Retry after it to back off resumed requests that fail to open.
+func Resume(maxResumes int) provider.Middleware {
+	var mw provider.Middleware
+	mw = func(p provider.Provider) provider.Provider {
+		return &resume{Wrapper: provider.Wrapper{Next: p, Wrap: mw}, maxResumes: maxResumes}
+	}
+	return mw
+}
+
+func (r *resume) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	return r.Next.Chat(ctx, req)
+}
+
+func (r *resume) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	stream, err := r.Next.Stream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan provider.StreamEvent)
+	done := make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	current := stream
+
+	go func() {
+		defer close(events)
+
+		var text strings.Builder
+		// pending is the trailing whitespace the caller received but the
+		// continuation was sent without, which the resumed stream is
+		// likely to repeat
+		var pending string
+		resumable := req.N == nil || *req.N <= 1
+		resumes := 0
+
+		for {
+			event, err := current.Recv()
+			if errors.Is(err, provider.ErrStreamClosed) {
+				return
+			}
+			if err != nil && resumable && resumes < r.maxResumes && ctx.Err() == nil && resumableErr(err) {
+				current.Close()
+				cont, trimmed := continuation(req, text.String())
+				next, resumeErr := r.Next.Stream(ctx, cont)
+				if resumeErr == nil {
+					resumes++
+					pending = trimmed
+					mu.Lock()
+					select {
+					case <-done:
+						mu.Unlock()
+						next.Close()
+						return
+					default:
+					}
+					current = next
+					mu.Unlock()
+					continue
+				}
+				err = fmt.Errorf("failed to resume stream after %w: %w", err, resumeErr)
+				event = provider.StreamEvent{Err: err}
+			}
+
+			if pending != "" && event.Delta.Content != "" {
+				event.Delta.Content, pending = reconcile(event.Delta.Content, pending)
+			}
+			text.WriteString(event.Delta.Content)
+			if len(event.Delta.ToolCalls) > 0 {
+				resumable = false
+			}
+
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return provider.NewStreamReader(events, func() {
+		once.Do(func() { close(done) })
+		mu.Lock()
+		defer mu.Unlock()
+		current.Close()
+	}), nil
+}
+
+// resumableErr reports whether a stream failing with err can be resumed:
+// retryable errors, and failures reading the body over the network, which
+// IsRetryable does not cover since they are not timeouts.
+func resumableErr(err error) bool {
+	if provider.IsRetryable(err) {
+		return true
+	}
+	var apiErr *provider.APIError
+	if errors.As(err, &apiErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr)
+}
+
+// continuation returns req continued from the partial assistant text. It
+// carries no idempotency key, since it is a new request. Trailing
+// whitespace is trimmed because some providers reject partial messages
+// ending with it, and returned.
+func continuation(req *provider.ChatRequest, partial string) (*provider.ChatRequest, string) {
+	clone := *req
+	clone.IdempotencyKey = ""
+	trimmed := strings.TrimRight(partial, " \t\r\n")
+	if trimmed != "" {
+		clone.Messages = append(req.Messages[:len(req.Messages):len(req.Messages)], provider.Message{
+			Role:    provider.RoleAssistant,
+			Content: trimmed,
+		})
+	}
+	return &clone, partial[len(trimmed):]
+}
+
+// reconcile drops from resumed content the part of the trimmed whitespace
+// pending it repeats, since the caller already has it, and returns what
+// remains of both. Once the content departs from pending nothing more is
+// dropped: the caller keeps its whitespace when the model skips it.
+func reconcile(content, pending string) (string, string) {
+	n := 0
+	for n < len(content) && n < len(pending) && content[n] == pending[n] {
+		n++
+	}
+	if n == len(content) {
+		return "", pending[n:]
+	}
+	return content[n:], ""
+}
@@ -0,0 +1,121 @@
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alexisbouchez/ai/middleware"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/provider/openai"
+)
+
+// scripted is a provider streaming the events of streams in turn, and
+// recording the requests it receives.
+type scripted struct {
+	provider.Provider
+	mu       sync.Mutex
+	streams  [][]provider.StreamEvent
+	requests []*provider.ChatRequest
+}
+
+func (s *scripted) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stream := s.streams[len(s.requests)]
+	events := make(chan provider.StreamEvent, len(stream))
+	for _, event := range stream {
+		events <- event
+	}
+	close(events)
+	s.requests = append(s.requests, req)
+	return provider.NewStreamReader(events, nil), nil
+}
+
+func (s *scripted) Requests() []*provider.ChatRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func content(deltas ...string) []provider.StreamEvent {
+	events := make([]provider.StreamEvent, len(deltas))
+	for i, delta := range deltas {
+		events[i] = provider.StreamEvent{Delta: provider.Delta{Content: delta}}
+	}
+	return events
+}
+
+func TestResumeAfterWhitespace(t *testing.T) {
+	interrupted := provider.StreamEvent{Err: io.ErrUnexpectedEOF}
+	tests := []struct {
+		name    string
+		first   []string
+		resumed []string
+		partial string
+		want    string
+	}{
+		{
+			name:    "repeated space",
+			first:   []string{"Hello", " "},
+			resumed: []string{" world"},
+			partial: "Hello",
+			want:    "Hello world",
+		},
+		{
+			name:    "skipped space",
+			first:   []string{"Hello "},
+			resumed: []string{"world"},
+			partial: "Hello",
+			want:    "Hello world",
+		},
+		{
+			name:    "split newlines",
+			first:   []string{"Line one.\n\n"},
+			resumed: []string{"\n", "\nLine two."},
+			partial: "Line one.",
+			want:    "Line one.\n\nLine two.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &scripted{
+				Provider: openai.New(),
+				streams: [][]provider.StreamEvent{
+					append(content(tt.first...), interrupted),
+					append(content(tt.resumed...), provider.StreamEvent{FinishReason: "stop"}),
+				},
+			}
+			stream, err := middleware.WithResume(p, 1).Stream(context.Background(), &provider.ChatRequest{
+				Messages: []provider.Message{{Role: provider.RoleUser, Content: "Hi"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+
+			var text strings.Builder
+			for event, err := range stream.Events() {
+				if err != nil {
+					t.Fatal(err)
+				}
+				text.WriteString(event.Delta.Content)
+			}
+			if text.String() != tt.want {
+				t.Errorf("text = %q, want %q", text.String(), tt.want)
+			}
+
+			reqs := p.Requests()
+			if len(reqs) != 2 {
+				t.Fatalf("got %d requests, want 2", len(reqs))
+			}
+			last := reqs[1].Messages[len(reqs[1].Messages)-1]
+			if last.Role != provider.RoleAssistant || last.Content != tt.partial {
+				t.Errorf("partial message = %+v, want %q", last, tt.partial)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/alexisbouchez/ai/internal/logging"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type RetryOption func(*retryConfig)
+
+type retryConfig struct {
+	maxRetries int
+	initial    time.Duration
+	max        time.Duration
+}
+
+// MaxRetries sets how many times a failed request is retried. Defaults to 3.
+func MaxRetries(n int) RetryOption {
+	return func(c *retryConfig) {
+		c.maxRetries = n
+	}
+}
+
+// Backoff sets the delay before the first retry and the maximum delay.
+// The delay doubles on every attempt, with jitter. Defaults to 500ms and 30s.
+// Requests the provider asks to retry after more than max are not retried.
+func Backoff(initial, max time.Duration) RetryOption {
+	return func(c *retryConfig) {
+		c.initial = initial
+		c.max = max
+	}
+}
+
+type retry struct {
+	provider.Wrapper
+	config retryConfig
+}
+
+// WithRetry retries requests to p that fail with a retryable error. Every
+// attempt of a request carries the same idempotency key, generated when the
+// request has none, so providers that support it process the request once.
+// Streams are only retried when opening them fails.
+func WithRetry(p provider.Provider, opts ...RetryOption) provider.Provider {
+	return Retry(opts...)(p)
+}
+
+// Retry returns a middleware retrying requests as described in WithRetry.
+func Retry(opts ...RetryOption) provider.Middleware {
+	config := retryConfig{maxRetries: 3, initial: 500 * time.Millisecond, max: 30 * time.Second}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	var mw provider.Middleware
+	mw = func(p provider.Provider) provider.Provider {
+		return &retry{Wrapper: provider.Wrapper{Next: p, Wrap: mw}, config: config}
+	}
+	return mw
+}
+
+func (r *retry) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	req = withIdempotencyKey(req)
+	for attempt := 0; ; attempt++ {
+		resp, err := r.Next.Chat(ctx, req)
+		if err == nil || !r.wait(ctx, attempt, err) {
+			return resp, err
+		}
+	}
+}
+
+func (r *retry) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	req = withIdempotencyKey(req)
+	for attempt := 0; ; attempt++ {
+		stream, err := r.Next.Stream(ctx, req)
+		if err == nil || !r.wait(ctx, attempt, err) {
+			return stream, err
+		}
+	}
+}
+
+// wait sleeps before the next attempt and reports whether it should be made.
+// A delay asked by the provider through retry-after replaces the backoff,
+// and the request is given up when it exceeds the maximum delay.
+func (r *retry) wait(ctx context.Context, attempt int, err error) bool {
+	if attempt >= r.config.maxRetries || !provider.IsRetryable(err) {
+		return false
+	}
+
+	delay := r.config.initial << attempt
+	if delay <= 0 || delay > r.config.max {
+		delay = r.config.max
+	}
+	if delay > 0 {
+		delay = delay/2 + rand.N(delay/2+1)
+	}
+	var apiErr *provider.APIError
+	if errors.As(err, &apiErr) && apiErr.RateLimit != nil && apiErr.RateLimit.RetryAfter > 0 {
+		if apiErr.RateLimit.RetryAfter > r.config.max {
+			logging.For(logging.Provider).WarnContext(ctx, "not retrying request", "retry_after", apiErr.RateLimit.RetryAfter, "error", err)
+			return false
+		}
+		delay = apiErr.RateLimit.RetryAfter
+	}
+	logging.For(logging.Provider).WarnContext(ctx, "retrying request", "attempt", attempt+1, "delay", delay, "error", err)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func withIdempotencyKey(req *provider.ChatRequest) *provider.ChatRequest {
+	if req.IdempotencyKey != "" {
+		return req
+	}
+	clone := *req
+	clone.IdempotencyKey = newIdempotencyKey()
+	return &clone
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	crand.Read(b)
+	return hex.EncodeToString(b)
+}
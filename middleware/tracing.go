@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Tracer is the subset of a tracing API used by WithTracing. The otelai
+// module adapts an OpenTelemetry trace.Tracer to it.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attribute keys from the OpenTelemetry GenAI semantic conventions. The
+// time to first token, in seconds, takes the name of the metric recording
+// it.
+const (
+	AttrSystem           = "gen_ai.system"
+	AttrOperationName    = "gen_ai.operation.name"
+	AttrRequestModel     = "gen_ai.request.model"
+	AttrRequestMaxTokens = "gen_ai.request.max_tokens"
+	AttrRequestTemp      = "gen_ai.request.temperature"
+	AttrRequestTopP      = "gen_ai.request.top_p"
+	AttrRequestStop      = "gen_ai.request.stop_sequences"
+	AttrResponseID       = "gen_ai.response.id"
+	AttrResponseModel    = "gen_ai.response.model"
+	AttrFinishReasons    = "gen_ai.response.finish_reasons"
+	AttrInputTokens      = "gen_ai.usage.input_tokens"
+	AttrOutputTokens     = "gen_ai.usage.output_tokens"
+	AttrTimeToFirstToken = "gen_ai.server.time_to_first_token"
+	AttrStreaming        = "gen_ai.request.streaming"
+	operationChat        = "chat"
+)
+
+type tracing struct {
+	provider.Wrapper
+	tracer Tracer
+}
+
+// Tracing returns a middleware emitting a span for every Chat and Stream
+// call.
+func Tracing(tracer Tracer) provider.Middleware {
+	var mw provider.Middleware
+	mw = func(p provider.Provider) provider.Provider {
+		return &tracing{Wrapper: provider.Wrapper{Next: p, Wrap: mw}, tracer: tracer}
+	}
+	return mw
+}
+
+// WithTracing emits a span for every Chat and Stream call made through p.
+func WithTracing(p provider.Provider, tracer Tracer) provider.Provider {
+	return Tracing(tracer)(p)
+}
+
+func (t *tracing) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	ctx, span := t.start(ctx, req, false)
+	defer span.End()
+
+	resp, err := t.Next.Chat(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	reasons := make([]string, len(resp.Choices))
+	for i, c := range resp.Choices {
+		reasons[i] = c.FinishReason
+	}
+	span.SetAttributes(
+		Attribute{AttrResponseID, resp.ID},
+		Attribute{AttrResponseModel, resp.Model},
+		Attribute{AttrFinishReasons, reasons},
+		Attribute{AttrInputTokens, resp.Usage.PromptTokens},
+		Attribute{AttrOutputTokens, resp.Usage.CompletionTokens},
+	)
+	return resp, nil
+}
+
+func (t *tracing) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	ctx, span := t.start(ctx, req, true)
+	start := time.Now()
+
+	stream, err := t.Next.Stream(ctx, req)
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var firstToken bool
+	var reasons []string
+	var usage *provider.Usage
+
+	observe := func(event provider.StreamEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !firstToken && (event.Delta.Content != "" || len(event.Delta.ToolCalls) > 0) {
+			firstToken = true
+			span.SetAttributes(Attribute{AttrTimeToFirstToken, time.Since(start).Seconds()})
+		}
+		if event.FinishReason != "" {
+			reasons = append(reasons, event.FinishReason)
+		}
+		if event.Usage != nil {
+			usage = event.Usage
+		}
+	}
+
+	finish := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			span.RecordError(err)
+		}
+		if len(reasons) > 0 {
+			span.SetAttributes(Attribute{AttrFinishReasons, reasons})
+		}
+		if usage != nil {
+			span.SetAttributes(
+				Attribute{AttrInputTokens, usage.PromptTokens},
+				Attribute{AttrOutputTokens, usage.CompletionTokens},
+			)
+		}
+		span.End()
+	}
+
+	return relay(stream, observe, finish), nil
+}
+
+func (t *tracing) start(ctx context.Context, req *provider.ChatRequest, streaming bool) (context.Context, Span) {
+	name := operationChat
+	if req.Model != "" {
+		name += " " + req.Model
+	}
+
+	ctx, span := t.tracer.Start(ctx, name)
+
+	attrs := []Attribute{
+		{AttrOperationName, operationChat},
+		{AttrStreaming, streaming},
+	}
+	if system := provider.System(t.Next); system != "" {
+		attrs = append(attrs, Attribute{AttrSystem, system})
+	}
+	if req.Model != "" {
+		attrs = append(attrs, Attribute{AttrRequestModel, req.Model})
+	}
+	if req.MaxTokens != nil {
+		attrs = append(attrs, Attribute{AttrRequestMaxTokens, *req.MaxTokens})
+	}
+	if req.Temperature != nil {
+		attrs = append(attrs, Attribute{AttrRequestTemp, *req.Temperature})
+	}
+	if req.TopP != nil {
+		attrs = append(attrs, Attribute{AttrRequestTopP, *req.TopP})
+	}
+	if len(req.Stop) > 0 {
+		attrs = append(attrs, Attribute{AttrRequestStop, req.Stop})
+	}
+	span.SetAttributes(attrs...)
+
+	return ctx, span
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/summarize"
+)
+
+// TruncateStrategy shortens the messages of a request that exceeded the
+// context window of the model.
+type TruncateStrategy func(ctx context.Context, messages []provider.Message) ([]provider.Message, error)
+
+// ErrNothingToTruncate is returned by strategies when the messages hold no
+// more turns than they keep, as retrying with the same messages would fail
+// again.
+var ErrNothingToTruncate = errors.New("no older turns to truncate")
+
+// KeepLastTurns keeps the system messages and the last n turns, a turn
+// starting at a user message and including the replies and tool calls that
+// follow it.
+func KeepLastTurns(n int) TruncateStrategy {
+	return func(ctx context.Context, messages []provider.Message) ([]provider.Message, error) {
+		start, ok := splitTurns(messages, n)
+		if !ok {
+			return nil, ErrNothingToTruncate
+		}
+		return keepFrom(messages, start, nil), nil
+	}
+}
+
+// SummarizeOlderTurns keeps the system messages and the last n turns, and
+// replaces the turns before them with a summary written by p.
+func SummarizeOlderTurns(p provider.Provider, n int) TruncateStrategy {
+	return func(ctx context.Context, messages []provider.Message) ([]provider.Message, error) {
+		start, ok := splitTurns(messages, n)
+		if !ok {
+			return nil, ErrNothingToTruncate
+		}
+
+		var transcript strings.Builder
+		for _, msg := range messages[:start] {
+			if msg.Role == provider.RoleSystem {
+				continue
+			}
+			content := msg.Text()
+			for _, tc := range msg.ToolCalls {
+				content += fmt.Sprintf(" [called %s(%s)]", tc.Function.Name, tc.Function.Arguments)
+			}
+			fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, content)
+		}
+		summary, err := summarize.New(p).Summarize(ctx, transcript.String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize conversation: %w", err)
+		}
+
+		return keepFrom(messages, start, &provider.Message{
+			Role:    provider.RoleSystem,
+			Content: "Summary of the earlier conversation: " + summary,
+		}), nil
+	}
+}
+
+// splitTurns returns the index of the first message of the last n turns,
+// and whether non-system messages come before it.
+func splitTurns(messages []provider.Message, n int) (int, bool) {
+	start := len(messages)
+	for turns := 0; start > 0 && turns < n; {
+		start--
+		if messages[start].Role == provider.RoleUser {
+			turns++
+		}
+	}
+	for _, msg := range messages[:start] {
+		if msg.Role != provider.RoleSystem {
+			return start, true
+		}
+	}
+	return start, false
+}
+
+// keepFrom returns the messages from start on, preceded by the system
+// messages before start in their original order. A summary replaces the
+// first message dropped.
+func keepFrom(messages []provider.Message, start int, summary *provider.Message) []provider.Message {
+	var kept []provider.Message
+	for _, msg := range messages[:start] {
+		switch {
+		case msg.Role == provider.RoleSystem:
+			kept = append(kept, msg)
+		case summary != nil:
+			kept = append(kept, *summary)
+			summary = nil
+		}
+	}
+	return append(kept, messages[start:]...)
+}
+
+type autoTruncate struct {
+	provider.Wrapper
+	strategy TruncateStrategy
+}
+
+// WithAutoTruncate retries requests to p rejected with
+// provider.ErrContextLengthExceeded once, with their messages shortened by
+// strategy. Streams are only retried when opening them fails.
+func WithAutoTruncate(p provider.Provider, strategy TruncateStrategy) provider.Provider {
+	return AutoTruncate(strategy)(p)
+}
+
+// AutoTruncate returns a middleware truncating requests as described in
+// WithAutoTruncate.
+func AutoTruncate(strategy TruncateStrategy) provider.Middleware {
+	var mw provider.Middleware
+	mw = func(p provider.Provider) provider.Provider {
+		return &autoTruncate{Wrapper: provider.Wrapper{Next: p, Wrap: mw}, strategy: strategy}
+	}
+	return mw
+}
+
+func (t *autoTruncate) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	resp, err := t.Next.Chat(ctx, req)
+	if err == nil || !errors.Is(err, provider.ErrContextLengthExceeded) {
+		return resp, err
+	}
+	truncated, truncErr := t.truncate(ctx, req, err)
+	if truncErr != nil {
+		return nil, truncErr
+	}
+	return t.Next.Chat(ctx, truncated)
+}
+
+func (t *autoTruncate) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	stream, err := t.Next.Stream(ctx, req)
+	if err == nil || !errors.Is(err, provider.ErrContextLengthExceeded) {
+		return stream, err
+	}
+	truncated, truncErr := t.truncate(ctx, req, err)
+	if truncErr != nil {
+		return nil, truncErr
+	}
+	return t.Next.Stream(ctx, truncated)
+}
+
+// truncate returns req with the messages shortened by the strategy.
+func (t *autoTruncate) truncate(ctx context.Context, req *provider.ChatRequest, err error) (*provider.ChatRequest, error) {
+	messages, truncErr := t.strategy(ctx, req.Messages)
+	if truncErr != nil {
+		return nil, fmt.Errorf("failed to truncate messages after %w: %w", err, truncErr)
+	}
+	clone := *req
+	clone.Messages = messages
+	return &clone, nil
+}
@@ -0,0 +1,155 @@
+package observe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/alexisbouchez/ai/agent"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Middleware returns a middleware recording every Chat and Stream call as
+// a generation, with its messages, response, model and usage.
+func (t *Tracer) Middleware() provider.Middleware {
+	var mw provider.Middleware
+	mw = func(p provider.Provider) provider.Provider {
+		return &traced{Wrapper: provider.Wrapper{Next: p, Wrap: mw}, tracer: t}
+	}
+	return mw
+}
+
+type traced struct {
+	provider.Wrapper
+	tracer *Tracer
+}
+
+func (p *traced) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	ctx, span := p.tracer.startGeneration(ctx, req)
+	resp, err := p.Next.Chat(ctx, req)
+	if err != nil {
+		span.End(nil, err)
+		return nil, err
+	}
+	span.SetGeneration(resp.Model, &resp.Usage)
+	span.End(output(resp.Choices), nil)
+	return resp, nil
+}
+
+func (p *traced) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	ctx, span := p.tracer.startGeneration(ctx, req)
+	stream, err := p.Next.Stream(ctx, req)
+	if err != nil {
+		span.End(nil, err)
+		return nil, err
+	}
+	return record(stream, span), nil
+}
+
+// AgentHooks returns hooks recording the tool calls of an agent run as
+// spans, children of the span of the context given to Run.
+func (t *Tracer) AgentHooks() agent.Hooks {
+	var mu sync.Mutex
+	spans := make(map[string]*ActiveSpan)
+	return agent.Hooks{
+		OnToolStart: func(ctx context.Context, call provider.ToolCall) {
+			var input any = call.Function.Arguments
+			if json.Valid([]byte(call.Function.Arguments)) {
+				input = json.RawMessage(call.Function.Arguments)
+			}
+			_, span := t.Start(ctx, KindTool, call.Function.Name, input)
+			span.SetMetadata("tool_call_id", call.ID)
+			mu.Lock()
+			spans[call.ID] = span
+			mu.Unlock()
+		},
+		OnToolEnd: func(ctx context.Context, call provider.ToolCall, result provider.Message, err error) {
+			mu.Lock()
+			span, ok := spans[call.ID]
+			delete(spans, call.ID)
+			mu.Unlock()
+			if ok {
+				span.End(result.Text(), err)
+			}
+		},
+	}
+}
+
+func (t *Tracer) startGeneration(ctx context.Context, req *provider.ChatRequest) (context.Context, *ActiveSpan) {
+	name := "chat"
+	if req.Model != "" {
+		name += " " + req.Model
+	}
+	ctx, span := t.Start(ctx, KindGeneration, name, req.Messages)
+	span.SetGeneration(req.Model, nil)
+	if req.Temperature != nil {
+		span.SetMetadata("temperature", *req.Temperature)
+	}
+	if req.MaxTokens != nil {
+		span.SetMetadata("max_tokens", *req.MaxTokens)
+	}
+	if len(req.Tools) > 0 {
+		names := make([]string, len(req.Tools))
+		for i, tool := range req.Tools {
+			names[i] = tool.Function.Name
+			if names[i] == "" {
+				names[i] = tool.Type
+			}
+		}
+		span.SetMetadata("tools", names)
+	}
+	return ctx, span
+}
+
+// output is the message of a single choice, or all the choices.
+func output(choices []provider.Choice) any {
+	if len(choices) == 1 {
+		return choices[0].Message
+	}
+	return choices
+}
+
+// record forwards the events of src to a new StreamReader, ending span
+// with the accumulated response when the stream ends.
+func record(src *provider.StreamReader, span *ActiveSpan) *provider.StreamReader {
+	events := make(chan provider.StreamEvent)
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer close(events)
+
+		var acc provider.Accumulator
+		var streamErr error
+		defer func() {
+			span.SetGeneration("", acc.Usage())
+			span.End(output(acc.Choices()), streamErr)
+		}()
+
+		for {
+			event, err := src.Recv()
+			if errors.Is(err, provider.ErrStreamClosed) {
+				return
+			}
+			if err != nil {
+				streamErr = err
+			} else {
+				acc.Add(event)
+			}
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return provider.NewStreamReader(events, func() {
+		once.Do(func() { close(done) })
+		src.Close()
+	}, provider.ReportRateLimit(src.RateLimit()))
+}
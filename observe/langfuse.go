@@ -0,0 +1,152 @@
+package observe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const defaultLangfuseHost = "https://cloud.langfuse.com"
+
+// Langfuse exports spans to the ingestion API of Langfuse. The root span
+// of a trace creates the trace, and every span an observation of it.
+type Langfuse struct {
+	PublicKey string
+	SecretKey string
+	// Host defaults to Langfuse Cloud
+	Host string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// LangfuseFromEnv returns an exporter configured by LANGFUSE_PUBLIC_KEY,
+// LANGFUSE_SECRET_KEY and LANGFUSE_HOST.
+func LangfuseFromEnv() (*Langfuse, error) {
+	publicKey, err := provider.RequireEnv("LANGFUSE_PUBLIC_KEY")
+	if err != nil {
+		return nil, err
+	}
+	secretKey, err := provider.RequireEnv("LANGFUSE_SECRET_KEY")
+	if err != nil {
+		return nil, err
+	}
+	return &Langfuse{PublicKey: publicKey, SecretKey: secretKey, Host: os.Getenv("LANGFUSE_HOST")}, nil
+}
+
+type langfuseEvent struct {
+	ID        string         `json:"id"`
+	Timestamp time.Time      `json:"timestamp"`
+	Type      string         `json:"type"`
+	Body      map[string]any `json:"body"`
+}
+
+func (l *Langfuse) Export(ctx context.Context, spans []Span) error {
+	var batch []langfuseEvent
+	for _, span := range spans {
+		if span.ParentID == "" {
+			batch = append(batch, langfuseEvent{
+				ID:        newID(),
+				Timestamp: span.End,
+				Type:      "trace-create",
+				Body: map[string]any{
+					"id":        span.TraceID,
+					"name":      span.Name,
+					"timestamp": span.Start,
+					"input":     span.Input,
+					"output":    span.Output,
+					"metadata":  span.Metadata,
+				},
+			})
+		}
+
+		body := map[string]any{
+			"id":        span.ID,
+			"traceId":   span.TraceID,
+			"name":      span.Name,
+			"startTime": span.Start,
+			"endTime":   span.End,
+			"input":     span.Input,
+			"output":    span.Output,
+			"metadata":  span.Metadata,
+		}
+		if span.ParentID != "" {
+			body["parentObservationId"] = span.ParentID
+		}
+		if span.Error != "" {
+			body["level"] = "ERROR"
+			body["statusMessage"] = span.Error
+		}
+		eventType := "span-create"
+		if span.Kind == KindGeneration {
+			eventType = "generation-create"
+			body["model"] = span.Model
+			if u := span.Usage; u != nil {
+				body["usage"] = map[string]int{"input": u.PromptTokens, "output": u.CompletionTokens, "total": u.TotalTokens}
+			}
+		}
+		batch = append(batch, langfuseEvent{ID: newID(), Timestamp: span.End, Type: eventType, Body: body})
+	}
+
+	data, err := json.Marshal(map[string]any{"batch": batch})
+	if err != nil {
+		return fmt.Errorf("failed to marshal traces: %w", err)
+	}
+	host := l.Host
+	if host == "" {
+		host = defaultLangfuseHost
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(host, "/")+"/api/public/ingestion", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(l.PublicKey, l.SecretKey)
+
+	return send(l.HTTPClient, req, func(body []byte) error {
+		// the API answers 207 with the events it rejected
+		var result struct {
+			Errors []struct {
+				ID      string `json:"id"`
+				Status  int    `json:"status"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		if json.Unmarshal(body, &result) == nil && len(result.Errors) > 0 {
+			e := result.Errors[0]
+			return fmt.Errorf("%d of %d events rejected, first with status %d: %s", len(result.Errors), len(batch), e.Status, e.Message)
+		}
+		return nil
+	})
+}
+
+// send sends req and checks the response with check, when set.
+func send(client *http.Client, req *http.Request, check func(body []byte) error) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send traces: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &provider.APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if check != nil {
+		return check(body)
+	}
+	return nil
+}
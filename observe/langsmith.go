@@ -0,0 +1,118 @@
+package observe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const defaultLangSmithEndpoint = "https://api.smith.langchain.com"
+
+// LangSmith exports spans as runs to the batch ingestion API of LangSmith.
+type LangSmith struct {
+	APIKey string
+	// Project is the project the runs are logged to, "default" when empty
+	Project string
+	// Endpoint defaults to LangSmith Cloud
+	Endpoint string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// LangSmithFromEnv returns an exporter configured by LANGSMITH_API_KEY,
+// LANGSMITH_PROJECT and LANGSMITH_ENDPOINT.
+func LangSmithFromEnv() (*LangSmith, error) {
+	key, err := provider.RequireEnv("LANGSMITH_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	return &LangSmith{
+		APIKey:   key,
+		Project:  os.Getenv("LANGSMITH_PROJECT"),
+		Endpoint: os.Getenv("LANGSMITH_ENDPOINT"),
+	}, nil
+}
+
+var runTypes = map[Kind]string{
+	KindGeneration: "llm",
+	KindTool:       "tool",
+	KindAgent:      "chain",
+	KindSpan:       "chain",
+}
+
+func (l *LangSmith) Export(ctx context.Context, spans []Span) error {
+	project := l.Project
+	if project == "" {
+		project = "default"
+	}
+
+	runs := make([]map[string]any, len(spans))
+	for i, span := range spans {
+		runType, ok := runTypes[span.Kind]
+		if !ok {
+			runType = "chain"
+		}
+		metadata := map[string]any{}
+		for k, v := range span.Metadata {
+			metadata[k] = v
+		}
+		outputs := map[string]any{"output": span.Output}
+		inputs := map[string]any{"input": span.Input}
+		if span.Kind == KindGeneration {
+			inputs = map[string]any{"messages": span.Input}
+			if span.Model != "" {
+				metadata["ls_model_name"] = span.Model
+			}
+			if u := span.Usage; u != nil {
+				outputs["usage_metadata"] = map[string]int{
+					"input_tokens":  u.PromptTokens,
+					"output_tokens": u.CompletionTokens,
+					"total_tokens":  u.TotalTokens,
+				}
+			}
+		}
+
+		run := map[string]any{
+			"id":           span.ID,
+			"trace_id":     span.TraceID,
+			"dotted_order": span.Path,
+			"name":         span.Name,
+			"run_type":     runType,
+			"start_time":   span.Start,
+			"end_time":     span.End,
+			"inputs":       inputs,
+			"outputs":      outputs,
+			"extra":        map[string]any{"metadata": metadata},
+			"session_name": project,
+		}
+		if span.ParentID != "" {
+			run["parent_run_id"] = span.ParentID
+		}
+		if span.Error != "" {
+			run["error"] = span.Error
+		}
+		runs[i] = run
+	}
+
+	data, err := json.Marshal(map[string]any{"post": runs})
+	if err != nil {
+		return fmt.Errorf("failed to marshal traces: %w", err)
+	}
+	endpoint := l.Endpoint
+	if endpoint == "" {
+		endpoint = defaultLangSmithEndpoint
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/runs/batch", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", l.APIKey)
+	return send(l.HTTPClient, req, nil)
+}
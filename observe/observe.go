@@ -0,0 +1,296 @@
+// Package observe records structured traces of chats, tool calls and agent
+// runs, and ships them to an observability backend such as Langfuse or
+// LangSmith:
+//
+//	tracer := observe.NewTracer(exporter, observe.SampleRate(0.1))
+//	defer tracer.Close(context.Background())
+//	p = provider.Chain(p, tracer.Middleware())
+//
+//	ctx, run := tracer.Start(ctx, observe.KindAgent, "support agent", input)
+//	result, err := a.Hooks(tracer.AgentHooks()).Run(ctx, input)
+//	run.End(result, err)
+//
+// Spans started with a context carrying a span are its children, so the
+// model and tool calls of a run are nested under it.
+package observe
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type Kind string
+
+const (
+	// KindGeneration is a model call
+	KindGeneration Kind = "generation"
+	KindTool       Kind = "tool"
+	KindAgent      Kind = "agent"
+	// KindSpan is any other unit of work
+	KindSpan Kind = "span"
+)
+
+// Span is a finished unit of work of a trace.
+type Span struct {
+	TraceID string
+	ID      string
+	// ParentID is empty for the root of the trace
+	ParentID string
+	// Path is the start time and ID of the ancestors of the span and of the
+	// span itself, dot separated, which orders the spans of a trace
+	Path   string
+	Kind   Kind
+	Name   string
+	Start  time.Time
+	End    time.Time
+	Input  any
+	Output any
+	// Model and Usage are set on generations
+	Model    string
+	Usage    *provider.Usage
+	Metadata map[string]any
+	// Error is the message of the error the work failed with
+	Error string
+}
+
+// Exporter ships finished spans to a backend.
+type Exporter interface {
+	Export(ctx context.Context, spans []Span) error
+}
+
+type Option func(*Tracer)
+
+// SampleRate records the given fraction of traces, all by default. The
+// decision is made at the root of a trace and applies to all its spans.
+func SampleRate(rate float64) Option {
+	return func(t *Tracer) {
+		t.sampleRate = rate
+	}
+}
+
+// Redact adds a function applied to every span before it is exported, to
+// remove sensitive data. See OmitContent and RedactPatterns.
+func Redact(fn func(*Span)) Option {
+	return func(t *Tracer) {
+		t.redact = append(t.redact, fn)
+	}
+}
+
+// BatchSize exports spans once n of them are pending, 100 by default.
+func BatchSize(n int) Option {
+	return func(t *Tracer) {
+		t.batchSize = n
+	}
+}
+
+// FlushInterval exports the pending spans every d, 5 seconds by default.
+func FlushInterval(d time.Duration) Option {
+	return func(t *Tracer) {
+		t.interval = d
+	}
+}
+
+// OnError sets the function receiving the errors of background exports,
+// which are dropped otherwise.
+func OnError(fn func(error)) Option {
+	return func(t *Tracer) {
+		t.onError = fn
+	}
+}
+
+// Tracer records spans and exports them in batches, in the background.
+// It is safe for concurrent use.
+type Tracer struct {
+	exporter   Exporter
+	sampleRate float64
+	redact     []func(*Span)
+	batchSize  int
+	interval   time.Duration
+	onError    func(error)
+
+	mu      sync.Mutex
+	pending []Span
+	// flushMu serializes exports
+	flushMu sync.Mutex
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewTracer(exporter Exporter, opts ...Option) *Tracer {
+	t := &Tracer{
+		exporter:   exporter,
+		sampleRate: 1,
+		batchSize:  100,
+		interval:   5 * time.Second,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	go t.loop()
+	return t
+}
+
+func (t *Tracer) loop() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flushAsync()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// Flush exports the pending spans.
+func (t *Tracer) Flush(ctx context.Context) error {
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+	for i := range spans {
+		for _, redact := range t.redact {
+			redact(&spans[i])
+		}
+	}
+	if err := t.exporter.Export(ctx, spans); err != nil {
+		return fmt.Errorf("failed to export %d spans: %w", len(spans), err)
+	}
+	return nil
+}
+
+// Close stops the background exports and exports the pending spans.
+func (t *Tracer) Close(ctx context.Context) error {
+	t.once.Do(func() { close(t.stop) })
+	<-t.done
+	return t.Flush(ctx)
+}
+
+func (t *Tracer) flushAsync() {
+	if err := t.Flush(context.Background()); err != nil && t.onError != nil {
+		t.onError(err)
+	}
+}
+
+func (t *Tracer) record(span Span) {
+	t.mu.Lock()
+	t.pending = append(t.pending, span)
+	full := len(t.pending) >= t.batchSize
+	t.mu.Unlock()
+	if full {
+		go t.flushAsync()
+	}
+}
+
+type spanKey struct{}
+
+// spanRef is the span of a context, parent of the spans started with it.
+type spanRef struct {
+	traceID string
+	id      string
+	path    string
+	sampled bool
+}
+
+// ActiveSpan is a span in progress.
+type ActiveSpan struct {
+	tracer  *Tracer
+	sampled bool
+	once    sync.Once
+
+	mu   sync.Mutex
+	span Span
+}
+
+// Start starts a span of kind, the child of the span of ctx if it has
+// one, and returns a context carrying it.
+func (t *Tracer) Start(ctx context.Context, kind Kind, name string, input any) (context.Context, *ActiveSpan) {
+	now := time.Now().UTC()
+	span := Span{ID: newID(), Kind: kind, Name: name, Start: now, Input: input}
+	order := now.Format("20060102T150405") + fmt.Sprintf("%06dZ", now.Nanosecond()/1000) + span.ID
+
+	parent, ok := ctx.Value(spanKey{}).(spanRef)
+	sampled := parent.sampled
+	if ok {
+		span.TraceID, span.ParentID = parent.traceID, parent.id
+		span.Path = parent.path + "." + order
+	} else {
+		span.TraceID = span.ID
+		span.Path = order
+		sampled = rand.Float64() < t.sampleRate
+	}
+
+	ctx = context.WithValue(ctx, spanKey{}, spanRef{traceID: span.TraceID, id: span.ID, path: span.Path, sampled: sampled})
+	return ctx, &ActiveSpan{tracer: t, sampled: sampled, span: span}
+}
+
+// SetMetadata attaches key and value to the span.
+func (s *ActiveSpan) SetMetadata(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.span.Metadata == nil {
+		s.span.Metadata = make(map[string]any)
+	}
+	s.span.Metadata[key] = value
+}
+
+// SetGeneration records the model and usage of a generation.
+func (s *ActiveSpan) SetGeneration(model string, usage *provider.Usage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if model != "" {
+		s.span.Model = model
+	}
+	if usage != nil {
+		s.span.Usage = usage
+	}
+}
+
+// End finishes the span with output, or with err when the work failed.
+// Later calls do nothing.
+func (s *ActiveSpan) End(output any, err error) {
+	s.once.Do(func() {
+		s.mu.Lock()
+		span := s.span
+		s.mu.Unlock()
+
+		span.End = time.Now().UTC()
+		span.Output = output
+		if err != nil {
+			span.Error = err.Error()
+		}
+		if s.sampled {
+			s.tracer.record(span)
+		}
+	})
+}
+
+// newID returns a random UUID, the identifier format both Langfuse and
+// LangSmith accept.
+func newID() string {
+	var b [16]byte
+	crand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
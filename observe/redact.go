@@ -0,0 +1,61 @@
+package observe
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+// OmitContent removes the input and output of a span, keeping its timing,
+// model, usage and metadata. Pass it to Redact.
+func OmitContent(span *Span) {
+	span.Input = nil
+	span.Output = nil
+}
+
+// RedactPatterns returns a function for Redact replacing the matches of
+// patterns in the strings of the input, output and metadata of a span with
+// [REDACTED].
+func RedactPatterns(patterns ...*regexp.Regexp) func(*Span) {
+	return func(span *Span) {
+		span.Input = redactValue(span.Input, patterns)
+		span.Output = redactValue(span.Output, patterns)
+		for k, v := range span.Metadata {
+			span.Metadata[k] = redactValue(v, patterns)
+		}
+	}
+}
+
+// redactValue redacts the strings of the JSON form of v.
+func redactValue(v any, patterns []*regexp.Regexp) any {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil
+	}
+	return redactStrings(decoded, patterns)
+}
+
+func redactStrings(v any, patterns []*regexp.Regexp) any {
+	switch v := v.(type) {
+	case string:
+		for _, pattern := range patterns {
+			v = pattern.ReplaceAllString(v, "[REDACTED]")
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = redactStrings(v[i], patterns)
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = redactStrings(v[k], patterns)
+		}
+	}
+	return v
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Accumulator rebuilds the assistant message from the deltas of a stream.
+// Content, Message and the other accessors describe the first choice; use
+// Choices for streams of several choices.
+type Accumulator struct {
+	content      strings.Builder
+	toolCalls    []ToolCall
+	citations    []Citation
+	hostedTools  []HostedToolUse
+	finishReason string
+	usage        *Usage
+	// others accumulates the choices after the first, by index
+	others map[int]*Accumulator
+}
+
+func (a *Accumulator) Add(event StreamEvent) {
+	if event.Usage != nil {
+		a.usage = event.Usage
+	}
+	if event.Index > 0 {
+		if a.others == nil {
+			a.others = make(map[int]*Accumulator)
+		}
+		other, ok := a.others[event.Index]
+		if !ok {
+			other = &Accumulator{}
+			a.others[event.Index] = other
+		}
+		other.Add(StreamEvent{Delta: event.Delta, FinishReason: event.FinishReason})
+		return
+	}
+
+	a.content.WriteString(event.Delta.Content)
+
+	for _, delta := range event.Delta.ToolCalls {
+		tc := a.toolCall(delta)
+		if delta.ID != "" {
+			tc.ID = delta.ID
+		}
+		if delta.Type != "" {
+			tc.Type = delta.Type
+		}
+		tc.Function.Name += delta.Function.Name
+		tc.Function.Arguments += delta.Function.Arguments
+	}
+
+	a.citations = append(a.citations, event.Delta.Citations...)
+	a.hostedTools = append(a.hostedTools, event.Delta.HostedTools...)
+
+	if event.FinishReason != "" {
+		a.finishReason = event.FinishReason
+	}
+}
+
+func (a *Accumulator) toolCall(delta ToolCall) *ToolCall {
+	for i := range a.toolCalls {
+		tc := &a.toolCalls[i]
+		if tc.Index != delta.Index {
+			continue
+		}
+		if delta.ID != "" && tc.ID != "" && tc.ID != delta.ID {
+			continue
+		}
+		return tc
+	}
+
+	a.toolCalls = append(a.toolCalls, ToolCall{Index: delta.Index, Type: "function"})
+	return &a.toolCalls[len(a.toolCalls)-1]
+}
+
+func (a *Accumulator) Content() string {
+	return a.content.String()
+}
+
+func (a *Accumulator) Citations() []Citation {
+	return a.citations
+}
+
+func (a *Accumulator) FinishReason() string {
+	return a.finishReason
+}
+
+// Usage returns the last usage reported by the stream, or nil if the
+// provider did not report any.
+func (a *Accumulator) Usage() *Usage {
+	return a.usage
+}
+
+func (a *Accumulator) Message() Message {
+	var toolCalls []ToolCall
+	if len(a.toolCalls) > 0 {
+		toolCalls = append(toolCalls, a.toolCalls...)
+	}
+	return Message{
+		Role:        RoleAssistant,
+		Content:     a.content.String(),
+		ToolCalls:   toolCalls,
+		HostedTools: slices.Clone(a.hostedTools),
+	}
+}
+
+// Choices returns every choice of the stream, ordered by index.
+func (a *Accumulator) Choices() []Choice {
+	choices := []Choice{{
+		Message:      a.Message(),
+		FinishReason: a.finishReason,
+		Citations:    a.citations,
+	}}
+	for _, index := range slices.Sorted(maps.Keys(a.others)) {
+		other := a.others[index]
+		choices = append(choices, Choice{
+			Index:        index,
+			Message:      other.Message(),
+			FinishReason: other.finishReason,
+			Citations:    other.citations,
+		})
+	}
+	return choices
+}
@@ -1,23 +1,50 @@
 package anthropic
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
+	"github.com/alexisbouchez/ai/internal/idle"
+	"github.com/alexisbouchez/ai/internal/logging"
+	"github.com/alexisbouchez/ai/internal/passthrough"
 	"github.com/alexisbouchez/ai/provider"
 )
 
 const (
-	defaultBaseURL    = "https://api.anthropic.com"
-	defaultModel      = "claude-sonnet-4-20250514"
-	apiVersion        = "2023-06-01"
-	defaultMaxTokens  = 8192
+	defaultBaseURL = "https://api.anthropic.com"
+	defaultModel   = "claude-sonnet-4-20250514"
+	apiVersion     = "2023-06-01"
+	webSearchTool  = "web_search_20250305"
+	// codeExecutionTool runs code server-side, with BetaCodeExecution
+	codeExecutionTool = "code_execution_20250522"
+)
+
+// computerUseTools maps the computer use tool types to their versions.
+var computerUseTools = map[string]string{
+	provider.ToolComputer:   "computer_20250124",
+	provider.ToolTextEditor: "text_editor_20250124",
+	provider.ToolBash:       "bash_20250124",
+}
+
+// Beta flags, enabled with WithBetas, give access to features in
+// development.
+const (
+	BetaPromptCaching       = "prompt-caching-2024-07-31"
+	BetaComputerUse         = "computer-use-2025-01-24"
+	BetaFiles               = "files-api-2025-04-14"
+	BetaContext1M           = "context-1m-2025-08-07"
+	BetaInterleavedThinking = "interleaved-thinking-2025-05-14"
+	BetaTokenEfficientTools = "token-efficient-tools-2025-02-19"
+	BetaCodeExecution       = "code-execution-2025-05-22"
 )
 
 type anthropic struct {
@@ -25,6 +52,8 @@ type anthropic struct {
 	baseURL    string
 	model      string
 	httpClient *http.Client
+	timeout    time.Duration
+	headers    map[string]string
 }
 
 // New creates a new Anthropic provider.
@@ -36,28 +65,93 @@ func New() provider.Provider {
 	}
 }
 
+// NewFromEnv creates an Anthropic provider authenticated with
+// ANTHROPIC_API_KEY, using ANTHROPIC_BASE_URL when set.
+func NewFromEnv() (provider.Provider, error) {
+	key, err := provider.RequireEnv("ANTHROPIC_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	p := New().WithAPIKey(key)
+	if url := os.Getenv("ANTHROPIC_BASE_URL"); url != "" {
+		p = p.WithBaseURL(url)
+	}
+	return p, nil
+}
+
 func (a *anthropic) WithAPIKey(key string) provider.Provider {
-	a.apiKey = key
-	return a
+	cp := *a
+	cp.apiKey = key
+	return &cp
 }
 
 func (a *anthropic) WithBaseURL(url string) provider.Provider {
-	a.baseURL = url
-	return a
+	cp := *a
+	cp.baseURL = url
+	return &cp
 }
 
 func (a *anthropic) WithModel(model string) provider.Provider {
-	a.model = model
-	return a
+	cp := *a
+	cp.model = model
+	return &cp
+}
+
+func (a *anthropic) WithHTTPClient(client *http.Client) provider.Provider {
+	cp := *a
+	cp.httpClient = client
+	return &cp
+}
+
+// HTTPClient returns the client requests are sent with.
+func (a *anthropic) HTTPClient() *http.Client {
+	return a.httpClient
+}
+
+func (a *anthropic) System() string {
+	return "anthropic"
+}
+
+func (a *anthropic) WithTimeout(timeout time.Duration) provider.Provider {
+	cp := *a
+	cp.timeout = timeout
+	return &cp
+}
+
+func (a *anthropic) WithHeaders(headers map[string]string) provider.Provider {
+	cp := *a
+	cp.headers = maps.Clone(headers)
+	return &cp
+}
+
+// client returns the client of non-streaming requests, bounded by the
+// timeout.
+func (a *anthropic) client() *http.Client {
+	if a.timeout == 0 {
+		return logging.Client(a.httpClient)
+	}
+	client := *a.httpClient
+	client.Timeout = a.timeout
+	return logging.Client(&client)
+}
+
+// streamClient returns the client of streams, which the timeout would cut
+// off; ChatRequest.StreamTimeout bounds them instead.
+func (a *anthropic) streamClient() *http.Client {
+	return logging.Client(a.httpClient)
 }
 
 func (a *anthropic) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	start := time.Now()
 	model := req.Model
 	if model == "" {
 		model = a.model
 	}
 
-	anthropicReq := a.toAnthropicRequest(req, model)
+	anthropicReq, err := a.toAnthropicRequest(req, model)
+	if err != nil {
+		return nil, err
+	}
 
 	body, err := json.Marshal(anthropicReq)
 	if err != nil {
@@ -70,10 +164,17 @@ func (a *anthropic) Chat(ctx context.Context, req *provider.ChatRequest) (*provi
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", a.apiKey)
+	if a.apiKey != "" {
+		httpReq.Header.Set("x-api-key", a.apiKey)
+	}
 	httpReq.Header.Set("anthropic-version", apiVersion)
+	for k, v := range a.headers {
+		httpReq.Header.Set(k, v)
+	}
+	provider.ApplyContext(httpReq)
+	a.setBetas(httpReq, anthropicReq.Betas)
 
-	resp, err := a.httpClient.Do(httpReq)
+	resp, err := a.client().Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -85,7 +186,7 @@ func (a *anthropic) Chat(ctx context.Context, req *provider.ChatRequest) (*provi
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, toAPIError(resp.StatusCode, resp.Header, respBody)
 	}
 
 	var anthropicResp anthropicMessageResponse
@@ -93,16 +194,26 @@ func (a *anthropic) Chat(ctx context.Context, req *provider.ChatRequest) (*provi
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
-	return a.toProviderResponse(&anthropicResp), nil
+	chatResp := a.toProviderResponse(&anthropicResp)
+	chatResp.Timing = provider.NewTiming(start, chatResp.Usage.CompletionTokens, 0)
+	chatResp.RateLimit = provider.ParseRateLimit(resp.Header)
+	return chatResp, nil
 }
 
 func (a *anthropic) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	return provider.ApplyStreamTimeouts(ctx, req, a.stream)
+}
+
+func (a *anthropic) stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
 	model := req.Model
 	if model == "" {
 		model = a.model
 	}
 
-	anthropicReq := a.toAnthropicRequest(req, model)
+	anthropicReq, err := a.toAnthropicRequest(req, model)
+	if err != nil {
+		return nil, err
+	}
 	anthropicReq.Stream = true
 
 	body, err := json.Marshal(anthropicReq)
@@ -116,11 +227,18 @@ func (a *anthropic) Stream(ctx context.Context, req *provider.ChatRequest) (*pro
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", a.apiKey)
+	if a.apiKey != "" {
+		httpReq.Header.Set("x-api-key", a.apiKey)
+	}
 	httpReq.Header.Set("anthropic-version", apiVersion)
 	httpReq.Header.Set("Accept", "text/event-stream")
+	for k, v := range a.headers {
+		httpReq.Header.Set(k, v)
+	}
+	provider.ApplyContext(httpReq)
+	a.setBetas(httpReq, anthropicReq.Betas)
 
-	resp, err := a.httpClient.Do(httpReq)
+	resp, err := a.streamClient().Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -128,123 +246,234 @@ func (a *anthropic) Stream(ctx context.Context, req *provider.ChatRequest) (*pro
 	if resp.StatusCode != http.StatusOK {
 		defer resp.Body.Close()
 		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
+		return nil, toAPIError(resp.StatusCode, resp.Header, respBody)
 	}
 
 	events := make(chan provider.StreamEvent)
+	stream := provider.NewStreamReader(events, func() { resp.Body.Close() },
+		provider.Buffer(req.StreamBuffer, req.StreamOverflow),
+		provider.ReportRateLimit(provider.ParseRateLimit(resp.Header)),
+	)
 
 	go func() {
 		defer close(events)
 		defer resp.Body.Close()
 
-		scanner := bufio.NewScanner(resp.Body)
-		var currentToolCallIndex int
-		toolCallIndices := make(map[string]int)
-
-		for scanner.Scan() {
-			line := scanner.Text()
-
-			if !strings.HasPrefix(line, "data: ") {
-				continue
+		send := func(event provider.StreamEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			case <-stream.Done():
+				return false
 			}
+		}
 
-			data := strings.TrimPrefix(line, "data: ")
+		var currentToolCallIndex int
+		// Server tools such as web search stream input too, but are not
+		// tool calls for the caller
+		toolBlocks := make(map[int]bool)
+		// and are reported with their result instead
+		hostedBlocks := make(map[int]*provider.HostedToolUse)
+		hostedInputs := make(map[int]*strings.Builder)
+		var usage anthropicUsage
+		// finished is set once the finish reason was sent, which
+		// message_stop sends otherwise
+		var finished bool
+		// Citations arrive ahead of the text they support, so they are held
+		// until their block ends and its span is known
+		var textLen int
+		blockStarts := make(map[int]int)
+		blockCitations := make(map[int][]anthropicCitation)
 
+		err := readEvents(idle.Wrap(resp.Body, req.StreamIdleTimeout), func(eventType, data string) (bool, error) {
 			var streamEvent anthropicStreamEvent
 			if err := json.Unmarshal([]byte(data), &streamEvent); err != nil {
-				continue
+				return false, fmt.Errorf("failed to parse %s event: %w", eventType, err)
+			}
+			if eventType == "" {
+				eventType = streamEvent.Type
 			}
 
-			switch streamEvent.Type {
-			case "content_block_delta":
-				if streamEvent.Delta != nil {
-					switch streamEvent.Delta.Type {
-					case "text_delta":
-						events <- provider.StreamEvent{
-							Delta: provider.Delta{
-								Content: streamEvent.Delta.Text,
-							},
-						}
-					case "input_json_delta":
-						// Tool call arguments delta
-						if streamEvent.Index != nil {
-							events <- provider.StreamEvent{
-								Delta: provider.Delta{
-									ToolCalls: []provider.ToolCall{{
-										Index: *streamEvent.Index,
-										Function: provider.FunctionCall{
-											Arguments: streamEvent.Delta.PartialJSON,
-										},
-									}},
-								},
-							}
-						}
-					}
-				}
+			switch eventType {
+			case "ping":
+				return true, nil
 
-			case "content_block_start":
-				if streamEvent.ContentBlock != nil {
-					if streamEvent.ContentBlock.Type == "tool_use" {
-						// Start of a tool call
-						idx := currentToolCallIndex
-						if streamEvent.Index != nil {
-							idx = *streamEvent.Index
-						}
-						toolCallIndices[streamEvent.ContentBlock.ID] = idx
-						currentToolCallIndex++
+			case "error":
+				return false, toStreamError(streamEvent.Error)
 
-						events <- provider.StreamEvent{
+			case "content_block_delta":
+				if streamEvent.Delta == nil {
+					return true, nil
+				}
+				switch streamEvent.Delta.Type {
+				case "text_delta":
+					textLen += len(streamEvent.Delta.Text)
+					return send(provider.StreamEvent{
+						Delta: provider.Delta{
+							Content: streamEvent.Delta.Text,
+						},
+					}), nil
+				case "citations_delta":
+					if streamEvent.Index != nil && streamEvent.Delta.Citation != nil {
+						blockCitations[*streamEvent.Index] = append(blockCitations[*streamEvent.Index], *streamEvent.Delta.Citation)
+					}
+				case "input_json_delta":
+					if streamEvent.Index != nil && hostedBlocks[*streamEvent.Index] != nil {
+						hostedInputs[*streamEvent.Index].WriteString(streamEvent.Delta.PartialJSON)
+					}
+					// Tool call arguments delta
+					if streamEvent.Index != nil && toolBlocks[*streamEvent.Index] {
+						return send(provider.StreamEvent{
 							Delta: provider.Delta{
 								ToolCalls: []provider.ToolCall{{
-									ID:    streamEvent.ContentBlock.ID,
-									Type:  "function",
-									Index: idx,
+									Index: *streamEvent.Index,
 									Function: provider.FunctionCall{
-										Name: streamEvent.ContentBlock.Name,
+										Arguments: streamEvent.Delta.PartialJSON,
 									},
 								}},
 							},
+						}), nil
+					}
+				}
+
+			case "content_block_start":
+				if streamEvent.ContentBlock != nil && streamEvent.ContentBlock.Type == "text" && streamEvent.Index != nil {
+					blockStarts[*streamEvent.Index] = textLen
+				}
+				if block := streamEvent.ContentBlock; block != nil && block.Type == "server_tool_use" && streamEvent.Index != nil {
+					hostedBlocks[*streamEvent.Index] = &provider.HostedToolUse{ID: block.ID, Name: block.Name}
+					hostedInputs[*streamEvent.Index] = &strings.Builder{}
+					return true, nil
+				}
+				if block := streamEvent.ContentBlock; block != nil && isServerToolResult(block.Type) {
+					for idx, hosted := range hostedBlocks {
+						if hosted.ID != block.ToolUseID {
+							continue
+						}
+						hosted.Input = json.RawMessage(hostedInputs[idx].String())
+						if len(hosted.Input) == 0 {
+							hosted.Input = json.RawMessage("{}")
 						}
+						hosted.Result, _ = json.Marshal(block)
+						delete(hostedBlocks, idx)
+						return send(provider.StreamEvent{
+							Delta: provider.Delta{HostedTools: []provider.HostedToolUse{*hosted}},
+						}), nil
 					}
+					return true, nil
 				}
+				if streamEvent.ContentBlock != nil && streamEvent.ContentBlock.Type == "tool_use" {
+					// Start of a tool call
+					idx := currentToolCallIndex
+					if streamEvent.Index != nil {
+						idx = *streamEvent.Index
+					}
+					currentToolCallIndex++
+					toolBlocks[idx] = true
 
-			case "message_stop":
-				events <- provider.StreamEvent{
-					FinishReason: "stop",
+					return send(provider.StreamEvent{
+						Delta: provider.Delta{
+							ToolCalls: []provider.ToolCall{{
+								ID:    streamEvent.ContentBlock.ID,
+								Type:  "function",
+								Index: idx,
+								Function: provider.FunctionCall{
+									Name: streamEvent.ContentBlock.Name,
+								},
+							}},
+						},
+					}), nil
+				}
+
+			case "content_block_stop":
+				if streamEvent.Index == nil || len(blockCitations[*streamEvent.Index]) == 0 {
+					return true, nil
+				}
+				idx := *streamEvent.Index
+				citations := make([]provider.Citation, len(blockCitations[idx]))
+				for i, citation := range blockCitations[idx] {
+					citations[i] = citation.toProvider(blockStarts[idx], textLen)
+				}
+				delete(blockCitations, idx)
+				return send(provider.StreamEvent{Delta: provider.Delta{Citations: citations}}), nil
+
+			case "message_start":
+				if streamEvent.Message != nil {
+					usage = streamEvent.Message.Usage
 				}
-				return
 
 			case "message_delta":
+				event := provider.StreamEvent{}
 				if streamEvent.Delta != nil && streamEvent.Delta.StopReason != "" {
-					finishReason := streamEvent.Delta.StopReason
-					if finishReason == "tool_use" {
-						finishReason = "tool_calls"
+					event.FinishReason = toFinishReason(streamEvent.Delta.StopReason)
+				}
+				if streamEvent.Usage != nil {
+					if streamEvent.Usage.InputTokens > 0 {
+						usage.InputTokens = streamEvent.Usage.InputTokens
+					}
+					if streamEvent.Usage.CacheReadInputTokens > 0 {
+						usage.CacheReadInputTokens = streamEvent.Usage.CacheReadInputTokens
 					}
-					events <- provider.StreamEvent{
-						FinishReason: finishReason,
+					if streamEvent.Usage.CacheCreationInputTokens > 0 {
+						usage.CacheCreationInputTokens = streamEvent.Usage.CacheCreationInputTokens
 					}
+					usage.OutputTokens = streamEvent.Usage.OutputTokens
+					event.Usage = usage.toProvider()
 				}
+				if event.FinishReason != "" || event.Usage != nil {
+					finished = finished || event.FinishReason != ""
+					return send(event), nil
+				}
+
+			case "message_stop":
+				if !finished {
+					send(provider.StreamEvent{FinishReason: provider.FinishReasonStop, Usage: usage.toProvider()})
+				}
+				return false, nil
 			}
+
+			return true, nil
+		})
+		if err != nil && ctx.Err() == nil {
+			send(provider.StreamEvent{Err: err})
 		}
 	}()
 
-	return provider.NewStreamReader(events, func() { resp.Body.Close() }), nil
+	return stream, nil
 }
 
 // Anthropic-specific types
 
 type anthropicMessageRequest struct {
-	Model     string             `json:"model"`
-	Messages  []anthropicMessage `json:"messages"`
-	System    string             `json:"system,omitempty"`
-	MaxTokens int                `json:"max_tokens"`
-	Stream    bool               `json:"stream,omitempty"`
-	Tools     []anthropicTool    `json:"tools,omitempty"`
+	Model         string               `json:"model"`
+	Messages      []anthropicMessage   `json:"messages"`
+	System        []anthropicContent   `json:"system,omitempty"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	Tools         []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Options       map[string]any       `json:"-"`
+	// Betas the request needs are sent in the anthropic-beta header
+	Betas []string `json:"-"`
+}
+
+func (r *anthropicMessageRequest) MarshalJSON() ([]byte, error) {
+	type plain anthropicMessageRequest
+	data, err := json.Marshal((*plain)(r))
+	if err != nil {
+		return nil, err
+	}
+	return passthrough.Merge(data, r.Options)
 }
 
 type anthropicMessage struct {
-	Role    string               `json:"role"`
-	Content []anthropicContent   `json:"content,omitempty"`
+	Role    string             `json:"role"`
+	Content []anthropicContent `json:"content,omitempty"`
 }
 
 type anthropicContent struct {
@@ -254,13 +483,81 @@ type anthropicContent struct {
 	Name      string `json:"name,omitempty"`
 	Input     any    `json:"input,omitempty"`
 	ToolUseID string `json:"tool_use_id,omitempty"`
-	Content   string `json:"content,omitempty"`
+	// Content is the string or content blocks of a tool result
+	Content any              `json:"content,omitempty"`
+	Source  *anthropicSource `json:"source,omitempty"`
+	Title   string           `json:"title,omitempty"`
+	// Citations enables citations on a document of the request, and lists
+	// the citations of a text block of the response
+	Citations json.RawMessage `json:"citations,omitempty"`
+}
+
+type anthropicCitation struct {
+	Type            string `json:"type"`
+	CitedText       string `json:"cited_text"`
+	DocumentIndex   int    `json:"document_index"`
+	DocumentTitle   string `json:"document_title"`
+	StartCharIndex  int    `json:"start_char_index"`
+	EndCharIndex    int    `json:"end_char_index"`
+	StartPageNumber int    `json:"start_page_number"`
+	EndPageNumber   int    `json:"end_page_number"`
+	StartBlockIndex int    `json:"start_block_index"`
+	EndBlockIndex   int    `json:"end_block_index"`
+	URL             string `json:"url"`
+	Title           string `json:"title"`
+}
+
+func (c *anthropicCitation) toProvider(textStart, textEnd int) provider.Citation {
+	citation := provider.Citation{
+		Type:          c.Type,
+		CitedText:     c.CitedText,
+		DocumentIndex: c.DocumentIndex,
+		DocumentTitle: c.DocumentTitle,
+		URL:           c.URL,
+		Title:         c.Title,
+		TextStart:     textStart,
+		TextEnd:       textEnd,
+	}
+	switch c.Type {
+	case "char_location":
+		citation.SourceStart, citation.SourceEnd = c.StartCharIndex, c.EndCharIndex
+	case "page_location":
+		citation.SourceStart, citation.SourceEnd = c.StartPageNumber, c.EndPageNumber
+	case "content_block_location":
+		citation.SourceStart, citation.SourceEnd = c.StartBlockIndex, c.EndBlockIndex
+	}
+	return citation
+}
+
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+	FileID    string `json:"file_id,omitempty"`
 }
 
 type anthropicTool struct {
+	Type        string         `json:"type,omitempty"`
 	Name        string         `json:"name"`
 	Description string         `json:"description,omitempty"`
-	InputSchema map[string]any `json:"input_schema"`
+	InputSchema map[string]any `json:"input_schema,omitempty"`
+	Options     map[string]any `json:"-"`
+}
+
+func (t anthropicTool) MarshalJSON() ([]byte, error) {
+	type plain anthropicTool
+	data, err := json.Marshal(plain(t))
+	if err != nil {
+		return nil, err
+	}
+	return passthrough.Merge(data, t.Options)
+}
+
+type anthropicToolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
 }
 
 type anthropicMessageResponse struct {
@@ -272,11 +569,43 @@ type anthropicMessageResponse struct {
 	StopReason   string             `json:"stop_reason"`
 	StopSequence string             `json:"stop_sequence,omitempty"`
 	Usage        anthropicUsage     `json:"usage"`
+	Metadata     map[string]any     `json:"-"`
+}
+
+func (r *anthropicMessageResponse) UnmarshalJSON(data []byte) error {
+	type plain anthropicMessageResponse
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.Metadata = passthrough.Unknown(data, r)
+	if r.StopSequence != "" {
+		if r.Metadata == nil {
+			r.Metadata = map[string]any{}
+		}
+		r.Metadata["stop_sequence"] = r.StopSequence
+	}
+	return nil
 }
 
 type anthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+// toProvider counts the tokens read from and written to the cache, which
+// Anthropic reports apart from input_tokens, as prompt tokens, and reports
+// them in CachedTokens and CacheWriteTokens so that they are priced apart.
+func (u *anthropicUsage) toProvider() *provider.Usage {
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	return &provider.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
 }
 
 type anthropicStreamEvent struct {
@@ -285,13 +614,21 @@ type anthropicStreamEvent struct {
 	Delta        *anthropicDelta           `json:"delta,omitempty"`
 	ContentBlock *anthropicContentBlock    `json:"content_block,omitempty"`
 	Message      *anthropicMessageResponse `json:"message,omitempty"`
+	Usage        *anthropicUsage           `json:"usage,omitempty"`
+	Error        *anthropicError           `json:"error,omitempty"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
 }
 
 type anthropicDelta struct {
-	Type        string `json:"type,omitempty"`
-	Text        string `json:"text,omitempty"`
-	PartialJSON string `json:"partial_json,omitempty"`
-	StopReason  string `json:"stop_reason,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Text        string             `json:"text,omitempty"`
+	PartialJSON string             `json:"partial_json,omitempty"`
+	StopReason  string             `json:"stop_reason,omitempty"`
+	Citation    *anthropicCitation `json:"citation,omitempty"`
 }
 
 type anthropicContentBlock struct {
@@ -300,28 +637,151 @@ type anthropicContentBlock struct {
 	Name  string `json:"name,omitempty"`
 	Input any    `json:"input,omitempty"`
 	Text  string `json:"text,omitempty"`
+	// ToolUseID and Content are set on the results of server tools
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+}
+
+func (a *anthropic) toAnthropicRequest(req *provider.ChatRequest, model string) (*anthropicMessageRequest, error) {
+	system, messages, err := toAnthropicMessages(req.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	var tools []anthropicTool
+	computerUse, codeExecution := false, false
+	for _, t := range req.Tools {
+		switch t.Type {
+		case provider.ToolCodeInterpreter:
+			tools = append(tools, anthropicTool{
+				Type:    codeExecutionTool,
+				Name:    "code_execution",
+				Options: t.Options,
+			})
+			codeExecution = true
+			continue
+		case provider.ToolFileSearch:
+			return nil, fmt.Errorf("anthropic has no %s tool", t.Type)
+		}
+		if version, ok := computerUseTools[t.Type]; ok {
+			tools = append(tools, anthropicTool{
+				Type:    version,
+				Name:    t.Function.Name,
+				Options: t.Options,
+			})
+			computerUse = true
+			continue
+		}
+		if t.Type == provider.ToolWebSearch {
+			tools = append(tools, anthropicTool{
+				Type:    webSearchTool,
+				Name:    "web_search",
+				Options: t.Options,
+			})
+			continue
+		}
+		tools = append(tools, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: t.Function.Parameters,
+		})
+	}
+
+	maxTokens, err := resolveMaxTokens(model, req.MaxTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	var betas []string
+	if usesFiles(messages) {
+		betas = append(betas, BetaFiles)
+	}
+	if computerUse {
+		betas = append(betas, BetaComputerUse)
+	}
+	if codeExecution {
+		betas = append(betas, BetaCodeExecution)
+	}
+
+	// Anthropic rejects a tool choice without tools
+	var toolChoice *anthropicToolChoice
+	if len(tools) > 0 {
+		toolChoice = toAnthropicToolChoice(req.ToolChoice, req.ParallelToolCalls)
+	}
+
+	return &anthropicMessageRequest{
+		Model:         model,
+		Messages:      messages,
+		System:        system,
+		MaxTokens:     maxTokens,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+		Tools:         tools,
+		ToolChoice:    toolChoice,
+		Options:       req.ProviderOptions,
+		Betas:         betas,
+	}, nil
 }
 
-func (a *anthropic) toAnthropicRequest(req *provider.ChatRequest, model string) *anthropicMessageRequest {
-	var systemPrompt string
+// toAnthropicMessages converts messages to the system prompt and the turns
+// of a Messages API request.
+func toAnthropicMessages(msgs []provider.Message) ([]anthropicContent, []anthropicMessage, error) {
+	if err := provider.ValidateParts(msgs); err != nil {
+		return nil, nil, err
+	}
+	var system []anthropicContent
 	var messages []anthropicMessage
 
-	for _, msg := range req.Messages {
+	for _, msg := range msgs {
 		switch msg.Role {
 		case provider.RoleSystem:
-			systemPrompt = msg.Content
+			// Anthropic only takes a system prompt ahead of the conversation;
+			// later system messages become a prefix of the next user turn
+			if len(messages) == 0 {
+				system = append(system, anthropicContent{
+					Type: "text",
+					Text: msg.Content,
+				})
+			} else {
+				messages = appendUser(messages, anthropicContent{
+					Type: "text",
+					Text: "System: " + msg.Content,
+				})
+			}
 
 		case provider.RoleUser:
-			messages = append(messages, anthropicMessage{
-				Role: "user",
-				Content: []anthropicContent{{
+			if msg.Content != "" || len(msg.Parts) == 0 {
+				messages = appendUser(messages, anthropicContent{
 					Type: "text",
 					Text: msg.Content,
-				}},
-			})
+				})
+			}
+			for _, part := range msg.Parts {
+				content, err := toAnthropicContent(part)
+				if err != nil {
+					return nil, nil, err
+				}
+				messages = appendUser(messages, content)
+			}
 
 		case provider.RoleAssistant:
 			var content []anthropicContent
+			for _, hosted := range msg.HostedTools {
+				content = append(content, anthropicContent{
+					Type:  "server_tool_use",
+					ID:    hosted.ID,
+					Name:  hosted.Name,
+					Input: hosted.Input,
+				})
+				if len(hosted.Result) > 0 {
+					var result anthropicContent
+					if err := json.Unmarshal(hosted.Result, &result); err != nil {
+						return nil, nil, fmt.Errorf("invalid result of hosted tool %s: %w", hosted.ID, err)
+					}
+					content = append(content, result)
+				}
+			}
 			if msg.Content != "" {
 				content = append(content, anthropicContent{
 					Type: "text",
@@ -348,48 +808,188 @@ func (a *anthropic) toAnthropicRequest(req *provider.ChatRequest, model string)
 			}
 
 		case provider.RoleTool:
-			messages = append(messages, anthropicMessage{
-				Role: "user",
-				Content: []anthropicContent{{
-					Type:      "tool_result",
-					ToolUseID: msg.ToolCallID,
-					Content:   msg.Content,
-				}},
-			})
+			result := anthropicContent{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			}
+			if len(msg.Parts) > 0 {
+				var blocks []anthropicContent
+				if msg.Content != "" {
+					blocks = append(blocks, anthropicContent{Type: "text", Text: msg.Content})
+				}
+				for _, part := range msg.Parts {
+					block, err := toAnthropicContent(part)
+					if err != nil {
+						return nil, nil, err
+					}
+					blocks = append(blocks, block)
+				}
+				result.Content = blocks
+			}
+			messages = appendUser(messages, result)
 		}
 	}
+	return system, messages, nil
+}
 
-	var tools []anthropicTool
-	for _, t := range req.Tools {
-		tools = append(tools, anthropicTool{
-			Name:        t.Function.Name,
-			Description: t.Function.Description,
-			InputSchema: t.Function.Parameters,
-		})
+func toAnthropicContent(part provider.Part) (anthropicContent, error) {
+	switch part.Type {
+	case provider.PartText:
+		return anthropicContent{Type: "text", Text: part.Text}, nil
+	case provider.PartJSON:
+		return anthropicContent{Type: "text", Text: string(part.JSON)}, nil
+	case provider.PartImage:
+		source := &anthropicSource{Type: "url", URL: part.Image.URL}
+		if part.Image.Data != "" {
+			source = &anthropicSource{Type: "base64", MediaType: part.Image.MediaType, Data: part.Image.Data}
+		}
+		return anthropicContent{Type: "image", Source: source}, nil
+	case provider.PartDocument:
+		source, err := toDocumentSource(part.Document)
+		if err != nil {
+			return anthropicContent{}, err
+		}
+		content := anthropicContent{Type: "document", Source: source, Title: part.Document.Title}
+		if part.Document.Citations {
+			content.Citations = json.RawMessage(`{"enabled":true}`)
+		}
+		return content, nil
+	default:
+		return anthropicContent{}, fmt.Errorf("unsupported content part: %s", part.Type)
 	}
+}
 
-	maxTokens := defaultMaxTokens
-	if req.MaxTokens != nil {
-		maxTokens = *req.MaxTokens
+// toDocumentSource inlines PDFs as base64 and plain text documents as
+// text, the two encodings the API accepts.
+func toDocumentSource(doc *provider.Document) (*anthropicSource, error) {
+	switch {
+	case doc.FileID != "":
+		return &anthropicSource{Type: "file", FileID: doc.FileID}, nil
+	case strings.HasPrefix(doc.MediaType, "text/"):
+		data, err := base64.StdEncoding.DecodeString(doc.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document data: %w", err)
+		}
+		return &anthropicSource{Type: "text", MediaType: "text/plain", Data: string(data)}, nil
+	default:
+		return &anthropicSource{Type: "base64", MediaType: doc.MediaType, Data: doc.Data}, nil
 	}
+}
 
-	return &anthropicMessageRequest{
-		Model:     model,
-		Messages:  messages,
-		System:    systemPrompt,
-		MaxTokens: maxTokens,
-		Tools:     tools,
+// isServerToolResult reports whether a content block of type typ is the
+// result of a server tool, such as web_search_tool_result.
+func isServerToolResult(typ string) bool {
+	return strings.HasSuffix(typ, "_tool_result")
+}
+
+// usesFiles reports whether messages reference uploaded files, which
+// requires the files beta.
+func usesFiles(messages []anthropicMessage) bool {
+	for _, msg := range messages {
+		for _, content := range msg.Content {
+			if content.Source != nil && content.Source.Type == "file" {
+				return true
+			}
+			if blocks, ok := content.Content.([]anthropicContent); ok {
+				for _, block := range blocks {
+					if block.Source != nil && block.Source.Type == "file" {
+						return true
+					}
+				}
+			}
+		}
 	}
+	return false
+}
+
+// appendUser adds content to the conversation as a user turn, merging it
+// into the previous turn when that is already a user turn.
+func appendUser(messages []anthropicMessage, content anthropicContent) []anthropicMessage {
+	if n := len(messages); n > 0 && messages[n-1].Role == "user" {
+		messages[n-1].Content = append(messages[n-1].Content, content)
+		return messages
+	}
+	return append(messages, anthropicMessage{
+		Role:    "user",
+		Content: []anthropicContent{content},
+	})
+}
+
+func toAnthropicToolChoice(choice *provider.ToolChoice, parallel *bool) *anthropicToolChoice {
+	// Anthropic sets parallel tool use on the tool choice, which defaults to auto
+	sequential := parallel != nil && !*parallel
+	if choice == nil {
+		if sequential {
+			return &anthropicToolChoice{Type: "auto", DisableParallelToolUse: true}
+		}
+		return nil
+	}
+
+	var tc *anthropicToolChoice
+	switch choice.Type {
+	case "any", "required":
+		tc = &anthropicToolChoice{Type: "any"}
+	case "none":
+		return &anthropicToolChoice{Type: "none"}
+	case "function":
+		tc = &anthropicToolChoice{Type: "tool", Name: choice.Function}
+	default:
+		tc = &anthropicToolChoice{Type: "auto"}
+	}
+	tc.DisableParallelToolUse = sequential
+	return tc
 }
 
 func (a *anthropic) toProviderResponse(resp *anthropicMessageResponse) *provider.ChatResponse {
+	msg, citations := toProviderMessage(resp.Content)
+	return &provider.ChatResponse{
+		ID:     resp.ID,
+		Object: "chat.completion",
+		Model:  resp.Model,
+		Choices: []provider.Choice{{
+			Index:        0,
+			Message:      msg,
+			FinishReason: toFinishReason(resp.StopReason),
+			Citations:    citations,
+		}},
+		Usage:            *resp.Usage.toProvider(),
+		ProviderMetadata: resp.Metadata,
+	}
+}
+
+// toProviderMessage converts the content blocks of an assistant turn to a
+// message and the citations of its text.
+func toProviderMessage(blocks []anthropicContent) (provider.Message, []provider.Citation) {
 	var content string
 	var toolCalls []provider.ToolCall
+	var citations []provider.Citation
+	var hosted []provider.HostedToolUse
 
-	for i, c := range resp.Content {
+	for i, c := range blocks {
+		if isServerToolResult(c.Type) {
+			for j := range hosted {
+				if hosted[j].ID == c.ToolUseID {
+					hosted[j].Result, _ = json.Marshal(c)
+				}
+			}
+			continue
+		}
 		switch c.Type {
 		case "text":
+			start := len(content)
 			content += c.Text
+			if len(c.Citations) > 0 {
+				var blockCitations []anthropicCitation
+				if err := json.Unmarshal(c.Citations, &blockCitations); err == nil {
+					for _, citation := range blockCitations {
+						citations = append(citations, citation.toProvider(start, len(content)))
+					}
+				}
+			}
+		case "server_tool_use":
+			inputJSON, _ := json.Marshal(c.Input)
+			hosted = append(hosted, provider.HostedToolUse{ID: c.ID, Name: c.Name, Input: inputJSON})
 		case "tool_use":
 			inputJSON, _ := json.Marshal(c.Input)
 			toolCalls = append(toolCalls, provider.ToolCall{
@@ -404,30 +1004,23 @@ func (a *anthropic) toProviderResponse(resp *anthropicMessageResponse) *provider
 		}
 	}
 
-	finishReason := resp.StopReason
-	if finishReason == "tool_use" {
-		finishReason = "tool_calls"
-	} else if finishReason == "end_turn" {
-		finishReason = "stop"
+	msg := provider.Message{
+		Role:        provider.RoleAssistant,
+		Content:     content,
+		ToolCalls:   toolCalls,
+		HostedTools: hosted,
 	}
+	return msg, citations
+}
 
-	return &provider.ChatResponse{
-		ID:      resp.ID,
-		Object:  "chat.completion",
-		Model:   resp.Model,
-		Choices: []provider.Choice{{
-			Index: 0,
-			Message: provider.Message{
-				Role:      provider.RoleAssistant,
-				Content:   content,
-				ToolCalls: toolCalls,
-			},
-			FinishReason: finishReason,
-		}},
-		Usage: provider.Usage{
-			PromptTokens:     resp.Usage.InputTokens,
-			CompletionTokens: resp.Usage.OutputTokens,
-			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
-		},
+func toFinishReason(stopReason string) string {
+	switch stopReason {
+	case "end_turn", "stop_sequence":
+		return provider.FinishReasonStop
+	case "max_tokens":
+		return provider.FinishReasonLength
+	case "tool_use":
+		return provider.FinishReasonToolCalls
 	}
+	return stopReason
 }
@@ -0,0 +1,221 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexisbouchez/ai/batch"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type anthropicBatchRequest struct {
+	CustomID string                   `json:"custom_id"`
+	Params   *anthropicMessageRequest `json:"params"`
+}
+
+type anthropicBatch struct {
+	ID               string    `json:"id"`
+	ProcessingStatus string    `json:"processing_status"`
+	ResultsURL       string    `json:"results_url"`
+	CreatedAt        time.Time `json:"created_at"`
+	RequestCounts    struct {
+		Processing int `json:"processing"`
+		Succeeded  int `json:"succeeded"`
+		Errored    int `json:"errored"`
+		Canceled   int `json:"canceled"`
+		Expired    int `json:"expired"`
+	} `json:"request_counts"`
+}
+
+type anthropicBatchResult struct {
+	CustomID string `json:"custom_id"`
+	Result   struct {
+		Type    string                    `json:"type"`
+		Message *anthropicMessageResponse `json:"message"`
+		Error   *struct {
+			Error *anthropicError `json:"error"`
+		} `json:"error"`
+	} `json:"result"`
+}
+
+func (a *anthropic) SubmitBatch(ctx context.Context, reqs []provider.ChatRequest) (*batch.Job, error) {
+	requests := make([]anthropicBatchRequest, len(reqs))
+	for i := range reqs {
+		model := reqs[i].Model
+		if model == "" {
+			model = a.model
+		}
+		params, err := a.toAnthropicRequest(&reqs[i], model)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request %d: %w", i, err)
+		}
+		requests[i] = anthropicBatchRequest{
+			CustomID: batch.CustomID(i),
+			Params:   params,
+		}
+	}
+
+	body, err := json.Marshal(map[string]any{"requests": requests})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := a.do(ctx, http.MethodPost, a.baseURL+"/v1/messages/batches", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return toBatchJob(respBody)
+}
+
+func (a *anthropic) PollBatch(ctx context.Context, id string) (*batch.Job, error) {
+	respBody, err := a.do(ctx, http.MethodGet, a.baseURL+"/v1/messages/batches/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	return toBatchJob(respBody)
+}
+
+func (a *anthropic) CancelBatch(ctx context.Context, id string) (*batch.Job, error) {
+	respBody, err := a.do(ctx, http.MethodPost, a.baseURL+"/v1/messages/batches/"+id+"/cancel", nil)
+	if err != nil {
+		return nil, err
+	}
+	return toBatchJob(respBody)
+}
+
+func (a *anthropic) BatchResults(ctx context.Context, id string) ([]batch.Result, error) {
+	respBody, err := a.do(ctx, http.MethodGet, a.baseURL+"/v1/messages/batches/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var b anthropicBatch
+	if err := json.Unmarshal(respBody, &b); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if b.ResultsURL == "" {
+		return nil, fmt.Errorf("batch %s has no results yet", id)
+	}
+
+	content, err := a.do(ctx, http.MethodGet, b.ResultsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := a.parseBatchResults(content)
+	if err != nil {
+		return nil, err
+	}
+	batch.SortResults(results)
+	return results, nil
+}
+
+func (a *anthropic) parseBatchResults(content []byte) ([]batch.Result, error) {
+	var results []batch.Result
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line anthropicBatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("failed to parse batch result: %w", err)
+		}
+
+		result := batch.Result{Index: batch.Index(line.CustomID), CustomID: line.CustomID}
+		switch line.Result.Type {
+		case "succeeded":
+			result.Response = a.toProviderResponse(line.Result.Message)
+		case "errored":
+			var e *anthropicError
+			if line.Result.Error != nil {
+				e = line.Result.Error.Error
+			}
+			result.Err = toStreamError(e)
+		default:
+			result.Err = fmt.Errorf("batch request %s", line.Result.Type)
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+func (a *anthropic) do(ctx context.Context, method, url string, body io.Reader) ([]byte, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if a.apiKey != "" {
+		httpReq.Header.Set("x-api-key", a.apiKey)
+	}
+	httpReq.Header.Set("anthropic-version", apiVersion)
+	for k, v := range a.headers {
+		httpReq.Header.Set(k, v)
+	}
+	provider.ApplyContext(httpReq)
+	a.setBetas(httpReq, nil)
+
+	resp, err := a.client().Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, toAPIError(resp.StatusCode, resp.Header, respBody)
+	}
+	return respBody, nil
+}
+
+func toBatchJob(data []byte) (*batch.Job, error) {
+	var b anthropicBatch
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	counts := b.RequestCounts
+	job := &batch.Job{
+		ID:        b.ID,
+		Total:     counts.Processing + counts.Succeeded + counts.Errored + counts.Canceled + counts.Expired,
+		Succeeded: counts.Succeeded,
+		Failed:    counts.Errored + counts.Canceled + counts.Expired,
+		CreatedAt: b.CreatedAt,
+	}
+
+	switch b.ProcessingStatus {
+	case "in_progress", "canceling":
+		job.Status = batch.StatusRunning
+	case "ended":
+		// an ended batch reports how it ended only through its request counts
+		switch {
+		case counts.Canceled > 0 && counts.Succeeded == 0:
+			job.Status = batch.StatusCancelled
+		case counts.Expired > 0 && counts.Succeeded == 0:
+			job.Status = batch.StatusExpired
+		default:
+			job.Status = batch.StatusCompleted
+		}
+	default:
+		job.Status = batch.Status(strings.ToLower(b.ProcessingStatus))
+	}
+	return job, nil
+}
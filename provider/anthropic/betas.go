@@ -0,0 +1,79 @@
+package anthropic
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type betasKey struct{}
+
+// WithBetas returns a middleware enabling beta features on the requests of
+// an Anthropic provider, wrapped or not:
+//
+//	p := provider.Chain(anthropic.New(), anthropic.WithBetas(anthropic.BetaContext1M))
+//
+// The anthropic-beta header lists them along with the betas a request
+// needs, such as BetaFiles for messages referencing uploaded files, and
+// those set with WithHeaders or provider.WithHeader.
+func WithBetas(betas ...string) provider.Middleware {
+	var mw provider.Middleware
+	mw = func(p provider.Provider) provider.Provider {
+		return &withBetas{Wrapper: provider.Wrapper{Next: p, Wrap: mw}, betas: betas}
+	}
+	return mw
+}
+
+type withBetas struct {
+	provider.Wrapper
+	betas []string
+}
+
+func (b *withBetas) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	return b.Next.Chat(enableBetas(ctx, b.betas), req)
+}
+
+func (b *withBetas) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	return b.Next.Stream(enableBetas(ctx, b.betas), req)
+}
+
+func enableBetas(ctx context.Context, betas []string) context.Context {
+	enabled, _ := ctx.Value(betasKey{}).([]string)
+	return context.WithValue(ctx, betasKey{}, slices.Concat(enabled, betas))
+}
+
+// setBetas sets the anthropic-beta header of httpReq to the betas set with
+// WithHeaders and provider.WithHeader, those enabled with WithBetas and
+// betas, without duplicates.
+func (a *anthropic) setBetas(httpReq *http.Request, betas []string) {
+	var values []string
+	for k, v := range a.headers {
+		if http.CanonicalHeaderKey(k) == "Anthropic-Beta" {
+			values = append(values, v)
+		}
+	}
+	values = append(values, httpReq.Header.Values("anthropic-beta")...)
+
+	var all []string
+	for _, value := range values {
+		for beta := range strings.SplitSeq(value, ",") {
+			all = append(all, strings.TrimSpace(beta))
+		}
+	}
+	enabled, _ := httpReq.Context().Value(betasKey{}).([]string)
+	all = append(all, enabled...)
+	all = append(all, betas...)
+
+	var merged []string
+	for _, beta := range all {
+		if beta != "" && !slices.Contains(merged, beta) {
+			merged = append(merged, beta)
+		}
+	}
+	if len(merged) > 0 {
+		httpReq.Header.Set("anthropic-beta", strings.Join(merged, ","))
+	}
+}
@@ -0,0 +1,81 @@
+package anthropic
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxTokens is the max_tokens sent when ChatRequest.MaxTokens is
+// unset, lowered to the limit of models supporting less. Anthropic requires
+// the field, and larger values make long non-streaming requests time out.
+const DefaultMaxTokens = 8192
+
+var (
+	mu              sync.RWMutex
+	maxOutputTokens = map[string]int{
+		"claude-opus-4-5":   64000,
+		"claude-opus-4":     32000,
+		"claude-sonnet-4":   64000,
+		"claude-haiku-4-5":  64000,
+		"claude-3-7-sonnet": 64000,
+		"claude-3-5-sonnet": 8192,
+		"claude-3-5-haiku":  8192,
+		"claude-3-opus":     4096,
+		"claude-3-sonnet":   4096,
+		"claude-3-haiku":    4096,
+	}
+)
+
+// MaxTokensError is returned when a request asks for more output tokens
+// than the model supports.
+type MaxTokensError struct {
+	Model     string
+	Requested int
+	Max       int
+}
+
+func (e *MaxTokensError) Error() string {
+	return fmt.Sprintf("max tokens %d exceeds the limit of %d for %s", e.Requested, e.Max, e.Model)
+}
+
+// MaxOutputTokens returns the output token limit of model, matching the
+// longest known prefix. It reports false when the model is unknown.
+func MaxOutputTokens(model string) (int, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var best string
+	var limit int
+	var found bool
+	for prefix, n := range maxOutputTokens {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, limit, found = prefix, n, true
+		}
+	}
+	return limit, found
+}
+
+// SetMaxOutputTokens sets the output token limit of the models starting
+// with prefix.
+func SetMaxOutputTokens(prefix string, limit int) {
+	mu.Lock()
+	defer mu.Unlock()
+	maxOutputTokens[prefix] = limit
+}
+
+// resolveMaxTokens returns the max_tokens to send for model, defaulting to
+// DefaultMaxTokens and rejecting requests above the model limit.
+func resolveMaxTokens(model string, requested *int) (int, error) {
+	limit, known := MaxOutputTokens(model)
+	if requested == nil {
+		if known && limit < DefaultMaxTokens {
+			return limit, nil
+		}
+		return DefaultMaxTokens, nil
+	}
+	if known && *requested > limit {
+		return 0, &MaxTokensError{Model: model, Requested: *requested, Max: limit}
+	}
+	return *requested, nil
+}
@@ -0,0 +1,69 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/sse"
+)
+
+// readEvents parses a server-sent event stream and calls handle with the type
+// and data of every complete event. Parsing stops when handle returns false
+// or an error.
+func readEvents(r io.Reader, handle func(eventType, data string) (bool, error)) error {
+	reader := sse.NewReader(r)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+
+		more, err := handle(event.Type, event.Data)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// Status codes Anthropic uses for each error type, so stream-level errors
+// classify the same way as HTTP errors.
+var errorStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"permission_error":      http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"request_too_large":     http.StatusRequestEntityTooLarge,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"overloaded_error":      529,
+}
+
+func toStreamError(e *anthropicError) error {
+	if e == nil {
+		return &provider.APIError{StatusCode: http.StatusInternalServerError, Type: "api_error", Message: "unknown stream error"}
+	}
+	return &provider.APIError{
+		StatusCode: errorStatus[e.Type],
+		Type:       e.Type,
+		Message:    e.Message,
+	}
+}
+
+func toAPIError(statusCode int, header http.Header, body []byte) error {
+	apiErr := &provider.APIError{StatusCode: statusCode, Body: string(body), RateLimit: provider.ParseRateLimit(header)}
+
+	var errResp struct {
+		Error *anthropicError `json:"error"`
+	}
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error != nil {
+		apiErr.Type = errResp.Error.Type
+		apiErr.Message = errResp.Error.Message
+	}
+	return apiErr
+}
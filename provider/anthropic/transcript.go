@@ -0,0 +1,188 @@
+package anthropic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// transcript is the conversation of a Messages API request.
+type transcript struct {
+	System   json.RawMessage `json:"system,omitempty"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+}
+
+// ImportMessages converts a Messages API payload, or its messages array
+// alone, to messages. The system prompt comes first as system messages, and
+// tool results become tool messages. Thinking blocks are dropped.
+func ImportMessages(data []byte) ([]provider.Message, error) {
+	var t transcript
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &t.Messages); err != nil {
+			return nil, fmt.Errorf("invalid messages: %w", err)
+		}
+	} else if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("invalid messages: %w", err)
+	}
+
+	system, err := parseContent(t.System)
+	if err != nil {
+		return nil, fmt.Errorf("invalid system prompt: %w", err)
+	}
+	var messages []provider.Message
+	for _, block := range system {
+		messages = append(messages, provider.Message{Role: provider.RoleSystem, Content: block.Text})
+	}
+
+	for i, msg := range t.Messages {
+		blocks, err := parseContent(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message %d: %w", i, err)
+		}
+		if msg.Role == "assistant" {
+			assistant, _ := toProviderMessage(blocks)
+			messages = append(messages, assistant)
+			continue
+		}
+
+		user := provider.Message{Role: provider.RoleUser}
+		flush := func() {
+			if user.Content != "" || len(user.Parts) > 0 {
+				messages = append(messages, user)
+				user = provider.Message{Role: provider.RoleUser}
+			}
+		}
+		for _, block := range blocks {
+			if block.Type == "tool_result" {
+				flush()
+				result, err := toToolMessage(block)
+				if err != nil {
+					return nil, fmt.Errorf("invalid message %d: %w", i, err)
+				}
+				messages = append(messages, result)
+				continue
+			}
+			if err := addContent(&user, block); err != nil {
+				return nil, fmt.Errorf("invalid message %d: %w", i, err)
+			}
+		}
+		flush()
+	}
+	return messages, nil
+}
+
+// ExportMessages converts messages to the system and messages fields of a
+// Messages API payload.
+func ExportMessages(messages []provider.Message) ([]byte, error) {
+	system, turns, err := toAnthropicMessages(messages)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(struct {
+		System   []anthropicContent `json:"system,omitempty"`
+		Messages []anthropicMessage `json:"messages"`
+	}{system, turns})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal messages: %w", err)
+	}
+	return data, nil
+}
+
+// parseContent parses message content, a string or content blocks.
+func parseContent(raw json.RawMessage) ([]anthropicContent, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return []anthropicContent{{Type: "text", Text: text}}, nil
+	}
+	var blocks []anthropicContent
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func toToolMessage(block anthropicContent) (provider.Message, error) {
+	msg := provider.Message{Role: provider.RoleTool, ToolCallID: block.ToolUseID}
+	raw, err := json.Marshal(block.Content)
+	if err != nil {
+		return provider.Message{}, err
+	}
+	blocks, err := parseContent(raw)
+	if err != nil {
+		return provider.Message{}, err
+	}
+	for _, b := range blocks {
+		if err := addContent(&msg, b); err != nil {
+			return provider.Message{}, err
+		}
+	}
+	return msg, nil
+}
+
+// addContent adds a content block to msg, the first text as its Content and
+// the others as parts.
+func addContent(msg *provider.Message, block anthropicContent) error {
+	switch block.Type {
+	case "text":
+		if msg.Content == "" && len(msg.Parts) == 0 {
+			msg.Content = block.Text
+		} else {
+			msg.Parts = append(msg.Parts, provider.TextPart(block.Text))
+		}
+	case "image":
+		if block.Source == nil {
+			return fmt.Errorf("image without source")
+		}
+		image := &provider.Image{URL: block.Source.URL}
+		if block.Source.Type == "base64" {
+			image = &provider.Image{Data: block.Source.Data, MediaType: block.Source.MediaType}
+		}
+		msg.Parts = append(msg.Parts, provider.Part{Type: provider.PartImage, Image: image})
+	case "document":
+		doc, err := toDocument(block)
+		if err != nil {
+			return err
+		}
+		msg.Parts = append(msg.Parts, provider.Part{Type: provider.PartDocument, Document: doc})
+	case "thinking", "redacted_thinking":
+	default:
+		return fmt.Errorf("unsupported content block: %s", block.Type)
+	}
+	return nil
+}
+
+func toDocument(block anthropicContent) (*provider.Document, error) {
+	source := block.Source
+	if source == nil {
+		return nil, fmt.Errorf("document without source")
+	}
+	doc := &provider.Document{Title: block.Title}
+	if len(block.Citations) > 0 {
+		var citations struct {
+			Enabled bool `json:"enabled"`
+		}
+		json.Unmarshal(block.Citations, &citations)
+		doc.Citations = citations.Enabled
+	}
+	switch source.Type {
+	case "file":
+		doc.FileID = source.FileID
+	case "text":
+		doc.Data = base64.StdEncoding.EncodeToString([]byte(source.Data))
+		doc.MediaType = "text/plain"
+	case "base64":
+		doc.Data, doc.MediaType = source.Data, source.MediaType
+	default:
+		return nil, fmt.Errorf("unsupported document source: %s", source.Type)
+	}
+	return doc, nil
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrJobCancelled is returned when polling a cancelled job.
+var ErrJobCancelled = errors.New("job cancelled")
+
+// JobStatus is the state of a chat running in the background.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Done reports whether s is a final status.
+func (s JobStatus) Done() bool {
+	switch s {
+	case JobCompleted, JobFailed, JobCancelled:
+		return true
+	}
+	return false
+}
+
+// JobHandle is a chat running in the background on the provider, such as a
+// long reasoning job. Its ID is enough to find it again with
+// AsyncChatter.Job, from another process or after a restart.
+type JobHandle interface {
+	ID() string
+	// Poll returns the status of the job, and its response once completed.
+	// A failed job returns its error, and a cancelled one ErrJobCancelled.
+	Poll(ctx context.Context) (JobStatus, *ChatResponse, error)
+	// Stream streams the response from its start, replaying the events
+	// generated so far, until the job is done
+	Stream(ctx context.Context) (*StreamReader, error)
+	Cancel(ctx context.Context) error
+}
+
+// AsyncChatter is implemented by providers that can run chats in the
+// background: AsyncChat returns once the job is submitted, and the
+// response is polled or streamed later.
+type AsyncChatter interface {
+	AsyncChat(ctx context.Context, req *ChatRequest) (JobHandle, error)
+	// Job returns the handle of the job with id
+	Job(id string) JobHandle
+}
+
+// Await polls job every interval until it is done, and returns its
+// response.
+func Await(ctx context.Context, job JobHandle, interval time.Duration) (*ChatResponse, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid poll interval %s", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, resp, err := job.Poll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if status.Done() {
+			return resp, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Scorer rates a candidate choice. Higher scores are better.
+type Scorer func(ctx context.Context, choice Choice) (float64, error)
+
+// BestOf generates req.N candidates and returns the response reduced to the
+// highest scoring one, with the usage of every call. Candidates the
+// provider does not return natively are generated by parallel calls.
+func BestOf(ctx context.Context, p Provider, req *ChatRequest, scorer Scorer) (*ChatResponse, error) {
+	n := 1
+	if req.N != nil {
+		n = *req.N
+	}
+
+	resp, err := p.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	choices := resp.Choices
+	usage := resp.Usage
+
+	if missing := n - len(choices); missing > 0 {
+		single := *req
+		single.N = nil
+		// Each call is a distinct request, so none may reuse the key
+		single.IdempotencyKey = ""
+
+		resps := make([]*ChatResponse, missing)
+		errs := make([]error, missing)
+		var wg sync.WaitGroup
+		for i := range missing {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resps[i], errs[i] = p.Chat(ctx, &single)
+			}()
+		}
+		wg.Wait()
+
+		for i, extra := range resps {
+			if errs[i] != nil {
+				return nil, fmt.Errorf("failed to generate candidate: %w", errs[i])
+			}
+			choices = append(choices, extra.Choices...)
+			usage.PromptTokens += extra.Usage.PromptTokens
+			usage.CompletionTokens += extra.Usage.CompletionTokens
+			usage.TotalTokens += extra.Usage.TotalTokens
+		}
+	}
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("no candidates returned")
+	}
+
+	scores := make([]float64, len(choices))
+	errs := make([]error, len(choices))
+	var wg sync.WaitGroup
+	for i, choice := range choices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scores[i], errs[i] = scorer(ctx, choice)
+		}()
+	}
+	wg.Wait()
+
+	best := 0
+	for i := range choices {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("failed to score candidate %d: %w", i, errs[i])
+		}
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+
+	result := *resp
+	choice := choices[best]
+	choice.Index = 0
+	result.Choices = []Choice{choice}
+	result.Usage = usage
+	return &result, nil
+}
@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"slices"
+	"time"
+)
+
+// Overflow is the policy of a full stream buffer.
+type Overflow int
+
+const (
+	// OverflowBlock stops reading the response until the reader catches up.
+	OverflowBlock Overflow = iota
+	// OverflowCoalesce merges the buffered deltas into fewer events, and
+	// blocks when they cannot be merged.
+	OverflowCoalesce
+	// OverflowDropOldest merges the buffered deltas, then drops the oldest
+	// ones when the buffer is still full. The text of dropped deltas is lost,
+	// but finish reasons, usage and errors are always delivered.
+	OverflowDropOldest
+)
+
+// StreamOption configures a StreamReader.
+type StreamOption func(*StreamReader)
+
+// Buffer returns a StreamOption queueing up to size events between the
+// producer and the reader, handling a full queue with overflow. Providers
+// pass it ChatRequest.StreamBuffer and ChatRequest.StreamOverflow.
+func Buffer(size int, overflow Overflow) StreamOption {
+	return func(s *StreamReader) {
+		s.size = size
+		s.overflow = overflow
+	}
+}
+
+// buffer moves the events of the producer to the reader through a queue,
+// so that the producer only waits when the queue is full and the overflow
+// policy blocks.
+func (s *StreamReader) buffer() {
+	defer close(s.events)
+
+	source := s.source
+	var queue []StreamEvent
+	for source != nil || len(queue) > 0 {
+		recv := source
+		if len(queue) >= s.size && s.overflow != OverflowDropOldest {
+			recv = nil
+		}
+		var send chan StreamEvent
+		var next StreamEvent
+		if len(queue) > 0 {
+			send = s.events
+			next = queue[0]
+		}
+
+		select {
+		case event, ok := <-recv:
+			if !ok {
+				source = nil
+				continue
+			}
+			queue = append(queue, event)
+			if len(queue) >= s.size && s.overflow != OverflowBlock {
+				queue = coalesce(queue)
+			}
+			if len(queue) > s.size && s.overflow == OverflowDropOldest {
+				queue = dropOldest(queue)
+			}
+		case send <- next:
+			queue = queue[1:]
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// coalesce merges the consecutive events of queue that can be merged.
+func coalesce(queue []StreamEvent) []StreamEvent {
+	merged := queue[:1]
+	for _, event := range queue[1:] {
+		last := &merged[len(merged)-1]
+		if !mergeEvent(last, event) {
+			merged = append(merged, event)
+		}
+	}
+	return merged
+}
+
+// mergeEvent appends the delta of event to dst, which it reports it could
+// do when both are of the same choice and dst neither ends the choice nor
+// carries usage, timing or an error.
+func mergeEvent(dst *StreamEvent, event StreamEvent) bool {
+	if dst.Index != event.Index || dst.FinishReason != "" || dst.Usage != nil || dst.Timing != nil || dst.Err != nil || event.Err != nil {
+		return false
+	}
+	dst.Delta.Content += event.Delta.Content
+	dst.Delta.ToolCalls = slices.Concat(dst.Delta.ToolCalls, event.Delta.ToolCalls)
+	dst.Delta.Citations = slices.Concat(dst.Delta.Citations, event.Delta.Citations)
+	dst.Delta.HostedTools = slices.Concat(dst.Delta.HostedTools, event.Delta.HostedTools)
+	dst.FinishReason = event.FinishReason
+	dst.Usage = event.Usage
+	dst.Timing = event.Timing
+	return true
+}
+
+// dropOldest removes the oldest event of queue carrying nothing but text.
+func dropOldest(queue []StreamEvent) []StreamEvent {
+	for i, event := range queue {
+		if event.FinishReason == "" && event.Usage == nil && event.Timing == nil && event.Err == nil &&
+			len(event.Delta.ToolCalls) == 0 && len(event.Delta.Citations) == 0 && len(event.Delta.HostedTools) == 0 {
+			return append(queue[:i], queue[i+1:]...)
+		}
+	}
+	return queue
+}
+
+// Coalesce returns a reader merging the deltas of s into events of at least
+// minBytes of content, for consumers that don't need every token. A merged
+// event is delivered early when it has waited maxLatency, zero waiting for
+// minBytes however long it takes, and when the choice changes, finishes or
+// fails. s must not be read afterwards, and closing the returned reader
+// closes s.
+func (s *StreamReader) Coalesce(minBytes int, maxLatency time.Duration) *StreamReader {
+	events := make(chan StreamEvent)
+	coalesced := NewStreamReader(events, s.Close)
+
+	go func() {
+		defer close(events)
+
+		var pending *StreamEvent
+		var deadline <-chan time.Time
+		flush := func() bool {
+			if pending == nil {
+				return true
+			}
+			event := *pending
+			pending, deadline = nil, nil
+			select {
+			case events <- event:
+				return true
+			case <-coalesced.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case event, ok := <-s.events:
+				if !ok {
+					flush()
+					return
+				}
+				if pending == nil || !mergeEvent(pending, event) {
+					if !flush() {
+						return
+					}
+					pending = &event
+					if maxLatency > 0 {
+						deadline = time.After(maxLatency)
+					}
+				}
+				if len(pending.Delta.Content) >= minBytes || pending.FinishReason != "" || pending.Usage != nil || pending.Err != nil {
+					if !flush() {
+						return
+					}
+				}
+			case <-deadline:
+				if !flush() {
+					return
+				}
+			case <-s.closed:
+				return
+			}
+		}
+	}()
+
+	return coalesced
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"context"
+	"maps"
+	"slices"
+)
+
+// WithDefaults returns p applying defaults to every request: each setting
+// the request leaves unset takes the default value. Default tools are added
+// unless the request has one of the same type and name, and the entries of
+// Metadata and ProviderOptions are merged, those of the request taking
+// precedence. The messages of defaults are ignored.
+func WithDefaults(p Provider, defaults ChatRequest) Provider {
+	return Defaults(defaults)(p)
+}
+
+// Defaults returns a Middleware applying defaults, as WithDefaults does.
+func Defaults(defaults ChatRequest) Middleware {
+	var mw Middleware
+	mw = func(p Provider) Provider {
+		return &defaulted{Wrapper: Wrapper{Next: p, Wrap: mw}, defaults: defaults}
+	}
+	return mw
+}
+
+type defaulted struct {
+	Wrapper
+	defaults ChatRequest
+}
+
+func (d *defaulted) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	return d.Next.Chat(ctx, applyDefaults(req, &d.defaults))
+}
+
+func (d *defaulted) Stream(ctx context.Context, req *ChatRequest) (*StreamReader, error) {
+	return d.Next.Stream(ctx, applyDefaults(req, &d.defaults))
+}
+
+func applyDefaults(req, defaults *ChatRequest) *ChatRequest {
+	r := *req
+	setDefault(&r.Model, defaults.Model)
+	setDefault(&r.Temperature, defaults.Temperature)
+	setDefault(&r.TopP, defaults.TopP)
+	setDefault(&r.MaxTokens, defaults.MaxTokens)
+	setDefault(&r.ToolChoice, defaults.ToolChoice)
+	setDefault(&r.ParallelToolCalls, defaults.ParallelToolCalls)
+	setDefault(&r.PresencePenalty, defaults.PresencePenalty)
+	setDefault(&r.FrequencyPenalty, defaults.FrequencyPenalty)
+	setDefault(&r.RandomSeed, defaults.RandomSeed)
+	setDefault(&r.N, defaults.N)
+	setDefault(&r.User, defaults.User)
+	setDefault(&r.Logprobs, defaults.Logprobs)
+	setDefault(&r.TopLogprobs, defaults.TopLogprobs)
+	setDefault(&r.StreamIdleTimeout, defaults.StreamIdleTimeout)
+	setDefault(&r.StreamBuffer, defaults.StreamBuffer)
+	setDefault(&r.StreamOverflow, defaults.StreamOverflow)
+	setDefault(&r.FirstEventTimeout, defaults.FirstEventTimeout)
+	setDefault(&r.StreamTimeout, defaults.StreamTimeout)
+	if len(r.Stop) == 0 {
+		r.Stop = defaults.Stop
+	}
+	if len(r.LogitBias) == 0 {
+		r.LogitBias = defaults.LogitBias
+	}
+
+	for _, t := range defaults.Tools {
+		if !slices.ContainsFunc(req.Tools, func(rt Tool) bool { return rt.Type == t.Type && rt.Function.Name == t.Function.Name }) {
+			r.Tools = append(slices.Clip(r.Tools), t)
+		}
+	}
+	r.Metadata = mergeDefaults(defaults.Metadata, req.Metadata)
+	r.ProviderOptions = mergeDefaults(defaults.ProviderOptions, req.ProviderOptions)
+	return &r
+}
+
+func setDefault[T comparable](field *T, value T) {
+	var zero T
+	if *field == zero {
+		*field = value
+	}
+}
+
+func mergeDefaults[V any](defaults, values map[string]V) map[string]V {
+	if len(defaults) == 0 {
+		return values
+	}
+	merged := maps.Clone(defaults)
+	maps.Copy(merged, values)
+	return merged
+}
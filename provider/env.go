@@ -0,0 +1,26 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+)
+
+// MissingEnvError is returned by the NewFromEnv constructors when a
+// required environment variable is unset.
+type MissingEnvError struct {
+	Var string
+}
+
+func (e *MissingEnvError) Error() string {
+	return fmt.Sprintf("environment variable %s is not set", e.Var)
+}
+
+// RequireEnv returns the value of the environment variable name, or a
+// MissingEnvError when it is unset or empty.
+func RequireEnv(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", &MissingEnvError{Var: name}
+	}
+	return value, nil
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrContextLengthExceeded matches, with errors.Is, the API errors of
+// requests whose messages do not fit the context window of the model.
+var ErrContextLengthExceeded = errors.New("context length exceeded")
+
+// Phrases providers use to reject prompts longer than the context window
+var contextLengthPhrases = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context window",
+	"prompt is too long",
+	"input is too long",
+	"exceeds the maximum number of tokens",
+	"too many tokens",
+}
+
+// APIError is returned when a provider rejects a request, either with an
+// HTTP error status or with an error event in the middle of a stream.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+	Body       string
+	// RateLimit is the rate limit state reported with the error, nil when
+	// there is none
+	RateLimit *RateLimitInfo
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("API error (status %d, %s): %s", e.StatusCode, e.Type, e.Message)
+	}
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+func (e *APIError) Is(target error) bool {
+	if target != ErrContextLengthExceeded {
+		return false
+	}
+	if e.StatusCode != http.StatusBadRequest && e.StatusCode != http.StatusRequestEntityTooLarge {
+		return false
+	}
+	text := strings.ToLower(e.Type + " " + e.Message + " " + e.Body)
+	for _, phrase := range contextLengthPhrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRetryable reports whether err is a transient failure (rate limit,
+// timeout or server error) that may succeed when retried or sent elsewhere.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests,
+			apiErr.StatusCode == http.StatusRequestTimeout,
+			apiErr.StatusCode >= 500:
+			return true
+		}
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrStreamStalled) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
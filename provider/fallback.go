@@ -0,0 +1,143 @@
+package provider
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"time"
+)
+
+type FallbackProvider struct {
+	providers []Provider
+	models    map[int]string
+	onServed  func(index int, p Provider)
+}
+
+// Fallback returns a provider that tries primary first and moves on to the
+// secondaries in order when a request fails with a retryable error.
+func Fallback(primary Provider, secondaries ...Provider) *FallbackProvider {
+	return &FallbackProvider{
+		providers: append([]Provider{primary}, secondaries...),
+		models:    make(map[int]string),
+	}
+}
+
+// Model overrides the request model whenever the provider at index is used.
+// Index 0 is the primary.
+func (f *FallbackProvider) Model(index int, model string) *FallbackProvider {
+	f.models[index] = model
+	return f
+}
+
+// OnServed registers a callback invoked with the provider that served the request.
+func (f *FallbackProvider) OnServed(fn func(index int, p Provider)) *FallbackProvider {
+	f.onServed = fn
+	return f
+}
+
+// WithAPIKey, WithBaseURL and WithModel configure the primary provider;
+// the HTTP client, timeout and headers apply to every provider in the chain.
+
+func (f *FallbackProvider) WithAPIKey(key string) Provider {
+	return f.configure(func(i int, p Provider) Provider {
+		if i > 0 {
+			return p
+		}
+		return p.WithAPIKey(key)
+	})
+}
+
+func (f *FallbackProvider) WithBaseURL(url string) Provider {
+	return f.configure(func(i int, p Provider) Provider {
+		if i > 0 {
+			return p
+		}
+		return p.WithBaseURL(url)
+	})
+}
+
+func (f *FallbackProvider) WithModel(model string) Provider {
+	return f.configure(func(i int, p Provider) Provider {
+		if i > 0 {
+			return p
+		}
+		return p.WithModel(model)
+	})
+}
+
+func (f *FallbackProvider) WithHTTPClient(client *http.Client) Provider {
+	return f.configure(func(_ int, p Provider) Provider {
+		return p.WithHTTPClient(client)
+	})
+}
+
+func (f *FallbackProvider) WithTimeout(timeout time.Duration) Provider {
+	return f.configure(func(_ int, p Provider) Provider {
+		return p.WithTimeout(timeout)
+	})
+}
+
+func (f *FallbackProvider) WithHeaders(headers map[string]string) Provider {
+	return f.configure(func(_ int, p Provider) Provider {
+		return p.WithHeaders(headers)
+	})
+}
+
+// configure returns a copy of f with every provider replaced by fn.
+func (f *FallbackProvider) configure(fn func(index int, p Provider) Provider) *FallbackProvider {
+	cp := *f
+	cp.providers = make([]Provider, len(f.providers))
+	for i, p := range f.providers {
+		cp.providers[i] = fn(i, p)
+	}
+	cp.models = maps.Clone(f.models)
+	return &cp
+}
+
+func (f *FallbackProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	var lastErr error
+	for i, p := range f.providers {
+		resp, err := p.Chat(ctx, f.request(i, req))
+		if err == nil {
+			f.served(i, p)
+			return resp, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !IsRetryable(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (f *FallbackProvider) Stream(ctx context.Context, req *ChatRequest) (*StreamReader, error) {
+	var lastErr error
+	for i, p := range f.providers {
+		stream, err := p.Stream(ctx, f.request(i, req))
+		if err == nil {
+			f.served(i, p)
+			return stream, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !IsRetryable(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (f *FallbackProvider) request(index int, req *ChatRequest) *ChatRequest {
+	model, ok := f.models[index]
+	if !ok {
+		return req
+	}
+	r := *req
+	r.Model = model
+	return &r
+}
+
+func (f *FallbackProvider) served(index int, p Provider) {
+	if f.onServed != nil {
+		f.onServed(index, p)
+	}
+}
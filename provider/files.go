@@ -0,0 +1,33 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// File purposes understood by the OpenAI and Mistral files endpoints.
+const (
+	FilePurposeBatch     = "batch"
+	FilePurposeFineTune  = "fine-tune"
+	FilePurposeUserData  = "user_data"
+	FilePurposeAssistant = "assistants"
+)
+
+// File is a file stored by a provider.
+type File struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Bytes     int64     `json:"bytes"`
+	Purpose   string    `json:"purpose,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FileStore manages files uploaded to a provider, referenced by ID from
+// batches, fine-tuning jobs and message content.
+type FileStore interface {
+	Upload(ctx context.Context, filename, purpose string, content io.Reader) (*File, error)
+	List(ctx context.Context) ([]File, error)
+	Get(ctx context.Context, id string) (*File, error)
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type (
+	headerKey struct{}
+	queryKey  struct{}
+)
+
+// WithHeader returns a copy of ctx adding a header to the provider requests
+// made with it, such as OpenAI-Organization, anthropic-beta or a tracing
+// header, without rebuilding the provider. It replaces the provider header
+// of the same name.
+func WithHeader(ctx context.Context, key, value string) context.Context {
+	headers, _ := ctx.Value(headerKey{}).(http.Header)
+	headers = headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set(key, value)
+	return context.WithValue(ctx, headerKey{}, headers)
+}
+
+// WithQuery returns a copy of ctx adding a query parameter to the provider
+// requests made with it.
+func WithQuery(ctx context.Context, key, value string) context.Context {
+	query, _ := ctx.Value(queryKey{}).(url.Values)
+	clone := make(url.Values, len(query)+1)
+	for k, v := range query {
+		clone[k] = v
+	}
+	clone.Set(key, value)
+	return context.WithValue(ctx, queryKey{}, clone)
+}
+
+// ApplyContext sets the headers and query parameters added to the context
+// of httpReq with WithHeader and WithQuery. Providers call it on every
+// request they send.
+func ApplyContext(httpReq *http.Request) {
+	ctx := httpReq.Context()
+	if headers, ok := ctx.Value(headerKey{}).(http.Header); ok {
+		for k, v := range headers {
+			httpReq.Header[k] = v
+		}
+	}
+	if query, ok := ctx.Value(queryKey{}).(url.Values); ok {
+		q := httpReq.URL.Query()
+		for k, v := range query {
+			q[k] = v
+		}
+		httpReq.URL.RawQuery = q.Encode()
+	}
+}
@@ -0,0 +1,189 @@
+package huggingface
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexisbouchez/ai/internal/openaicompat"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const (
+	defaultBaseURL       = "https://router.huggingface.co"
+	defaultModel         = "meta-llama/Llama-3.1-8B-Instruct"
+	defaultColdStartWait = 5 * time.Minute
+	// fallbackLoadTime is waited when a loading model gives no estimate
+	fallbackLoadTime = 10 * time.Second
+)
+
+type huggingface struct {
+	*openaicompat.Client
+	coldStartWait time.Duration
+}
+
+type Option func(*huggingface)
+
+// WithColdStartWait sets how long requests wait in total for a model that
+// is loading. Zero fails immediately with the 503 error. Defaults to 5
+// minutes.
+func WithColdStartWait(d time.Duration) Option {
+	return func(h *huggingface) {
+		h.coldStartWait = d
+	}
+}
+
+// Model is a model available through the Inference API.
+type Model struct {
+	ID      string `json:"id"`
+	OwnedBy string `json:"owned_by"`
+	Created int64  `json:"created"`
+}
+
+// New creates a new Hugging Face provider for the serverless Inference
+// API. Dedicated Inference Endpoints are used by passing their URL to
+// WithBaseURL.
+func New(opts ...Option) provider.Provider {
+	h := &huggingface{
+		Client: openaicompat.New(openaicompat.Config{
+			System:  "huggingface",
+			BaseURL: defaultBaseURL,
+			Model:   defaultModel,
+			Quirks: openaicompat.Quirks{
+				StreamUsage: true,
+				SeedField:   "seed",
+			},
+		}),
+		coldStartWait: defaultColdStartWait,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// NewFromEnv creates a Hugging Face provider authenticated with HF_TOKEN.
+func NewFromEnv(opts ...Option) (provider.Provider, error) {
+	token, err := provider.RequireEnv("HF_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	return New(opts...).WithAPIKey(token), nil
+}
+
+func (h *huggingface) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	var resp *provider.ChatResponse
+	err := h.waitForModel(ctx, func() (err error) {
+		resp, err = h.Client.Chat(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (h *huggingface) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	var stream *provider.StreamReader
+	err := h.waitForModel(ctx, func() (err error) {
+		stream, err = h.Client.Stream(ctx, req)
+		return err
+	})
+	return stream, err
+}
+
+// Models lists the models served at the base URL.
+func (h *huggingface) Models(ctx context.Context) ([]Model, error) {
+	respBody, err := h.Do(ctx, http.MethodGet, "/v1/models", nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data []Model `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return resp.Data, nil
+}
+
+// waitForModel calls send until the model has loaded, sleeping for the
+// estimated load time after every 503 response.
+func (h *huggingface) waitForModel(ctx context.Context, send func() error) error {
+	deadline := time.Now().Add(h.coldStartWait)
+	for {
+		err := send()
+		wait, loading := loadTime(err)
+		if !loading {
+			return err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return err
+		}
+		wait = min(wait, remaining)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// loadTime reports whether err is a model loading error and how long the
+// model is expected to take.
+func loadTime(err error) (time.Duration, bool) {
+	var apiErr *provider.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+
+	var body struct {
+		EstimatedTime float64 `json:"estimated_time"`
+	}
+	if json.Unmarshal([]byte(apiErr.Body), &body) != nil || body.EstimatedTime <= 0 {
+		return fallbackLoadTime, true
+	}
+	return time.Duration(body.EstimatedTime * float64(time.Second)), true
+}
+
+func (h *huggingface) WithAPIKey(key string) provider.Provider {
+	cp := *h
+	cp.Client = h.Client.WithAPIKey(key).(*openaicompat.Client)
+	return &cp
+}
+
+func (h *huggingface) WithBaseURL(url string) provider.Provider {
+	cp := *h
+	cp.Client = h.Client.WithBaseURL(url).(*openaicompat.Client)
+	return &cp
+}
+
+func (h *huggingface) WithModel(model string) provider.Provider {
+	cp := *h
+	cp.Client = h.Client.WithModel(model).(*openaicompat.Client)
+	return &cp
+}
+
+func (h *huggingface) WithHTTPClient(client *http.Client) provider.Provider {
+	cp := *h
+	cp.Client = h.Client.WithHTTPClient(client).(*openaicompat.Client)
+	return &cp
+}
+
+func (h *huggingface) WithTimeout(timeout time.Duration) provider.Provider {
+	cp := *h
+	cp.Client = h.Client.WithTimeout(timeout).(*openaicompat.Client)
+	return &cp
+}
+
+func (h *huggingface) WithHeaders(headers map[string]string) provider.Provider {
+	cp := *h
+	cp.Client = h.Client.WithHeaders(headers).(*openaicompat.Client)
+	return &cp
+}
@@ -0,0 +1,141 @@
+package llamacpp
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexisbouchez/ai/internal/openaicompat"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// defaultBaseURL is the llama.cpp server default. LM Studio listens on
+// http://localhost:1234.
+const defaultBaseURL = "http://localhost:8080"
+
+type llamacpp struct {
+	*openaicompat.Client
+	slot        *int
+	cachePrompt *bool
+	nativeTools bool
+}
+
+type Option func(*llamacpp)
+
+// WithSlot pins requests to a server slot, so that consecutive turns of a
+// conversation reuse its KV cache.
+func WithSlot(id int) Option {
+	return func(l *llamacpp) {
+		l.slot = &id
+	}
+}
+
+// WithCachePrompt controls whether the server reuses the KV cache of a
+// previous request with the same prompt prefix. The server enables it by
+// default.
+func WithCachePrompt(enabled bool) Option {
+	return func(l *llamacpp) {
+		l.cachePrompt = &enabled
+	}
+}
+
+// WithNativeTools sends tool results with the tool role, for servers
+// started with --jinja and a chat template that supports it. By default
+// tool results are sent as user messages.
+func WithNativeTools() Option {
+	return func(l *llamacpp) {
+		l.nativeTools = true
+	}
+}
+
+// New creates a provider for a llama.cpp server, or any server exposing
+// the same OpenAI-compatible endpoint such as LM Studio. The server serves
+// the model it was started with, so no model is set by default.
+func New(opts ...Option) provider.Provider {
+	l := &llamacpp{}
+	l.Client = openaicompat.New(openaicompat.Config{
+		System:  "llama_cpp",
+		BaseURL: defaultBaseURL,
+		Quirks: openaicompat.Quirks{
+			SeedField: "seed",
+			LogitBias: true,
+		},
+		Prepare: l.prepare,
+	})
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// JSONSchema returns ChatRequest.ProviderOptions constraining the output to
+// schema with a grammar generated by the server.
+func JSONSchema(schema map[string]any) map[string]any {
+	return map[string]any{"json_schema": schema}
+}
+
+func (l *llamacpp) prepare(req *provider.ChatRequest, body *openaicompat.ChatCompletionRequest) {
+	if !l.nativeTools {
+		toolNames := make(map[string]string)
+		for _, msg := range req.Messages {
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+			}
+		}
+		for i, msg := range body.Messages {
+			result, ok := msg.(openaicompat.ToolResultMessage)
+			if !ok {
+				continue
+			}
+			content := fmt.Sprintf("Result of %s: %s", toolNames[result.ToolCallID], result.Content)
+			body.Messages[i] = openaicompat.Message{Role: string(provider.RoleUser), Content: &content}
+		}
+	}
+
+	if l.slot == nil && l.cachePrompt == nil {
+		return
+	}
+	body.Extra = make(map[string]any)
+	if l.slot != nil {
+		body.Extra["id_slot"] = *l.slot
+	}
+	if l.cachePrompt != nil {
+		body.Extra["cache_prompt"] = *l.cachePrompt
+	}
+}
+
+func (l *llamacpp) WithAPIKey(key string) provider.Provider {
+	cp := *l
+	cp.Client = l.Client.WithAPIKey(key).(*openaicompat.Client)
+	return &cp
+}
+
+func (l *llamacpp) WithBaseURL(url string) provider.Provider {
+	cp := *l
+	cp.Client = l.Client.WithBaseURL(url).(*openaicompat.Client)
+	return &cp
+}
+
+func (l *llamacpp) WithModel(model string) provider.Provider {
+	cp := *l
+	cp.Client = l.Client.WithModel(model).(*openaicompat.Client)
+	return &cp
+}
+
+func (l *llamacpp) WithHTTPClient(client *http.Client) provider.Provider {
+	cp := *l
+	cp.Client = l.Client.WithHTTPClient(client).(*openaicompat.Client)
+	return &cp
+}
+
+func (l *llamacpp) WithTimeout(timeout time.Duration) provider.Provider {
+	cp := *l
+	cp.Client = l.Client.WithTimeout(timeout).(*openaicompat.Client)
+	return &cp
+}
+
+func (l *llamacpp) WithHeaders(headers map[string]string) provider.Provider {
+	cp := *l
+	cp.Client = l.Client.WithHeaders(headers).(*openaicompat.Client)
+	return &cp
+}
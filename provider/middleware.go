@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"net/http"
+	"time"
+)
+
+// Middleware wraps a Provider to add behavior around its requests. The
+// returned provider should apply builder methods to the wrapped provider
+// and wrap the result again, so that configuration keeps the middleware,
+// which embedding Wrapper does.
+type Middleware func(Provider) Provider
+
+// Chain wraps p with mws. The first middleware is the outermost and sees
+// requests first.
+func Chain(p Provider, mws ...Middleware) Provider {
+	for i := len(mws) - 1; i >= 0; i-- {
+		p = mws[i](p)
+	}
+	return p
+}
+
+// Wrapper implements the builder methods of Provider for middleware, by
+// applying them to Next and wrapping the result again with Wrap. A
+// middleware embeds it and implements Chat and Stream, calling Next:
+//
+//	type logged struct{ provider.Wrapper }
+//
+//	func Logging() provider.Middleware {
+//		var mw provider.Middleware
+//		mw = func(p provider.Provider) provider.Provider {
+//			return &logged{provider.Wrapper{Next: p, Wrap: mw}}
+//		}
+//		return mw
+//	}
+//
+//	func (l *logged) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+//		log.Printf("chat with %s", req.Model)
+//		return l.Next.Chat(ctx, req)
+//	}
+//
+// A middleware keeping state about the provider it wraps, such as its
+// model, overrides the builder methods concerned.
+type Wrapper struct {
+	Next Provider
+	Wrap Middleware
+}
+
+func (w Wrapper) WithAPIKey(key string) Provider {
+	return w.Wrap(w.Next.WithAPIKey(key))
+}
+
+func (w Wrapper) WithBaseURL(url string) Provider {
+	return w.Wrap(w.Next.WithBaseURL(url))
+}
+
+func (w Wrapper) WithModel(model string) Provider {
+	return w.Wrap(w.Next.WithModel(model))
+}
+
+func (w Wrapper) WithHTTPClient(client *http.Client) Provider {
+	return w.Wrap(w.Next.WithHTTPClient(client))
+}
+
+func (w Wrapper) WithTimeout(timeout time.Duration) Provider {
+	return w.Wrap(w.Next.WithTimeout(timeout))
+}
+
+func (w Wrapper) WithHeaders(headers map[string]string) Provider {
+	return w.Wrap(w.Next.WithHeaders(headers))
+}
+
+func (w Wrapper) HTTPClient() *http.Client {
+	return HTTPClient(w.Next)
+}
+
+func (w Wrapper) System() string {
+	return System(w.Next)
+}
@@ -0,0 +1,210 @@
+package mistral
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexisbouchez/ai/batch"
+	"github.com/alexisbouchez/ai/internal/openaicompat"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const batchEndpoint = "/v1/chat/completions"
+
+type mistralBatchLine struct {
+	CustomID string                              `json:"custom_id"`
+	Body     *openaicompat.ChatCompletionRequest `json:"body"`
+}
+
+type mistralBatchJob struct {
+	ID                string `json:"id"`
+	Status            string `json:"status"`
+	OutputFile        string `json:"output_file"`
+	ErrorFile         string `json:"error_file"`
+	CreatedAt         int64  `json:"created_at"`
+	TotalRequests     int    `json:"total_requests"`
+	SucceededRequests int    `json:"succeeded_requests"`
+	FailedRequests    int    `json:"failed_requests"`
+}
+
+type mistralBatchResult struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    any    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (m *mistral) SubmitBatch(ctx context.Context, reqs []provider.ChatRequest) (*batch.Job, error) {
+	// Mistral runs a batch against a single model set on the job
+	model := reqs[0].Model
+	if model == "" {
+		model = m.Model()
+	}
+	for i := range reqs {
+		other := reqs[i].Model
+		if other == "" {
+			other = m.Model()
+		}
+		if other != model {
+			return nil, fmt.Errorf("mistral batches run a single model: request %d uses %s, not %s", i, other, model)
+		}
+	}
+
+	var input bytes.Buffer
+	enc := json.NewEncoder(&input)
+	for i := range reqs {
+		body, err := m.Request(&reqs[i], model)
+		if err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(mistralBatchLine{CustomID: batch.CustomID(i), Body: body}); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	file, err := m.UploadFile(ctx, "batch.jsonl", provider.FilePurposeBatch, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"input_files": []string{file.ID},
+		"endpoint":    batchEndpoint,
+		"model":       model,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := m.Do(ctx, http.MethodPost, "/v1/batch/jobs", bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	return toBatchJob(respBody)
+}
+
+func (m *mistral) PollBatch(ctx context.Context, id string) (*batch.Job, error) {
+	respBody, err := m.Do(ctx, http.MethodGet, "/v1/batch/jobs/"+id, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return toBatchJob(respBody)
+}
+
+func (m *mistral) CancelBatch(ctx context.Context, id string) (*batch.Job, error) {
+	respBody, err := m.Do(ctx, http.MethodPost, "/v1/batch/jobs/"+id+"/cancel", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return toBatchJob(respBody)
+}
+
+func (m *mistral) BatchResults(ctx context.Context, id string) ([]batch.Result, error) {
+	respBody, err := m.Do(ctx, http.MethodGet, "/v1/batch/jobs/"+id, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var job mistralBatchJob
+	if err := json.Unmarshal(respBody, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var results []batch.Result
+	for _, fileID := range []string{job.OutputFile, job.ErrorFile} {
+		if fileID == "" {
+			continue
+		}
+		content, err := m.FileContent(ctx, fileID)
+		if err != nil {
+			return nil, err
+		}
+		lines, err := m.parseBatchResults(content)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, lines...)
+	}
+
+	batch.SortResults(results)
+	return results, nil
+}
+
+func (m *mistral) parseBatchResults(content []byte) ([]batch.Result, error) {
+	var results []batch.Result
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line mistralBatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("failed to parse batch result: %w", err)
+		}
+
+		result := batch.Result{Index: batch.Index(line.CustomID), CustomID: line.CustomID}
+		switch {
+		case line.Error != nil:
+			result.Err = &provider.APIError{Type: fmt.Sprint(line.Error.Code), Message: line.Error.Message}
+		case line.Response == nil:
+			result.Err = fmt.Errorf("batch result has no response")
+		case line.Response.StatusCode != http.StatusOK:
+			result.Err = &provider.APIError{StatusCode: line.Response.StatusCode, Body: string(line.Response.Body)}
+		default:
+			var resp openaicompat.ChatCompletionResponse
+			if err := json.Unmarshal(line.Response.Body, &resp); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+			}
+			result.Response = m.Response(&resp)
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+func toBatchJob(data []byte) (*batch.Job, error) {
+	var job mistralBatchJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var status batch.Status
+	switch job.Status {
+	case "QUEUED":
+		status = batch.StatusPending
+	case "RUNNING", "CANCELLATION_REQUESTED":
+		status = batch.StatusRunning
+	case "SUCCESS":
+		status = batch.StatusCompleted
+	case "FAILED":
+		status = batch.StatusFailed
+	case "TIMEOUT_EXCEEDED":
+		status = batch.StatusExpired
+	case "CANCELLED":
+		status = batch.StatusCancelled
+	default:
+		status = batch.Status(job.Status)
+	}
+
+	return &batch.Job{
+		ID:        job.ID,
+		Status:    status,
+		Total:     job.TotalRequests,
+		Succeeded: job.SucceededRequests,
+		Failed:    job.FailedRequests,
+		CreatedAt: time.Unix(job.CreatedAt, 0),
+	}, nil
+}
@@ -0,0 +1,24 @@
+package mistral
+
+import (
+	"context"
+	"io"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+func (m *mistral) Upload(ctx context.Context, filename, purpose string, content io.Reader) (*provider.File, error) {
+	return m.UploadFile(ctx, filename, purpose, content)
+}
+
+func (m *mistral) List(ctx context.Context) ([]provider.File, error) {
+	return m.ListFiles(ctx)
+}
+
+func (m *mistral) Get(ctx context.Context, id string) (*provider.File, error) {
+	return m.GetFile(ctx, id)
+}
+
+func (m *mistral) Delete(ctx context.Context, id string) error {
+	return m.DeleteFile(ctx, id)
+}
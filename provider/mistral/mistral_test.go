@@ -0,0 +1,159 @@
+package mistral_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/provider/mistral"
+	"github.com/alexisbouchez/ai/record"
+)
+
+// replay returns a provider serving the cassette testdata/name.json, and
+// the recorder holding it. Set MISTRAL_RECORD to record the cassette again
+// against the API, with the key in MISTRAL_API_KEY.
+func replay(t *testing.T, name string) (provider.Provider, *record.Recorder) {
+	t.Helper()
+	r := record.New(filepath.Join("testdata", name+".json")).Mode(record.Replay)
+	key := "test"
+	if os.Getenv("MISTRAL_RECORD") != "" {
+		r.Mode(record.Record)
+		key = os.Getenv("MISTRAL_API_KEY")
+	}
+	return mistral.New().WithAPIKey(key).WithHTTPClient(r.Client()), r
+}
+
+// sentBody decodes the body of the only request of the cassette. Replaying
+// it proves the provider sent that body, as requests are matched by hash.
+func sentBody(t *testing.T, r *record.Recorder) map[string]any {
+	t.Helper()
+	interactions := r.Cassette().Interactions
+	if len(interactions) != 1 {
+		t.Fatalf("got %d interactions, want 1", len(interactions))
+	}
+	var body map[string]any
+	if err := json.Unmarshal([]byte(interactions[0].Request.Body), &body); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	return body
+}
+
+func TestSafePrompt(t *testing.T) {
+	p, r := replay(t, "safe_prompt")
+	resp, err := p.Chat(context.Background(), &provider.ChatRequest{
+		Messages:        []provider.Message{{Role: provider.RoleUser, Content: "How do I pick a lock?"}},
+		ProviderOptions: mistral.SafePrompt(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body := sentBody(t, r); body["safe_prompt"] != true {
+		t.Errorf("safe_prompt = %v, want true", body["safe_prompt"])
+	}
+	if resp.Choices[0].Message.Content == "" {
+		t.Error("empty reply")
+	}
+}
+
+func TestJSONObject(t *testing.T) {
+	p, r := replay(t, "json_object")
+	resp, err := p.Chat(context.Background(), &provider.ChatRequest{
+		Messages: []provider.Message{{Role: provider.RoleUser, Content: "Give the capital of France as JSON, with a capital key."}},
+		ProviderOptions: mistral.Options(
+			mistral.SafePrompt(),
+			mistral.JSONObject(),
+		),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := sentBody(t, r)
+	if format, _ := body["response_format"].(map[string]any); format["type"] != "json_object" {
+		t.Errorf("response_format = %v", body["response_format"])
+	}
+	if body["safe_prompt"] != true {
+		t.Errorf("safe_prompt = %v, want true", body["safe_prompt"])
+	}
+	var reply struct{ Capital string }
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &reply); err != nil {
+		t.Fatalf("reply is not JSON: %v", err)
+	}
+	if reply.Capital != "Paris" {
+		t.Errorf("capital = %q, want Paris", reply.Capital)
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name":       map[string]any{"type": "string"},
+			"population": map[string]any{"type": "integer"},
+		},
+		"required":             []any{"name", "population"},
+		"additionalProperties": false,
+	}
+	p, r := replay(t, "json_schema")
+	resp, err := p.Chat(context.Background(), &provider.ChatRequest{
+		Messages:        []provider.Message{{Role: provider.RoleUser, Content: "Describe Lyon."}},
+		ProviderOptions: mistral.JSONSchema("city", schema),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	format, _ := sentBody(t, r)["response_format"].(map[string]any)
+	jsonSchema, _ := format["json_schema"].(map[string]any)
+	if format["type"] != "json_schema" || jsonSchema["name"] != "city" || jsonSchema["strict"] != true {
+		t.Errorf("response_format = %v", format)
+	}
+	var city struct {
+		Name       string
+		Population int
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &city); err != nil {
+		t.Fatalf("reply is not JSON: %v", err)
+	}
+	if city.Name != "Lyon" || city.Population <= 0 {
+		t.Errorf("city = %+v", city)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	p, r := replay(t, "document")
+	resp, err := p.Chat(context.Background(), &provider.ChatRequest{
+		Messages: []provider.Message{{Role: provider.RoleUser, Parts: []provider.Part{
+			provider.TextPart("What is the title of this document?"),
+			provider.DocumentPart([]byte("%PDF-1.4 Annual report"), "application/pdf"),
+		}}},
+		ProviderOptions: mistral.DocumentLimits(8, 4),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := sentBody(t, r)
+	if body["document_page_limit"] != 8.0 || body["document_image_limit"] != 4.0 {
+		t.Errorf("limits = %v, %v", body["document_page_limit"], body["document_image_limit"])
+	}
+	messages, _ := body["messages"].([]any)
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	parts, _ := messages[0].(map[string]any)["content"].([]any)
+	if len(parts) != 2 {
+		t.Fatalf("content = %v", messages[0])
+	}
+	document := parts[1].(map[string]any)
+	if document["type"] != "document_url" || document["document_url"] != "data:application/pdf;base64,JVBERi0xLjQgQW5udWFsIHJlcG9ydA==" {
+		t.Errorf("document = %v", document)
+	}
+	if resp.Choices[0].Message.Content == "" {
+		t.Error("empty reply")
+	}
+}
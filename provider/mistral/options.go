@@ -0,0 +1,78 @@
+package mistral
+
+import (
+	"maps"
+
+	"github.com/alexisbouchez/ai/internal/openaicompat"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Options merges ChatRequest.ProviderOptions built by the functions of this
+// package, such as Options(SafePrompt(), JSONObject()).
+func Options(opts ...map[string]any) map[string]any {
+	merged := make(map[string]any)
+	for _, opt := range opts {
+		maps.Copy(merged, opt)
+	}
+	return merged
+}
+
+// SafePrompt returns ChatRequest.ProviderOptions prepending Mistral's
+// safety prompt to the conversation.
+func SafePrompt() map[string]any {
+	return map[string]any{"safe_prompt": true}
+}
+
+// JSONObject returns ChatRequest.ProviderOptions making the model reply
+// with a JSON object. The prompt should still ask for JSON.
+func JSONObject() map[string]any {
+	return map[string]any{"response_format": map[string]any{"type": "json_object"}}
+}
+
+// JSONSchema returns ChatRequest.ProviderOptions constraining the reply to
+// schema.
+func JSONSchema(name string, schema map[string]any) map[string]any {
+	return map[string]any{"response_format": map[string]any{
+		"type": "json_schema",
+		"json_schema": map[string]any{
+			"name":   name,
+			"schema": schema,
+			"strict": true,
+		},
+	}}
+}
+
+// DocumentLimits returns ChatRequest.ProviderOptions bounding the pages and
+// the images read from the documents of a request. Zero leaves a limit
+// unset.
+func DocumentLimits(pages, images int) map[string]any {
+	opts := make(map[string]any)
+	if pages > 0 {
+		opts["document_page_limit"] = pages
+	}
+	if images > 0 {
+		opts["document_image_limit"] = images
+	}
+	return opts
+}
+
+// prepare sends inline documents as document_url parts, which Mistral reads
+// with OCR.
+func prepare(req *provider.ChatRequest, body *openaicompat.ChatCompletionRequest) {
+	for _, msg := range body.Messages {
+		parts, ok := msg.(openaicompat.PartsMessage)
+		if !ok {
+			continue
+		}
+		for i, part := range parts.Content {
+			if part.File == nil || part.File.FileData == "" {
+				continue
+			}
+			parts.Content[i] = openaicompat.ContentPart{
+				Type:         "document_url",
+				DocumentURL:  part.File.FileData,
+				DocumentName: part.File.Filename,
+			}
+		}
+	}
+}
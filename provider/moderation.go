@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"context"
+	"strings"
+)
+
+// Moderator classifies content against a provider's safety categories.
+type Moderator interface {
+	Moderate(ctx context.Context, inputs ...string) ([]ModerationResult, error)
+}
+
+// ModerationResult is the classification of one input. Scores range from 0
+// to 1 and are keyed by category name.
+type ModerationResult struct {
+	Flagged    bool               `json:"flagged"`
+	Categories map[string]bool    `json:"categories"`
+	Scores     map[string]float64 `json:"scores"`
+}
+
+// FlaggedCategories returns the categories the input was flagged for.
+func (r *ModerationResult) FlaggedCategories() []string {
+	var categories []string
+	for category, flagged := range r.Categories {
+		if flagged {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+type keywordModerator struct {
+	keywords map[string][]string
+}
+
+// KeywordModerator flags inputs containing any of the keywords of a
+// category, case-insensitively. It needs no network access and serves as a
+// fallback when no moderation API is available. Scores are 1 for flagged
+// categories and 0 otherwise.
+func KeywordModerator(keywords map[string][]string) Moderator {
+	lowered := make(map[string][]string, len(keywords))
+	for category, words := range keywords {
+		for _, w := range words {
+			lowered[category] = append(lowered[category], strings.ToLower(w))
+		}
+	}
+	return &keywordModerator{keywords: lowered}
+}
+
+func (k *keywordModerator) Moderate(ctx context.Context, inputs ...string) ([]ModerationResult, error) {
+	results := make([]ModerationResult, len(inputs))
+	for i, input := range inputs {
+		input = strings.ToLower(input)
+		result := ModerationResult{
+			Categories: make(map[string]bool, len(k.keywords)),
+			Scores:     make(map[string]float64, len(k.keywords)),
+		}
+		for category, words := range k.keywords {
+			for _, w := range words {
+				if strings.Contains(input, w) {
+					result.Flagged = true
+					result.Categories[category] = true
+					result.Scores[category] = 1
+					break
+				}
+			}
+			if !result.Categories[category] {
+				result.Categories[category] = false
+				result.Scores[category] = 0
+			}
+		}
+		results[i] = result
+	}
+	return results, nil
+}
@@ -0,0 +1,86 @@
+package ollama
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// errGuardStop aborts the Ollama stream once a guard has ended it.
+var errGuardStop = errors.New("stream ended by client-side guard")
+
+// streamGuard enforces MaxTokens and Stop on the client, so a stream ends
+// with the same content and finish reason as on hosted providers. Ollama
+// sends one token per chunk, so chunks are counted as tokens.
+type streamGuard struct {
+	maxTokens int
+	stop      []string
+	emitted   int
+	pending   string
+}
+
+func newStreamGuard(req *provider.ChatRequest) *streamGuard {
+	g := &streamGuard{stop: req.Stop}
+	if req.MaxTokens != nil {
+		g.maxTokens = *req.MaxTokens
+	}
+	return g
+}
+
+// push consumes a content chunk and returns the content that can be emitted.
+// A non-empty finish reason means the stream must end after that content.
+func (g *streamGuard) push(content string) (string, string) {
+	if content != "" {
+		g.emitted++
+	}
+	g.pending += content
+
+	if idx := g.stopIndex(); idx >= 0 {
+		out := g.pending[:idx]
+		g.pending = ""
+		return out, provider.FinishReasonStop
+	}
+
+	if g.maxTokens > 0 && g.emitted >= g.maxTokens {
+		return g.flush(), provider.FinishReasonLength
+	}
+
+	// Hold back a suffix that may turn out to be the start of a stop sequence
+	keep := g.partialStop()
+	out := g.pending[:len(g.pending)-keep]
+	g.pending = g.pending[len(g.pending)-keep:]
+	return out, ""
+}
+
+func (g *streamGuard) flush() string {
+	out := g.pending
+	g.pending = ""
+	return out
+}
+
+func (g *streamGuard) stopIndex() int {
+	idx := -1
+	for _, s := range g.stop {
+		if s == "" {
+			continue
+		}
+		if i := strings.Index(g.pending, s); i >= 0 && (idx < 0 || i < idx) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+func (g *streamGuard) partialStop() int {
+	var keep int
+	for _, s := range g.stop {
+		for n := min(len(s)-1, len(g.pending)); n > keep; n-- {
+			if strings.HasSuffix(g.pending, s[:n]) {
+				keep = n
+				break
+			}
+		}
+	}
+	return keep
+}
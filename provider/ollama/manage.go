@@ -0,0 +1,176 @@
+package ollama
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/ollama/ollama/api"
+)
+
+// Manager manages the models of an Ollama server. The providers returned by
+// New implement it:
+//
+//	m := ollama.New().(ollama.Manager)
+//	err := m.Ensure(ctx, "llama3.2", nil)
+type Manager interface {
+	// Pull downloads model, reporting progress when it is not nil.
+	Pull(ctx context.Context, model string, progress func(PullProgress)) error
+	List(ctx context.Context) ([]Model, error)
+	Show(ctx context.Context, model string) (*ModelInfo, error)
+	Delete(ctx context.Context, model string) error
+	Copy(ctx context.Context, source, destination string) error
+	// Ensure pulls model unless the server already has it.
+	Ensure(ctx context.Context, model string, progress func(PullProgress)) error
+}
+
+// PullProgress is a status update of Pull. Total and Completed are the
+// bytes of the layer being downloaded, when there is one.
+type PullProgress struct {
+	Status    string
+	Digest    string
+	Total     int64
+	Completed int64
+}
+
+type Model struct {
+	Name              string
+	Size              int64
+	Digest            string
+	ModifiedAt        time.Time
+	Family            string
+	ParameterSize     string
+	QuantizationLevel string
+}
+
+type ModelInfo struct {
+	Family            string
+	Format            string
+	ParameterSize     string
+	QuantizationLevel string
+	// ContextLength is the context window the model was trained with, zero
+	// when unknown
+	ContextLength int
+	Capabilities  []string
+	Template      string
+	Parameters    string
+	System        string
+	License       string
+	ModifiedAt    time.Time
+}
+
+func (o *ollama) Pull(ctx context.Context, model string, progress func(PullProgress)) error {
+	client, err := o.getClient(true, nil)
+	if err != nil {
+		return err
+	}
+
+	err = client.Pull(ctx, &api.PullRequest{Model: model}, func(resp api.ProgressResponse) error {
+		if progress != nil {
+			progress(PullProgress{
+				Status:    resp.Status,
+				Digest:    resp.Digest,
+				Total:     resp.Total,
+				Completed: resp.Completed,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", model, toProviderError(err))
+	}
+	return nil
+}
+
+func (o *ollama) List(ctx context.Context) ([]Model, error) {
+	client, err := o.getClient(false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", toProviderError(err))
+	}
+	models := make([]Model, len(resp.Models))
+	for i, m := range resp.Models {
+		models[i] = Model{
+			Name:              m.Name,
+			Size:              m.Size,
+			Digest:            m.Digest,
+			ModifiedAt:        m.ModifiedAt,
+			Family:            m.Details.Family,
+			ParameterSize:     m.Details.ParameterSize,
+			QuantizationLevel: m.Details.QuantizationLevel,
+		}
+	}
+	return models, nil
+}
+
+func (o *ollama) Show(ctx context.Context, model string) (*ModelInfo, error) {
+	client, err := o.getClient(false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Show(ctx, &api.ShowRequest{Model: model})
+	if err != nil {
+		return nil, fmt.Errorf("failed to show %s: %w", model, toProviderError(err))
+	}
+	info := &ModelInfo{
+		Family:            resp.Details.Family,
+		Format:            resp.Details.Format,
+		ParameterSize:     resp.Details.ParameterSize,
+		QuantizationLevel: resp.Details.QuantizationLevel,
+		Template:          resp.Template,
+		Parameters:        resp.Parameters,
+		System:            resp.System,
+		License:           resp.License,
+		ModifiedAt:        resp.ModifiedAt,
+	}
+	for _, c := range resp.Capabilities {
+		info.Capabilities = append(info.Capabilities, string(c))
+	}
+	// the context length is keyed by architecture, as in llama.context_length
+	for key, value := range resp.ModelInfo {
+		if n, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			info.ContextLength = int(n)
+		}
+	}
+	return info, nil
+}
+
+func (o *ollama) Delete(ctx context.Context, model string) error {
+	client, err := o.getClient(false, nil)
+	if err != nil {
+		return err
+	}
+	if err := client.Delete(ctx, &api.DeleteRequest{Model: model}); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", model, toProviderError(err))
+	}
+	return nil
+}
+
+func (o *ollama) Copy(ctx context.Context, source, destination string) error {
+	client, err := o.getClient(false, nil)
+	if err != nil {
+		return err
+	}
+	if err := client.Copy(ctx, &api.CopyRequest{Source: source, Destination: destination}); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", source, destination, toProviderError(err))
+	}
+	return nil
+}
+
+func (o *ollama) Ensure(ctx context.Context, model string, progress func(PullProgress)) error {
+	_, err := o.Show(ctx, model)
+	var apiErr *provider.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return o.Pull(ctx, model, progress)
+	}
+	return err
+}
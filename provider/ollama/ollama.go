@@ -2,12 +2,22 @@ package ollama
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/alexisbouchez/ai/internal/idle"
+	"github.com/alexisbouchez/ai/internal/logging"
+	"github.com/alexisbouchez/ai/internal/passthrough"
 	"github.com/alexisbouchez/ai/provider"
 	"github.com/ollama/ollama/api"
 )
@@ -21,8 +31,11 @@ type ollama struct {
 	baseURL    string
 	model      string
 	httpClient *http.Client
+	timeout    time.Duration
+	headers    map[string]string
 }
 
+// New creates a new Ollama provider.
 func New() provider.Provider {
 	return &ollama{
 		baseURL:    defaultBaseURL,
@@ -31,30 +44,145 @@ func New() provider.Provider {
 	}
 }
 
+// NewFromEnv creates an Ollama provider for the server at OLLAMA_HOST,
+// which may omit the scheme and port as the ollama CLI allows. Ollama
+// needs no credentials, so the local default is used when it is unset.
+func NewFromEnv() (provider.Provider, error) {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return New(), nil
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OLLAMA_HOST: %w", err)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "11434")
+	}
+	return New().WithBaseURL(u.String()), nil
+}
+
 func (o *ollama) WithAPIKey(key string) provider.Provider {
 	return o
 }
 
 func (o *ollama) WithBaseURL(url string) provider.Provider {
-	o.baseURL = url
-	return o
+	cp := *o
+	cp.baseURL = url
+	return &cp
 }
 
 func (o *ollama) WithModel(model string) provider.Provider {
-	o.model = model
-	return o
+	cp := *o
+	cp.model = model
+	return &cp
+}
+
+func (o *ollama) WithHTTPClient(client *http.Client) provider.Provider {
+	cp := *o
+	cp.httpClient = client
+	return &cp
+}
+
+// HTTPClient returns the client requests are sent with.
+func (o *ollama) HTTPClient() *http.Client {
+	return o.httpClient
 }
 
-func (o *ollama) getClient() (*api.Client, error) {
+func (o *ollama) System() string {
+	return "ollama"
+}
+
+func (o *ollama) WithTimeout(timeout time.Duration) provider.Provider {
+	cp := *o
+	cp.timeout = timeout
+	return &cp
+}
+
+func (o *ollama) WithHeaders(headers map[string]string) provider.Provider {
+	cp := *o
+	cp.headers = maps.Clone(headers)
+	return &cp
+}
+
+// getClient returns a client for the configured endpoint. The timeout does
+// not apply to streaming requests, which it would cut off. Response bodies
+// go through stall when it is not nil.
+func (o *ollama) getClient(streaming bool, stall *idleTransport) (*api.Client, error) {
 	u, err := url.Parse(o.baseURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid base URL: %w", err)
 	}
-	return api.NewClient(u, o.httpClient), nil
+
+	client := *o.httpClient
+	if o.timeout != 0 && !streaming {
+		client.Timeout = o.timeout
+	}
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	transport = &logging.Transport{Base: transport}
+	client.Transport = &headerTransport{base: transport, headers: o.headers}
+	if stall != nil {
+		stall.base = client.Transport
+		if stall.base == nil {
+			stall.base = http.DefaultTransport
+		}
+		client.Transport = stall
+	}
+	return api.NewClient(u, &client), nil
+}
+
+// headerTransport adds fixed headers, and those of the request context, to
+// every request, since the Ollama client offers no hook to set them.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	provider.ApplyContext(req)
+	return t.base.RoundTrip(req)
+}
+
+// idleTransport closes response bodies receiving no data for timeout. The
+// Ollama client ends streams on read errors without returning them, so the
+// stall is kept for Stream to report.
+type idleTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+	body    atomic.Pointer[idle.Reader]
+}
+
+func (t *idleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body := idle.NewReader(resp.Body, t.timeout)
+	t.body.Store(body)
+	resp.Body = body
+	return resp, nil
+}
+
+func (t *idleTransport) err() error {
+	if body := t.body.Load(); body != nil {
+		return body.Err()
+	}
+	return nil
 }
 
 func (o *ollama) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
-	client, err := o.getClient()
+	start := time.Now()
+	client, err := o.getClient(false, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -64,9 +192,14 @@ func (o *ollama) Chat(ctx context.Context, req *provider.ChatRequest) (*provider
 		model = o.model
 	}
 
+	messages, err := o.convertMessages(req.Messages)
+	if err != nil {
+		return nil, err
+	}
+
 	chatReq := &api.ChatRequest{
 		Model:    model,
-		Messages: o.convertMessages(req.Messages),
+		Messages: messages,
 		Stream:   boolPtr(false),
 	}
 
@@ -93,6 +226,9 @@ func (o *ollama) Chat(ctx context.Context, req *provider.ChatRequest) (*provider
 	if len(opts) > 0 {
 		chatReq.Options = opts
 	}
+	if err := applyProviderOptions(chatReq, req.ProviderOptions); err != nil {
+		return nil, err
+	}
 
 	var response *api.ChatResponse
 	err = client.Chat(ctx, chatReq, func(resp api.ChatResponse) error {
@@ -100,14 +236,24 @@ func (o *ollama) Chat(ctx context.Context, req *provider.ChatRequest) (*provider
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("chat request failed: %w", err)
+		return nil, fmt.Errorf("chat request failed: %w", toProviderError(err))
 	}
 
-	return o.toProviderResponse(response, model), nil
+	chatResp := o.toProviderResponse(response, model)
+	chatResp.Timing = provider.NewTiming(start, response.EvalCount, response.EvalDuration)
+	return chatResp, nil
 }
 
 func (o *ollama) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
-	client, err := o.getClient()
+	return provider.ApplyStreamTimeouts(ctx, req, o.stream)
+}
+
+func (o *ollama) stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	var stall *idleTransport
+	if req.StreamIdleTimeout > 0 {
+		stall = &idleTransport{timeout: req.StreamIdleTimeout}
+	}
+	client, err := o.getClient(true, stall)
 	if err != nil {
 		return nil, err
 	}
@@ -117,9 +263,14 @@ func (o *ollama) Stream(ctx context.Context, req *provider.ChatRequest) (*provid
 		model = o.model
 	}
 
+	messages, err := o.convertMessages(req.Messages)
+	if err != nil {
+		return nil, err
+	}
+
 	chatReq := &api.ChatRequest{
 		Model:    model,
-		Messages: o.convertMessages(req.Messages),
+		Messages: messages,
 		Stream:   boolPtr(true),
 	}
 
@@ -146,10 +297,15 @@ func (o *ollama) Stream(ctx context.Context, req *provider.ChatRequest) (*provid
 	if len(opts) > 0 {
 		chatReq.Options = opts
 	}
+	if err := applyProviderOptions(chatReq, req.ProviderOptions); err != nil {
+		return nil, err
+	}
 
 	events := make(chan provider.StreamEvent)
 	done := make(chan struct{})
 
+	guard := newStreamGuard(req)
+
 	go func() {
 		defer close(events)
 
@@ -178,16 +334,35 @@ func (o *ollama) Stream(ctx context.Context, req *provider.ChatRequest) (*provid
 				}
 			}
 
+			content, guardReason := guard.push(resp.Message.Content)
+			if resp.Done {
+				content += guard.flush()
+			}
+			if guardReason != "" {
+				finishReason = guardReason
+			}
+
 			event := provider.StreamEvent{
 				Delta: provider.Delta{
-					Content:   resp.Message.Content,
+					Content:   content,
 					ToolCalls: toolCalls,
 				},
 				FinishReason: finishReason,
 			}
+			if resp.Done {
+				event.Usage = &provider.Usage{
+					PromptTokens:     resp.PromptEvalCount,
+					CompletionTokens: resp.EvalCount,
+					TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+				}
+				event.Timing = &provider.Timing{Generation: resp.EvalDuration}
+			}
 
 			select {
 			case events <- event:
+				if guardReason != "" {
+					return errGuardStop
+				}
 				return nil
 			case <-ctx.Done():
 				return ctx.Err()
@@ -196,21 +371,46 @@ func (o *ollama) Stream(ctx context.Context, req *provider.ChatRequest) (*provid
 			}
 		})
 
-		if err != nil {
-			events <- provider.StreamEvent{Err: err}
+		if err == nil && stall != nil && stall.err() != nil {
+			err = fmt.Errorf("failed to read stream: %w", stall.err())
+		}
+		if err != nil && !errors.Is(err, errGuardStop) {
+			select {
+			case events <- provider.StreamEvent{Err: toProviderError(err)}:
+			case <-done:
+			}
 		}
 	}()
 
-	return provider.NewStreamReader(events, func() { close(done) }), nil
+	return provider.NewStreamReader(events, func() { close(done) }, provider.Buffer(req.StreamBuffer, req.StreamOverflow)), nil
 }
 
-func (o *ollama) convertMessages(messages []provider.Message) []api.Message {
+func (o *ollama) convertMessages(messages []provider.Message) ([]api.Message, error) {
+	if err := provider.ValidateParts(messages); err != nil {
+		return nil, err
+	}
 	result := make([]api.Message, 0, len(messages))
 
 	for _, msg := range messages {
 		apiMsg := api.Message{
 			Role:    string(msg.Role),
-			Content: msg.Content,
+			Content: msg.Text(),
+		}
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case provider.PartText, provider.PartJSON:
+			case provider.PartImage:
+				if part.Image.Data == "" {
+					return nil, fmt.Errorf("image URLs are not supported, inline the image data")
+				}
+				data, err := base64.StdEncoding.DecodeString(part.Image.Data)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode image: %w", err)
+				}
+				apiMsg.Images = append(apiMsg.Images, data)
+			default:
+				return nil, fmt.Errorf("unsupported content part: %s", part.Type)
+			}
 		}
 
 		if len(msg.ToolCalls) > 0 {
@@ -230,7 +430,7 @@ func (o *ollama) convertMessages(messages []provider.Message) []api.Message {
 		result = append(result, apiMsg)
 	}
 
-	return result
+	return result, nil
 }
 
 func (o *ollama) convertTools(tools []provider.Tool) []api.Tool {
@@ -316,7 +516,60 @@ func (o *ollama) toProviderResponse(resp *api.ChatResponse, model string) *provi
 			CompletionTokens: resp.EvalCount,
 			TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
 		},
+		ProviderMetadata: metricsMetadata(resp.Metrics),
+	}
+}
+
+// applyProviderOptions merges options into the JSON form of chatReq. Fields
+// the Ollama client does not know are dropped. The "options" field is merged
+// into the model options rather than replacing them.
+func applyProviderOptions(chatReq *api.ChatRequest, options map[string]any) error {
+	if native, ok := options["options"].(map[string]any); ok {
+		if chatReq.Options == nil {
+			chatReq.Options = make(map[string]any)
+		}
+		maps.Copy(chatReq.Options, native)
+		options = maps.Clone(options)
+		delete(options, "options")
+	}
+	if len(options) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(chatReq)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	data, err = passthrough.Merge(data, options)
+	if err != nil {
+		return fmt.Errorf("failed to merge provider options: %w", err)
+	}
+	*chatReq = api.ChatRequest{}
+	if err := json.Unmarshal(data, chatReq); err != nil {
+		return fmt.Errorf("failed to apply provider options: %w", err)
+	}
+	return nil
+}
+
+func metricsMetadata(metrics api.Metrics) map[string]any {
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return nil
+	}
+	var metadata map[string]any
+	json.Unmarshal(data, &metadata)
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+func toProviderError(err error) error {
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) {
+		return &provider.APIError{StatusCode: statusErr.StatusCode, Body: statusErr.ErrorMessage}
 	}
+	return err
 }
 
 func boolPtr(b bool) *bool {
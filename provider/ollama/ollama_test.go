@@ -0,0 +1,196 @@
+package ollama_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/provider/ollama"
+	"github.com/alexisbouchez/ai/providertest"
+)
+
+// sentRequest decodes the body of the only request srv received.
+func sentRequest(t *testing.T, srv *providertest.Server) map[string]any {
+	t.Helper()
+	requests := srv.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	if requests[0].Path != "/api/chat" {
+		t.Errorf("path = %q, want /api/chat", requests[0].Path)
+	}
+	var body map[string]any
+	if err := json.Unmarshal([]byte(requests[0].Body), &body); err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	return body
+}
+
+func TestChatRoundTrip(t *testing.T) {
+	srv := providertest.NewServer(providertest.OllamaResponse("Paris"))
+	defer srv.Close()
+
+	temperature, maxTokens := 0.5, 64
+	p := ollama.New().WithBaseURL(srv.URL).WithModel("llama3")
+	resp, err := p.Chat(context.Background(), &provider.ChatRequest{
+		Messages: []provider.Message{
+			{Role: provider.RoleSystem, Content: "Be brief."},
+			{Role: provider.RoleUser, Parts: []provider.Part{
+				provider.TextPart("Where is this?"),
+				provider.ImagePart([]byte("hello"), "image/png"),
+			}},
+			{Role: provider.RoleAssistant, ToolCalls: []provider.ToolCall{{
+				ID:       "call_0",
+				Type:     "function",
+				Function: provider.FunctionCall{Name: "locate", Arguments: `{"hint":"tower"}`},
+			}}},
+			{Role: provider.RoleTool, ToolCallID: "call_0", Name: "locate", Content: "France"},
+		},
+		Tools: []provider.Tool{{
+			Type: "function",
+			Function: provider.Function{
+				Name:        "locate",
+				Description: "Locates a landmark",
+				Parameters: map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"hint": map[string]any{"type": "string", "description": "A clue"}},
+					"required":   []any{"hint"},
+				},
+			},
+		}},
+		Temperature: &temperature,
+		MaxTokens:   &maxTokens,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := sentRequest(t, srv)
+	if body["model"] != "llama3" || body["stream"] != false {
+		t.Errorf("model = %v, stream = %v", body["model"], body["stream"])
+	}
+	messages, _ := body["messages"].([]any)
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages, want 4", len(messages))
+	}
+	user := messages[1].(map[string]any)
+	if user["content"] != "Where is this?" {
+		t.Errorf("user content = %v", user["content"])
+	}
+	if images, _ := user["images"].([]any); len(images) != 1 || images[0] != "aGVsbG8=" {
+		t.Errorf("images = %v", user["images"])
+	}
+	calls, _ := messages[2].(map[string]any)["tool_calls"].([]any)
+	if len(calls) != 1 {
+		t.Fatalf("tool calls = %v", messages[2])
+	}
+	function := calls[0].(map[string]any)["function"].(map[string]any)
+	if function["name"] != "locate" || function["arguments"].(map[string]any)["hint"] != "tower" {
+		t.Errorf("tool call = %v", function)
+	}
+	if tool := messages[3].(map[string]any); tool["role"] != "tool" || tool["content"] != "France" {
+		t.Errorf("tool result = %v", tool)
+	}
+	tools, _ := body["tools"].([]any)
+	if len(tools) != 1 || tools[0].(map[string]any)["function"].(map[string]any)["name"] != "locate" {
+		t.Errorf("tools = %v", body["tools"])
+	}
+	options, _ := body["options"].(map[string]any)
+	if options["temperature"] != 0.5 || options["num_predict"] != 64.0 {
+		t.Errorf("options = %v", options)
+	}
+
+	if got := resp.Choices[0].Message.Content; got != "Paris" {
+		t.Errorf("content = %q, want Paris", got)
+	}
+	if got := resp.Choices[0].FinishReason; got != provider.FinishReasonStop {
+		t.Errorf("finish reason = %q", got)
+	}
+	if resp.Usage != (provider.Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}) {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+func TestChatToolCalls(t *testing.T) {
+	srv := providertest.NewServer(providertest.Script{
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body: `{"model":"test","created_at":"2025-01-01T00:00:00Z","done":true,"done_reason":"stop",` +
+			`"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"weather","arguments":{"city":"Lyon"}}}]}}`,
+	})
+	defer srv.Close()
+
+	resp, err := ollama.New().WithBaseURL(srv.URL).Chat(context.Background(), &provider.ChatRequest{
+		Messages: []provider.Message{{Role: provider.RoleUser, Content: "Weather in Lyon?"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason != provider.FinishReasonToolCalls {
+		t.Errorf("finish reason = %q", choice.FinishReason)
+	}
+	if len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("tool calls = %+v", choice.Message.ToolCalls)
+	}
+	call := choice.Message.ToolCalls[0]
+	if call.Function.Name != "weather" || call.Function.Arguments != `{"city":"Lyon"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	srv := providertest.NewServer(providertest.OllamaStream("Hel", "lo"))
+	defer srv.Close()
+
+	stream, err := ollama.New().WithBaseURL(srv.URL).Stream(context.Background(), &provider.ChatRequest{
+		Messages: []provider.Message{{Role: provider.RoleUser, Content: "Hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var acc provider.Accumulator
+	var last provider.StreamEvent
+	for event, err := range stream.Events() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		acc.Add(event)
+		last = event
+	}
+
+	if body := sentRequest(t, srv); body["stream"] != true {
+		t.Errorf("stream = %v, want true", body["stream"])
+	}
+	if got := acc.Message().Content; got != "Hello" {
+		t.Errorf("content = %q, want Hello", got)
+	}
+	if last.FinishReason != provider.FinishReasonStop {
+		t.Errorf("finish reason = %q", last.FinishReason)
+	}
+	if last.Usage == nil || last.Usage.CompletionTokens != 2 {
+		t.Errorf("usage = %+v", last.Usage)
+	}
+	if last.Timing == nil || last.Timing.Generation <= 0 {
+		t.Errorf("timing = %+v", last.Timing)
+	}
+}
+
+func TestChatError(t *testing.T) {
+	srv := providertest.NewServer(providertest.Error(404, `{"error":"model \"missing\" not found"}`))
+	defer srv.Close()
+
+	_, err := ollama.New().WithBaseURL(srv.URL).WithModel("missing").Chat(context.Background(), &provider.ChatRequest{
+		Messages: []provider.Message{{Role: provider.RoleUser, Content: "Hi"}},
+	})
+	var apiErr *provider.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want an APIError", err)
+	}
+	if apiErr.StatusCode != 404 || !strings.Contains(apiErr.Body, "not found") {
+		t.Errorf("err = %+v", apiErr)
+	}
+}
@@ -0,0 +1,74 @@
+package ollama
+
+import (
+	"maps"
+	"time"
+)
+
+// Options merges ChatRequest.ProviderOptions built by the functions of this
+// package, such as Options(KeepAlive(time.Hour), NumCtx(8192)), combining
+// their model options.
+func Options(opts ...map[string]any) map[string]any {
+	merged := make(map[string]any)
+	native := make(map[string]any)
+	for _, opt := range opts {
+		for k, v := range opt {
+			if m, ok := v.(map[string]any); ok && k == "options" {
+				maps.Copy(native, m)
+				continue
+			}
+			merged[k] = v
+		}
+	}
+	if len(native) > 0 {
+		merged["options"] = native
+	}
+	return merged
+}
+
+// KeepAlive returns ChatRequest.ProviderOptions keeping the model loaded
+// for d after the request. A negative d keeps it loaded until the server
+// stops, and zero unloads it right away.
+func KeepAlive(d time.Duration) map[string]any {
+	return map[string]any{"keep_alive": d.String()}
+}
+
+// NumCtx returns ChatRequest.ProviderOptions setting the size of the
+// context window, in tokens.
+func NumCtx(n int) map[string]any {
+	return ModelOptions(map[string]any{"num_ctx": n})
+}
+
+// NumGPU returns ChatRequest.ProviderOptions setting the number of layers
+// offloaded to the GPU. Zero runs on the CPU only.
+func NumGPU(n int) map[string]any {
+	return ModelOptions(map[string]any{"num_gpu": n})
+}
+
+// JSONFormat returns ChatRequest.ProviderOptions making the model reply
+// with JSON.
+func JSONFormat() map[string]any {
+	return map[string]any{"format": "json"}
+}
+
+// JSONSchema returns ChatRequest.ProviderOptions constraining the reply to
+// schema.
+func JSONSchema(schema map[string]any) map[string]any {
+	return map[string]any{"format": schema}
+}
+
+// Mirostat returns ChatRequest.ProviderOptions sampling with Mirostat
+// version 1 or 2, targeting the perplexity tau with the learning rate eta.
+func Mirostat(version int, tau, eta float64) map[string]any {
+	return ModelOptions(map[string]any{
+		"mirostat":     version,
+		"mirostat_tau": tau,
+		"mirostat_eta": eta,
+	})
+}
+
+// ModelOptions returns ChatRequest.ProviderOptions setting native model
+// options, such as num_thread or repeat_penalty, by name.
+func ModelOptions(options map[string]any) map[string]any {
+	return map[string]any{"options": options}
+}
@@ -0,0 +1,17 @@
+package openai
+
+import (
+	"context"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// AsyncChat runs req in the background with the Responses API, for jobs
+// outlasting an HTTP request such as long reasoning.
+func (o *openai) AsyncChat(ctx context.Context, req *provider.ChatRequest) (provider.JobHandle, error) {
+	return o.BackgroundResponse(ctx, req)
+}
+
+func (o *openai) Job(id string) provider.JobHandle {
+	return o.ResponseJob(id)
+}
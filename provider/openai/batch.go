@@ -0,0 +1,209 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexisbouchez/ai/batch"
+	"github.com/alexisbouchez/ai/internal/openaicompat"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const batchEndpoint = "/v1/chat/completions"
+
+type openaiBatchLine struct {
+	CustomID string                              `json:"custom_id"`
+	Method   string                              `json:"method"`
+	URL      string                              `json:"url"`
+	Body     *openaicompat.ChatCompletionRequest `json:"body"`
+}
+
+type openaiBatch struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	OutputFileID  string `json:"output_file_id"`
+	ErrorFileID   string `json:"error_file_id"`
+	CreatedAt     int64  `json:"created_at"`
+	RequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"request_counts"`
+}
+
+type openaiBatchResult struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (o *openai) SubmitBatch(ctx context.Context, reqs []provider.ChatRequest) (*batch.Job, error) {
+	var input bytes.Buffer
+	enc := json.NewEncoder(&input)
+	for i := range reqs {
+		model := reqs[i].Model
+		if model == "" {
+			model = o.Model()
+		}
+		body, err := o.Request(&reqs[i], model)
+		if err != nil {
+			return nil, err
+		}
+		line := openaiBatchLine{
+			CustomID: batch.CustomID(i),
+			Method:   http.MethodPost,
+			URL:      batchEndpoint,
+			Body:     body,
+		}
+		if err := enc.Encode(line); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	file, err := o.UploadFile(ctx, "batch.jsonl", provider.FilePurposeBatch, &input)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"input_file_id":     file.ID,
+		"endpoint":          batchEndpoint,
+		"completion_window": "24h",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := o.Do(ctx, http.MethodPost, "/v1/batches", bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	return toBatchJob(respBody)
+}
+
+func (o *openai) PollBatch(ctx context.Context, id string) (*batch.Job, error) {
+	respBody, err := o.Do(ctx, http.MethodGet, "/v1/batches/"+id, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return toBatchJob(respBody)
+}
+
+func (o *openai) CancelBatch(ctx context.Context, id string) (*batch.Job, error) {
+	respBody, err := o.Do(ctx, http.MethodPost, "/v1/batches/"+id+"/cancel", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	return toBatchJob(respBody)
+}
+
+func (o *openai) BatchResults(ctx context.Context, id string) ([]batch.Result, error) {
+	respBody, err := o.Do(ctx, http.MethodGet, "/v1/batches/"+id, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var b openaiBatch
+	if err := json.Unmarshal(respBody, &b); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var results []batch.Result
+	for _, fileID := range []string{b.OutputFileID, b.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		content, err := o.FileContent(ctx, fileID)
+		if err != nil {
+			return nil, err
+		}
+		lines, err := o.parseBatchResults(content)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, lines...)
+	}
+
+	batch.SortResults(results)
+	return results, nil
+}
+
+func (o *openai) parseBatchResults(content []byte) ([]batch.Result, error) {
+	var results []batch.Result
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var line openaiBatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("failed to parse batch result: %w", err)
+		}
+
+		result := batch.Result{Index: batch.Index(line.CustomID), CustomID: line.CustomID}
+		switch {
+		case line.Error != nil:
+			result.Err = &provider.APIError{Type: line.Error.Code, Message: line.Error.Message}
+		case line.Response == nil:
+			result.Err = fmt.Errorf("batch result has no response")
+		case line.Response.StatusCode != http.StatusOK:
+			result.Err = &provider.APIError{StatusCode: line.Response.StatusCode, Body: string(line.Response.Body)}
+		default:
+			var resp openaicompat.ChatCompletionResponse
+			if err := json.Unmarshal(line.Response.Body, &resp); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+			}
+			result.Response = o.Response(&resp)
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+func toBatchJob(data []byte) (*batch.Job, error) {
+	var b openaiBatch
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var status batch.Status
+	switch b.Status {
+	case "validating":
+		status = batch.StatusPending
+	case "in_progress", "finalizing", "cancelling":
+		status = batch.StatusRunning
+	case "completed":
+		status = batch.StatusCompleted
+	case "failed":
+		status = batch.StatusFailed
+	case "expired":
+		status = batch.StatusExpired
+	case "cancelled":
+		status = batch.StatusCancelled
+	default:
+		status = batch.Status(b.Status)
+	}
+
+	return &batch.Job{
+		ID:        b.ID,
+		Status:    status,
+		Total:     b.RequestCounts.Total,
+		Succeeded: b.RequestCounts.Completed,
+		Failed:    b.RequestCounts.Failed,
+		CreatedAt: time.Unix(b.CreatedAt, 0),
+	}, nil
+}
@@ -0,0 +1,24 @@
+package openai
+
+import (
+	"context"
+	"io"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+func (o *openai) Upload(ctx context.Context, filename, purpose string, content io.Reader) (*provider.File, error) {
+	return o.UploadFile(ctx, filename, purpose, content)
+}
+
+func (o *openai) List(ctx context.Context) ([]provider.File, error) {
+	return o.ListFiles(ctx)
+}
+
+func (o *openai) Get(ctx context.Context, id string) (*provider.File, error) {
+	return o.GetFile(ctx, id)
+}
+
+func (o *openai) Delete(ctx context.Context, id string) error {
+	return o.DeleteFile(ctx, id)
+}
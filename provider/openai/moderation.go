@@ -0,0 +1,52 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const defaultModerationModel = "omni-moderation-latest"
+
+type openaiModerationResponse struct {
+	Results []struct {
+		Flagged        bool               `json:"flagged"`
+		Categories     map[string]bool    `json:"categories"`
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+}
+
+// Moderate classifies inputs with the moderation endpoint.
+func (o *openai) Moderate(ctx context.Context, inputs ...string) ([]provider.ModerationResult, error) {
+	body, err := json.Marshal(map[string]any{
+		"model": defaultModerationModel,
+		"input": inputs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	respBody, err := o.Do(ctx, http.MethodPost, "/v1/moderations", bytes.NewReader(body), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp openaiModerationResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	results := make([]provider.ModerationResult, len(resp.Results))
+	for i, r := range resp.Results {
+		results[i] = provider.ModerationResult{
+			Flagged:    r.Flagged,
+			Categories: r.Categories,
+			Scores:     r.CategoryScores,
+		}
+	}
+	return results, nil
+}
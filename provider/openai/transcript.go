@@ -0,0 +1,18 @@
+package openai
+
+import (
+	"github.com/alexisbouchez/ai/internal/openaicompat"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// ImportMessages converts the messages array of a chat completions request,
+// or a request holding one, to messages.
+func ImportMessages(data []byte) ([]provider.Message, error) {
+	return openaicompat.ImportMessages(data)
+}
+
+// ExportMessages converts messages to the messages array of a chat
+// completions request, as sent by the provider.
+func ExportMessages(messages []provider.Message) ([]byte, error) {
+	return New().(*openai).ExportMessages(messages)
+}
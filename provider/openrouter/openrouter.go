@@ -0,0 +1,163 @@
+package openrouter
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/alexisbouchez/ai/internal/openaicompat"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+const (
+	defaultBaseURL = "https://openrouter.ai/api"
+	defaultModel   = "openrouter/auto"
+)
+
+// Preferences control which upstream providers OpenRouter routes to.
+type Preferences struct {
+	// Order lists provider names to try first
+	Order          []string `json:"order,omitempty"`
+	AllowFallbacks *bool    `json:"allow_fallbacks,omitempty"`
+	// RequireParameters skips providers that ignore some request parameters
+	RequireParameters bool     `json:"require_parameters,omitempty"`
+	DataCollection    string   `json:"data_collection,omitempty"`
+	Only              []string `json:"only,omitempty"`
+	Ignore            []string `json:"ignore,omitempty"`
+	Quantizations     []string `json:"quantizations,omitempty"`
+	// Sort is price, throughput or latency
+	Sort string `json:"sort,omitempty"`
+}
+
+type openrouter struct {
+	*openaicompat.Client
+	siteURL     string
+	appName     string
+	preferences *Preferences
+	models      []string
+}
+
+type Option func(*openrouter)
+
+// WithApp identifies the calling application on openrouter.ai rankings
+// through the HTTP-Referer and X-Title headers.
+func WithApp(siteURL, name string) Option {
+	return func(o *openrouter) {
+		o.siteURL = siteURL
+		o.appName = name
+	}
+}
+
+func WithPreferences(p Preferences) Option {
+	return func(o *openrouter) {
+		o.preferences = &p
+	}
+}
+
+// WithFallbackModels lists models OpenRouter tries, in order, when the
+// requested one is unavailable.
+func WithFallbackModels(models ...string) Option {
+	return func(o *openrouter) {
+		o.models = models
+	}
+}
+
+// New creates a new OpenRouter provider. Models are named
+// "vendor/model", optionally suffixed with a variant such as ":online" for
+// web search or ":free". The upstream that served a request is reported in
+// ChatResponse.Provider.
+func New(opts ...Option) provider.Provider {
+	o := &openrouter{}
+	o.Client = openaicompat.New(openaicompat.Config{
+		System:  "openrouter",
+		BaseURL: defaultBaseURL,
+		Model:   defaultModel,
+		Quirks: openaicompat.Quirks{
+			StreamUsage:       true,
+			SeedField:         "seed",
+			LogitBias:         true,
+			User:              true,
+			ParallelToolCalls: true,
+			Logprobs:          true,
+		},
+		Prepare: o.prepare,
+	})
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o.WithHeaders(nil)
+}
+
+// NewFromEnv creates an OpenRouter provider authenticated with
+// OPENROUTER_API_KEY.
+func NewFromEnv(opts ...Option) (provider.Provider, error) {
+	key, err := provider.RequireEnv("OPENROUTER_API_KEY")
+	if err != nil {
+		return nil, err
+	}
+	return New(opts...).WithAPIKey(key), nil
+}
+
+// Online returns the variant of model augmented with web search results.
+func Online(model string) string {
+	return model + ":online"
+}
+
+func (o *openrouter) prepare(req *provider.ChatRequest, body *openaicompat.ChatCompletionRequest) {
+	if o.preferences == nil && len(o.models) == 0 {
+		return
+	}
+	body.Extra = make(map[string]any)
+	if o.preferences != nil {
+		body.Extra["provider"] = o.preferences
+	}
+	if len(o.models) > 0 {
+		body.Extra["models"] = append([]string{body.Model}, o.models...)
+	}
+}
+
+func (o *openrouter) WithAPIKey(key string) provider.Provider {
+	cp := *o
+	cp.Client = o.Client.WithAPIKey(key).(*openaicompat.Client)
+	return &cp
+}
+
+func (o *openrouter) WithBaseURL(url string) provider.Provider {
+	cp := *o
+	cp.Client = o.Client.WithBaseURL(url).(*openaicompat.Client)
+	return &cp
+}
+
+func (o *openrouter) WithModel(model string) provider.Provider {
+	cp := *o
+	cp.Client = o.Client.WithModel(model).(*openaicompat.Client)
+	return &cp
+}
+
+func (o *openrouter) WithHTTPClient(client *http.Client) provider.Provider {
+	cp := *o
+	cp.Client = o.Client.WithHTTPClient(client).(*openaicompat.Client)
+	return &cp
+}
+
+func (o *openrouter) WithTimeout(timeout time.Duration) provider.Provider {
+	cp := *o
+	cp.Client = o.Client.WithTimeout(timeout).(*openaicompat.Client)
+	return &cp
+}
+
+// WithHeaders sets extra headers, keeping the application headers.
+func (o *openrouter) WithHeaders(headers map[string]string) provider.Provider {
+	merged := make(map[string]string, len(headers)+2)
+	if o.siteURL != "" {
+		merged["HTTP-Referer"] = o.siteURL
+	}
+	if o.appName != "" {
+		merged["X-Title"] = o.appName
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+	cp := *o
+	cp.Client = o.Client.WithHeaders(merged).(*openaicompat.Client)
+	return &cp
+}
@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type PartType string
+
+const (
+	PartText  PartType = "text"
+	PartAudio PartType = "audio"
+	PartImage PartType = "image"
+	PartJSON  PartType = "json"
+	// PartDocument is a file such as a PDF, read by the model natively
+	PartDocument PartType = "document"
+)
+
+// Part is a piece of multimodal message content. The parts of a message
+// follow its Content. Tool results may hold parts as well.
+type Part struct {
+	Type     PartType        `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	Audio    *Audio          `json:"audio,omitempty"`
+	Image    *Image          `json:"image,omitempty"`
+	JSON     json.RawMessage `json:"json,omitempty"`
+	Document *Document       `json:"document,omitempty"`
+}
+
+// Audio is audio input or output. Data is base64 encoded and Format is the
+// encoding, such as "wav" or "mp3".
+type Audio struct {
+	// ID references audio generated by the provider in later turns
+	ID         string `json:"id,omitempty"`
+	Data       string `json:"data,omitempty"`
+	Format     string `json:"format,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
+}
+
+// Image is either fetched by the provider from URL, or inlined as base64
+// Data of MediaType, such as "image/png".
+type Image struct {
+	URL       string `json:"url,omitempty"`
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+}
+
+// DataURL returns the image as a data URL, or its URL when it has no data.
+func (i *Image) DataURL() string {
+	if i.Data == "" {
+		return i.URL
+	}
+	return "data:" + i.MediaType + ";base64," + i.Data
+}
+
+// Document is either inlined as base64 Data of MediaType, such as
+// "application/pdf", or references a file uploaded to the provider by
+// FileID. Filename is sent to providers that require one and Title to
+// those that show it to the model. Citations asks providers that support
+// it to cite the document in Choice.Citations.
+type Document struct {
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	FileID    string `json:"file_id,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Citations bool   `json:"citations,omitempty"`
+}
+
+// DataURL returns the document as a data URL.
+func (d *Document) DataURL() string {
+	return "data:" + d.MediaType + ";base64," + d.Data
+}
+
+// ValidateParts reports the first part of messages missing the content of
+// its type, such as an audio part without Audio, which converters would
+// otherwise dereference.
+func ValidateParts(messages []Message) error {
+	for i, msg := range messages {
+		for j, part := range msg.Parts {
+			var missing bool
+			switch part.Type {
+			case PartAudio:
+				missing = part.Audio == nil
+			case PartImage:
+				missing = part.Image == nil
+			case PartDocument:
+				missing = part.Document == nil
+			}
+			if missing {
+				return fmt.Errorf("part %d of message %d is of type %s but has no %s", j, i, part.Type, part.Type)
+			}
+		}
+	}
+	return nil
+}
+
+func TextPart(text string) Part {
+	return Part{Type: PartText, Text: text}
+}
+
+// AudioPart returns a part holding the raw audio data in the given format.
+func AudioPart(data []byte, format string) Part {
+	return Part{Type: PartAudio, Audio: &Audio{
+		Data:   base64.StdEncoding.EncodeToString(data),
+		Format: format,
+	}}
+}
+
+// ImagePart returns a part holding the raw image data of mediaType.
+func ImagePart(data []byte, mediaType string) Part {
+	return Part{Type: PartImage, Image: &Image{
+		Data:      base64.StdEncoding.EncodeToString(data),
+		MediaType: mediaType,
+	}}
+}
+
+func ImageURLPart(url string) Part {
+	return Part{Type: PartImage, Image: &Image{URL: url}}
+}
+
+// DocumentPart returns a part holding the raw document data of mediaType,
+// such as a PDF.
+func DocumentPart(data []byte, mediaType string) Part {
+	return Part{Type: PartDocument, Document: &Document{
+		Data:      base64.StdEncoding.EncodeToString(data),
+		MediaType: mediaType,
+	}}
+}
+
+// DocumentFilePart returns a part referencing a document uploaded through
+// the provider's FileStore, or a file URI on Vertex AI.
+func DocumentFilePart(fileID string) Part {
+	return Part{Type: PartDocument, Document: &Document{FileID: fileID}}
+}
+
+// JSONPart returns a part holding v encoded as JSON, for structured tool
+// results.
+func JSONPart(v any) (Part, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{Type: PartJSON, JSON: data}, nil
+}
+
+// Text returns Content followed by the text and JSON parts of the message,
+// one per line.
+func (m Message) Text() string {
+	texts := make([]string, 0, len(m.Parts)+1)
+	if m.Content != "" {
+		texts = append(texts, m.Content)
+	}
+	for _, part := range m.Parts {
+		switch part.Type {
+		case PartText:
+			texts = append(texts, part.Text)
+		case PartJSON:
+			texts = append(texts, string(part.JSON))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -2,63 +2,177 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"iter"
+	"net/http"
+	"sync"
+	"time"
 )
 
+// Provider is a chat model API. Providers are immutable once built: the
+// With methods return a configured copy and leave the receiver unchanged,
+// so a provider can be shared between goroutines and used as the base of
+// differently configured variants.
 type Provider interface {
 	WithAPIKey(key string) Provider
 	WithBaseURL(url string) Provider
 	WithModel(model string) Provider
+	WithHTTPClient(client *http.Client) Provider
+	// WithTimeout bounds requests that do not stream. Streams would be cut
+	// off by it, so they are bounded by ChatRequest.StreamTimeout instead.
+	WithTimeout(timeout time.Duration) Provider
+	WithHeaders(headers map[string]string) Provider
 	Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
 	Stream(ctx context.Context, req *ChatRequest) (*StreamReader, error)
 }
 
+// HTTPClient returns the HTTP client p sends its requests with, or nil
+// when p does not expose it. Middleware forwards it from the provider it
+// wraps.
+func HTTPClient(p Provider) *http.Client {
+	if c, ok := p.(interface{ HTTPClient() *http.Client }); ok {
+		return c.HTTPClient()
+	}
+	return nil
+}
+
+// System returns the name of the API p calls, as the gen_ai.system attribute
+// of the OpenTelemetry semantic conventions names it, or "" when p does not
+// expose it. Middleware forwards it from the provider it wraps.
+func System(p Provider) string {
+	if s, ok := p.(interface{ System() string }); ok {
+		return s.System()
+	}
+	return ""
+}
+
+// StreamReader delivers the events of a streamed response. Range over
+// Events to consume it:
+//
+//	for event, err := range stream.Events() {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Print(event.Delta.Content)
+//	}
 type StreamReader struct {
 	events chan StreamEvent
-	err    error
-	done   bool
-	close  func()
+	// source is the channel of the producer, events when unbuffered
+	source   chan StreamEvent
+	size     int
+	overflow Overflow
+	closed   chan struct{}
+	close    func()
+	once     sync.Once
+
+	rateLimit *RateLimitInfo
+
+	// mu guards the measures of Timing
+	mu               sync.Mutex
+	started          time.Time
+	first, last      time.Time
+	completionTokens int
+	generation       time.Duration
 }
 
-func NewStreamReader(events chan StreamEvent, close func()) *StreamReader {
-	return &StreamReader{events: events, close: close}
+// NewStreamReader returns a reader over events, which the producer closes
+// after the last event. close is called once when the reader is closed.
+func NewStreamReader(events chan StreamEvent, close func(), opts ...StreamOption) *StreamReader {
+	s := &StreamReader{events: events, source: events, closed: make(chan struct{}), close: close, started: time.Now()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.size > 0 {
+		s.events = make(chan StreamEvent)
+		go s.buffer()
+	}
+	return s
 }
 
-func (s *StreamReader) Recv() (StreamEvent, error) {
-	if s.done {
-		return StreamEvent{}, ErrStreamClosed
+// Events returns an iterator over the stream. Iteration ends after the last
+// event or the first error, and the stream is closed when the loop exits.
+func (s *StreamReader) Events() iter.Seq2[StreamEvent, error] {
+	return func(yield func(StreamEvent, error) bool) {
+		defer s.Close()
+		for {
+			event, err := s.Recv()
+			if errors.Is(err, ErrStreamClosed) {
+				return
+			}
+			if !yield(event, err) || err != nil {
+				return
+			}
+		}
 	}
-	event, ok := <-s.events
-	if !ok {
-		s.done = true
+}
+
+// Recv returns the next event, or ErrStreamClosed once the stream is
+// exhausted or closed. Prefer Events.
+func (s *StreamReader) Recv() (StreamEvent, error) {
+	select {
+	case <-s.closed:
 		return StreamEvent{}, ErrStreamClosed
+	default:
 	}
-	if event.Err != nil {
-		s.err = event.Err
+
+	select {
+	case event, ok := <-s.events:
+		if !ok {
+			return StreamEvent{}, ErrStreamClosed
+		}
+		s.observe(event)
 		return event, event.Err
+	case <-s.closed:
+		return StreamEvent{}, ErrStreamClosed
 	}
-	return event, nil
 }
 
+// Close stops the stream. It is idempotent and safe to call concurrently
+// with Recv.
 func (s *StreamReader) Close() {
-	if s.close != nil {
-		s.close()
-	}
+	s.once.Do(func() {
+		close(s.closed)
+		if s.close != nil {
+			s.close()
+		}
+	})
+}
+
+// Done returns a channel closed by Close. Producers must select on it, or
+// on a channel closed by the close function given to NewStreamReader, when
+// sending, so that they stop instead of blocking once the reader is gone.
+func (s *StreamReader) Done() <-chan struct{} {
+	return s.closed
 }
 
 type StreamEvent struct {
+	// Index is the choice the event belongs to when N > 1
+	Index        int    `json:"index,omitempty"`
 	Delta        Delta  `json:"delta"`
 	FinishReason string `json:"finish_reason,omitempty"`
-	Err          error  `json:"-"`
+	Usage        *Usage `json:"usage,omitempty"`
+	// Timing is set on the last event by providers reporting the
+	// generation time
+	Timing *Timing `json:"timing,omitempty"`
+	Err    error   `json:"-"`
 }
 
 type Delta struct {
 	Content   string     `json:"content,omitempty"`
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Citations are sent once the text they support has been streamed
+	Citations []Citation `json:"citations,omitempty"`
+	// HostedTools are sent once their result is known
+	HostedTools []HostedToolUse `json:"hosted_tools,omitempty"`
 }
 
 var ErrStreamClosed = errors.New("stream closed")
 
+// ErrStreamStalled is sent as a stream event error when no data arrives
+// for ChatRequest.StreamIdleTimeout.
+var ErrStreamStalled = errors.New("stream stalled")
+
 type Role string
 
 const (
@@ -74,6 +188,24 @@ type Message struct {
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
 	Name       string     `json:"name,omitempty"`
+	Parts      []Part     `json:"parts,omitempty"`
+	// Audio is the audio generated by audio-capable models
+	Audio *Audio `json:"audio,omitempty"`
+	// HostedTools are the calls of provider-hosted tools the model made
+	// while writing the message
+	HostedTools []HostedToolUse `json:"hosted_tools,omitempty"`
+}
+
+// HostedToolUse is a call of a tool run by the provider, such as web search
+// or code execution, with its result. Assistant messages keep them so that
+// the conversation can be sent back as it happened.
+type HostedToolUse struct {
+	ID string `json:"id,omitempty"`
+	// Name is the native name of the tool, such as code_execution
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// Result is the native result
+	Result json.RawMessage `json:"result,omitempty"`
 }
 
 type ToolCall struct {
@@ -91,8 +223,33 @@ type FunctionCall struct {
 type Tool struct {
 	Type     string   `json:"type"`
 	Function Function `json:"function"`
+	// Options configures tools hosted by the provider, such as max_uses
+	Options map[string]any `json:"options,omitempty"`
 }
 
+// ToolWebSearch is the type of the web search tool hosted by providers that
+// have one. It runs server-side and never produces tool calls.
+const ToolWebSearch = "web_search"
+
+// ToolFileSearch and ToolCodeInterpreter are the types of the file search
+// and code execution tools hosted by providers that have them. They can be
+// mixed with function tools, and their calls are reported in
+// Message.HostedTools. OpenAI only hosts them on the Responses API, used by
+// AsyncChat; chat completions requests holding them fail.
+const (
+	ToolFileSearch      = "file_search"
+	ToolCodeInterpreter = "code_interpreter"
+)
+
+// ToolComputer, ToolTextEditor and ToolBash are the types of the computer
+// use tools of Anthropic. The model knows their schemas, and their calls
+// are executed by the application like function calls.
+const (
+	ToolComputer   = "computer"
+	ToolTextEditor = "text_editor"
+	ToolBash       = "bash"
+)
+
 type Function struct {
 	Name        string         `json:"name"`
 	Description string         `json:"description,omitempty"`
@@ -100,55 +257,168 @@ type Function struct {
 	Strict      bool           `json:"strict,omitempty"`
 }
 
-type ToolChoice string
+// ToolChoice controls whether the model calls tools. Type is auto, none,
+// any, required, or function to force the tool named by Function.
+type ToolChoice struct {
+	Type     string `json:"type"`
+	Function string `json:"function,omitempty"`
+}
 
-const (
-	ToolChoiceAuto     ToolChoice = "auto"
-	ToolChoiceNone     ToolChoice = "none"
-	ToolChoiceAny      ToolChoice = "any"
-	ToolChoiceRequired ToolChoice = "required"
+var (
+	ToolChoiceAuto     = ToolChoice{Type: "auto"}
+	ToolChoiceNone     = ToolChoice{Type: "none"}
+	ToolChoiceAny      = ToolChoice{Type: "any"}
+	ToolChoiceRequired = ToolChoice{Type: "required"}
 )
 
+// ForceTool returns a tool choice requiring a call to the named function.
+func ForceTool(name string) *ToolChoice {
+	return &ToolChoice{Type: "function", Function: name}
+}
+
 type ChatRequest struct {
-	Messages         []Message   `json:"messages"`
-	Model            string      `json:"model,omitempty"`
-	Temperature      *float64    `json:"temperature,omitempty"`
-	TopP             *float64    `json:"top_p,omitempty"`
-	MaxTokens        *int        `json:"max_tokens,omitempty"`
-	Stream           bool        `json:"stream,omitempty"`
-	Stop             []string    `json:"stop,omitempty"`
-	Tools            []Tool      `json:"tools,omitempty"`
-	ToolChoice       *ToolChoice `json:"tool_choice,omitempty"`
-	PresencePenalty  *float64    `json:"presence_penalty,omitempty"`
-	FrequencyPenalty *float64    `json:"frequency_penalty,omitempty"`
-	RandomSeed       *int        `json:"random_seed,omitempty"`
+	Messages    []Message   `json:"messages"`
+	Model       string      `json:"model,omitempty"`
+	Temperature *float64    `json:"temperature,omitempty"`
+	TopP        *float64    `json:"top_p,omitempty"`
+	MaxTokens   *int        `json:"max_tokens,omitempty"`
+	Stream      bool        `json:"stream,omitempty"`
+	Stop        []string    `json:"stop,omitempty"`
+	Tools       []Tool      `json:"tools,omitempty"`
+	ToolChoice  *ToolChoice `json:"tool_choice,omitempty"`
+	// ParallelToolCalls set to false makes the model call at most one tool
+	// per turn
+	ParallelToolCalls *bool          `json:"parallel_tool_calls,omitempty"`
+	PresencePenalty   *float64       `json:"presence_penalty,omitempty"`
+	FrequencyPenalty  *float64       `json:"frequency_penalty,omitempty"`
+	RandomSeed        *int           `json:"random_seed,omitempty"`
+	N                 *int           `json:"n,omitempty"`
+	LogitBias         map[string]int `json:"logit_bias,omitempty"`
+	User              string         `json:"user,omitempty"`
+	// Logprobs requests the log probability of every output token, and
+	// TopLogprobs the number of most likely alternatives at each position
+	Logprobs    bool `json:"logprobs,omitempty"`
+	TopLogprobs *int `json:"top_logprobs,omitempty"`
+	// IdempotencyKey is sent as the Idempotency-Key header by providers that
+	// support it, so retried requests are not processed twice
+	IdempotencyKey string `json:"-"`
+	// Metadata carries request-scoped values for middleware and is not sent
+	// to providers
+	Metadata map[string]string `json:"-"`
+	// ProviderOptions are merged into the top level of the native request
+	// body, replacing fields of the same name
+	ProviderOptions map[string]any `json:"-"`
+	// StreamIdleTimeout ends streams receiving no data for this long with an
+	// ErrStreamStalled error. Zero waits indefinitely.
+	StreamIdleTimeout time.Duration `json:"-"`
+	// StreamBuffer queues up to this many events for a slow reader, so that
+	// the response is read from the network at its own pace. Zero hands
+	// each event over to the reader before reading the next.
+	StreamBuffer int `json:"-"`
+	// StreamOverflow is what a full StreamBuffer does
+	StreamOverflow Overflow `json:"-"`
+	// FirstEventTimeout ends streams whose first event has not arrived
+	// within it, and StreamTimeout those not completed within it, both with
+	// a TimeoutError. Zero waits indefinitely.
+	FirstEventTimeout time.Duration `json:"-"`
+	StreamTimeout     time.Duration `json:"-"`
 }
 
 type ChatResponse struct {
-	ID      string   `json:"id"`
-	Object  string   `json:"object"`
-	Created int64    `json:"created"`
-	Model   string   `json:"model"`
-	Choices []Choice `json:"choices"`
-	Usage   Usage    `json:"usage"`
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	// Provider is the upstream that served the request, reported by
+	// aggregators such as OpenRouter
+	Provider string `json:"provider,omitempty"`
+	// SystemFingerprint identifies the backend configuration, which
+	// together with RandomSeed determines reproducibility
+	SystemFingerprint string   `json:"system_fingerprint,omitempty"`
+	Choices           []Choice `json:"choices"`
+	Usage             Usage    `json:"usage"`
+	// ProviderMetadata holds the fields of the native response that have no
+	// equivalent in ChatResponse
+	ProviderMetadata map[string]any `json:"provider_metadata,omitempty"`
+	// Timing is set by providers on the responses of Chat
+	Timing *Timing `json:"timing,omitempty"`
+	// RateLimit is the rate limit state reported with the response
+	RateLimit *RateLimitInfo `json:"rate_limit,omitempty"`
 }
 
 type Choice struct {
 	Index        int     `json:"index"`
 	Message      Message `json:"message"`
 	FinishReason string  `json:"finish_reason"`
+	// Logprobs is set when requested with ChatRequest.Logprobs
+	Logprobs *Logprobs `json:"logprobs,omitempty"`
+	// Citations link spans of the message content to the sources backing
+	// them
+	Citations []Citation `json:"citations,omitempty"`
+}
+
+// Citation ties a span of the response text to the source supporting it:
+// a document of the request or a web search result.
+type Citation struct {
+	// Type is the location kind, such as "char_location", "page_location",
+	// "content_block_location" or "web_search_result_location"
+	Type      string `json:"type"`
+	CitedText string `json:"cited_text,omitempty"`
+	// DocumentIndex is the position of the cited document among the
+	// documents of the request
+	DocumentIndex int    `json:"document_index"`
+	DocumentTitle string `json:"document_title,omitempty"`
+	// SourceStart and SourceEnd locate the cited text in the document as
+	// character offsets, page numbers or content block indices, depending
+	// on Type. SourceEnd is exclusive.
+	SourceStart int `json:"source_start,omitempty"`
+	SourceEnd   int `json:"source_end,omitempty"`
+	// URL and Title identify a cited web page
+	URL   string `json:"url,omitempty"`
+	Title string `json:"title,omitempty"`
+	// TextStart and TextEnd are the byte offsets of the supported span in
+	// the message content. TextEnd is exclusive.
+	TextStart int `json:"text_start"`
+	TextEnd   int `json:"text_end"`
+}
+
+type Logprobs struct {
+	Content []TokenLogprob `json:"content"`
+}
+
+type TokenLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	// Bytes is the UTF-8 encoding of Token, which may be a partial character
+	Bytes       []int        `json:"bytes,omitempty"`
+	TopLogprobs []TopLogprob `json:"top_logprobs,omitempty"`
+}
+
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes,omitempty"`
 }
 
 const (
-	FinishReasonStop        = "stop"
-	FinishReasonLength      = "length"
-	FinishReasonToolCalls   = "tool_calls"
-	FinishReasonModelLength = "model_length"
-	FinishReasonError       = "error"
+	FinishReasonStop          = "stop"
+	FinishReasonLength        = "length"
+	FinishReasonToolCalls     = "tool_calls"
+	FinishReasonModelLength   = "model_length"
+	FinishReasonError         = "error"
+	FinishReasonContentFilter = "content_filter"
 )
 
 type Usage struct {
+	// PromptTokens includes CachedTokens and CacheWriteTokens
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// CachedTokens are the prompt tokens read from the prompt cache of the
+	// provider, included in PromptTokens
+	CachedTokens int `json:"cached_tokens,omitempty"`
+	// CacheWriteTokens are the prompt tokens written to the prompt cache,
+	// which Anthropic bills above the input price, included in
+	// PromptTokens
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
 }
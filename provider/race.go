@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Race sends req to every provider at once and returns the first successful
+// response, canceling the other requests. Leave req.Model empty unless every
+// provider serves that model, so that each uses its own. When all requests
+// fail, the joined errors are returned.
+func Race(ctx context.Context, req *ChatRequest, providers ...Provider) (*ChatResponse, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("no providers to race")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		resp *ChatResponse
+		err  error
+	}
+	results := make(chan result, len(providers))
+	for i, p := range providers {
+		go func() {
+			resp, err := p.Chat(ctx, req)
+			if err != nil {
+				err = fmt.Errorf("provider %d: %w", i, err)
+			}
+			results <- result{resp, err}
+		}()
+	}
+
+	errs := make([]error, 0, len(providers))
+	for range providers {
+		r := <-results
+		if r.err == nil {
+			return r.resp, nil
+		}
+		errs = append(errs, r.err)
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitInfo is the rate limit state reported in the response headers
+// of a provider: the x-ratelimit-* headers of OpenAI and compatible APIs,
+// the anthropic-ratelimit-* headers of Anthropic and Retry-After. Counts
+// not reported are -1.
+type RateLimitInfo struct {
+	LimitRequests     int `json:"limit_requests"`
+	RemainingRequests int `json:"remaining_requests"`
+	LimitTokens       int `json:"limit_tokens"`
+	RemainingTokens   int `json:"remaining_tokens"`
+	// ResetRequests and ResetTokens are when the limits are replenished
+	ResetRequests time.Time `json:"reset_requests,omitzero"`
+	ResetTokens   time.Time `json:"reset_tokens,omitzero"`
+	// RetryAfter is how long to wait before retrying a rejected request
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+}
+
+// ParseRateLimit returns the rate limit state of header, or nil when it
+// reports none.
+func ParseRateLimit(header http.Header) *RateLimitInfo {
+	info := &RateLimitInfo{
+		LimitRequests:     headerInt(header, "x-ratelimit-limit-requests", "anthropic-ratelimit-requests-limit"),
+		RemainingRequests: headerInt(header, "x-ratelimit-remaining-requests", "anthropic-ratelimit-requests-remaining"),
+		LimitTokens:       headerInt(header, "x-ratelimit-limit-tokens", "anthropic-ratelimit-tokens-limit"),
+		RemainingTokens:   headerInt(header, "x-ratelimit-remaining-tokens", "anthropic-ratelimit-tokens-remaining"),
+		ResetRequests:     headerReset(header, "x-ratelimit-reset-requests", "anthropic-ratelimit-requests-reset"),
+		ResetTokens:       headerReset(header, "x-ratelimit-reset-tokens", "anthropic-ratelimit-tokens-reset"),
+		RetryAfter:        retryAfter(header),
+	}
+	if *info == (RateLimitInfo{LimitRequests: -1, RemainingRequests: -1, LimitTokens: -1, RemainingTokens: -1}) {
+		return nil
+	}
+	return info
+}
+
+// ReportRateLimit returns a StreamOption making info the RateLimit of the
+// reader. Providers pass it the state parsed from the stream response.
+func ReportRateLimit(info *RateLimitInfo) StreamOption {
+	return func(s *StreamReader) {
+		s.rateLimit = info
+	}
+}
+
+// RateLimit returns the rate limit state reported with the stream, or nil.
+func (s *StreamReader) RateLimit() *RateLimitInfo {
+	return s.rateLimit
+}
+
+func headerInt(header http.Header, keys ...string) int {
+	for _, key := range keys {
+		if n, err := strconv.Atoi(header.Get(key)); err == nil {
+			return n
+		}
+	}
+	return -1
+}
+
+// headerReset parses the reset of a limit, a duration such as "6m0s" for
+// OpenAI and an RFC 3339 time for Anthropic.
+func headerReset(header http.Header, keys ...string) time.Time {
+	for _, key := range keys {
+		value := header.Get(key)
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err == nil {
+			return time.Now().Add(d)
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// retryAfter parses retry-after-ms, then Retry-After in seconds or as an
+// HTTP date.
+func retryAfter(header http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"errors"
+	"io"
+)
+
+// Text returns a reader over the content deltas of the stream, for piping
+// an answer into a terminal or HTTP response:
+//
+//	io.Copy(os.Stdout, stream.Text())
+//
+// Read returns io.EOF once the stream is exhausted and the stream error if
+// it failed. The stream is closed when either happens. Only the first
+// choice is read when N > 1.
+func (s *StreamReader) Text() io.Reader {
+	return &textReader{stream: s}
+}
+
+type textReader struct {
+	stream *StreamReader
+	buf    string
+	err    error
+}
+
+func (t *textReader) Read(p []byte) (int, error) {
+	for t.buf == "" {
+		if t.err != nil {
+			return 0, t.err
+		}
+
+		event, err := t.stream.Recv()
+		if err != nil {
+			t.stream.Close()
+			if errors.Is(err, ErrStreamClosed) {
+				err = io.EOF
+			}
+			t.err = err
+			continue
+		}
+		if event.Index == 0 {
+			t.buf = event.Delta.Content
+		}
+	}
+
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TimeoutError ends streams exceeding ChatRequest.FirstEventTimeout or
+// ChatRequest.StreamTimeout. It matches context.DeadlineExceeded with
+// errors.Is.
+type TimeoutError struct {
+	// FirstEvent is true when the model did not start responding in time,
+	// and false when the whole stream took too long
+	FirstEvent bool
+	Timeout    time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.FirstEvent {
+		return fmt.Sprintf("no stream event received within %s", e.Timeout)
+	}
+	return fmt.Sprintf("stream not completed within %s", e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+type StreamFunc func(ctx context.Context, req *ChatRequest) (*StreamReader, error)
+
+// ApplyStreamTimeouts calls stream, applying the FirstEventTimeout and
+// StreamTimeout of req. The Timing of the returned reader is measured from
+// the call. Providers call it in Stream with their own implementation.
+func ApplyStreamTimeouts(ctx context.Context, req *ChatRequest, stream StreamFunc) (*StreamReader, error) {
+	start := time.Now()
+	if req.FirstEventTimeout <= 0 && req.StreamTimeout <= 0 {
+		r, err := stream(ctx, req)
+		if r != nil {
+			r.started = start
+		}
+		return r, err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	var timers []*time.Timer
+	after := func(timeout time.Duration, firstEvent bool) *time.Timer {
+		if timeout <= 0 {
+			return nil
+		}
+		t := time.AfterFunc(timeout, func() {
+			cancel(&TimeoutError{FirstEvent: firstEvent, Timeout: timeout})
+		})
+		timers = append(timers, t)
+		return t
+	}
+	first := after(req.FirstEventTimeout, true)
+	after(req.StreamTimeout, false)
+	stop := func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+		cancel(nil)
+	}
+
+	inner, err := stream(ctx, req)
+	if err != nil {
+		stop()
+		var timeoutErr *TimeoutError
+		if errors.As(context.Cause(ctx), &timeoutErr) {
+			return nil, timeoutErr
+		}
+		return nil, err
+	}
+
+	events := make(chan StreamEvent)
+	outer := NewStreamReader(events, inner.Close)
+	outer.started = start
+	outer.rateLimit = inner.rateLimit
+	go func() {
+		defer close(events)
+		defer stop()
+
+		send := func(event StreamEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-outer.Done():
+				return false
+			}
+		}
+		timedOut := func() bool {
+			var timeoutErr *TimeoutError
+			if errors.As(context.Cause(ctx), &timeoutErr) {
+				inner.Close()
+				send(StreamEvent{Err: timeoutErr})
+				return true
+			}
+			return false
+		}
+
+		for {
+			select {
+			case event, ok := <-inner.events:
+				if !ok {
+					return
+				}
+				if first != nil {
+					first.Stop()
+				}
+				// the failure of a canceled stream is reported as the timeout
+				if event.Err != nil && timedOut() {
+					return
+				}
+				if !send(event) {
+					return
+				}
+			case <-ctx.Done():
+				// a canceled parent ends the stream with its cause, so that
+				// it does not look complete
+				if !timedOut() {
+					inner.Close()
+					send(StreamEvent{Err: context.Cause(ctx)})
+				}
+				return
+			case <-outer.Done():
+				return
+			}
+		}
+	}()
+	return outer, nil
+}
@@ -0,0 +1,78 @@
+package provider
+
+import "time"
+
+// Timing measures a response, client-side from the call of Chat or Stream
+// unless the provider reports a duration itself.
+type Timing struct {
+	// Latency is the time until the response was complete
+	Latency time.Duration `json:"latency"`
+	// FirstToken is the time until the first content of a stream, zero for
+	// Chat
+	FirstToken time.Duration `json:"first_token,omitempty"`
+	// Generation is the time spent generating the completion, reported by
+	// Ollama or measured from the first to the last event of a stream
+	Generation time.Duration `json:"generation,omitempty"`
+	// TokensPerSecond is the completion tokens over Generation, or over
+	// Latency when Generation is unknown
+	TokensPerSecond float64 `json:"tokens_per_second,omitempty"`
+}
+
+// NewTiming returns the timing of a response started at start and complete
+// now. generation is the generation time reported by the provider, zero
+// when unknown.
+func NewTiming(start time.Time, completionTokens int, generation time.Duration) *Timing {
+	t := &Timing{Latency: time.Since(start), Generation: generation}
+	t.TokensPerSecond = tokensPerSecond(completionTokens, generation, t.Latency)
+	return t
+}
+
+// Timing returns the timing of the stream so far, measured as its events
+// are received.
+func (s *StreamReader) Timing() Timing {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var t Timing
+	if !s.last.IsZero() {
+		t.Latency = s.last.Sub(s.started)
+	}
+	if !s.first.IsZero() {
+		t.FirstToken = s.first.Sub(s.started)
+		t.Generation = s.last.Sub(s.first)
+	}
+	if s.generation > 0 {
+		t.Generation = s.generation
+	}
+	t.TokensPerSecond = tokensPerSecond(s.completionTokens, t.Generation, t.Latency)
+	return t
+}
+
+// observe records the arrival of event for Timing.
+func (s *StreamReader) observe(event StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.last = now
+	if s.first.IsZero() && (event.Delta.Content != "" || len(event.Delta.ToolCalls) > 0) {
+		s.first = now
+	}
+	if event.Usage != nil {
+		s.completionTokens = event.Usage.CompletionTokens
+	}
+	if event.Timing != nil && event.Timing.Generation > 0 {
+		s.generation = event.Timing.Generation
+	}
+}
+
+func tokensPerSecond(tokens int, generation, latency time.Duration) float64 {
+	d := generation
+	if d <= 0 {
+		d = latency
+	}
+	if tokens <= 0 || d <= 0 {
+		return 0
+	}
+	return float64(tokens) / d.Seconds()
+}
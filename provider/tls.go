@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// WithTLSConfig returns p connecting with config, such as for a gateway
+// with a private CA or requiring a client certificate. It replaces the HTTP
+// client of p; combine it with a custom one through TLSClient.
+func WithTLSConfig(p Provider, config *tls.Config) Provider {
+	return p.WithHTTPClient(TLSClient(config))
+}
+
+// TLSClient returns an HTTP client connecting with config, with the
+// settings of http.DefaultTransport otherwise.
+func TLSClient(config *tls.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}
+}
+
+// LoadTLSConfig returns a TLS configuration trusting the PEM certificates
+// of caFile in addition to the system roots, and presenting the client
+// certificate of certFile and keyFile for mutual TLS. Empty paths are
+// skipped.
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("a client certificate needs both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
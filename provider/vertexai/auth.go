@@ -0,0 +1,310 @@
+package vertexai
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+	defaultTokenURL    = "https://oauth2.googleapis.com/token"
+	metadataTokenURL   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+}
+
+// TokenSource provides OAuth2 access tokens for the Vertex AI API.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+type credentialsFile struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// DefaultCredentials finds Application Default Credentials: the file named by
+// GOOGLE_APPLICATION_CREDENTIALS, the gcloud user credentials, and finally
+// the metadata server available on Google Cloud compute.
+func DefaultCredentials(client *http.Client) (TokenSource, error) {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		return CredentialsFromFile(path, client)
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		path := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+		if _, err := os.Stat(path); err == nil {
+			return CredentialsFromFile(path, client)
+		}
+	}
+
+	return cached(&metadataSource{client: client}), nil
+}
+
+func CredentialsFromFile(path string, client *http.Client) (TokenSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+	return CredentialsFromJSON(data, client)
+}
+
+// CredentialsFromJSON accepts service account keys and gcloud authorized
+// user credentials.
+func CredentialsFromJSON(data []byte, client *http.Client) (TokenSource, error) {
+	var creds credentialsFile
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+
+	tokenURL := creds.TokenURI
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+
+	switch creds.Type {
+	case "service_account":
+		key, err := parsePrivateKey(creds.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		return cached(&serviceAccountSource{
+			email:    creds.ClientEmail,
+			keyID:    creds.PrivateKeyID,
+			key:      key,
+			tokenURL: tokenURL,
+			client:   client,
+		}), nil
+
+	case "authorized_user":
+		return cached(&refreshTokenSource{
+			clientID:     creds.ClientID,
+			clientSecret: creds.ClientSecret,
+			refreshToken: creds.RefreshToken,
+			tokenURL:     tokenURL,
+			client:       client,
+		}), nil
+	}
+
+	return nil, fmt.Errorf("unsupported credentials type %q", creds.Type)
+}
+
+// StaticToken returns a TokenSource that always yields token, e.g. the
+// output of `gcloud auth print-access-token`.
+func StaticToken(token string) TokenSource {
+	return staticSource(token)
+}
+
+type staticSource string
+
+func (s staticSource) Token(ctx context.Context) (*Token, error) {
+	return &Token{AccessToken: string(s)}, nil
+}
+
+// defaultSource finds Application Default Credentials on first use, so
+// that providers sharing it look them up once.
+type defaultSource struct {
+	mu     sync.Mutex
+	client *http.Client
+	source TokenSource
+}
+
+func (d *defaultSource) Token(ctx context.Context) (*Token, error) {
+	d.mu.Lock()
+	if d.source == nil {
+		ts, err := DefaultCredentials(d.client)
+		if err != nil {
+			d.mu.Unlock()
+			return nil, err
+		}
+		d.source = ts
+	}
+	source := d.source
+	d.mu.Unlock()
+	return source.Token(ctx)
+}
+
+// cachingSource reuses a token until shortly before it expires.
+type cachingSource struct {
+	mu     sync.Mutex
+	source TokenSource
+	token  *Token
+}
+
+func cached(source TokenSource) TokenSource {
+	return &cachingSource{source: source}
+}
+
+func (c *cachingSource) Token(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != nil && time.Until(c.token.Expiry) > time.Minute {
+		return c.token, nil
+	}
+
+	token, err := c.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+	return token, nil
+}
+
+type serviceAccountSource struct {
+	email    string
+	keyID    string
+	key      *rsa.PrivateKey
+	tokenURL string
+	client   *http.Client
+}
+
+func (s *serviceAccountSource) Token(ctx context.Context) (*Token, error) {
+	now := time.Now()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.keyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   s.email,
+		"scope": cloudPlatformScope,
+		"aud":   s.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign token request: %w", err)
+	}
+
+	return exchange(ctx, s.client, s.tokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	})
+}
+
+type refreshTokenSource struct {
+	clientID     string
+	clientSecret string
+	refreshToken string
+	tokenURL     string
+	client       *http.Client
+}
+
+func (s *refreshTokenSource) Token(ctx context.Context) (*Token, error) {
+	return exchange(ctx, s.client, s.tokenURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+		"refresh_token": {s.refreshToken},
+	})
+}
+
+type metadataSource struct {
+	client *http.Client
+}
+
+func (s *metadataSource) Token(ctx context.Context) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataTokenURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("no application default credentials found: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeToken(resp)
+}
+
+func exchange(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (*Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return decodeToken(resp)
+}
+
+func decodeToken(resp *http.Response) (*Token, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response has no access token")
+	}
+
+	return &Token{
+		AccessToken: tokenResp.AccessToken,
+		Expiry:      time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}, nil
+}
+
+func parsePrivateKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid service account private key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("service account private key is not RSA")
+	}
+	return key, nil
+}
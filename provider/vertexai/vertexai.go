@@ -0,0 +1,814 @@
+package vertexai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alexisbouchez/ai/internal/idle"
+	"github.com/alexisbouchez/ai/internal/logging"
+	"github.com/alexisbouchez/ai/internal/passthrough"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/sse"
+)
+
+const (
+	defaultLocation  = "us-central1"
+	defaultModel     = "gemini-2.5-flash"
+	defaultPublisher = "google"
+	// codeExecution names the code execution tool in HostedToolUse
+	codeExecution = "code_execution"
+)
+
+type vertexai struct {
+	project     string
+	location    string
+	publisher   string
+	apiKey      string
+	baseURL     string
+	model       string
+	tokenSource TokenSource
+	// adc is used when no token source or API key is configured
+	adc        *defaultSource
+	httpClient *http.Client
+	timeout    time.Duration
+	headers    map[string]string
+}
+
+type Option func(*vertexai)
+
+// WithTokenSource replaces Application Default Credentials.
+func WithTokenSource(ts TokenSource) Option {
+	return func(v *vertexai) {
+		v.tokenSource = ts
+	}
+}
+
+// WithPublisher selects the model publisher; the default is "google".
+func WithPublisher(publisher string) Option {
+	return func(v *vertexai) {
+		v.publisher = publisher
+	}
+}
+
+// New creates a new Vertex AI provider for the given Google Cloud project
+// and location ("us-central1", "europe-west4", "global", ...). Requests are
+// authenticated with Application Default Credentials unless a token source
+// or an express mode API key is configured.
+func New(project, location string, opts ...Option) provider.Provider {
+	if location == "" {
+		location = defaultLocation
+	}
+	v := &vertexai{
+		project:    project,
+		location:   location,
+		publisher:  defaultPublisher,
+		model:      defaultModel,
+		httpClient: http.DefaultClient,
+		adc:        &defaultSource{client: http.DefaultClient},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// NewFromEnv creates a Vertex AI provider for GOOGLE_CLOUD_PROJECT in
+// GOOGLE_CLOUD_LOCATION, authenticated with Application Default
+// Credentials. Without a project, GOOGLE_API_KEY selects express mode.
+func NewFromEnv(opts ...Option) (provider.Provider, error) {
+	location := os.Getenv("GOOGLE_CLOUD_LOCATION")
+	project := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if project != "" {
+		return New(project, location, opts...), nil
+	}
+	key, err := provider.RequireEnv("GOOGLE_API_KEY")
+	if err != nil {
+		return nil, &provider.MissingEnvError{Var: "GOOGLE_CLOUD_PROJECT"}
+	}
+	return New("", location, opts...).WithAPIKey(key), nil
+}
+
+func (v *vertexai) WithAPIKey(key string) provider.Provider {
+	cp := *v
+	cp.apiKey = key
+	return &cp
+}
+
+func (v *vertexai) WithBaseURL(url string) provider.Provider {
+	cp := *v
+	cp.baseURL = url
+	return &cp
+}
+
+func (v *vertexai) WithModel(model string) provider.Provider {
+	cp := *v
+	cp.model = model
+	return &cp
+}
+
+func (v *vertexai) WithHTTPClient(client *http.Client) provider.Provider {
+	cp := *v
+	cp.httpClient = client
+	cp.adc = &defaultSource{client: client}
+	return &cp
+}
+
+// HTTPClient returns the client requests are sent with.
+func (v *vertexai) HTTPClient() *http.Client {
+	return v.httpClient
+}
+
+func (v *vertexai) System() string {
+	return "gcp.vertex_ai"
+}
+
+func (v *vertexai) WithTimeout(timeout time.Duration) provider.Provider {
+	cp := *v
+	cp.timeout = timeout
+	return &cp
+}
+
+func (v *vertexai) WithHeaders(headers map[string]string) provider.Provider {
+	cp := *v
+	cp.headers = maps.Clone(headers)
+	return &cp
+}
+
+// client returns the client of non-streaming requests, bounded by the
+// timeout.
+func (v *vertexai) client() *http.Client {
+	if v.timeout == 0 {
+		return logging.Client(v.httpClient)
+	}
+	client := *v.httpClient
+	client.Timeout = v.timeout
+	return logging.Client(&client)
+}
+
+// streamClient returns the client of streams, which the timeout would cut
+// off; ChatRequest.StreamTimeout bounds them instead.
+func (v *vertexai) streamClient() *http.Client {
+	return logging.Client(v.httpClient)
+}
+
+// endpoint builds the URL of a model method. Models may be given as "name",
+// "publisher/name" or a full "publishers/.../models/..." resource path.
+func (v *vertexai) endpoint(model, method string) string {
+	baseURL := v.baseURL
+	if baseURL == "" {
+		if v.location == "global" {
+			baseURL = "https://aiplatform.googleapis.com"
+		} else {
+			baseURL = fmt.Sprintf("https://%s-aiplatform.googleapis.com", v.location)
+		}
+	}
+
+	resource := model
+	if !strings.HasPrefix(model, "publishers/") {
+		publisher := v.publisher
+		if p, name, ok := strings.Cut(model, "/"); ok {
+			publisher, model = p, name
+		}
+		resource = fmt.Sprintf("publishers/%s/models/%s", publisher, model)
+	}
+
+	if v.apiKey != "" && v.project == "" {
+		// Express mode addresses publisher models without a project
+		return fmt.Sprintf("%s/v1/%s:%s", baseURL, resource, method)
+	}
+	return fmt.Sprintf("%s/v1/projects/%s/locations/%s/%s:%s", baseURL, v.project, v.location, resource, method)
+}
+
+func (v *vertexai) newRequest(ctx context.Context, url string, body []byte) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if v.apiKey != "" {
+		httpReq.Header.Set("x-goog-api-key", v.apiKey)
+	} else {
+		var ts TokenSource = v.adc
+		if v.tokenSource != nil {
+			ts = v.tokenSource
+		}
+		token, err := ts.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get access token: %w", err)
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	}
+	for k, val := range v.headers {
+		httpReq.Header.Set(k, val)
+	}
+	provider.ApplyContext(httpReq)
+
+	return httpReq, nil
+}
+
+func (v *vertexai) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	start := time.Now()
+	model := req.Model
+	if model == "" {
+		model = v.model
+	}
+
+	geminiReq, err := toGeminiRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(geminiReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := v.newRequest(ctx, v.endpoint(model, "generateContent"), body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.client().Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, toAPIError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	var geminiResp geminiResponse
+	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	chatResp := toProviderResponse(&geminiResp, model)
+	chatResp.Timing = provider.NewTiming(start, chatResp.Usage.CompletionTokens, 0)
+	chatResp.RateLimit = provider.ParseRateLimit(resp.Header)
+	return chatResp, nil
+}
+
+func (v *vertexai) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	return provider.ApplyStreamTimeouts(ctx, req, v.stream)
+}
+
+func (v *vertexai) stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	model := req.Model
+	if model == "" {
+		model = v.model
+	}
+
+	geminiReq, err := toGeminiRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(geminiReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := v.newRequest(ctx, v.endpoint(model, "streamGenerateContent")+"?alt=sse", body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := v.streamClient().Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, toAPIError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	events := make(chan provider.StreamEvent)
+	stream := provider.NewStreamReader(events, func() { resp.Body.Close() },
+		provider.Buffer(req.StreamBuffer, req.StreamOverflow),
+		provider.ReportRateLimit(provider.ParseRateLimit(resp.Header)),
+	)
+
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		send := func(event provider.StreamEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			case <-stream.Done():
+				return false
+			}
+		}
+
+		toolCallIndex := 0
+		var executed *provider.HostedToolUse
+
+		reader := sse.NewReader(idle.Wrap(resp.Body, req.StreamIdleTimeout))
+		for {
+			sseEvent, err := reader.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					send(provider.StreamEvent{Err: fmt.Errorf("failed to read stream: %w", err)})
+				}
+				return
+			}
+
+			var chunk geminiResponse
+			if err := json.Unmarshal([]byte(sseEvent.Data), &chunk); err != nil {
+				send(provider.StreamEvent{Err: fmt.Errorf("failed to parse chunk: %w", err)})
+				return
+			}
+
+			for _, candidate := range chunk.Candidates {
+				event := provider.StreamEvent{
+					Index:        candidate.Index,
+					FinishReason: toFinishReason(candidate.FinishReason),
+				}
+				if candidate.Content != nil {
+					for _, part := range candidate.Content.Parts {
+						if part.FunctionCall != nil {
+							args, _ := json.Marshal(part.FunctionCall.Args)
+							event.Delta.ToolCalls = append(event.Delta.ToolCalls, provider.ToolCall{
+								ID:    fmt.Sprintf("call_%d", toolCallIndex),
+								Type:  "function",
+								Index: toolCallIndex,
+								Function: provider.FunctionCall{
+									Name:      part.FunctionCall.Name,
+									Arguments: string(args),
+								},
+							})
+							toolCallIndex++
+						} else if part.ExecutableCode != nil {
+							// sent once its result arrives, possibly in a later chunk
+							executed = &provider.HostedToolUse{Name: codeExecution, Input: part.ExecutableCode}
+						} else if part.CodeExecutionResult != nil {
+							if executed != nil {
+								executed.Result = part.CodeExecutionResult
+								event.Delta.HostedTools = append(event.Delta.HostedTools, *executed)
+								executed = nil
+							}
+						} else if !part.Thought {
+							event.Delta.Content += part.Text
+						}
+					}
+				}
+				if len(event.Delta.ToolCalls) > 0 && event.FinishReason == provider.FinishReasonStop {
+					event.FinishReason = provider.FinishReasonToolCalls
+				}
+				if chunk.UsageMetadata != nil && event.FinishReason != "" {
+					event.Usage = chunk.UsageMetadata.toProvider()
+				}
+
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}()
+
+	return stream, nil
+}
+
+// Gemini-specific request/response types
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+	Options           map[string]any          `json:"-"`
+}
+
+func (r *geminiRequest) MarshalJSON() ([]byte, error) {
+	type plain geminiRequest
+	data, err := json.Marshal((*plain)(r))
+	if err != nil {
+		return nil, err
+	}
+	return passthrough.Merge(data, r.Options)
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	// ExecutableCode and CodeExecutionResult are the code run by the code
+	// execution tool and its outcome
+	ExecutableCode      json.RawMessage `json:"executableCode,omitempty"`
+	CodeExecutionResult json.RawMessage `json:"codeExecutionResult,omitempty"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFunctionCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations,omitempty"`
+	// GoogleSearch grounds answers on Google Search, an empty object enables it
+	GoogleSearch any `json:"googleSearch,omitempty"`
+	// CodeExecution lets the model run code, an empty object enables it
+	CodeExecution any `json:"codeExecution,omitempty"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	CandidateCount   *int     `json:"candidateCount,omitempty"`
+	Seed             *int     `json:"seed,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+}
+
+type geminiResponse struct {
+	ResponseID    string            `json:"responseId"`
+	ModelVersion  string            `json:"modelVersion"`
+	CreateTime    time.Time         `json:"createTime"`
+	Candidates    []geminiCandidate `json:"candidates"`
+	UsageMetadata *geminiUsage      `json:"usageMetadata,omitempty"`
+	Metadata      map[string]any    `json:"-"`
+}
+
+func (r *geminiResponse) UnmarshalJSON(data []byte) error {
+	type plain geminiResponse
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.Metadata = passthrough.Unknown(data, r)
+	return nil
+}
+
+type geminiCandidate struct {
+	Index        int            `json:"index"`
+	Content      *geminiContent `json:"content,omitempty"`
+	FinishReason string         `json:"finishReason,omitempty"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+}
+
+func toGeminiRequest(req *provider.ChatRequest) (*geminiRequest, error) {
+	if err := provider.ValidateParts(req.Messages); err != nil {
+		return nil, err
+	}
+	var system []geminiPart
+	var contents []geminiContent
+	toolNames := make(map[string]string)
+
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case provider.RoleSystem:
+			system = append(system, geminiPart{Text: msg.Content})
+
+		case provider.RoleUser:
+			contents = appendContent(contents, "user", toGeminiParts(msg)...)
+
+		case provider.RoleAssistant:
+			var parts []geminiPart
+			for _, hosted := range msg.HostedTools {
+				if hosted.Name != codeExecution {
+					continue
+				}
+				parts = append(parts, geminiPart{ExecutableCode: hosted.Input})
+				if len(hosted.Result) > 0 {
+					parts = append(parts, geminiPart{CodeExecutionResult: hosted.Result})
+				}
+			}
+			if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				var args map[string]any
+				if tc.Function.Arguments != "" {
+					json.Unmarshal([]byte(tc.Function.Arguments), &args)
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{
+					Name: tc.Function.Name,
+					Args: args,
+				}})
+			}
+			if len(parts) > 0 {
+				contents = appendContent(contents, "model", parts...)
+			}
+
+		case provider.RoleTool:
+			name := msg.Name
+			if name == "" {
+				name = toolNames[msg.ToolCallID]
+			}
+			var response map[string]any
+			if len(msg.Parts) == 1 && msg.Content == "" && msg.Parts[0].Type == provider.PartJSON {
+				json.Unmarshal(msg.Parts[0].JSON, &response)
+			} else {
+				json.Unmarshal([]byte(msg.Content), &response)
+			}
+			if response == nil {
+				response = map[string]any{"content": msg.Text()}
+			}
+			parts := []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+				Name:     name,
+				Response: response,
+			}}}
+			for _, part := range msg.Parts {
+				if part.Type == provider.PartImage {
+					parts = append(parts, toGeminiPart(part))
+				}
+			}
+			contents = appendContent(contents, "user", parts...)
+		}
+	}
+
+	geminiReq := &geminiRequest{Contents: contents}
+
+	if len(system) > 0 {
+		geminiReq.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	var declarations []geminiFunctionDeclaration
+	for _, t := range req.Tools {
+		switch t.Type {
+		case provider.ToolWebSearch, provider.ToolCodeInterpreter:
+			options := t.Options
+			if options == nil {
+				options = map[string]any{}
+			}
+			if t.Type == provider.ToolWebSearch {
+				geminiReq.Tools = append(geminiReq.Tools, geminiTool{GoogleSearch: options})
+			} else {
+				geminiReq.Tools = append(geminiReq.Tools, geminiTool{CodeExecution: options})
+			}
+			continue
+		case provider.ToolFileSearch:
+			return nil, fmt.Errorf("vertexai has no %s tool", t.Type)
+		}
+		declarations = append(declarations, geminiFunctionDeclaration{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			Parameters:  t.Function.Parameters,
+		})
+	}
+	if len(declarations) > 0 {
+		geminiReq.Tools = append(geminiReq.Tools, geminiTool{FunctionDeclarations: declarations})
+	}
+
+	if req.ToolChoice != nil {
+		config := geminiFunctionCallingConfig{}
+		switch req.ToolChoice.Type {
+		case "none":
+			config.Mode = "NONE"
+		case "any", "required":
+			config.Mode = "ANY"
+		case "function":
+			config.Mode = "ANY"
+			config.AllowedFunctionNames = []string{req.ToolChoice.Function}
+		default:
+			config.Mode = "AUTO"
+		}
+		geminiReq.ToolConfig = &geminiToolConfig{FunctionCallingConfig: config}
+	}
+
+	geminiReq.GenerationConfig = &geminiGenerationConfig{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		MaxOutputTokens:  req.MaxTokens,
+		StopSequences:    req.Stop,
+		CandidateCount:   req.N,
+		Seed:             req.RandomSeed,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+	}
+	geminiReq.Options = req.ProviderOptions
+	return geminiReq, nil
+}
+
+func toGeminiParts(msg provider.Message) []geminiPart {
+	if len(msg.Parts) == 0 {
+		return []geminiPart{{Text: msg.Content}}
+	}
+
+	var parts []geminiPart
+	if msg.Content != "" {
+		parts = append(parts, geminiPart{Text: msg.Content})
+	}
+	for _, part := range msg.Parts {
+		parts = append(parts, toGeminiPart(part))
+	}
+	return parts
+}
+
+func toGeminiPart(part provider.Part) geminiPart {
+	switch part.Type {
+	case provider.PartAudio:
+		return geminiPart{InlineData: &geminiBlob{
+			MimeType: "audio/" + part.Audio.Format,
+			Data:     part.Audio.Data,
+		}}
+	case provider.PartImage:
+		if part.Image.Data == "" {
+			mimeType := part.Image.MediaType
+			if mimeType == "" {
+				mimeType = mime.TypeByExtension(path.Ext(part.Image.URL))
+			}
+			return geminiPart{FileData: &geminiFileData{MimeType: mimeType, FileURI: part.Image.URL}}
+		}
+		return geminiPart{InlineData: &geminiBlob{MimeType: part.Image.MediaType, Data: part.Image.Data}}
+	case provider.PartDocument:
+		doc := part.Document
+		if doc.FileID != "" {
+			mimeType := doc.MediaType
+			if mimeType == "" {
+				mimeType = "application/pdf"
+			}
+			return geminiPart{FileData: &geminiFileData{MimeType: mimeType, FileURI: doc.FileID}}
+		}
+		return geminiPart{InlineData: &geminiBlob{MimeType: doc.MediaType, Data: doc.Data}}
+	case provider.PartJSON:
+		return geminiPart{Text: string(part.JSON)}
+	default:
+		return geminiPart{Text: part.Text}
+	}
+}
+
+// appendContent merges consecutive parts of the same role into one turn,
+// as Gemini expects all function responses of a turn together.
+func appendContent(contents []geminiContent, role string, parts ...geminiPart) []geminiContent {
+	if n := len(contents); n > 0 && contents[n-1].Role == role {
+		contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+func toProviderResponse(resp *geminiResponse, model string) *provider.ChatResponse {
+	choices := make([]provider.Choice, len(resp.Candidates))
+	for i, candidate := range resp.Candidates {
+		msg := provider.Message{Role: provider.RoleAssistant}
+		if candidate.Content != nil {
+			for _, part := range candidate.Content.Parts {
+				if part.FunctionCall != nil {
+					args, _ := json.Marshal(part.FunctionCall.Args)
+					msg.ToolCalls = append(msg.ToolCalls, provider.ToolCall{
+						ID:    fmt.Sprintf("call_%d", len(msg.ToolCalls)),
+						Type:  "function",
+						Index: len(msg.ToolCalls),
+						Function: provider.FunctionCall{
+							Name:      part.FunctionCall.Name,
+							Arguments: string(args),
+						},
+					})
+				} else if part.ExecutableCode != nil {
+					msg.HostedTools = append(msg.HostedTools, provider.HostedToolUse{Name: codeExecution, Input: part.ExecutableCode})
+				} else if part.CodeExecutionResult != nil {
+					if n := len(msg.HostedTools); n > 0 {
+						msg.HostedTools[n-1].Result = part.CodeExecutionResult
+					}
+				} else if blob := part.InlineData; blob != nil && strings.HasPrefix(blob.MimeType, "audio/") {
+					msg.Audio = &provider.Audio{
+						Data:   blob.Data,
+						Format: strings.TrimPrefix(blob.MimeType, "audio/"),
+					}
+				} else if !part.Thought {
+					msg.Content += part.Text
+				}
+			}
+		}
+
+		finishReason := toFinishReason(candidate.FinishReason)
+		if len(msg.ToolCalls) > 0 && finishReason == provider.FinishReasonStop {
+			finishReason = provider.FinishReasonToolCalls
+		}
+
+		choices[i] = provider.Choice{
+			Index:        candidate.Index,
+			Message:      msg,
+			FinishReason: finishReason,
+		}
+	}
+
+	if resp.ModelVersion != "" {
+		model = resp.ModelVersion
+	}
+
+	chatResp := &provider.ChatResponse{
+		ID:      resp.ResponseID,
+		Object:  "chat.completion",
+		Created: resp.CreateTime.Unix(),
+		Model:   model,
+		Choices: choices,
+
+		ProviderMetadata: resp.Metadata,
+	}
+	if resp.UsageMetadata != nil {
+		chatResp.Usage = *resp.UsageMetadata.toProvider()
+	}
+	return chatResp
+}
+
+func toFinishReason(reason string) string {
+	switch reason {
+	case "":
+		return ""
+	case "STOP":
+		return provider.FinishReasonStop
+	case "MAX_TOKENS":
+		return provider.FinishReasonLength
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return provider.FinishReasonContentFilter
+	}
+	return strings.ToLower(reason)
+}
+
+func toAPIError(statusCode int, header http.Header, body []byte) error {
+	apiErr := &provider.APIError{StatusCode: statusCode, Body: string(body), RateLimit: provider.ParseRateLimit(header)}
+
+	var errResp struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error.Message != "" {
+		apiErr.Type = errResp.Error.Status
+		apiErr.Message = errResp.Error.Message
+	}
+	return apiErr
+}
+
+func (u *geminiUsage) toProvider() *provider.Usage {
+	return &provider.Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+		CachedTokens:     u.CachedContentTokenCount,
+	}
+}
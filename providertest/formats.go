@@ -0,0 +1,176 @@
+package providertest
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// OpenAIStream returns a chat completions stream sending deltas, then the
+// stop reason and the usage. Mistral and the other OpenAI-compatible APIs
+// stream the same way.
+func OpenAIStream(deltas ...string) Script {
+	var chunks []Chunk
+	for _, delta := range deltas {
+		chunks = append(chunks, Chunk{Data: openAIChunk(map[string]any{"content": delta}, nil)})
+	}
+	stop := "stop"
+	chunks = append(chunks,
+		Chunk{Data: openAIChunk(map[string]any{}, &stop)},
+		Chunk{Data: marshal(map[string]any{
+			"id": "chatcmpl-test", "object": "chat.completion.chunk", "model": "test",
+			"choices": []any{},
+			"usage":   openAIUsage(deltas),
+		})},
+		Chunk{Data: "[DONE]"},
+	)
+	return Script{Chunks: chunks}
+}
+
+// OpenAIResponse returns a chat completion answering content.
+func OpenAIResponse(content string) Script {
+	return Script{
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body: marshal(map[string]any{
+			"id": "chatcmpl-test", "object": "chat.completion", "model": "test",
+			"choices": []any{map[string]any{
+				"index":         0,
+				"message":       map[string]any{"role": "assistant", "content": content},
+				"finish_reason": "stop",
+			}},
+			"usage": openAIUsage([]string{content}),
+		}),
+	}
+}
+
+// MistralStream returns a Mistral chat stream sending deltas.
+func MistralStream(deltas ...string) Script {
+	return OpenAIStream(deltas...)
+}
+
+// AnthropicStream returns a Messages API stream sending deltas as a text
+// block.
+func AnthropicStream(deltas ...string) Script {
+	chunks := []Chunk{
+		{Event: "message_start", Data: marshal(map[string]any{
+			"type": "message_start",
+			"message": map[string]any{
+				"id": "msg_test", "type": "message", "role": "assistant", "model": "test",
+				"content": []any{},
+				"usage":   map[string]any{"input_tokens": 1, "output_tokens": 0},
+			},
+		})},
+		{Event: "content_block_start", Data: `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`},
+	}
+	for _, delta := range deltas {
+		chunks = append(chunks, Chunk{Event: "content_block_delta", Data: marshal(map[string]any{
+			"type":  "content_block_delta",
+			"index": 0,
+			"delta": map[string]any{"type": "text_delta", "text": delta},
+		})})
+	}
+	chunks = append(chunks,
+		Chunk{Event: "content_block_stop", Data: `{"type":"content_block_stop","index":0}`},
+		Chunk{Event: "message_delta", Data: fmt.Sprintf(`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":%d}}`, len(deltas))},
+		Chunk{Event: "message_stop", Data: `{"type":"message_stop"}`},
+	)
+	return Script{Chunks: chunks}
+}
+
+// AnthropicResponse returns a Messages API response answering content.
+func AnthropicResponse(content string) Script {
+	return Script{
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body: marshal(map[string]any{
+			"id": "msg_test", "type": "message", "role": "assistant", "model": "test",
+			"content":     []any{map[string]any{"type": "text", "text": content}},
+			"stop_reason": "end_turn",
+			"usage":       map[string]any{"input_tokens": 1, "output_tokens": 1},
+		}),
+	}
+}
+
+// GeminiStream returns a Gemini streamGenerateContent stream, as served to
+// Vertex AI with alt=sse, sending deltas then the stop reason and usage.
+func GeminiStream(deltas ...string) Script {
+	var chunks []Chunk
+	for _, delta := range deltas {
+		chunks = append(chunks, Chunk{Data: marshal(map[string]any{
+			"candidates": []any{map[string]any{
+				"index":   0,
+				"content": map[string]any{"role": "model", "parts": []any{map[string]any{"text": delta}}},
+			}},
+		})})
+	}
+	chunks = append(chunks, Chunk{Data: marshal(map[string]any{
+		"candidates": []any{map[string]any{
+			"index":        0,
+			"content":      map[string]any{"role": "model", "parts": []any{map[string]any{"text": ""}}},
+			"finishReason": "STOP",
+		}},
+		"usageMetadata": map[string]any{"promptTokenCount": 1, "candidatesTokenCount": len(deltas), "totalTokenCount": 1 + len(deltas)},
+	})})
+	return Script{Chunks: chunks}
+}
+
+// OllamaStream returns an Ollama chat stream sending deltas as JSON lines,
+// then the final line with the stop reason and the counts.
+func OllamaStream(deltas ...string) Script {
+	var chunks []Chunk
+	for _, delta := range deltas {
+		chunks = append(chunks, Chunk{Raw: marshal(ollamaMessage(delta, false, len(deltas))) + "\n"})
+	}
+	chunks = append(chunks, Chunk{Raw: marshal(ollamaMessage("", true, len(deltas))) + "\n"})
+	return Script{Headers: map[string]string{"Content-Type": "application/x-ndjson"}, Chunks: chunks}
+}
+
+// OllamaResponse returns an Ollama chat response answering content.
+func OllamaResponse(content string) Script {
+	return Script{
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    marshal(ollamaMessage(content, true, 1)),
+	}
+}
+
+func ollamaMessage(content string, done bool, evalCount int) map[string]any {
+	msg := map[string]any{
+		"model":      "test",
+		"created_at": "2025-01-01T00:00:00Z",
+		"message":    map[string]any{"role": "assistant", "content": content},
+		"done":       done,
+	}
+	if done {
+		msg["done_reason"] = "stop"
+		msg["prompt_eval_count"] = 1
+		msg["eval_count"] = evalCount
+		msg["eval_duration"] = 1000000
+	}
+	return msg
+}
+
+func openAIChunk(delta map[string]any, finishReason *string) string {
+	return marshal(map[string]any{
+		"id": "chatcmpl-test", "object": "chat.completion.chunk", "model": "test",
+		"choices": []any{map[string]any{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		}},
+	})
+}
+
+// openAIUsage counts a token per delta, so that usage is predictable.
+func openAIUsage(deltas []string) map[string]any {
+	return map[string]any{
+		"prompt_tokens":     1,
+		"completion_tokens": len(deltas),
+		"total_tokens":      1 + len(deltas),
+	}
+}
+
+func marshal(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,90 @@
+package providertest
+
+import (
+	"bytes"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ignoredStacks are goroutines outliving a test by design: the connections
+// of HTTP clients and servers, which the transport keeps alive.
+var ignoredStacks = []string{
+	"net/http.(*persistConn)",
+	"net/http.(*conn).serve",
+	"net/http/httptest.(*Server)",
+	"testing.(*T).Run",
+	"testing.tRunner",
+	"runtime.goexit0",
+}
+
+// VerifyNoLeaks fails t when goroutines started during the test are still
+// running once it ends, which happens when a stream producer blocks after
+// its reader is closed. Goroutines get a second to exit first.
+//
+//	func TestStream(t *testing.T) {
+//		providertest.VerifyNoLeaks(t)
+//		...
+//	}
+func VerifyNoLeaks(t testing.TB) {
+	t.Helper()
+	before := goroutines()
+	t.Cleanup(func() {
+		t.Helper()
+		http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+
+		var leaked []string
+		deadline := time.Now().Add(time.Second)
+		for {
+			leaked = leaked[:0]
+			for id, stack := range goroutines() {
+				if _, ok := before[id]; !ok && !ignored(stack) {
+					leaked = append(leaked, stack)
+				}
+			}
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(leaked) > 0 {
+			t.Errorf("%d goroutines leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+	})
+}
+
+// goroutines returns the stacks of the running goroutines, by ID.
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	stacks := make(map[string]string)
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		// goroutine 42 [chan send]:
+		header, _, _ := strings.Cut(string(stack), "\n")
+		fields := strings.Fields(header)
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		stacks[fields[1]] = string(stack)
+	}
+	return stacks
+}
+
+func ignored(stack string) bool {
+	for _, ignore := range ignoredStacks {
+		if strings.Contains(stack, ignore) {
+			return true
+		}
+	}
+	return false
+}
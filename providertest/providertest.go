@@ -0,0 +1,185 @@
+// Package providertest serves fake provider APIs replaying scripted
+// responses, so that adapters and the code using them can be tested without
+// API keys:
+//
+//	srv := providertest.NewServer(providertest.OpenAIStream("Hello", " world"))
+//	defer srv.Close()
+//	p := openai.New().WithAPIKey("test").WithBaseURL(srv.URL)
+//
+// Scripts are served in order, the last one repeating, whatever the path of
+// the request, and the requests are recorded for assertions.
+package providertest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Chunk is a piece of a streamed response, sent as a server-sent event.
+type Chunk struct {
+	// Event is the event type, omitted when empty
+	Event string
+	Data  string
+	// Delay is waited before sending the chunk
+	Delay time.Duration
+	// Raw is written as is instead of an event, to inject malformed lines
+	Raw string
+}
+
+// Script is a scripted response. It streams its chunks when it has some,
+// and sends Body otherwise.
+type Script struct {
+	// Status defaults to 200
+	Status  int
+	Headers map[string]string
+	Body    string
+	Chunks  []Chunk
+}
+
+// Delay returns the script waiting d before each chunk.
+func (s Script) Delay(d time.Duration) Script {
+	s.Chunks = append([]Chunk(nil), s.Chunks...)
+	for i := range s.Chunks {
+		s.Chunks[i].Delay += d
+	}
+	return s
+}
+
+// Inject returns the script writing raw before chunk i, such as a truncated
+// JSON line or a comment. An i past the last chunk writes it at the end.
+func (s Script) Inject(i int, raw string) Script {
+	i = min(max(i, 0), len(s.Chunks))
+	chunks := make([]Chunk, 0, len(s.Chunks)+1)
+	chunks = append(chunks, s.Chunks[:i]...)
+	chunks = append(chunks, Chunk{Raw: raw})
+	s.Chunks = append(chunks, s.Chunks[i:]...)
+	return s
+}
+
+// Header returns the script sending the response header key.
+func (s Script) Header(key, value string) Script {
+	headers := make(map[string]string, len(s.Headers)+1)
+	for k, v := range s.Headers {
+		headers[k] = v
+	}
+	headers[key] = value
+	s.Headers = headers
+	return s
+}
+
+// Error returns a script failing with status and body.
+func Error(status int, body string) Script {
+	return Script{Status: status, Headers: map[string]string{"Content-Type": "application/json"}, Body: body}
+}
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+// Server is a fake provider API. Its URL is the base URL to give the
+// provider.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	scripts  []Script
+	requests []Request
+}
+
+// NewServer starts a server replaying scripts.
+func NewServer(scripts ...Script) *Server {
+	s := &Server{scripts: scripts}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Enqueue adds scripts to serve after the pending ones.
+func (s *Server) Enqueue(scripts ...Script) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts = append(s.scripts, scripts...)
+	return s
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) next(r *http.Request) (Script, bool) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Header: r.Header.Clone(),
+		Body:   string(body),
+	})
+	if len(s.scripts) == 0 {
+		return Script{}, false
+	}
+	script := s.scripts[0]
+	if len(s.scripts) > 1 {
+		s.scripts = s.scripts[1:]
+	}
+	return script, true
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	script, ok := s.next(r)
+	if !ok {
+		http.Error(w, "no script", http.StatusNotImplemented)
+		return
+	}
+
+	for k, v := range script.Headers {
+		w.Header().Set(k, v)
+	}
+	if len(script.Chunks) > 0 && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
+	status := script.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+
+	if len(script.Chunks) == 0 {
+		io.WriteString(w, script.Body)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	for _, chunk := range script.Chunks {
+		if chunk.Delay > 0 {
+			select {
+			case <-time.After(chunk.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		switch {
+		case chunk.Raw != "":
+			io.WriteString(w, chunk.Raw)
+		case chunk.Event != "":
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", chunk.Event, chunk.Data)
+		default:
+			fmt.Fprintf(w, "data: %s\n\n", chunk.Data)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
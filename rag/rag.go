@@ -0,0 +1,186 @@
+// Package rag answers questions from a document collection: the question is
+// embedded, the closest chunks are retrieved from a vector store and packed
+// into the prompt, and the model answers citing them by number.
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/alexisbouchez/ai/guard"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tokens"
+)
+
+const (
+	defaultTopK          = 5
+	defaultContextTokens = 3000
+	defaultPrompt        = "Answer the question using only the numbered sources below. Cite the sources you use with their number in brackets, like [1]. If the sources do not contain the answer, say so."
+)
+
+type Pipeline struct {
+	embedder      Embedder
+	store         VectorStore
+	provider      provider.Provider
+	model         string
+	topK          int
+	contextTokens int
+	prompt        string
+	screens       []guard.Validator
+}
+
+func New(e Embedder, s VectorStore, p provider.Provider) *Pipeline {
+	return &Pipeline{
+		embedder:      e,
+		store:         s,
+		provider:      p,
+		topK:          defaultTopK,
+		contextTokens: defaultContextTokens,
+		prompt:        defaultPrompt,
+	}
+}
+
+func (r *Pipeline) Model(model string) *Pipeline {
+	r.model = model
+	return r
+}
+
+// TopK sets the number of chunks retrieved per question, which must be
+// positive.
+func (r *Pipeline) TopK(k int) *Pipeline {
+	r.topK = k
+	return r
+}
+
+// ContextTokens bounds the size of the sources packed into the prompt.
+// Retrieved chunks that do not fit are dropped, least similar first.
+func (r *Pipeline) ContextTokens(n int) *Pipeline {
+	r.contextTokens = n
+	return r
+}
+
+// Prompt replaces the system instructions. They should ask for [n] citations.
+func (r *Pipeline) Prompt(prompt string) *Pipeline {
+	r.prompt = prompt
+	return r
+}
+
+// Screen adds validators run on every retrieved chunk, such as
+// guard.PromptInjection. Chunks they reject are dropped and redacted chunks
+// are packed with their redacted text.
+func (r *Pipeline) Screen(validators ...guard.Validator) *Pipeline {
+	r.screens = append(r.screens, validators...)
+	return r
+}
+
+// Index embeds chunks and adds them to the store.
+func (r *Pipeline) Index(ctx context.Context, chunks ...Chunk) error {
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Text
+	}
+
+	vectors, err := r.embedder.Embed(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("failed to embed chunks: %w", err)
+	}
+	return r.store.Add(ctx, chunks, vectors)
+}
+
+// Retrieve returns the chunks packed into the prompt for question, in
+// citation order: sources[0] is cited as [1].
+func (r *Pipeline) Retrieve(ctx context.Context, question string) ([]Chunk, error) {
+	if r.topK <= 0 {
+		return nil, fmt.Errorf("invalid top k %d", r.topK)
+	}
+	vectors, err := r.embedder.Embed(ctx, []string{question})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed question: %w", err)
+	}
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("failed to embed question: no embedding returned")
+	}
+
+	chunks, err := r.store.Search(ctx, vectors[0], r.topK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search store: %w", err)
+	}
+
+	var packed []Chunk
+	used := 0
+	for _, c := range chunks {
+		c, ok, err := r.screen(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		n := tokens.Estimate(r.model, c.Text)
+		if r.contextTokens > 0 && used+n > r.contextTokens {
+			continue
+		}
+		packed = append(packed, c)
+		used += n
+	}
+	return packed, nil
+}
+
+// screen runs the screening validators on c and reports whether it is kept.
+func (r *Pipeline) screen(ctx context.Context, c Chunk) (Chunk, bool, error) {
+	for _, v := range r.screens {
+		result, err := v.Validate(ctx, c.Text)
+		if err != nil {
+			return c, false, fmt.Errorf("failed to screen chunk %s: %w", c.ID, err)
+		}
+		switch result.Action {
+		case guard.Redact:
+			c.Text = result.Content
+		case guard.Reject, guard.Retry:
+			return c, false, nil
+		}
+	}
+	return c, true, nil
+}
+
+// Answer answers question from the retrieved sources. The answer cites
+// sources as [n], where n is the 1-based position in the returned sources.
+func (r *Pipeline) Answer(ctx context.Context, question string) (string, []Chunk, error) {
+	sources, err := r.Retrieve(ctx, question)
+	if err != nil {
+		return "", nil, err
+	}
+
+	resp, err := r.provider.Chat(ctx, &provider.ChatRequest{
+		Model: r.model,
+		Messages: []provider.Message{
+			{Role: provider.RoleSystem, Content: r.prompt + "\n\n" + formatSources(sources)},
+			{Role: provider.RoleUser, Content: question},
+		},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return "", sources, fmt.Errorf("empty response")
+	}
+	return resp.Choices[0].Message.Content, sources, nil
+}
+
+func formatSources(sources []Chunk) string {
+	if len(sources) == 0 {
+		return "No sources were found."
+	}
+
+	var b strings.Builder
+	b.WriteString("Sources:\n")
+	for i, c := range sources {
+		fmt.Fprintf(&b, "\n[%d]", i+1)
+		if c.Source != "" {
+			fmt.Fprintf(&b, " (%s)", c.Source)
+		}
+		fmt.Fprintf(&b, "\n%s\n", c.Text)
+	}
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+)
+
+// Embedder turns texts into vectors. The OpenAI and Mistral providers
+// implement it.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Chunk is a piece of a source document.
+type Chunk struct {
+	ID       string            `json:"id"`
+	Text     string            `json:"text"`
+	Source   string            `json:"source,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Score is the similarity to the query, set by Search
+	Score float64 `json:"score,omitempty"`
+}
+
+type VectorStore interface {
+	Add(ctx context.Context, chunks []Chunk, vectors [][]float32) error
+	// Search returns the k chunks most similar to vector, most similar first.
+	Search(ctx context.Context, vector []float32, k int) ([]Chunk, error)
+}
+
+// MemoryStore is a VectorStore ranking chunks by cosine similarity with a
+// linear scan. It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	chunks  []Chunk
+	vectors [][]float32
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) Add(ctx context.Context, chunks []Chunk, vectors [][]float32) error {
+	if len(chunks) != len(vectors) {
+		return errors.New("chunks and vectors differ in length")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chunks = append(m.chunks, chunks...)
+	m.vectors = append(m.vectors, vectors...)
+	return nil
+}
+
+func (m *MemoryStore) Search(ctx context.Context, vector []float32, k int) ([]Chunk, error) {
+	if k < 0 {
+		return nil, fmt.Errorf("invalid number of chunks %d", k)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := make([]Chunk, len(m.chunks))
+	for i, chunk := range m.chunks {
+		chunk.Score = cosine(vector, m.vectors[i])
+		results[i] = chunk
+	}
+	slices.SortStableFunc(results, func(a, b Chunk) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+
+	if k < len(results) {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+func (m *MemoryStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.chunks)
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,424 @@
+// Package record records the HTTP interactions of providers to JSON
+// cassettes and replays them, so that tests run offline against real
+// responses.
+package record
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrNoInteraction is returned in replay mode for requests the cassette
+// has no recorded response for.
+var ErrNoInteraction = errors.New("no recorded interaction")
+
+const redacted = "REDACTED"
+
+type Mode int
+
+const (
+	// Auto replays the cassette when it exists and records it otherwise
+	Auto Mode = iota
+	// Record sends every request and overwrites the cassette
+	Record
+	// Replay serves requests from the cassette only
+	Replay
+)
+
+// Cassette is the recorded interactions of a test.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request and its response. Hash identifies the request by
+// method, URL and body.
+type Interaction struct {
+	Hash     string   `json:"hash"`
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Recorder is an http.RoundTripper recording to or replaying from the
+// cassette at path. Credentials are scrubbed from recorded headers, query
+// parameters and JSON or form bodies before anything is written.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	headers   []string
+	params    []string
+	fields    []string
+
+	mu       sync.Mutex
+	loaded   bool
+	loadErr  error
+	replay   bool
+	cassette Cassette
+	// replayed counts the interactions served per hash, so that repeated
+	// identical requests replay in recorded order
+	replayed map[string]int
+}
+
+func New(path string) *Recorder {
+	return &Recorder{
+		path:      path,
+		transport: http.DefaultTransport,
+		headers:   []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key", "Api-Key", "Cookie", "Set-Cookie", "Openai-Organization", "Openai-Project"},
+		params:    []string{"key", "api_key"},
+		fields:    []string{"access_token", "refresh_token", "id_token", "client_secret", "assertion", "subject_token", "password"},
+		replayed:  make(map[string]int),
+	}
+}
+
+func (r *Recorder) Mode(mode Mode) *Recorder {
+	r.mode = mode
+	return r
+}
+
+// Transport sets the transport recorded requests are sent with.
+func (r *Recorder) Transport(t http.RoundTripper) *Recorder {
+	r.transport = t
+	return r
+}
+
+// Scrub adds headers whose values are redacted from the cassette.
+func (r *Recorder) Scrub(headers ...string) *Recorder {
+	r.headers = append(r.headers, headers...)
+	return r
+}
+
+// ScrubParams adds query parameters whose values are redacted from the
+// cassette.
+func (r *Recorder) ScrubParams(params ...string) *Recorder {
+	r.params = append(r.params, params...)
+	return r
+}
+
+// ScrubFields adds fields of JSON and form bodies whose values are
+// redacted from the cassette, at any depth.
+func (r *Recorder) ScrubFields(fields ...string) *Recorder {
+	r.fields = append(r.fields, fields...)
+	return r
+}
+
+// Client returns an HTTP client using the recorder, to pass to
+// provider.Provider.WithHTTPClient.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Wrap returns a transport recording to the cassette of r and sending
+// recorded requests with base instead of the transport of r, to record
+// through an existing client. A nil base uses http.DefaultTransport.
+func (r *Recorder) Wrap(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		return r.roundTrip(req, base)
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Cassette returns a copy of the interactions recorded or loaded so far.
+func (r *Recorder) Cassette() Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.roundTrip(req, r.transport)
+}
+
+func (r *Recorder) roundTrip(req *http.Request, transport http.RoundTripper) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	scrubbed, _ := r.scrubBody(req.Header.Get("Content-Type"), body)
+	hash := r.hash(req, scrubbed)
+
+	replay, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	if replay {
+		return r.serve(req, hash)
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	recorded := Interaction{
+		Hash: hash,
+		Request: Request{
+			Method:  req.Method,
+			URL:     r.scrubURL(req.URL),
+			Headers: r.scrubHeaders(req.Header),
+			Body:    string(scrubbed),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Headers:    r.scrubHeaders(resp.Header),
+		},
+	}
+	// The body is recorded as it is read, so that streams keep streaming
+	contentType := resp.Header.Get("Content-Type")
+	resp.Body = &recordingBody{body: resp.Body, done: func(data []byte) error {
+		if scrubbed, changed := r.scrubBody(contentType, data); changed {
+			data = scrubbed
+		}
+		recorded.Response.Body = string(data)
+		return r.save(recorded)
+	}}
+	return resp, nil
+}
+
+func (r *Recorder) load() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.loaded {
+		return r.replay, r.loadErr
+	}
+	r.loaded = true
+
+	if r.mode == Record {
+		return false, nil
+	}
+	data, err := os.ReadFile(r.path)
+	if errors.Is(err, os.ErrNotExist) && r.mode == Auto {
+		return false, nil
+	}
+	if err != nil {
+		r.loadErr = fmt.Errorf("failed to read cassette: %w", err)
+		return false, r.loadErr
+	}
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		r.loadErr = fmt.Errorf("failed to parse cassette %s: %w", r.path, err)
+		return false, r.loadErr
+	}
+	r.replay = true
+	return true, nil
+}
+
+func (r *Recorder) serve(req *http.Request, hash string) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	skip := r.replayed[hash]
+	for _, interaction := range r.cassette.Interactions {
+		if interaction.Hash != hash {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		r.replayed[hash]++
+		return &http.Response{
+			StatusCode:    interaction.Response.StatusCode,
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Headers.Clone(),
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w for %s %s in %s", ErrNoInteraction, req.Method, r.scrubURL(req.URL), r.path)
+}
+
+func (r *Recorder) save(interaction Interaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	if err := os.WriteFile(r.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+// hash identifies a request by its method, scrubbed URL and scrubbed body.
+// Multipart boundaries are random, so they are normalized away.
+func (r *Recorder) hash(req *http.Request, body []byte) string {
+	if _, params, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), []byte("boundary"))
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, r.scrubURL(req.URL))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (r *Recorder) scrubHeaders(headers http.Header) http.Header {
+	scrubbed := headers.Clone()
+	for _, name := range r.headers {
+		if scrubbed.Get(name) != "" {
+			scrubbed.Set(name, redacted)
+		}
+	}
+	return scrubbed
+}
+
+// scrubBody redacts the credential fields of a JSON or form body. It
+// returns the body normalized, with sorted keys, so that hashes do not
+// depend on field order, and reports whether a field was redacted. Other
+// bodies are returned as is.
+func (r *Recorder) scrubBody(contentType string, body []byte) ([]byte, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body, false
+		}
+		changed := false
+		for _, field := range r.fields {
+			if values.Has(field) {
+				values.Set(field, redacted)
+				changed = true
+			}
+		}
+		return []byte(values.Encode()), changed
+
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var v any
+		if err := decoder.Decode(&v); err != nil || decoder.More() {
+			return body, false
+		}
+		changed := r.scrubValue(v)
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err != nil {
+			return body, false
+		}
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), changed
+	}
+	return body, false
+}
+
+func (r *Recorder) scrubValue(v any) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			if slices.Contains(r.fields, k) {
+				if _, ok := item.(string); ok {
+					v[k] = redacted
+					changed = true
+					continue
+				}
+			}
+			changed = r.scrubValue(item) || changed
+		}
+	case []any:
+		for _, item := range v {
+			changed = r.scrubValue(item) || changed
+		}
+	}
+	return changed
+}
+
+func (r *Recorder) scrubURL(u *url.URL) string {
+	scrubbed := *u
+	query := scrubbed.Query()
+	for _, param := range r.params {
+		if query.Has(param) {
+			query.Set(param, redacted)
+		}
+	}
+	scrubbed.RawQuery = query.Encode()
+	return scrubbed.String()
+}
+
+// recordingBody captures a response body as it is read and passes it to
+// done once, when it is fully read or closed. The rest of a body closed
+// early is read first so that the recording is complete.
+type recordingBody struct {
+	body io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte) error
+	once sync.Once
+	err  error
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+		if b.err != nil {
+			return n, b.err
+		}
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.once.Do(func() {
+		io.Copy(&b.buf, b.body)
+		b.err = b.done(b.buf.Bytes())
+	})
+	if err := b.body.Close(); err != nil {
+		return err
+	}
+	return b.err
+}
+
+func (b *recordingBody) finish() {
+	b.once.Do(func() {
+		b.err = b.done(b.buf.Bytes())
+	})
+}
@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/provider/anthropic"
+	"github.com/alexisbouchez/ai/provider/huggingface"
+	"github.com/alexisbouchez/ai/provider/llamacpp"
+	"github.com/alexisbouchez/ai/provider/mistral"
+	"github.com/alexisbouchez/ai/provider/ollama"
+	"github.com/alexisbouchez/ai/provider/openai"
+	"github.com/alexisbouchez/ai/provider/openrouter"
+	"github.com/alexisbouchez/ai/provider/vertexai"
+)
+
+// Factory creates a configured provider, typically from the environment.
+type Factory func() (provider.Provider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		"openai":    openai.NewFromEnv,
+		"anthropic": anthropic.NewFromEnv,
+		"mistral":   mistral.NewFromEnv,
+		"ollama":    ollama.NewFromEnv,
+		"openrouter": func() (provider.Provider, error) {
+			return openrouter.NewFromEnv()
+		},
+		"huggingface": func() (provider.Provider, error) {
+			return huggingface.NewFromEnv()
+		},
+		"vertexai": func() (provider.Provider, error) {
+			return vertexai.NewFromEnv()
+		},
+		"llamacpp": func() (provider.Provider, error) {
+			return llamacpp.New(), nil
+		},
+	}
+)
+
+// Register makes a provider available to Open and FromEnv under name,
+// replacing any provider registered with the same name. Names cannot
+// contain a slash.
+func Register(name string, factory Factory) {
+	if name == "" || strings.Contains(name, "/") {
+		panic(fmt.Sprintf("ai: invalid provider name %q", name))
+	}
+	if factory == nil {
+		panic("ai: Register factory is nil")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// Providers returns the registered provider names, sorted.
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// FromEnv creates the named registered provider. The built-in providers
+// read the standard environment variables of their NewFromEnv
+// constructors.
+func FromEnv(name string) (provider.Provider, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+
+	p, err := factory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// Open resolves a "provider/model" string such as "openai/gpt-4o" to the
+// registered provider, with the model as its default. The model keeps any
+// further slashes, as in "openrouter/anthropic/claude-sonnet-4", and may be
+// omitted to use the provider's default model.
+func Open(uri string) (provider.Provider, error) {
+	name, model, _ := strings.Cut(uri, "/")
+	p, err := FromEnv(name)
+	if err != nil {
+		return nil, err
+	}
+	if model != "" {
+		p = p.WithModel(model)
+	}
+	return p, nil
+}
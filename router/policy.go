@@ -0,0 +1,155 @@
+package router
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alexisbouchez/ai/cost"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tokens"
+)
+
+// Policy orders the candidates for a request. The router tries them in the
+// returned order; candidates left out are not tried.
+type Policy interface {
+	Order(ctx context.Context, req *provider.ChatRequest, candidates []Candidate) []Candidate
+}
+
+type PolicyFunc func(ctx context.Context, req *provider.ChatRequest, candidates []Candidate) []Candidate
+
+func (f PolicyFunc) Order(ctx context.Context, req *provider.ChatRequest, candidates []Candidate) []Candidate {
+	return f(ctx, req, candidates)
+}
+
+// Observer is implemented by policies that learn from the route that served
+// a request.
+type Observer interface {
+	Served(ctx context.Context, route *Route)
+}
+
+// ScoreFunc rates a candidate for a request. Lower scores are tried first.
+type ScoreFunc func(ctx context.Context, req *provider.ChatRequest, c Candidate) float64
+
+// ByScore orders candidates by ascending score, keeping registration order
+// between equal scores.
+func ByScore(score ScoreFunc) Policy {
+	return PolicyFunc(func(ctx context.Context, req *provider.ChatRequest, candidates []Candidate) []Candidate {
+		scores := make(map[*Route]float64, len(candidates))
+		for _, c := range candidates {
+			scores[c.Route] = score(ctx, req, c)
+		}
+		slices.SortStableFunc(candidates, func(a, b Candidate) int {
+			sa, sb := scores[a.Route], scores[b.Route]
+			switch {
+			case sa < sb:
+				return -1
+			case sa > sb:
+				return 1
+			}
+			return 0
+		})
+		return candidates
+	})
+}
+
+// expectedCompletion is the completion size assumed when pricing a request
+// without MaxTokens.
+const expectedCompletion = 512
+
+// Cheapest tries the capable route with the lowest estimated cost first.
+// Routes without a known price are tried last.
+func Cheapest() Policy {
+	return ByScore(func(ctx context.Context, req *provider.ChatRequest, c Candidate) float64 {
+		price, ok := c.Route.price()
+		if !ok {
+			return math.Inf(1)
+		}
+		usage := provider.Usage{
+			PromptTokens:     tokens.EstimateMessages(c.Route.Model, req.Messages),
+			CompletionTokens: expectedCompletion,
+		}
+		if req.MaxTokens != nil {
+			usage.CompletionTokens = *req.MaxTokens
+		}
+		return price.Cost(usage)
+	})
+}
+
+// LowestLatency tries the route with the lowest expected latency first: its
+// observed latency divided by its success rate, so that failures count as
+// retries. Routes that have not been tried yet are tried before the others
+// so that every route gets measured, and routes that never succeeded are
+// tried last.
+func LowestLatency() Policy {
+	return ByScore(func(ctx context.Context, req *provider.ChatRequest, c Candidate) float64 {
+		s := c.Stats
+		if s.Requests == 0 {
+			return 0
+		}
+		if s.Failures >= s.Requests {
+			return math.Inf(1)
+		}
+		success := float64(s.Requests-s.Failures) / float64(s.Requests)
+		return float64(s.Latency) / success
+	})
+}
+
+// RoundRobin rotates the starting route on every request.
+func RoundRobin() Policy {
+	var next atomic.Uint64
+	return PolicyFunc(func(ctx context.Context, req *provider.ChatRequest, candidates []Candidate) []Candidate {
+		n := int((next.Add(1) - 1) % uint64(len(candidates)))
+		return slices.Concat(candidates[n:], candidates[:n])
+	})
+}
+
+type sticky struct {
+	next     Policy
+	mu       sync.Mutex
+	sessions map[string]*Route
+}
+
+// Sticky keeps every session, as set with cost.WithSession, on the route
+// that first served it, and orders the remaining routes with next. Requests
+// without a session are ordered by next alone.
+func Sticky(next Policy) Policy {
+	return &sticky{next: next, sessions: make(map[string]*Route)}
+}
+
+func (s *sticky) Order(ctx context.Context, req *provider.ChatRequest, candidates []Candidate) []Candidate {
+	candidates = s.next.Order(ctx, req, candidates)
+
+	session := cost.SessionFromContext(ctx)
+	if session == "" {
+		return candidates
+	}
+
+	s.mu.Lock()
+	route := s.sessions[session]
+	s.mu.Unlock()
+
+	i := slices.IndexFunc(candidates, func(c Candidate) bool { return c.Route == route })
+	if i > 0 {
+		c := candidates[i]
+		copy(candidates[1:i+1], candidates[:i])
+		candidates[0] = c
+	}
+	return candidates
+}
+
+func (s *sticky) Served(ctx context.Context, route *Route) {
+	if o, ok := s.next.(Observer); ok {
+		o.Served(ctx, route)
+	}
+
+	session := cost.SessionFromContext(ctx)
+	if session == "" {
+		return
+	}
+	s.mu.Lock()
+	s.sessions[session] = route
+	s.mu.Unlock()
+}
@@ -0,0 +1,300 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alexisbouchez/ai/cost"
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tokens"
+)
+
+var ErrNoRoute = errors.New("no route can serve the request")
+
+type Capability string
+
+const (
+	Tools  Capability = "tools"
+	Vision Capability = "vision"
+	JSON   Capability = "json"
+)
+
+// Route is a provider and model the router can send requests to.
+type Route struct {
+	Name     string
+	Provider provider.Provider
+	// Model overrides the request model when the route is used
+	Model        string
+	Capabilities []Capability
+	// Price defaults to the cost package price of Model
+	Price *cost.Price
+	// ContextWindow defaults to tokens.ContextWindow(Model)
+	ContextWindow int
+}
+
+func (r *Route) Has(c Capability) bool {
+	return slices.Contains(r.Capabilities, c)
+}
+
+func (r *Route) price() (cost.Price, bool) {
+	if r.Price != nil {
+		return *r.Price, true
+	}
+	return cost.Lookup(r.Model)
+}
+
+func (r *Route) contextWindow() int {
+	if r.ContextWindow > 0 {
+		return r.ContextWindow
+	}
+	return tokens.ContextWindow(r.Model)
+}
+
+// Stats are the observations the router made of a route.
+type Stats struct {
+	Requests int
+	Failures int
+	// Latency is an exponentially weighted moving average of successful
+	// request durations, zero until the route served a request
+	Latency time.Duration
+}
+
+type Candidate struct {
+	Route *Route
+	Stats Stats
+}
+
+type requirementsKey struct{}
+
+// Require returns a context whose requests are only routed to routes with
+// all of caps. Tools is inferred from the request.
+func Require(ctx context.Context, caps ...Capability) context.Context {
+	caps = append(requirements(ctx), caps...)
+	return context.WithValue(ctx, requirementsKey{}, caps)
+}
+
+func requirements(ctx context.Context) []Capability {
+	caps, _ := ctx.Value(requirementsKey{}).([]Capability)
+	return slices.Clone(caps)
+}
+
+type Router struct {
+	routes []*Route
+	// providers holds the route providers configured through the builder
+	// methods, which leave the routes themselves untouched
+	providers map[*Route]provider.Provider
+	policy    Policy
+	mu        sync.Mutex
+	stats     map[*Route]*Stats
+	onRoute   func(ctx context.Context, route *Route)
+}
+
+// New returns a provider that orders the capable routes with policy for
+// every request and moves on to the next one when a request fails with a
+// retryable error.
+func New(policy Policy, routes ...*Route) *Router {
+	return &Router{
+		routes: routes,
+		policy: policy,
+		stats:  make(map[*Route]*Stats),
+	}
+}
+
+// OnRoute registers a callback invoked with the route that served a request.
+func (r *Router) OnRoute(fn func(ctx context.Context, route *Route)) *Router {
+	r.onRoute = fn
+	return r
+}
+
+// Stats returns the observations made of route.
+func (r *Router) Stats(route *Route) Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.stats[route]; ok {
+		return *s
+	}
+	return Stats{}
+}
+
+// WithAPIKey, WithBaseURL and WithModel are no-ops: each route's provider
+// is configured directly. The HTTP client, timeout and headers apply to
+// every route, in a new router starting without stats.
+
+func (r *Router) WithAPIKey(key string) provider.Provider {
+	return r
+}
+
+func (r *Router) WithBaseURL(url string) provider.Provider {
+	return r
+}
+
+func (r *Router) WithModel(model string) provider.Provider {
+	return r
+}
+
+func (r *Router) WithHTTPClient(client *http.Client) provider.Provider {
+	return r.configure(func(p provider.Provider) provider.Provider {
+		return p.WithHTTPClient(client)
+	})
+}
+
+func (r *Router) WithTimeout(timeout time.Duration) provider.Provider {
+	return r.configure(func(p provider.Provider) provider.Provider {
+		return p.WithTimeout(timeout)
+	})
+}
+
+func (r *Router) WithHeaders(headers map[string]string) provider.Provider {
+	return r.configure(func(p provider.Provider) provider.Provider {
+		return p.WithHeaders(headers)
+	})
+}
+
+// configure returns a copy of r with every route provider replaced by fn.
+func (r *Router) configure(fn func(provider.Provider) provider.Provider) *Router {
+	cp := New(r.policy, r.routes...)
+	cp.onRoute = r.onRoute
+	cp.providers = make(map[*Route]provider.Provider, len(r.routes))
+	for _, route := range r.routes {
+		cp.providers[route] = fn(r.provider(route))
+	}
+	return cp
+}
+
+func (r *Router) provider(route *Route) provider.Provider {
+	if p, ok := r.providers[route]; ok {
+		return p
+	}
+	return route.Provider
+}
+
+func (r *Router) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	candidates, err := r.candidates(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, c := range candidates {
+		start := time.Now()
+		resp, err := r.provider(c.Route).Chat(ctx, request(c.Route, req))
+		r.observe(c.Route, time.Since(start), err)
+		if err == nil {
+			r.served(ctx, c.Route)
+			return resp, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !provider.IsRetryable(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (r *Router) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	candidates, err := r.candidates(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, c := range candidates {
+		start := time.Now()
+		stream, err := r.provider(c.Route).Stream(ctx, request(c.Route, req))
+		r.observe(c.Route, time.Since(start), err)
+		if err == nil {
+			r.served(ctx, c.Route)
+			return stream, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !provider.IsRetryable(err) {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// candidates returns the routes able to serve req, in policy order.
+func (r *Router) candidates(ctx context.Context, req *provider.ChatRequest) ([]Candidate, error) {
+	required := requirements(ctx)
+	if len(req.Tools) > 0 {
+		required = append(required, Tools)
+	}
+
+	r.mu.Lock()
+	var candidates []Candidate
+	for _, route := range r.routes {
+		if !capable(route, required) {
+			continue
+		}
+		if tokens.EstimateMessages(route.Model, req.Messages) > route.contextWindow() {
+			continue
+		}
+		c := Candidate{Route: route}
+		if s, ok := r.stats[route]; ok {
+			c.Stats = *s
+		}
+		candidates = append(candidates, c)
+	}
+	r.mu.Unlock()
+
+	if len(candidates) == 0 {
+		return nil, ErrNoRoute
+	}
+	if r.policy != nil {
+		candidates = r.policy.Order(ctx, req, candidates)
+	}
+	return candidates, nil
+}
+
+func capable(route *Route, required []Capability) bool {
+	for _, c := range required {
+		if !route.Has(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Router) observe(route *Route, elapsed time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.stats[route]
+	if !ok {
+		s = &Stats{}
+		r.stats[route] = s
+	}
+	s.Requests++
+	if err != nil {
+		s.Failures++
+		return
+	}
+	if s.Latency == 0 {
+		s.Latency = elapsed
+	} else {
+		s.Latency = (s.Latency*4 + elapsed) / 5
+	}
+}
+
+func (r *Router) served(ctx context.Context, route *Route) {
+	if r.onRoute != nil {
+		r.onRoute(ctx, route)
+	}
+	if o, ok := r.policy.(Observer); ok {
+		o.Served(ctx, route)
+	}
+}
+
+func request(route *Route, req *provider.ChatRequest) *provider.ChatRequest {
+	if route.Model == "" {
+		return req
+	}
+	r := *req
+	r.Model = route.Model
+	return &r
+}
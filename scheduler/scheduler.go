@@ -0,0 +1,346 @@
+// Package scheduler queues the requests of providers sharing a process, so
+// that interactive traffic is served ahead of background jobs:
+//
+//	s := scheduler.New(scheduler.MaxConcurrent(8), scheduler.ModelLimit("gpt-4o", 4))
+//	interactive := s.Wrap(p, scheduler.Interactive)
+//	batch := s.Wrap(p, scheduler.Background)
+//
+// Waiting requests start in priority order, first come first served within
+// a priority, as slots free up. A stream holds its slot until it ends.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Priority orders waiting requests, the highest starting first.
+type Priority int
+
+const (
+	Background  Priority = -10
+	Normal      Priority = 0
+	Interactive Priority = 10
+)
+
+type Option func(*Scheduler)
+
+// MaxConcurrent limits the requests running at once across all models.
+func MaxConcurrent(n int) Option {
+	return func(s *Scheduler) {
+		s.maxConcurrent = n
+	}
+}
+
+// ModelLimit limits the requests running at once for model.
+func ModelLimit(model string, n int) Option {
+	return func(s *Scheduler) {
+		s.modelLimits[model] = n
+	}
+}
+
+// DefaultModelLimit limits the requests running at once for the models
+// without a ModelLimit.
+func DefaultModelLimit(n int) Option {
+	return func(s *Scheduler) {
+		s.defaultLimit = n
+	}
+}
+
+// Scheduler admits the requests of the providers it wraps. A zero or
+// negative limit is unlimited.
+//
+// The rate limit state reported by the providers is shared: when a model
+// runs out of requests or tokens, or a request is rejected with a
+// retry-after, the requests for that model wait until the limit resets.
+type Scheduler struct {
+	maxConcurrent int
+	modelLimits   map[string]int
+	defaultLimit  int
+
+	mu      sync.Mutex
+	running int
+	models  map[string]*model
+	queue   []*waiter
+	seq     uint64
+}
+
+type model struct {
+	running int
+	paused  time.Time
+	timer   *time.Timer
+}
+
+type waiter struct {
+	priority Priority
+	seq      uint64
+	model    string
+	ready    chan struct{}
+}
+
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		modelLimits: make(map[string]int),
+		models:      make(map[string]*model),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose requests are scheduled with
+// priority, instead of the priority of the wrapped provider.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// Wrap returns p with its requests scheduled by s at priority.
+func (s *Scheduler) Wrap(p provider.Provider, priority Priority) provider.Provider {
+	return s.Middleware(priority)(p)
+}
+
+// Middleware returns a middleware scheduling requests by s at priority.
+func (s *Scheduler) Middleware(priority Priority) provider.Middleware {
+	var mw provider.Middleware
+	mw = func(p provider.Provider) provider.Provider {
+		return &scheduled{Wrapper: provider.Wrapper{Next: p, Wrap: mw}, scheduler: s, priority: priority}
+	}
+	return mw
+}
+
+type scheduled struct {
+	provider.Wrapper
+	scheduler *Scheduler
+	priority  Priority
+}
+
+func (p *scheduled) Chat(ctx context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	s := p.scheduler
+	release, err := s.acquire(ctx, req.Model, priorityOf(ctx, p.priority))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := p.Next.Chat(ctx, req)
+	if err != nil {
+		s.observe(req.Model, rateLimitOf(err))
+		return nil, err
+	}
+	s.observe(req.Model, resp.RateLimit)
+	return resp, nil
+}
+
+func (p *scheduled) Stream(ctx context.Context, req *provider.ChatRequest) (*provider.StreamReader, error) {
+	s := p.scheduler
+	release, err := s.acquire(ctx, req.Model, priorityOf(ctx, p.priority))
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := p.Next.Stream(ctx, req)
+	if err != nil {
+		release()
+		s.observe(req.Model, rateLimitOf(err))
+		return nil, err
+	}
+	s.observe(req.Model, stream.RateLimit())
+	return hold(stream, release), nil
+}
+
+// Queued returns the number of requests waiting for a slot.
+func (s *Scheduler) Queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Running returns the number of requests holding a slot.
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// acquire waits for a slot to run a request for name, and returns the
+// function releasing it.
+func (s *Scheduler) acquire(ctx context.Context, name string, priority Priority) (func(), error) {
+	s.mu.Lock()
+	s.seq++
+	w := &waiter{priority: priority, seq: s.seq, model: name, ready: make(chan struct{})}
+	i := len(s.queue)
+	for i > 0 && s.queue[i-1].priority < priority {
+		i--
+	}
+	s.queue = append(s.queue, nil)
+	copy(s.queue[i+1:], s.queue[i:])
+	s.queue[i] = w
+	s.dispatch()
+	s.mu.Unlock()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running--
+			s.models[name].running--
+			s.dispatch()
+		})
+	}
+
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		granted := !s.remove(w)
+		s.mu.Unlock()
+		if granted {
+			release()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// remove removes w from the queue and reports whether it was waiting.
+func (s *Scheduler) remove(w *waiter) bool {
+	for i, queued := range s.queue {
+		if queued == w {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch starts the waiting requests that have a slot, highest priority
+// first. A request for a saturated or paused model does not hold back the
+// requests for other models. s.mu must be held.
+func (s *Scheduler) dispatch() {
+	now := time.Now()
+	for i := 0; i < len(s.queue); {
+		if s.maxConcurrent > 0 && s.running >= s.maxConcurrent {
+			return
+		}
+		w := s.queue[i]
+		m := s.model(w.model)
+		if now.Before(m.paused) || (s.limit(w.model) > 0 && m.running >= s.limit(w.model)) {
+			i++
+			continue
+		}
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		s.running++
+		m.running++
+		close(w.ready)
+	}
+}
+
+func (s *Scheduler) model(name string) *model {
+	m, ok := s.models[name]
+	if !ok {
+		m = &model{}
+		s.models[name] = m
+	}
+	return m
+}
+
+func (s *Scheduler) limit(name string) int {
+	if n, ok := s.modelLimits[name]; ok {
+		return n
+	}
+	return s.defaultLimit
+}
+
+// observe pauses the requests for name until the limits reported in info
+// reset, when they are exhausted.
+func (s *Scheduler) observe(name string, info *provider.RateLimitInfo) {
+	if info == nil {
+		return
+	}
+	now := time.Now()
+	var until time.Time
+	if info.RetryAfter > 0 {
+		until = now.Add(info.RetryAfter)
+	}
+	if info.RemainingRequests == 0 && info.ResetRequests.After(until) {
+		until = info.ResetRequests
+	}
+	if info.RemainingTokens == 0 && info.ResetTokens.After(until) {
+		until = info.ResetTokens
+	}
+	if !until.After(now) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.model(name)
+	if !until.After(m.paused) {
+		return
+	}
+	m.paused = until
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.timer = time.AfterFunc(until.Sub(now), func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.dispatch()
+	})
+}
+
+func priorityOf(ctx context.Context, priority Priority) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return priority
+}
+
+func rateLimitOf(err error) *provider.RateLimitInfo {
+	var apiErr *provider.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RateLimit
+	}
+	return nil
+}
+
+// hold forwards the events of src to a new StreamReader, calling release
+// when the stream ends or is closed.
+func hold(src *provider.StreamReader, release func()) *provider.StreamReader {
+	events := make(chan provider.StreamEvent)
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer close(events)
+		defer release()
+
+		for {
+			event, err := src.Recv()
+			if errors.Is(err, provider.ErrStreamClosed) {
+				return
+			}
+			select {
+			case events <- event:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return provider.NewStreamReader(events, func() {
+		once.Do(func() { close(done) })
+		src.Close()
+	}, provider.ReportRateLimit(src.RateLimit()))
+}
@@ -0,0 +1,595 @@
+// Package schema validates JSON values against JSON Schema, such as the
+// schemas of tool parameters and structured outputs, and describes every
+// violation with its location so that a model can correct its output.
+//
+// It supports the keywords of draft 2020-12 used to describe data: type,
+// enum, const, the numeric, string, array and object constraints, format,
+// $ref within the document, allOf, anyOf, oneOf, not and if/then/else.
+// Unknown keywords and formats are ignored.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Violation is a part of a value that does not match the schema.
+type Violation struct {
+	// Path locates the value, such as $.items[2].price
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// ValidationError lists the violations of a value.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return "value does not match schema: " + strings.Join(messages, "; ")
+}
+
+// Schema is a compiled JSON Schema. It is safe for concurrent use.
+type Schema struct {
+	root any
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// New compiles schema, given as JSON bytes, a json.RawMessage or a value
+// marshaling to a schema such as the maps of tool.SchemaOf.
+func New(schema any) (*Schema, error) {
+	var data []byte
+	switch s := schema.(type) {
+	case []byte:
+		data = s
+	case json.RawMessage:
+		data = s
+	default:
+		var err error
+		if data, err = json.Marshal(schema); err != nil {
+			return nil, fmt.Errorf("failed to marshal schema: %w", err)
+		}
+	}
+
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	switch root.(type) {
+	case map[string]any, bool:
+	default:
+		return nil, fmt.Errorf("schema must be an object or a boolean")
+	}
+	return &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}, nil
+}
+
+// Validate checks value, after converting it to JSON, and returns a
+// *ValidationError listing every violation.
+func (s *Schema) Validate(value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return s.ValidateJSON(data)
+}
+
+// ValidateJSON checks the JSON document data.
+func (s *Schema) ValidateJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	var violations []Violation
+	s.validate(s.root, value, "$", &violations, 0)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// maxDepth stops the resolution of recursive $refs that never reach a value
+const maxDepth = 64
+
+func (s *Schema) validate(schema, value any, path string, out *[]Violation, depth int) {
+	fail := func(format string, args ...any) {
+		*out = append(*out, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			fail("is not allowed")
+		}
+		return
+	}
+	keywords, ok := schema.(map[string]any)
+	if !ok {
+		return
+	}
+
+	if ref, ok := keywords["$ref"].(string); ok {
+		if depth >= maxDepth {
+			fail("schema reference %s is too deeply nested", ref)
+			return
+		}
+		target, err := s.resolve(ref)
+		if err != nil {
+			fail("%v", err)
+			return
+		}
+		s.validate(target, value, path, out, depth+1)
+	}
+
+	if t, ok := keywords["type"]; ok && !matchesType(t, value) {
+		fail("must be %s, got %s", describeType(t), describe(value))
+		return
+	}
+	if enum, ok := keywords["enum"].([]any); ok && !slices.ContainsFunc(enum, func(v any) bool { return equal(v, value) }) {
+		options := make([]string, len(enum))
+		for i, v := range enum {
+			options[i] = literal(v)
+		}
+		fail("must be one of %s, got %s", strings.Join(options, ", "), literal(value))
+	}
+	if c, ok := keywords["const"]; ok && !equal(c, value) {
+		fail("must be %s, got %s", literal(c), literal(value))
+	}
+
+	switch value := value.(type) {
+	case string:
+		s.validateString(keywords, value, fail)
+	case float64:
+		validateNumber(keywords, value, fail)
+	case []any:
+		s.validateArray(keywords, value, path, out, depth, fail)
+	case map[string]any:
+		s.validateObject(keywords, value, path, out, depth, fail)
+	}
+
+	if all, ok := keywords["allOf"].([]any); ok {
+		for _, sub := range all {
+			s.validate(sub, value, path, out, depth+1)
+		}
+	}
+	if anyOf, ok := keywords["anyOf"].([]any); ok {
+		if matched, closest := s.branches(anyOf, value, path, depth); matched == 0 {
+			fail("must match one of %d alternatives, the closest fails with: %s", len(anyOf), closest)
+		}
+	}
+	if oneOf, ok := keywords["oneOf"].([]any); ok {
+		matched, closest := s.branches(oneOf, value, path, depth)
+		switch {
+		case matched == 0:
+			fail("must match one of %d alternatives, the closest fails with: %s", len(oneOf), closest)
+		case matched > 1:
+			fail("must match exactly one of %d alternatives, matches %d", len(oneOf), matched)
+		}
+	}
+	if not, ok := keywords["not"]; ok && s.valid(not, value, path, depth) {
+		fail("must not match the excluded schema")
+	}
+	if cond, ok := keywords["if"]; ok {
+		if s.valid(cond, value, path, depth) {
+			if then, ok := keywords["then"]; ok {
+				s.validate(then, value, path, out, depth+1)
+			}
+		} else if otherwise, ok := keywords["else"]; ok {
+			s.validate(otherwise, value, path, out, depth+1)
+		}
+	}
+}
+
+func (s *Schema) validateString(keywords map[string]any, value string, fail func(string, ...any)) {
+	length := utf8.RuneCountInString(value)
+	if n, ok := number(keywords["minLength"]); ok && float64(length) < n {
+		fail("must be at least %s characters long, got %d", format(n), length)
+	}
+	if n, ok := number(keywords["maxLength"]); ok && float64(length) > n {
+		fail("must be at most %s characters long, got %d", format(n), length)
+	}
+	if pattern, ok := keywords["pattern"].(string); ok {
+		re, err := s.pattern(pattern)
+		if err != nil {
+			fail("schema pattern %q is invalid: %v", pattern, err)
+		} else if !re.MatchString(value) {
+			fail("must match the pattern %s, got %s", pattern, literal(value))
+		}
+	}
+	if f, ok := keywords["format"].(string); ok && !matchesFormat(f, value) {
+		fail("must be a valid %s, got %s", f, literal(value))
+	}
+}
+
+func validateNumber(keywords map[string]any, value float64, fail func(string, ...any)) {
+	if n, ok := number(keywords["minimum"]); ok && value < n {
+		fail("must be at least %s, got %s", format(n), format(value))
+	}
+	if n, ok := number(keywords["maximum"]); ok && value > n {
+		fail("must be at most %s, got %s", format(n), format(value))
+	}
+	if n, ok := number(keywords["exclusiveMinimum"]); ok && value <= n {
+		fail("must be greater than %s, got %s", format(n), format(value))
+	}
+	if n, ok := number(keywords["exclusiveMaximum"]); ok && value >= n {
+		fail("must be less than %s, got %s", format(n), format(value))
+	}
+	if n, ok := number(keywords["multipleOf"]); ok && n > 0 {
+		if q := value / n; math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("must be a multiple of %s, got %s", format(n), format(value))
+		}
+	}
+}
+
+func (s *Schema) validateArray(keywords map[string]any, value []any, path string, out *[]Violation, depth int, fail func(string, ...any)) {
+	if n, ok := number(keywords["minItems"]); ok && float64(len(value)) < n {
+		fail("must have at least %s items, got %d", format(n), len(value))
+	}
+	if n, ok := number(keywords["maxItems"]); ok && float64(len(value)) > n {
+		fail("must have at most %s items, got %d", format(n), len(value))
+	}
+	if unique, _ := keywords["uniqueItems"].(bool); unique {
+	duplicates:
+		for i := range value {
+			for j := range i {
+				if equal(value[i], value[j]) {
+					fail("must have unique items, items %d and %d are equal", j, i)
+					break duplicates
+				}
+			}
+		}
+	}
+
+	// Before draft 2020-12, an array of items described a tuple
+	prefix, _ := keywords["prefixItems"].([]any)
+	items, hasItems := keywords["items"]
+	if tuple, ok := items.([]any); ok {
+		prefix, items, hasItems = tuple, keywords["additionalItems"], keywords["additionalItems"] != nil
+	}
+	for i, item := range value {
+		itemPath := path + "[" + strconv.Itoa(i) + "]"
+		if i < len(prefix) {
+			s.validate(prefix[i], item, itemPath, out, depth+1)
+		} else if hasItems {
+			s.validate(items, item, itemPath, out, depth+1)
+		}
+	}
+
+	if contains, ok := keywords["contains"]; ok {
+		count := 0
+		for i, item := range value {
+			if s.valid(contains, item, path+"["+strconv.Itoa(i)+"]", depth) {
+				count++
+			}
+		}
+		least := 1.0
+		if n, ok := number(keywords["minContains"]); ok {
+			least = n
+		}
+		if float64(count) < least {
+			fail("must contain at least %s matching items, got %d", format(least), count)
+		}
+		if n, ok := number(keywords["maxContains"]); ok && float64(count) > n {
+			fail("must contain at most %s matching items, got %d", format(n), count)
+		}
+	}
+}
+
+func (s *Schema) validateObject(keywords map[string]any, value map[string]any, path string, out *[]Violation, depth int, fail func(string, ...any)) {
+	if required, ok := keywords["required"].([]any); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, ok := value[name]; !ok {
+					*out = append(*out, Violation{Path: join(path, name), Message: "is required"})
+				}
+			}
+		}
+	}
+	if n, ok := number(keywords["minProperties"]); ok && float64(len(value)) < n {
+		fail("must have at least %s properties, got %d", format(n), len(value))
+	}
+	if n, ok := number(keywords["maxProperties"]); ok && float64(len(value)) > n {
+		fail("must have at most %s properties, got %d", format(n), len(value))
+	}
+
+	properties, _ := keywords["properties"].(map[string]any)
+	patternProperties, _ := keywords["patternProperties"].(map[string]any)
+	additional, hasAdditional := keywords["additionalProperties"]
+	names, hasNames := keywords["propertyNames"]
+
+	for _, name := range slices.Sorted(maps.Keys(value)) {
+		propertyPath := join(path, name)
+		if hasNames {
+			s.validate(names, name, propertyPath, out, depth+1)
+		}
+
+		matched := false
+		if sub, ok := properties[name]; ok {
+			matched = true
+			s.validate(sub, value[name], propertyPath, out, depth+1)
+		}
+		for pattern, sub := range patternProperties {
+			if re, err := s.pattern(pattern); err == nil && re.MatchString(name) {
+				matched = true
+				s.validate(sub, value[name], propertyPath, out, depth+1)
+			}
+		}
+		if matched || !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			*out = append(*out, Violation{Path: propertyPath, Message: "is not an allowed property"})
+			continue
+		}
+		s.validate(additional, value[name], propertyPath, out, depth+1)
+	}
+
+	if dependent, ok := keywords["dependentRequired"].(map[string]any); ok {
+		for name, deps := range dependent {
+			if _, ok := value[name]; !ok {
+				continue
+			}
+			deps, _ := deps.([]any)
+			for _, dep := range deps {
+				if dep, ok := dep.(string); ok {
+					if _, ok := value[dep]; !ok {
+						*out = append(*out, Violation{Path: join(path, dep), Message: fmt.Sprintf("is required when %s is set", name)})
+					}
+				}
+			}
+		}
+	}
+}
+
+// branches counts the schemas value matches and describes the violations of
+// the closest one when none matches.
+func (s *Schema) branches(schemas []any, value any, path string, depth int) (int, string) {
+	matched := 0
+	var closest []Violation
+	for _, sub := range schemas {
+		var violations []Violation
+		s.validate(sub, value, path, &violations, depth+1)
+		if len(violations) == 0 {
+			matched++
+		} else if closest == nil || len(violations) < len(closest) {
+			closest = violations
+		}
+	}
+
+	messages := make([]string, len(closest))
+	for i, v := range closest {
+		messages[i] = v.String()
+	}
+	return matched, strings.Join(messages, "; ")
+}
+
+func (s *Schema) valid(schema, value any, path string, depth int) bool {
+	var violations []Violation
+	s.validate(schema, value, path, &violations, depth+1)
+	return len(violations) == 0
+}
+
+// resolve returns the schema referenced by ref, a JSON pointer into the
+// document such as #/$defs/address.
+func (s *Schema) resolve(ref string) (any, error) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("schema reference %s is not supported, only references within the schema are", ref)
+	}
+
+	target := s.root
+	if pointer == "" {
+		return target, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token, _ = url.PathUnescape(token)
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch node := target.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("schema reference %s not found", ref)
+			}
+			target = next
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("schema reference %s not found", ref)
+			}
+			target = node[i]
+		default:
+			return nil, fmt.Errorf("schema reference %s not found", ref)
+		}
+	}
+	return target, nil
+}
+
+func (s *Schema) pattern(pattern string) (*regexp.Regexp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if re, ok := s.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	s.patterns[pattern] = re
+	return re, nil
+}
+
+func matchesType(t, value any) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, value)
+	case []any:
+		return slices.ContainsFunc(t, func(t any) bool {
+			name, _ := t.(string)
+			return isType(name, value)
+		})
+	}
+	return true
+}
+
+func isType(name string, value any) bool {
+	switch name {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	}
+	return false
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func matchesFormat(f, value string) bool {
+	switch f {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", value)
+		if err != nil {
+			_, err = time.Parse(time.TimeOnly, value)
+		}
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && !strings.Contains(value, ":")
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	}
+	return true
+}
+
+func number(v any) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
+
+func equal(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func describeType(t any) string {
+	switch t := t.(type) {
+	case string:
+		return article(t)
+	case []any:
+		names := make([]string, len(t))
+		for i, name := range t {
+			names[i] = fmt.Sprint(name)
+		}
+		return "one of " + strings.Join(names, ", ")
+	}
+	return fmt.Sprint(t)
+}
+
+func article(name string) string {
+	switch name {
+	case "null":
+		return "null"
+	case "array", "integer", "object":
+		return "an " + name
+	}
+	return "a " + name
+}
+
+// describe names the type of value, with the value itself for scalars.
+func describe(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean " + strconv.FormatBool(value)
+	case string:
+		return "string " + literal(value)
+	case float64:
+		return "number " + format(value)
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprint(value)
+}
+
+// literal formats value as JSON, shortened for long values.
+func literal(value any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	s := strings.TrimSpace(buf.String())
+	if utf8.RuneCountInString(s) > 60 {
+		s = string([]rune(s)[:57]) + "..."
+	}
+	return s
+}
+
+func format(n float64) string {
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func join(path, name string) string {
+	if identifier.MatchString(name) {
+		return path + "." + name
+	}
+	return path + "[" + strconv.Quote(name) + "]"
+}
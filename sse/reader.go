@@ -0,0 +1,107 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultMaxLineSize is the longest line a Reader accepts unless configured
+// otherwise. Tool call arguments can arrive as a single multi-megabyte line.
+const DefaultMaxLineSize = 16 << 20
+
+var ErrLineTooLong = errors.New("sse: line too long")
+
+// Event is a server-sent event. Data joins multiple data lines with "\n".
+type Event struct {
+	Type string
+	Data string
+	ID   string
+}
+
+// Reader parses a server-sent event stream.
+type Reader struct {
+	r           *bufio.Reader
+	maxLineSize int
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), maxLineSize: DefaultMaxLineSize}
+}
+
+// MaxLineSize sets the longest line the reader accepts before failing with
+// ErrLineTooLong.
+func (r *Reader) MaxLineSize(n int) *Reader {
+	r.maxLineSize = n
+	return r
+}
+
+// Next returns the next event carrying data, or io.EOF at the end of the
+// stream. Comments and events without data are skipped.
+func (r *Reader) Next() (Event, error) {
+	var event Event
+	var data []string
+
+	for {
+		line, err := r.readLine()
+		if err == io.EOF && len(data) > 0 {
+			// the stream ended without the blank line closing the event
+			event.Data = strings.Join(data, "\n")
+			return event, nil
+		}
+		if err != nil {
+			return Event{}, err
+		}
+
+		if line == "" {
+			if len(data) > 0 {
+				event.Data = strings.Join(data, "\n")
+				return event, nil
+			}
+			event = Event{}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Type = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			event.ID = value
+		}
+	}
+}
+
+// readLine returns the next line without its line ending.
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.r.ReadSlice('\n')
+		if len(line)+len(chunk) > r.maxLineSize+2 {
+			return "", fmt.Errorf("%w: exceeds %d bytes", ErrLineTooLong, r.maxLineSize)
+		}
+		line = append(line, chunk...)
+
+		switch {
+		case err == nil:
+			line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+			return string(line), nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err == io.EOF && len(line) > 0:
+			return string(bytes.TrimSuffix(line, []byte("\r"))), nil
+		default:
+			return "", err
+		}
+	}
+}
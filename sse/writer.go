@@ -0,0 +1,201 @@
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Writer serializes stream events as OpenAI-compatible chat.completion.chunk
+// server-sent events.
+type Writer struct {
+	w       io.Writer
+	flusher http.Flusher
+	id      string
+	model   string
+	created int64
+	started map[int]bool
+}
+
+// NewWriter returns a Writer for w. When w is an http.ResponseWriter the
+// event stream headers are set and every event is flushed as it is written.
+// id and model are reported on every chunk.
+func NewWriter(w io.Writer, id, model string) *Writer {
+	if rw, ok := w.(http.ResponseWriter); ok {
+		h := rw.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+	}
+	flusher, _ := w.(http.Flusher)
+	return &Writer{
+		w:       w,
+		flusher: flusher,
+		id:      id,
+		model:   model,
+		created: time.Now().Unix(),
+		started: make(map[int]bool),
+	}
+}
+
+type chunk struct {
+	ID      string          `json:"id"`
+	Object  string          `json:"object"`
+	Created int64           `json:"created"`
+	Model   string          `json:"model"`
+	Choices []chunkChoice   `json:"choices"`
+	Usage   *provider.Usage `json:"usage,omitempty"`
+}
+
+type chunkChoice struct {
+	Index        int        `json:"index"`
+	Delta        chunkDelta `json:"delta"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+type chunkDelta struct {
+	Role      provider.Role   `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []chunkToolCall `json:"tool_calls,omitempty"`
+}
+
+// chunkToolCall is a tool call delta. Clients accumulate arguments by
+// index, so it is always sent, while the id, type and name only appear on
+// the first delta of a call.
+type chunkToolCall struct {
+	Index    int           `json:"index"`
+	ID       string        `json:"id,omitempty"`
+	Type     string        `json:"type,omitempty"`
+	Function chunkFunction `json:"function"`
+}
+
+type chunkFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+func toChunkToolCalls(calls []provider.ToolCall) []chunkToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	out := make([]chunkToolCall, len(calls))
+	for i, call := range calls {
+		out[i] = chunkToolCall{
+			Index: call.Index,
+			ID:    call.ID,
+			Type:  call.Type,
+			Function: chunkFunction{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			},
+		}
+	}
+	return out
+}
+
+// WriteEvent writes event as a chunk. The first chunk of every choice
+// carries the assistant role, and an event holding only usage is written
+// with an empty choices list, as OpenAI does with include_usage.
+func (w *Writer) WriteEvent(event provider.StreamEvent) error {
+	if event.Err != nil {
+		return w.WriteError(event.Err)
+	}
+
+	c := chunk{
+		ID:      w.id,
+		Object:  "chat.completion.chunk",
+		Created: w.created,
+		Model:   w.model,
+		Choices: []chunkChoice{},
+		Usage:   event.Usage,
+	}
+
+	empty := event.Delta.Content == "" && len(event.Delta.ToolCalls) == 0 && event.FinishReason == ""
+	if !empty || event.Usage == nil {
+		choice := chunkChoice{
+			Index: event.Index,
+			Delta: chunkDelta{Content: event.Delta.Content, ToolCalls: toChunkToolCalls(event.Delta.ToolCalls)},
+		}
+		if !w.started[event.Index] {
+			choice.Delta.Role = provider.RoleAssistant
+			w.started[event.Index] = true
+		}
+		if event.FinishReason != "" {
+			choice.FinishReason = &event.FinishReason
+		}
+		c.Choices = append(c.Choices, choice)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chunk: %w", err)
+	}
+	return w.write(data)
+}
+
+// WriteError writes err as an OpenAI error object. API errors keep their
+// type and message.
+func (w *Writer) WriteError(err error) error {
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+		} `json:"error"`
+	}
+	e.Error.Message = err.Error()
+	e.Error.Type = "server_error"
+
+	var apiErr *provider.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Message != "" {
+			e.Error.Message = apiErr.Message
+		}
+		if apiErr.Type != "" {
+			e.Error.Type = apiErr.Type
+		}
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal error: %w", err)
+	}
+	return w.write(data)
+}
+
+// Done writes the [DONE] terminator.
+func (w *Writer) Done() error {
+	return w.write([]byte("[DONE]"))
+}
+
+func (w *Writer) write(data []byte) error {
+	if _, err := fmt.Fprintf(w.w, "data: %s\n\n", data); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return nil
+}
+
+// Copy writes every event of stream to w followed by [DONE], or the stream
+// error in place of [DONE] when the stream fails. It closes the stream and
+// returns the first write or stream error.
+func Copy(w *Writer, stream *provider.StreamReader) error {
+	for event, err := range stream.Events() {
+		if err != nil {
+			if werr := w.WriteError(err); werr != nil {
+				return werr
+			}
+			return err
+		}
+		if err := w.WriteEvent(event); err != nil {
+			return err
+		}
+	}
+	return w.Done()
+}
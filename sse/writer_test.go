@@ -0,0 +1,99 @@
+package sse_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/sse"
+)
+
+func TestWriterToolCalls(t *testing.T) {
+	var buf bytes.Buffer
+	w := sse.NewWriter(&buf, "chatcmpl-1", "gpt-4o")
+	deltas := []provider.ToolCall{
+		{Index: 0, ID: "call_1", Type: "function", Function: provider.FunctionCall{Name: "weather", Arguments: `{"city":`}},
+		{Index: 1, ID: "call_2", Type: "function", Function: provider.FunctionCall{Name: "time", Arguments: `{"zone":`}},
+		{Index: 0, Function: provider.FunctionCall{Arguments: `"Paris"}`}},
+		{Index: 1, Function: provider.FunctionCall{Arguments: `"CET"}`}},
+	}
+	for _, call := range deltas {
+		event := provider.StreamEvent{Delta: provider.Delta{ToolCalls: []provider.ToolCall{call}}}
+		if err := w.WriteEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteEvent(provider.StreamEvent{FinishReason: "tool_calls"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	type call struct {
+		ID, Type, Name, Arguments string
+	}
+	var calls []call
+	reader := sse.NewReader(&buf)
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Data == "[DONE]" {
+			break
+		}
+		if strings.Contains(event.Data, `"id":""`) || strings.Contains(event.Data, `"name":""`) {
+			t.Errorf("empty fields in %s", event.Data)
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					ToolCalls []struct {
+						Index    *int
+						ID, Type string
+						Function struct{ Name, Arguments string }
+					} `json:"tool_calls"`
+				}
+			}
+		}
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			t.Fatal(err)
+		}
+		for _, choice := range chunk.Choices {
+			for _, delta := range choice.Delta.ToolCalls {
+				if delta.Index == nil {
+					t.Fatalf("tool call delta without index: %s", event.Data)
+				}
+				for len(calls) <= *delta.Index {
+					calls = append(calls, call{})
+				}
+				c := &calls[*delta.Index]
+				c.ID += delta.ID
+				c.Type += delta.Type
+				c.Name += delta.Function.Name
+				c.Arguments += delta.Function.Arguments
+			}
+		}
+	}
+
+	want := []call{
+		{ID: "call_1", Type: "function", Name: "weather", Arguments: `{"city":"Paris"}`},
+		{ID: "call_2", Type: "function", Name: "time", Arguments: `{"zone":"CET"}`},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got %d calls, want %d", len(calls), len(want))
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %+v, want %+v", i, calls[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package store persists state, such as workflow checkpoints, under string
+// keys.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotFound is returned by Get for keys without a value.
+var ErrNotFound = errors.New("key not found")
+
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Memory is a Store keeping values in memory. It is safe for concurrent
+// use.
+type Memory struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+func NewMemory() *Memory {
+	return &Memory{values: make(map[string][]byte)}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+func (m *Memory) Put(ctx context.Context, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	return nil
+}
+
+// Dir is a Store keeping every value in a file of a directory, named after
+// the escaped key with a .json extension, so that it survives restarts.
+// Values are replaced atomically.
+type Dir struct {
+	path string
+}
+
+// NewDir stores values in the directory at path, creating it if needed.
+func NewDir(path string) (*Dir, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	return &Dir{path: path}, nil
+}
+
+func (d *Dir) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := os.ReadFile(d.file(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", key, err)
+	}
+	return value, nil
+}
+
+func (d *Dir) Put(ctx context.Context, key string, value []byte) error {
+	tmp, err := os.CreateTemp(d.path, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %q: %w", key, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %q: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %q: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), d.file(key)); err != nil {
+		return fmt.Errorf("failed to write %q: %w", key, err)
+	}
+	return nil
+}
+
+func (d *Dir) Delete(ctx context.Context, key string) error {
+	err := os.Remove(d.file(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %q: %w", key, err)
+	}
+	return nil
+}
+
+func (d *Dir) file(key string) string {
+	return filepath.Join(d.path, url.PathEscape(key)+".json")
+}
@@ -0,0 +1,194 @@
+// Package streamjson parses JSON as it is streamed, turning every prefix of
+// a document into the most complete valid JSON it can, so structured output
+// can be rendered before the model finishes writing it.
+package streamjson
+
+import (
+	"encoding/json"
+	"iter"
+	"strings"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Complete closes a truncated JSON document. Strings being written are cut
+// where they stop, while keys, numbers and literals that are not finished
+// yet are left out. Text before the first { or [, such as a code fence, is
+// ignored. It reports false when no value has started.
+func Complete(partial string) (string, bool) {
+	start := strings.IndexAny(partial, "{[")
+	if start < 0 {
+		return "", false
+	}
+	s := partial[start:]
+
+	type frame struct {
+		object    bool
+		expectKey bool
+	}
+	var stack []frame
+
+	closers := func() string {
+		var b strings.Builder
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].object {
+				b.WriteByte('}')
+			} else {
+				b.WriteByte(']')
+			}
+		}
+		return b.String()
+	}
+
+	// the longest prefix known to end on a complete value, with the
+	// brackets that close it
+	safe, safeClosers := 0, ""
+	mark := func(i int) {
+		safe, safeClosers = i, closers()
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '{' || c == '[':
+			stack = append(stack, frame{object: c == '{', expectKey: c == '{'})
+			mark(i + 1)
+
+		case c == '}' || c == ']':
+			if len(stack) == 0 {
+				return s[:i], true
+			}
+			stack = stack[:len(stack)-1]
+			mark(i + 1)
+			if len(stack) == 0 {
+				return s[:i+1], true
+			}
+
+		case c == ',':
+			if n := len(stack); n > 0 && stack[n-1].object {
+				stack[n-1].expectKey = true
+			}
+
+		case c == '"':
+			key := len(stack) > 0 && stack[len(stack)-1].object && stack[len(stack)-1].expectKey
+			end := stringEnd(s, i)
+			if end < 0 {
+				if key {
+					return s[:safe] + safeClosers, safe > 0
+				}
+				return trimEscape(s) + `"` + closers(), true
+			}
+			if key {
+				stack[len(stack)-1].expectKey = false
+			} else {
+				mark(end + 1)
+			}
+			i = end
+
+		case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			end := i
+			for end < len(s) && strings.IndexByte("+-.eE0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ", s[end]) >= 0 {
+				end++
+			}
+			if end < len(s) || json.Valid([]byte(s[i:end])) {
+				mark(end)
+			}
+			i = end - 1
+		}
+	}
+	return s[:safe] + safeClosers, safe > 0
+}
+
+// stringEnd returns the index of the quote closing the string opened at i,
+// or -1 when the string is unterminated.
+func stringEnd(s string, i int) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '"':
+			return j
+		}
+	}
+	return -1
+}
+
+// trimEscape drops an unfinished escape sequence at the end of s.
+func trimEscape(s string) string {
+	if i := strings.LastIndex(s, `\u`); i >= 0 && len(s)-i < 6 && (i == 0 || s[i-1] != '\\') {
+		return s[:i]
+	}
+	backslashes := len(s) - len(strings.TrimRight(s, `\`))
+	if backslashes%2 == 1 {
+		return s[:len(s)-1]
+	}
+	return s
+}
+
+// Parser accumulates streamed text and decodes its best-effort completion.
+type Parser struct {
+	buf  strings.Builder
+	last string
+}
+
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// Write appends a delta and reports whether the completed document changed.
+func (p *Parser) Write(delta string) bool {
+	p.buf.WriteString(delta)
+	completed, ok := Complete(p.buf.String())
+	if !ok || completed == p.last {
+		return false
+	}
+	p.last = completed
+	return true
+}
+
+// JSON returns the completion of the text written so far.
+func (p *Parser) JSON() string {
+	return p.last
+}
+
+// Decode unmarshals the completion of the text written so far into v.
+func (p *Parser) Decode(v any) error {
+	if p.last == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(p.last), v)
+}
+
+// Values yields a partial T every time the content streamed so far
+// completes to a different document, ending with the final value. Tool call
+// arguments are parsed instead of the content when the model answers with a
+// tool call.
+func Values[T any](stream *provider.StreamReader) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		p := NewParser()
+		for event, err := range stream.Events() {
+			var zero T
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+
+			delta := event.Delta.Content
+			for _, tc := range event.Delta.ToolCalls {
+				delta += tc.Function.Arguments
+			}
+			if !p.Write(delta) {
+				continue
+			}
+
+			var v T
+			if err := p.Decode(&v); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package summarize condenses documents of any length with map-reduce
+// summarization: the text is split into chunks that fit the model, the
+// chunks are summarized concurrently and the partial summaries are merged
+// until a single summary remains.
+package summarize
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/textsplit"
+	"github.com/alexisbouchez/ai/tokens"
+)
+
+const (
+	defaultChunkTokens = 4000
+	defaultConcurrency = 4
+	defaultStyle       = "Write a concise, factual summary. Keep names, figures, dates and conclusions."
+	// maxRounds bounds the reduce rounds, each of which at least halves the
+	// number of chunks
+	maxRounds = 32
+)
+
+type Summarizer struct {
+	provider    provider.Provider
+	model       string
+	chunkTokens int
+	concurrency int
+	words       int
+	style       string
+}
+
+func New(p provider.Provider) *Summarizer {
+	return &Summarizer{
+		provider:    p,
+		chunkTokens: defaultChunkTokens,
+		concurrency: defaultConcurrency,
+		style:       defaultStyle,
+	}
+}
+
+// Model sets the model used for every call and for token counting.
+func (s *Summarizer) Model(model string) *Summarizer {
+	s.model = model
+	return s
+}
+
+// ChunkTokens bounds the size of the text sent in a single call.
+func (s *Summarizer) ChunkTokens(n int) *Summarizer {
+	s.chunkTokens = n
+	return s
+}
+
+// Concurrency bounds the number of chunks summarized at once.
+func (s *Summarizer) Concurrency(n int) *Summarizer {
+	s.concurrency = n
+	return s
+}
+
+// Length sets the target length of the final summary in words. Zero lets
+// the model decide.
+func (s *Summarizer) Length(words int) *Summarizer {
+	s.words = words
+	return s
+}
+
+// Style replaces the instructions given with every chunk, e.g. to ask for
+// bullet points or a particular audience.
+func (s *Summarizer) Style(prompt string) *Summarizer {
+	s.style = prompt
+	return s
+}
+
+// Summarize returns a summary of text.
+func (s *Summarizer) Summarize(ctx context.Context, text string) (string, error) {
+	chunks := s.split(text)
+	for round := 0; len(chunks) > 1; round++ {
+		if round == maxRounds {
+			return "", fmt.Errorf("summaries did not converge after %d rounds", maxRounds)
+		}
+		summaries, err := s.mapChunks(ctx, chunks)
+		if err != nil {
+			return "", err
+		}
+		// summaries that still do not fit together are reduced again, in
+		// pairs when they are too long to pack into fewer chunks
+		grouped := s.group(summaries)
+		if len(grouped) >= len(chunks) {
+			grouped = pair(summaries)
+		}
+		chunks = grouped
+	}
+	return s.summarize(ctx, chunks[0], s.words)
+}
+
+func (s *Summarizer) mapChunks(ctx context.Context, chunks []string) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	summaries := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, max(s.concurrency, 1))
+
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			summaries[i], errs[i] = s.summarize(ctx, chunk, 0)
+			if errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize chunk %d: %w", i, err)
+		}
+	}
+	return summaries, nil
+}
+
+func (s *Summarizer) summarize(ctx context.Context, text string, words int) (string, error) {
+	instructions := s.style
+	if words > 0 {
+		instructions += fmt.Sprintf(" Use at most %d words.", words)
+	}
+
+	resp, err := s.provider.Chat(ctx, &provider.ChatRequest{
+		Model: s.model,
+		Messages: []provider.Message{
+			{Role: provider.RoleSystem, Content: instructions},
+			{Role: provider.RoleUser, Content: text},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("empty response")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+func (s *Summarizer) split(text string) []string {
+	chunks := textsplit.Tokens(s.model, s.chunkTokens, 0).Split(text)
+	if len(chunks) == 0 {
+		return []string{text}
+	}
+	return chunks
+}
+
+// group packs summaries into as few chunks as fit chunkTokens.
+func (s *Summarizer) group(summaries []string) []string {
+	var chunks []string
+	var current []string
+	size := 0
+	for _, part := range summaries {
+		n := s.count(part)
+		if len(current) > 0 && size+n > s.chunkTokens {
+			chunks = append(chunks, strings.Join(current, "\n\n"))
+			current, size = nil, 0
+		}
+		current = append(current, part)
+		size += n
+	}
+	if len(current) > 0 || len(chunks) == 0 {
+		chunks = append(chunks, strings.Join(current, "\n\n"))
+	}
+	return chunks
+}
+
+// pair joins summaries two by two.
+func pair(summaries []string) []string {
+	chunks := make([]string, 0, (len(summaries)+1)/2)
+	for i := 0; i < len(summaries); i += 2 {
+		if i+1 < len(summaries) {
+			chunks = append(chunks, summaries[i]+"\n\n"+summaries[i+1])
+		} else {
+			chunks = append(chunks, summaries[i])
+		}
+	}
+	return chunks
+}
+
+func (s *Summarizer) count(text string) int {
+	return tokens.Estimate(s.model, text)
+}
@@ -0,0 +1,213 @@
+// Package textsplit cuts documents into chunks of bounded size for
+// embedding, retrieval and summarization.
+package textsplit
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alexisbouchez/ai/tokens"
+)
+
+var defaultSeparators = []string{"\n\n", "\n", ". ", " ", ""}
+
+// Splitter packs a text into chunks of at most size units, as measured by
+// its length function, with consecutive chunks sharing up to overlap units.
+// Text is first broken at the coarsest separator that yields small enough
+// pieces; the empty separator breaks between characters.
+type Splitter struct {
+	size       int
+	overlap    int
+	length     func(string) int
+	separators []string
+	// segment cuts text into parts that never share a chunk
+	segment func(string) []string
+	// units cuts text into the smallest parts worth keeping whole
+	units func(string) []string
+}
+
+// Recursive splits by characters at paragraphs, then lines, sentences and
+// words.
+func Recursive(size, overlap int) *Splitter {
+	return &Splitter{
+		size:       size,
+		overlap:    overlap,
+		length:     utf8.RuneCountInString,
+		separators: defaultSeparators,
+	}
+}
+
+// Tokens is Recursive measured in tokens of model.
+func Tokens(model string, size, overlap int) *Splitter {
+	return Recursive(size, overlap).Length(func(text string) int {
+		return tokens.Estimate(model, text)
+	})
+}
+
+// Sentences keeps sentences whole, only cutting those longer than size.
+func Sentences(size, overlap int) *Splitter {
+	s := Recursive(size, overlap)
+	s.units = sentences
+	s.separators = []string{" ", ""}
+	return s
+}
+
+// Markdown starts a new chunk at every heading, so sections are never
+// merged with the end of the previous one, and keeps fenced code blocks
+// together when they fit.
+func Markdown(size, overlap int) *Splitter {
+	s := Recursive(size, overlap)
+	s.segment = sections
+	s.separators = []string{"\n```", "\n\n", "\n", " ", ""}
+	return s
+}
+
+// Length replaces the function measuring chunk size.
+func (s *Splitter) Length(fn func(string) int) *Splitter {
+	s.length = fn
+	return s
+}
+
+// Separators replaces the separators tried, coarsest first.
+func (s *Splitter) Separators(separators ...string) *Splitter {
+	s.separators = separators
+	return s
+}
+
+// Split returns the chunks of text, trimmed of surrounding whitespace.
+func (s *Splitter) Split(text string) []string {
+	segments := []string{text}
+	if s.segment != nil {
+		segments = s.segment(text)
+	}
+
+	var chunks []string
+	for _, segment := range segments {
+		units := []string{segment}
+		if s.units != nil {
+			units = s.units(segment)
+		}
+
+		var pieces []string
+		for _, unit := range units {
+			pieces = append(pieces, s.pieces(unit, s.separators)...)
+		}
+		chunks = append(chunks, s.merge(pieces)...)
+	}
+	return chunks
+}
+
+// pieces breaks text into parts no longer than size. Separators stay at the
+// start of the part that follows them.
+func (s *Splitter) pieces(text string, separators []string) []string {
+	if s.length(text) <= s.size {
+		return []string{text}
+	}
+
+	for i, sep := range separators {
+		if sep == "" {
+			return s.runes(text)
+		}
+		if !strings.Contains(text, sep) {
+			continue
+		}
+
+		var out []string
+		for j, part := range strings.Split(text, sep) {
+			if j > 0 {
+				part = sep + part
+			}
+			if part != "" {
+				out = append(out, s.pieces(part, separators[i+1:])...)
+			}
+		}
+		return out
+	}
+	return []string{text}
+}
+
+// runes cuts text between characters.
+func (s *Splitter) runes(text string) []string {
+	var out []string
+	start := 0
+	for i, r := range text {
+		if i > start && s.length(text[start:i+utf8.RuneLen(r)]) > s.size {
+			out = append(out, text[start:i])
+			start = i
+		}
+	}
+	return append(out, text[start:])
+}
+
+// merge packs consecutive pieces into chunks, starting every chunk with the
+// trailing pieces of the previous one that fit in the overlap.
+func (s *Splitter) merge(pieces []string) []string {
+	var chunks []string
+	var window []string
+	size := 0
+
+	flush := func() {
+		if chunk := strings.TrimSpace(strings.Join(window, "")); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	for _, piece := range pieces {
+		n := s.length(piece)
+		if len(window) > 0 && size+n > s.size {
+			flush()
+			for len(window) > 0 && (size > s.overlap || size+n > s.size) {
+				size -= s.length(window[0])
+				window = window[1:]
+			}
+		}
+		window = append(window, piece)
+		size += n
+	}
+	flush()
+	return chunks
+}
+
+// sentences splits after sentence-ending punctuation followed by a space.
+func sentences(text string) []string {
+	var out []string
+	start := 0
+	for i, r := range text {
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+		end := i + utf8.RuneLen(r)
+		if next, _ := utf8.DecodeRuneInString(text[end:]); unicode.IsSpace(next) {
+			out = append(out, text[start:end])
+			start = end
+		}
+	}
+	if start < len(text) {
+		out = append(out, text[start:])
+	}
+	return out
+}
+
+// sections splits before every heading outside fenced code blocks.
+func sections(text string) []string {
+	var out []string
+	var current strings.Builder
+	fenced := false
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			fenced = !fenced
+		}
+		if !fenced && strings.HasPrefix(trimmed, "#") && current.Len() > 0 {
+			out = append(out, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		out = append(out, current.String())
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package tokens
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pre-tokenization patterns of cl100k_base and o200k_base. Go's regexp has
+// no lookahead, so the trailing `\s+(?!\S)` alternative is emulated in
+// split.
+var (
+	cl100kPattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+	o200kPattern  = regexp.MustCompile(`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`)
+)
+
+// BPE is a byte-level byte-pair-encoding tokenizer compatible with tiktoken.
+type BPE struct {
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// NewBPE returns a tokenizer splitting text as cl100k_base does.
+func NewBPE(ranks map[string]int) *BPE {
+	return &BPE{ranks: ranks, pattern: cl100kPattern}
+}
+
+// LoadTiktoken reads a vocabulary in the .tiktoken format published for
+// OpenAI encodings: one base64 token and its rank per line.
+func LoadTiktoken(r io.Reader) (*BPE, error) {
+	ranks := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		token, rank, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid tiktoken line: %q", line)
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tiktoken token %q: %w", token, err)
+		}
+
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tiktoken rank %q: %w", rank, err)
+		}
+
+		ranks[string(decoded)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tiktoken data: %w", err)
+	}
+
+	return NewBPE(ranks), nil
+}
+
+func (b *BPE) Count(text string) int {
+	var n int
+	for _, piece := range split(b.pattern, text) {
+		if _, ok := b.ranks[piece]; ok {
+			n++
+			continue
+		}
+		n += b.merge(piece)
+	}
+	return n
+}
+
+func (b *BPE) merge(piece string) int {
+	parts := make([]string, len(piece))
+	for i := range piece {
+		parts[i] = piece[i : i+1]
+	}
+
+	for len(parts) > 1 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := b.ranks[parts[i]+parts[i+1]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts)
+}
+
+func split(pattern *regexp.Regexp, text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		loc := pattern.FindStringIndex(text)
+		if loc == nil {
+			pieces = append(pieces, text)
+			break
+		}
+
+		end := loc[1]
+		match := text[:end]
+		if isSpace(match) && end < len(text) {
+			// Leave the last whitespace rune to prefix the following word
+			if _, size := utf8.DecodeLastRuneInString(match); size < len(match) {
+				end -= size
+			}
+		}
+
+		pieces = append(pieces, text[:end])
+		text = text[end:]
+	}
+	return pieces
+}
+
+func isSpace(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
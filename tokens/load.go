@@ -0,0 +1,169 @@
+package tokens
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Loader opens the vocabulary of an encoding, in the .tiktoken format read
+// by LoadTiktoken.
+type Loader func(encoding string) (io.ReadCloser, error)
+
+var (
+	loader Loader = DownloadTiktoken
+
+	// loadMu serializes loads, so that an encoding is read once
+	loadMu sync.Mutex
+	failed = map[string]bool{}
+
+	patterns = map[string]*regexp.Regexp{
+		EncodingCL100K: cl100kPattern,
+		EncodingO200K:  o200kPattern,
+	}
+)
+
+// SetLoader sets the loader the encodings of known models are read with,
+// the first time ForModel needs one that is not registered. A nil loader
+// leaves these models to Heuristic.
+func SetLoader(l Loader) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	mu.Lock()
+	defer mu.Unlock()
+	loader = l
+	clear(failed)
+}
+
+// LoadEncoding reads the encoding name with the loader and registers it.
+// ForModel calls it on first use, falling back to Heuristic when it fails;
+// call it ahead to pay for the load at startup or to see its error.
+func LoadEncoding(name string) error {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	_, err := load(name)
+	return err
+}
+
+// encoding returns the tokenizer registered under name, loading it first
+// when it is not. A failed load is not tried again.
+func encoding(name string) (Tokenizer, bool) {
+	mu.RLock()
+	t, ok := encodings[name]
+	mu.RUnlock()
+	if ok {
+		return t, true
+	}
+
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	if failed[name] {
+		return nil, false
+	}
+	t, err := load(name)
+	if err != nil {
+		failed[name] = true
+		return nil, false
+	}
+	return t, true
+}
+
+// load must be called with loadMu held.
+func load(name string) (Tokenizer, error) {
+	mu.RLock()
+	t, ok := encodings[name]
+	l := loader
+	mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+	if l == nil {
+		return nil, fmt.Errorf("no loader for encoding %s", name)
+	}
+
+	r, err := l(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encoding %s: %w", name, err)
+	}
+	defer r.Close()
+
+	bpe, err := LoadTiktoken(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encoding %s: %w", name, err)
+	}
+	if pattern, ok := patterns[name]; ok {
+		bpe.pattern = pattern
+	}
+	RegisterEncoding(name, bpe)
+	return bpe, nil
+}
+
+const tiktokenURL = "https://openaipublic.blob.core.windows.net/encodings/"
+
+var downloadClient = &http.Client{Timeout: time.Minute}
+
+// DownloadTiktoken is the default Loader. It downloads the vocabulary of an
+// OpenAI encoding from where tiktoken gets it, and keeps it in the user
+// cache directory so that it is downloaded once.
+func DownloadTiktoken(encoding string) (io.ReadCloser, error) {
+	if !validEncoding.MatchString(encoding) {
+		return nil, fmt.Errorf("invalid encoding name %q", encoding)
+	}
+
+	var path string
+	if dir, err := os.UserCacheDir(); err == nil {
+		path = filepath.Join(dir, "ai", "tiktoken", encoding+".tiktoken")
+		if f, err := os.Open(path); err == nil {
+			return f, nil
+		}
+	}
+
+	resp, err := downloadClient.Get(tiktokenURL + encoding + ".tiktoken")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download vocabulary: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download vocabulary: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download vocabulary: %w", err)
+	}
+
+	// the cache is best effort, the vocabulary is used either way
+	if path != "" {
+		cache(path, data)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+var validEncoding = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// cache writes data to path through a temporary file, so that concurrent
+// processes never read a partial vocabulary.
+func cache(path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tiktoken-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
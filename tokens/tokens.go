@@ -0,0 +1,182 @@
+// Package tokens estimates the number of tokens of text and messages, to
+// budget context windows and rate limits. OpenAI models are counted with
+// their tiktoken encoding, cl100k_base or o200k_base, downloaded on first
+// use by DownloadTiktoken unless another Loader is set. Other models, and
+// OpenAI models when the encoding cannot be loaded, are counted with
+// Heuristic, which can be off by a fair margin. Message counts add an
+// estimate of the framing of every message: leave room when budgeting
+// against hard limits.
+package tokens
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type Tokenizer interface {
+	Count(text string) int
+}
+
+type TokenizerFunc func(text string) int
+
+func (f TokenizerFunc) Count(text string) int {
+	return f(text)
+}
+
+const (
+	EncodingO200K  = "o200k_base"
+	EncodingCL100K = "cl100k_base"
+)
+
+var (
+	mu        sync.RWMutex
+	encodings = map[string]Tokenizer{}
+	models    = map[string]string{
+		"gpt-4o":        EncodingO200K,
+		"gpt-4.1":       EncodingO200K,
+		"gpt-5":         EncodingO200K,
+		"o1":            EncodingO200K,
+		"o3":            EncodingO200K,
+		"o4":            EncodingO200K,
+		"gpt-4":         EncodingCL100K,
+		"gpt-3.5-turbo": EncodingCL100K,
+	}
+)
+
+// RegisterEncoding makes a tokenizer available under an encoding name, e.g.
+// a BPE loaded with LoadTiktoken for "cl100k_base", in place of the one the
+// loader would read.
+func RegisterEncoding(name string, t Tokenizer) {
+	mu.Lock()
+	defer mu.Unlock()
+	encodings[name] = t
+}
+
+// RegisterModel maps a model name prefix to an encoding name.
+func RegisterModel(prefix, encoding string) {
+	mu.Lock()
+	defer mu.Unlock()
+	models[prefix] = encoding
+}
+
+// ForModel returns the tokenizer of the encoding of model, loading the
+// encoding on first use, and falls back to Heuristic when the model is
+// unknown or its encoding cannot be loaded.
+func ForModel(model string) Tokenizer {
+	mu.RLock()
+	name, ok := lookupPrefix(models, model)
+	mu.RUnlock()
+
+	if ok {
+		if t, ok := encoding(name); ok {
+			return t
+		}
+	}
+	return Heuristic
+}
+
+// Estimate returns the number of tokens of text for model.
+func Estimate(model, text string) int {
+	return ForModel(model).Count(text)
+}
+
+// Per-message framing overhead used by OpenAI chat models
+const (
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	tokensPerReply   = 3
+)
+
+// EstimateMessages returns the number of prompt tokens of messages for
+// model, including the framing of every message and of the reply.
+func EstimateMessages(model string, messages []provider.Message) int {
+	t := ForModel(model)
+
+	total := tokensPerReply
+	for _, msg := range messages {
+		total += countMessage(t, msg)
+	}
+	return total
+}
+
+// CountMessages is EstimateMessages.
+func CountMessages(model string, messages []provider.Message) int {
+	return EstimateMessages(model, messages)
+}
+
+func EstimateMessage(model string, msg provider.Message) int {
+	return countMessage(ForModel(model), msg)
+}
+
+func countMessage(t Tokenizer, msg provider.Message) int {
+	n := tokensPerMessage + t.Count(string(msg.Role)) + t.Count(msg.Text())
+	if msg.Name != "" {
+		n += tokensPerName + t.Count(msg.Name)
+	}
+	for _, tc := range msg.ToolCalls {
+		n += t.Count(tc.Function.Name) + t.Count(tc.Function.Arguments)
+	}
+	return n
+}
+
+func EstimateTools(model string, tools []provider.Tool) int {
+	t := ForModel(model)
+
+	var n int
+	for _, tool := range tools {
+		n += t.Count(tool.Function.Name) + t.Count(tool.Function.Description)
+		schema, _ := json.Marshal(tool.Function.Parameters)
+		n += t.Count(string(schema))
+	}
+	return n
+}
+
+// Heuristic approximates BPE tokenizers without a vocabulary: words cost
+// about one token per four characters, and every symbol costs one.
+var Heuristic Tokenizer = TokenizerFunc(heuristicCount)
+
+func heuristicCount(text string) int {
+	var n, word int
+	flush := func() {
+		if word > 0 {
+			n += (word + 3) / 4
+			word = 0
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if r > unicode.MaxLatin1 {
+				// CJK and other scripts are close to one token per rune
+				flush()
+				n++
+				continue
+			}
+			word++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			n++
+		}
+	}
+	flush()
+	return n
+}
+
+func lookupPrefix[V any](table map[string]V, model string) (V, bool) {
+	var best string
+	var value V
+	var found bool
+	for prefix, v := range table {
+		if strings.HasPrefix(model, prefix) && len(prefix) >= len(best) {
+			best, value, found = prefix, v, true
+		}
+	}
+	return value, found
+}
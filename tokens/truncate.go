@@ -0,0 +1,60 @@
+package tokens
+
+import (
+	"slices"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Strategy trims messages so that EstimateMessages(model, result) <= budget.
+type Strategy func(model string, messages []provider.Message, budget int) []provider.Message
+
+// Truncate trims messages to fit the context window of model, leaving
+// reserve tokens for the completion.
+func Truncate(model string, messages []provider.Message, reserve int, strategy Strategy) []provider.Message {
+	budget := ContextWindow(model) - reserve
+	if EstimateMessages(model, messages) <= budget {
+		return messages
+	}
+	return strategy(model, messages, budget)
+}
+
+// TruncateRequest applies Truncate to req.Messages, reserving req.MaxTokens
+// for the completion.
+func TruncateRequest(req *provider.ChatRequest, model string, strategy Strategy) {
+	var reserve int
+	if req.MaxTokens != nil {
+		reserve = *req.MaxTokens
+	}
+	req.Messages = Truncate(model, req.Messages, reserve, strategy)
+}
+
+// DropOldest removes the oldest non-system messages until the rest fit.
+// System messages are kept in place, and tool results are dropped together
+// with the assistant turn that requested them so the remaining history
+// stays valid.
+var DropOldest Strategy = func(model string, messages []provider.Message, budget int) []provider.Message {
+	kept := slices.Clone(messages)
+	for EstimateMessages(model, kept) > budget {
+		first := nextTurn(kept, 0)
+		if first < 0 {
+			break
+		}
+		kept = slices.Delete(kept, first, first+1)
+		for i := nextTurn(kept, first); i >= 0 && kept[i].Role == provider.RoleTool; i = nextTurn(kept, first) {
+			kept = slices.Delete(kept, i, i+1)
+		}
+	}
+	return kept
+}
+
+// nextTurn returns the index of the first non-system message from start, or
+// -1 if there is none.
+func nextTurn(messages []provider.Message, start int) int {
+	for i := start; i < len(messages); i++ {
+		if messages[i].Role != provider.RoleSystem {
+			return i
+		}
+	}
+	return -1
+}
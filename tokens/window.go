@@ -0,0 +1,47 @@
+package tokens
+
+const DefaultContextWindow = 8192
+
+var contextWindows = map[string]int{
+	"gpt-5":             400000,
+	"gpt-4.1":           1047576,
+	"gpt-4o":            128000,
+	"gpt-4-turbo":       128000,
+	"gpt-4":             8192,
+	"gpt-3.5-turbo":     16385,
+	"o1":                200000,
+	"o3":                200000,
+	"o4":                200000,
+	"claude":            200000,
+	"mistral-large":     131072,
+	"mistral-medium":    131072,
+	"mistral-small":     32768,
+	"codestral":         262144,
+	"open-mistral-nemo": 131072,
+	"ministral":         131072,
+	"llama3.1":          131072,
+	"llama3.2":          131072,
+	"llama3.3":          131072,
+	"qwen2.5":           32768,
+	"gemma3":            131072,
+	"gemini":            1048576,
+}
+
+// ContextWindow returns the maximum number of tokens (prompt and completion)
+// supported by model.
+func ContextWindow(model string) int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if n, ok := lookupPrefix(contextWindows, model); ok {
+		return n
+	}
+	return DefaultContextWindow
+}
+
+// SetContextWindow overrides the context window for a model name prefix.
+func SetContextWindow(prefix string, tokens int) {
+	mu.Lock()
+	defer mu.Unlock()
+	contextWindows[prefix] = tokens
+}
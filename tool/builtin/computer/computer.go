@@ -0,0 +1,156 @@
+// Package computer provides the computer use tools of Anthropic: a screen,
+// keyboard and mouse, a file editor and a shell. The model knows how to use
+// them, and the application executes their calls with a Controller, an
+// Editor and a Shell. Run them in a sandboxed VM or container.
+package computer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tool"
+)
+
+// Display is the screen the model controls. Screenshots should be of this
+// size, and coordinates are given in it.
+type Display struct {
+	Width  int
+	Height int
+	// Number is the X11 display number, zero when irrelevant
+	Number int
+}
+
+// Action is an action of the model on the computer, such as "screenshot",
+// "left_click", "type", "key", "mouse_move", "scroll" or "wait".
+type Action struct {
+	Action string `json:"action"`
+	// Coordinate is the [x, y] position of pointer actions
+	Coordinate []int `json:"coordinate,omitempty"`
+	// StartCoordinate is where left_click_drag starts
+	StartCoordinate []int  `json:"start_coordinate,omitempty"`
+	Text            string `json:"text,omitempty"`
+	ScrollDirection string `json:"scroll_direction,omitempty"`
+	ScrollAmount    int    `json:"scroll_amount,omitempty"`
+	// Duration is in seconds, for hold_key and wait
+	Duration float64 `json:"duration,omitempty"`
+	// Key is held down during clicks and scrolls
+	Key string `json:"key,omitempty"`
+}
+
+// Result is the outcome of an action. Screenshot, a PNG image, is required
+// for screenshot actions and helps the model after any other.
+type Result struct {
+	Output     string
+	Screenshot []byte
+}
+
+type Controller interface {
+	Do(ctx context.Context, action Action) (*Result, error)
+}
+
+// EditorCommand is a command of the model on the file editor: "view",
+// "create", "str_replace", "insert" or "undo_edit".
+type EditorCommand struct {
+	Command  string `json:"command"`
+	Path     string `json:"path"`
+	FileText string `json:"file_text,omitempty"`
+	OldStr   string `json:"old_str,omitempty"`
+	NewStr   string `json:"new_str,omitempty"`
+	// InsertLine is the line after which insert adds NewStr
+	InsertLine *int `json:"insert_line,omitempty"`
+	// ViewRange is the [first, last] lines shown by view, last being -1
+	// for the end of the file
+	ViewRange []int `json:"view_range,omitempty"`
+}
+
+type Editor interface {
+	// Edit runs cmd and returns the output shown to the model, such as the
+	// viewed file or a snippet around an edit.
+	Edit(ctx context.Context, cmd EditorCommand) (string, error)
+}
+
+type Shell interface {
+	// Run runs command in a persistent shell session and returns its
+	// output.
+	Run(ctx context.Context, command string) (string, error)
+	// Restart starts a new session.
+	Restart(ctx context.Context) error
+}
+
+// Computer returns the "computer" tool, controlling display with c.
+func Computer(display Display, c Controller) *tool.Tool {
+	options := map[string]any{
+		"display_width_px":  display.Width,
+		"display_height_px": display.Height,
+	}
+	if display.Number != 0 {
+		options["display_number"] = display.Number
+	}
+
+	return tool.New("computer").
+		Builtin(provider.ToolComputer, options).
+		ExecuteParts(func(ctx context.Context, args tool.Args) ([]provider.Part, error) {
+			var action Action
+			if err := decode(args, &action); err != nil {
+				return nil, err
+			}
+			result, err := c.Do(ctx, action)
+			if err != nil {
+				return nil, err
+			}
+
+			var parts []provider.Part
+			if result.Output != "" {
+				parts = append(parts, provider.TextPart(result.Output))
+			}
+			if len(result.Screenshot) > 0 {
+				parts = append(parts, provider.ImagePart(result.Screenshot, "image/png"))
+			}
+			if len(parts) == 0 {
+				parts = append(parts, provider.TextPart("done"))
+			}
+			return parts, nil
+		})
+}
+
+// TextEditor returns the "str_replace_editor" tool, viewing and editing
+// files with e.
+func TextEditor(e Editor) *tool.Tool {
+	return tool.New("str_replace_editor").
+		Builtin(provider.ToolTextEditor, nil).
+		Execute(func(ctx context.Context, args tool.Args) (string, error) {
+			var cmd EditorCommand
+			if err := decode(args, &cmd); err != nil {
+				return "", err
+			}
+			return e.Edit(ctx, cmd)
+		})
+}
+
+// Bash returns the "bash" tool, running commands with s.
+func Bash(s Shell) *tool.Tool {
+	return tool.New("bash").
+		Builtin(provider.ToolBash, nil).
+		Execute(func(ctx context.Context, args tool.Args) (string, error) {
+			if args.Bool("restart") {
+				if err := s.Restart(ctx); err != nil {
+					return "", err
+				}
+				return "shell restarted", nil
+			}
+			return s.Run(ctx, args.String("command"))
+		})
+}
+
+func decode(args tool.Args, v any) error {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Errorf("failed to encode arguments: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// Package runcode provides a tool executing model-generated Python or Go in
+// a constrained subprocess.
+package runcode
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tool"
+)
+
+type Language string
+
+const (
+	Python Language = "python"
+	Go     Language = "go"
+)
+
+const (
+	defaultTimeout   = 30 * time.Second
+	defaultMemory    = 512 << 20
+	defaultFileSize  = 64 << 20
+	defaultMaxOutput = 64 << 10
+)
+
+// Output is the result of a run. Stdout and Stderr are truncated to the
+// output limit.
+type Output struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+}
+
+// Runner executes code in a fresh temporary directory, with resource limits
+// and without network access unless allowed. It is a guard against runaway
+// code, not a security boundary against hostile code: run it in a container
+// or VM for that.
+type Runner struct {
+	timeout   time.Duration
+	memory    int64
+	fileSize  int64
+	maxOutput int
+	network   bool
+	python    string
+	goBin     string
+}
+
+func New() *Runner {
+	return &Runner{
+		timeout:   defaultTimeout,
+		memory:    defaultMemory,
+		fileSize:  defaultFileSize,
+		maxOutput: defaultMaxOutput,
+		python:    "python3",
+		goBin:     "go",
+	}
+}
+
+// Timeout bounds the wall-clock time of a run, including Go compilation.
+// CPU time is limited to the same duration.
+func (r *Runner) Timeout(d time.Duration) *Runner {
+	r.timeout = d
+	return r
+}
+
+// MemoryLimit bounds the data segment and writable mappings of the
+// program in bytes.
+func (r *Runner) MemoryLimit(bytes int64) *Runner {
+	r.memory = bytes
+	return r
+}
+
+// FileSizeLimit bounds the size of files the program writes in bytes.
+func (r *Runner) FileSizeLimit(bytes int64) *Runner {
+	r.fileSize = bytes
+	return r
+}
+
+// MaxOutput bounds the bytes kept from stdout and stderr each.
+func (r *Runner) MaxOutput(n int) *Runner {
+	r.maxOutput = n
+	return r
+}
+
+// AllowNetwork gives programs network access.
+func (r *Runner) AllowNetwork() *Runner {
+	r.network = true
+	return r
+}
+
+// Python sets the Python interpreter, python3 by default.
+func (r *Runner) Python(path string) *Runner {
+	r.python = path
+	return r
+}
+
+// GoBinary sets the go command used to compile Go programs.
+func (r *Runner) GoBinary(path string) *Runner {
+	r.goBin = path
+	return r
+}
+
+// Run executes code. A program failing or timing out is reported in
+// Output; errors are reserved for failures to run it at all.
+func (r *Runner) Run(ctx context.Context, lang Language, code string) (*Output, error) {
+	dir, err := os.MkdirTemp("", "runcode-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	switch lang {
+	case Python:
+		if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte(code), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write program: %w", err)
+		}
+		return r.exec(ctx, dir, true, r.python, "-I", "main.py")
+
+	case Go:
+		if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(code), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write program: %w", err)
+		}
+		// The toolchain needs more memory than the program, so only the
+		// program runs under the memory limit
+		out, err := r.exec(ctx, dir, false, r.goBin, "build", "-o", "main", "main.go")
+		if err != nil || out.ExitCode != 0 || out.TimedOut {
+			return out, err
+		}
+		return r.exec(ctx, dir, true, "./main")
+
+	default:
+		return nil, fmt.Errorf("unsupported language %q", lang)
+	}
+}
+
+func (r *Runner) exec(ctx context.Context, dir string, limitMemory bool, name string, args ...string) (*Output, error) {
+	// POSIX shells such as dash take a single limit per ulimit call
+	limits := fmt.Sprintf("ulimit -t %d && ulimit -f %d", max(int(r.timeout.Seconds()), 1), r.fileSize/512)
+	if limitMemory {
+		limits += fmt.Sprintf(" && ulimit -d %d", r.memory/1024)
+	}
+	cmd := exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", limits + ` && exec "$@"`, "sh", name}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = r.env(dir)
+
+	stdout := &limitedBuffer{max: r.maxOutput}
+	stderr := &limitedBuffer{max: r.maxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := sandbox(cmd, r.network); err != nil {
+		return nil, err
+	}
+
+	err := cmd.Run()
+	out := &Output{Stdout: stdout.String(), Stderr: stderr.String()}
+	if ctx.Err() == context.DeadlineExceeded {
+		out.TimedOut = true
+		out.ExitCode = -1
+		return out, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		out.ExitCode = exitErr.ExitCode()
+		return out, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", name, err)
+	}
+	return out, nil
+}
+
+func (r *Runner) env(dir string) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"LANG=C.UTF-8",
+		"GOTOOLCHAIN=local",
+		"GOFLAGS=",
+	}
+	// Share the build cache so that the standard library is not rebuilt on
+	// every run
+	if cache, err := os.UserCacheDir(); err == nil {
+		env = append(env, "GOCACHE="+filepath.Join(cache, "go-build"))
+	}
+	return env
+}
+
+// Tool returns a "run_code" tool executing code with r.
+func (r *Runner) Tool() *tool.Tool {
+	return tool.New("run_code").
+		Description("Run a Python or Go program and return its exit code, stdout and stderr. Print the results you need. Go programs must be a main package. Runs are limited to "+r.timeout.String()+".").
+		Input(
+			tool.Param("language").Enum(string(Python), string(Go)).Required(),
+			tool.Param("code").String().Required().Desc("Complete program source"),
+		).
+		ExecuteParts(func(ctx context.Context, args tool.Args) ([]provider.Part, error) {
+			out, err := r.Run(ctx, Language(args.String("language")), args.String("code"))
+			if err != nil {
+				return nil, err
+			}
+			part, err := provider.JSONPart(out)
+			if err != nil {
+				return nil, err
+			}
+			return []provider.Part{part}, nil
+		})
+}
+
+// limitedBuffer keeps the first max bytes written to it.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.buf.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[truncated after " + strconv.Itoa(b.max) + " bytes]"
+	}
+	return b.buf.String()
+}
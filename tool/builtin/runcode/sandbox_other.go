@@ -0,0 +1,12 @@
+//go:build !unix
+
+package runcode
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func sandbox(cmd *exec.Cmd, network bool) error {
+	return errors.New("run_code is only supported on Unix systems")
+}
@@ -0,0 +1,22 @@
+//go:build unix && !linux
+
+package runcode
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// sandbox runs cmd in its own process group, killed as a whole on timeout.
+// Network isolation is only implemented on Linux.
+func sandbox(cmd *exec.Cmd, network bool) error {
+	if !network {
+		return errors.New("network isolation requires Linux, use AllowNetwork to run without it")
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return nil
+}
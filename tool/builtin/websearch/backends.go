@@ -0,0 +1,163 @@
+package websearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func do(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("search API error (status %d): %s", resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// Brave searches with the Brave Search API.
+type Brave struct {
+	apiKey string
+	client *http.Client
+}
+
+func NewBrave(apiKey string) *Brave {
+	return &Brave{apiKey: apiKey, client: http.DefaultClient}
+}
+
+func (b *Brave) HTTPClient(client *http.Client) *Brave {
+	b.client = client
+	return b
+}
+
+func (b *Brave) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	params := url.Values{"q": {query}, "count": {strconv.Itoa(count)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.search.brave.com/res/v1/web/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Subscription-Token", b.apiKey)
+
+	var resp struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := do(b.client, req, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(resp.Web.Results))
+	for i, r := range resp.Web.Results {
+		results[i] = Result{Title: r.Title, URL: r.URL, Snippet: r.Description}
+	}
+	return results, nil
+}
+
+// Tavily searches with the Tavily API.
+type Tavily struct {
+	apiKey string
+	client *http.Client
+}
+
+func NewTavily(apiKey string) *Tavily {
+	return &Tavily{apiKey: apiKey, client: http.DefaultClient}
+}
+
+func (t *Tavily) HTTPClient(client *http.Client) *Tavily {
+	t.client = client
+	return t
+}
+
+func (t *Tavily) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	body, err := json.Marshal(map[string]any{"query": query, "max_results": count})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.tavily.com/search", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+
+	var resp struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := do(t.client, req, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(resp.Results))
+	for i, r := range resp.Results {
+		results[i] = Result{Title: r.Title, URL: r.URL, Snippet: r.Content}
+	}
+	return results, nil
+}
+
+// SearxNG searches with a SearxNG instance. The instance must have the
+// json format enabled.
+type SearxNG struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewSearxNG(baseURL string) *SearxNG {
+	return &SearxNG{baseURL: strings.TrimSuffix(baseURL, "/"), client: http.DefaultClient}
+}
+
+func (s *SearxNG) HTTPClient(client *http.Client) *SearxNG {
+	s.client = client
+	return s
+}
+
+func (s *SearxNG) Search(ctx context.Context, query string, count int) ([]Result, error) {
+	params := url.Values{"q": {query}, "format": {"json"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	var resp struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := do(s.client, req, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, min(count, len(resp.Results)))
+	for _, r := range resp.Results[:min(count, len(resp.Results))] {
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return results, nil
+}
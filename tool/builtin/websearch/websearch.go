@@ -0,0 +1,70 @@
+// Package websearch provides a web search tool backed by a search API, and
+// the web search tool hosted by providers that have one.
+package websearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/tool"
+)
+
+const (
+	defaultCount = 5
+	maxCount     = 20
+)
+
+// Result is a normalized search result.
+type Result struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet"`
+}
+
+type Backend interface {
+	Search(ctx context.Context, query string, count int) ([]Result, error)
+}
+
+// New returns a "search_web" tool running queries on b. Results are
+// returned to the model as JSON.
+func New(b Backend) *tool.Tool {
+	return tool.New("search_web").
+		Description("Search the web. Returns the title, URL and a snippet of the top results.").
+		Input(
+			tool.Param("query").String().Required().Desc("Search query"),
+			tool.Param("count").Integer().Desc(fmt.Sprintf("Number of results, at most %d", maxCount)),
+		).
+		ExecuteParts(func(ctx context.Context, args tool.Args) ([]provider.Part, error) {
+			query := args.String("query")
+			if query == "" {
+				return nil, errors.New("query is required")
+			}
+			count := args.Int("count")
+			if count <= 0 {
+				count = defaultCount
+			}
+
+			results, err := b.Search(ctx, query, min(count, maxCount))
+			if err != nil {
+				return nil, fmt.Errorf("failed to search: %w", err)
+			}
+			if results == nil {
+				results = []Result{}
+			}
+			part, err := provider.JSONPart(results)
+			if err != nil {
+				return nil, err
+			}
+			return []provider.Part{part}, nil
+		})
+}
+
+// Native returns the web search tool hosted by the provider: web_search
+// on Anthropic, Google Search grounding on Vertex AI and web_search_options
+// on OpenAI search models. options are passed as is, such as max_uses for
+// Anthropic.
+func Native(options map[string]any) provider.Tool {
+	return provider.Tool{Type: provider.ToolWebSearch, Options: options}
+}
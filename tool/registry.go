@@ -0,0 +1,68 @@
+package tool
+
+import (
+	"sync"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// Registry is a set of tools looked up by name. It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	tools []*Tool
+}
+
+func NewRegistry(tools ...*Tool) *Registry {
+	r := &Registry{}
+	r.Register(tools...)
+	return r
+}
+
+// Register adds tools, replacing any registered tool with the same name.
+func (r *Registry) Register(tools ...*Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range tools {
+		if i := r.index(t.name); i >= 0 {
+			r.tools[i] = t
+		} else {
+			r.tools = append(r.tools, t)
+		}
+	}
+}
+
+func (r *Registry) Get(name string) (*Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i := r.index(name); i >= 0 {
+		return r.tools[i], true
+	}
+	return nil, false
+}
+
+func (r *Registry) Tools() []*Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Tool(nil), r.tools...)
+}
+
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.tools)
+}
+
+func (r *Registry) ToProvider() []provider.Tool {
+	return ToProviderTools(r.Tools()...)
+}
+
+func (r *Registry) index(name string) int {
+	for i, t := range r.tools {
+		if t.name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,208 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/alexisbouchez/ai/provider"
+)
+
+// ArgumentsError reports tool arguments that are not valid JSON or do not
+// match the parameter schema.
+type ArgumentsError struct {
+	Arguments string
+	Err       error
+}
+
+func (e *ArgumentsError) Error() string {
+	return fmt.Sprintf("invalid arguments: %v", e.Err)
+}
+
+func (e *ArgumentsError) Unwrap() error {
+	return e.Err
+}
+
+// RepairJSON fixes common defects of model-generated JSON: code fences,
+// comments, trailing commas, single-quoted strings, unquoted keys, Python
+// literals and unterminated strings, arrays or objects.
+func RepairJSON(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	s = strings.TrimSpace(s)
+
+	if start := strings.IndexAny(s, "{["); start > 0 {
+		s = s[start:]
+	}
+
+	var out strings.Builder
+	var stack []byte
+	r := []rune(s)
+
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+		switch {
+		case c == '"' || c == '\'':
+			end := writeString(&out, r, i)
+			i = end
+
+		case c == '/' && i+1 < len(r) && r[i+1] == '/':
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < len(r) && r[i+1] == '*':
+			i += 2
+			for i+1 < len(r) && !(r[i] == '*' && r[i+1] == '/') {
+				i++
+			}
+			i++
+
+		case c == '{' || c == '[':
+			stack = append(stack, byte(c))
+			out.WriteRune(c)
+
+		case c == '}' || c == ']':
+			trimTrailingComma(&out)
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			out.WriteRune(c)
+
+		case unicode.IsLetter(c) || c == '_' || c == '$':
+			j := i
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_' || r[j] == '$' || r[j] == '-') {
+				j++
+			}
+			word := string(r[i:j])
+			i = j - 1
+
+			if isKey(r, j) {
+				out.WriteString(quote(word))
+				continue
+			}
+			switch word {
+			case "true", "false", "null":
+				out.WriteString(word)
+			case "True":
+				out.WriteString("true")
+			case "False":
+				out.WriteString("false")
+			case "None", "undefined", "nil":
+				out.WriteString("null")
+			default:
+				out.WriteString(quote(word))
+			}
+
+		default:
+			out.WriteRune(c)
+		}
+	}
+
+	trimTrailingComma(&out)
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == '{' {
+			out.WriteByte('}')
+		} else {
+			out.WriteByte(']')
+		}
+	}
+
+	repaired := out.String()
+	if !json.Valid([]byte(repaired)) {
+		return "", fmt.Errorf("unable to repair JSON")
+	}
+	return repaired, nil
+}
+
+// writeString copies the string starting at r[start] as a double-quoted JSON
+// string and returns the index of its closing quote.
+func writeString(out *strings.Builder, r []rune, start int) int {
+	q := r[start]
+	out.WriteByte('"')
+
+	i := start + 1
+	for ; i < len(r); i++ {
+		c := r[i]
+		switch {
+		case c == '\\' && i+1 < len(r):
+			if r[i+1] == '\'' {
+				out.WriteRune('\'')
+			} else {
+				out.WriteRune(c)
+				out.WriteRune(r[i+1])
+			}
+			i++
+		case c == q:
+			out.WriteByte('"')
+			return i
+		case c == '"':
+			out.WriteString(`\"`)
+		case c == '\n':
+			out.WriteString(`\n`)
+		default:
+			out.WriteRune(c)
+		}
+	}
+
+	out.WriteByte('"')
+	return i
+}
+
+func isKey(r []rune, i int) bool {
+	for ; i < len(r); i++ {
+		if !unicode.IsSpace(r[i]) {
+			return r[i] == ':'
+		}
+	}
+	return false
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func trimTrailingComma(out *strings.Builder) {
+	s := strings.TrimRightFunc(out.String(), unicode.IsSpace)
+	if strings.HasSuffix(s, ",") {
+		out.Reset()
+		out.WriteString(strings.TrimSuffix(s, ","))
+	}
+}
+
+const repairPrompt = `The arguments for the tool %q are not valid JSON (%v). The tool expects this JSON schema:
+
+%s
+
+Reply with the corrected arguments as a single JSON object and nothing else.
+
+Invalid arguments:
+%s`
+
+// RepairWithModel asks p to rewrite invalid arguments for t. The result is
+// checked with RepairJSON before it is returned.
+func RepairWithModel(ctx context.Context, p provider.Provider, t *Tool, argsJSON string, parseErr error) (string, error) {
+	schema, _ := json.MarshalIndent(t.ToProvider().Function.Parameters, "", "  ")
+	temperature := 0.0
+
+	resp, err := p.Chat(ctx, &provider.ChatRequest{
+		Messages: []provider.Message{{
+			Role:    provider.RoleUser,
+			Content: fmt.Sprintf(repairPrompt, t.name, parseErr, schema, argsJSON),
+		}},
+		Temperature: &temperature,
+	})
+	if err != nil {
+		return "", fmt.Errorf("repair request failed: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("repair request returned no choices")
+	}
+
+	return RepairJSON(resp.Choices[0].Message.Content)
+}
@@ -0,0 +1,140 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alexisbouchez/ai/internal/logging"
+	"github.com/alexisbouchez/ai/provider"
+)
+
+type RunOptions struct {
+	// Concurrency bounds the number of tools running at once. Zero runs all
+	// calls in parallel.
+	Concurrency int
+	// Timeout applies to tools without their own timeout. Zero means none.
+	Timeout time.Duration
+	// Repair, when set, is asked once to fix arguments that fail to parse.
+	Repair provider.Provider
+	// OnStart and OnEnd, when set, are called around every call. They may
+	// be called concurrently.
+	OnStart func(ctx context.Context, call provider.ToolCall)
+	OnEnd   func(ctx context.Context, call provider.ToolCall, result provider.Message, err error)
+}
+
+type CallError struct {
+	Call provider.ToolCall
+	Err  error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("tool %q (call %s): %v", e.Call.Function.Name, e.Call.ID, e.Err)
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+// RunAll executes calls concurrently and returns one tool message per call,
+// in the order of calls. Failed calls produce an error message for the model
+// and are also reported in the returned error, which joins a CallError for
+// every failure.
+func RunAll(ctx context.Context, registry *Registry, calls []provider.ToolCall, opts RunOptions) ([]provider.Message, error) {
+	messages := make([]provider.Message, len(calls))
+	errs := make([]error, len(calls))
+
+	workers := opts.Concurrency
+	if workers <= 0 || workers > len(calls) {
+		workers = len(calls)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if opts.OnStart != nil {
+					opts.OnStart(ctx, calls[i])
+				}
+				start := time.Now()
+				messages[i], errs[i] = runCall(ctx, registry, calls[i], opts)
+				logCall(ctx, calls[i], time.Since(start), errs[i])
+				if opts.OnEnd != nil {
+					opts.OnEnd(ctx, calls[i], messages[i], errs[i])
+				}
+			}
+		}()
+	}
+
+	for i := range calls {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return messages, errors.Join(errs...)
+}
+
+func logCall(ctx context.Context, call provider.ToolCall, duration time.Duration, err error) {
+	log := logging.For(logging.Tool)
+	attrs := []any{"tool", call.Function.Name, "call_id", call.ID, "duration", duration}
+	if err != nil {
+		log.WarnContext(ctx, "tool call failed", append(attrs, "error", err)...)
+		return
+	}
+	log.DebugContext(ctx, "tool called", attrs...)
+}
+
+func runCall(ctx context.Context, registry *Registry, call provider.ToolCall, opts RunOptions) (provider.Message, error) {
+	msg := provider.Message{
+		Role:       provider.RoleTool,
+		ToolCallID: call.ID,
+		Name:       call.Function.Name,
+	}
+
+	parts, err := runWithTimeout(ctx, registry, call, opts)
+	if err != nil {
+		msg.Content = fmt.Sprintf("error: %v", err)
+		return msg, &CallError{Call: call, Err: err}
+	}
+	if len(parts) == 1 && parts[0].Type == provider.PartText {
+		msg.Content = parts[0].Text
+	} else {
+		msg.Parts = parts
+	}
+	return msg, nil
+}
+
+func runWithTimeout(ctx context.Context, registry *Registry, call provider.ToolCall, opts RunOptions) ([]provider.Part, error) {
+	t, ok := registry.Get(call.Function.Name)
+	if !ok {
+		return nil, fmt.Errorf("unknown tool %q", call.Function.Name)
+	}
+
+	timeout := opts.Timeout
+	if t.timeout > 0 {
+		timeout = t.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	result, err := t.RunParts(ctx, call.Function.Arguments)
+
+	var argsErr *ArgumentsError
+	if opts.Repair != nil && errors.As(err, &argsErr) {
+		repaired, repairErr := RepairWithModel(ctx, opts.Repair, t, call.Function.Arguments, argsErr.Err)
+		if repairErr != nil {
+			return nil, err
+		}
+		return t.RunParts(ctx, repaired)
+	}
+	return result, err
+}
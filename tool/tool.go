@@ -3,24 +3,65 @@ package tool
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/schema"
 )
 
 type Handler func(ctx context.Context, args Args) (string, error)
 
+// PartsHandler returns a structured result, such as JSON, images or several
+// blocks of text.
+type PartsHandler func(ctx context.Context, args Args) ([]provider.Part, error)
+
+// ValueHandler returns a result of any type. Strings are returned as they
+// are and other values are encoded as JSON.
+type ValueHandler func(ctx context.Context, args Args) (any, error)
+
 type Tool struct {
 	name        string
 	description string
 	params      []*ParamBuilder
+	schema      map[string]any
 	handler     Handler
+	parts       PartsHandler
+	timeout     time.Duration
+	lenient     bool
+	builtin     string
+	options     map[string]any
+	run         func(ctx context.Context, argsJSON string) (string, error)
+
+	// mu guards validator, compiled on first use
+	mu        sync.Mutex
+	validator *schema.Schema
 }
 
 func New(name string) *Tool {
 	return &Tool{name: name}
 }
 
+// NewTyped creates a tool whose arguments are decoded into T. The parameter
+// schema is derived from T with SchemaOf.
+func NewTyped[T any](name string, fn func(ctx context.Context, args T) (string, error)) *Tool {
+	t := &Tool{
+		name:   name,
+		schema: SchemaOf[T](),
+	}
+	t.run = func(ctx context.Context, argsJSON string) (string, error) {
+		var args T
+		if err := t.decode(argsJSON, &args); err != nil {
+			return "", err
+		}
+		return fn(ctx, args)
+	}
+	return t
+}
+
 func (t *Tool) Description(desc string) *Tool {
 	t.description = desc
 	return t
@@ -28,54 +69,265 @@ func (t *Tool) Description(desc string) *Tool {
 
 func (t *Tool) Input(params ...*ParamBuilder) *Tool {
 	t.params = params
+	t.resetValidator()
+	return t
+}
+
+// InputSchema sets the JSON schema of the arguments, for parameters Input
+// cannot describe such as nested objects, arrays of objects or oneOf. It
+// replaces the parameters set with Input.
+func (t *Tool) InputSchema(schema map[string]any) *Tool {
+	t.schema = schema
+	t.resetValidator()
 	return t
 }
 
+// InputSchemaJSON is InputSchema with the schema given as JSON. It panics
+// if schema is not a JSON object.
+func (t *Tool) InputSchemaJSON(schema []byte) *Tool {
+	var parsed map[string]any
+	if err := json.Unmarshal(schema, &parsed); err != nil || parsed == nil {
+		panic(fmt.Sprintf("tool %q: input schema is not a JSON object: %v", t.name, err))
+	}
+	return t.InputSchema(parsed)
+}
+
 func (t *Tool) Execute(h Handler) *Tool {
 	t.handler = h
 	return t
 }
 
+// Execute2 sets a handler whose result is encoded as JSON unless it is a
+// string, so that handlers can return structs, maps or slices directly.
+// Map keys are sorted, so equal results encode identically.
+func (t *Tool) Execute2(h ValueHandler) *Tool {
+	return t.Execute(func(ctx context.Context, args Args) (string, error) {
+		result, err := h(ctx, args)
+		if err != nil {
+			return "", err
+		}
+		return encodeResult(result)
+	})
+}
+
+func encodeResult(result any) (string, error) {
+	switch v := result.(type) {
+	case string:
+		return v, nil
+	case json.RawMessage:
+		return string(v), nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode result: %w", err)
+	}
+	return string(data), nil
+}
+
+// ExecuteParts sets a handler returning a structured result.
+func (t *Tool) ExecuteParts(h PartsHandler) *Tool {
+	t.parts = h
+	return t
+}
+
+// Lenient makes Run repair malformed arguments with RepairJSON instead of
+// failing.
+func (t *Tool) Lenient() *Tool {
+	t.lenient = true
+	return t
+}
+
+// Builtin declares the tool as a tool whose schema the provider defines,
+// of type typ such as provider.ToolComputer, configured with options
+// rather than parameters. Its calls run the handler as usual, with
+// arguments that are not validated.
+func (t *Tool) Builtin(typ string, options map[string]any) *Tool {
+	t.builtin = typ
+	t.options = options
+	return t
+}
+
+// Timeout bounds the run time of the tool when executed with RunAll.
+func (t *Tool) Timeout(d time.Duration) *Tool {
+	t.timeout = d
+	return t
+}
+
 func (t *Tool) Name() string {
 	return t.name
 }
 
+// Run runs the tool and returns its result as text. Structured results are
+// flattened as with provider.Message.Text.
 func (t *Tool) Run(ctx context.Context, argsJSON string) (string, error) {
-	if t.handler == nil {
+	if t.parts != nil {
+		parts, err := t.RunParts(ctx, argsJSON)
+		return provider.Message{Parts: parts}.Text(), err
+	}
+	if t.run == nil && t.handler == nil {
 		return "", fmt.Errorf("no handler defined for tool %q", t.name)
 	}
 
+	if t.run != nil {
+		// typed tools decode the arguments themselves, from the JSON the
+		// model sent, so that numbers keep their precision
+		decoded, err := t.validate(argsJSON)
+		if err != nil {
+			return "", err
+		}
+		return t.run(ctx, decoded)
+	}
+	raw, err := t.arguments(argsJSON)
+	if err != nil {
+		return "", err
+	}
+	return t.handler(ctx, Args(raw))
+}
+
+// RunParts runs the tool and returns its result as parts. Tools with a
+// text result return a single text part.
+func (t *Tool) RunParts(ctx context.Context, argsJSON string) ([]provider.Part, error) {
+	if t.parts == nil {
+		result, err := t.Run(ctx, argsJSON)
+		if err != nil {
+			return nil, err
+		}
+		return []provider.Part{provider.TextPart(result)}, nil
+	}
+
+	raw, err := t.arguments(argsJSON)
+	if err != nil {
+		return nil, err
+	}
+	return t.parts(ctx, Args(raw))
+}
+
+// arguments decodes argsJSON, fills in the parameter defaults and validates
+// the result against the parameter schema.
+func (t *Tool) arguments(argsJSON string) (map[string]any, error) {
 	var raw map[string]any
-	if err := json.Unmarshal([]byte(argsJSON), &raw); err != nil {
-		return "", fmt.Errorf("failed to parse arguments: %w", err)
+	if _, err := t.decodeJSON(argsJSON, &raw); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		raw = make(map[string]any)
+	}
+	applyDefaults(t.params, raw)
+	if err := t.check(argsJSON, raw); err != nil {
+		return nil, err
 	}
+	return raw, nil
+}
 
-	return t.handler(ctx, Args(raw))
+// validate validates argsJSON against the parameter schema and returns it,
+// repaired when the tool is lenient. Numbers are validated as decoded with
+// json.Number, so that they are not rounded.
+func (t *Tool) validate(argsJSON string) (string, error) {
+	var raw any
+	decoded, err := t.decodeJSON(argsJSON, &raw)
+	if err != nil {
+		return "", err
+	}
+	if raw == nil {
+		raw = make(map[string]any)
+	}
+	if err := t.check(argsJSON, raw); err != nil {
+		return "", err
+	}
+	return decoded, nil
 }
 
-func (t *Tool) ToProvider() provider.Tool {
-	properties := make(map[string]any)
-	var required []string
+func (t *Tool) check(argsJSON string, raw any) error {
+	if t.builtin != "" {
+		return nil
+	}
+	validator, err := t.compiled()
+	if err != nil {
+		return err
+	}
+	if err := validator.Validate(raw); err != nil {
+		return &ArgumentsError{Arguments: argsJSON, Err: err}
+	}
+	return nil
+}
 
-	for _, p := range t.params {
-		prop := map[string]any{
-			"type": p.typ,
-		}
-		if p.description != "" {
-			prop["description"] = p.description
-		}
-		if len(p.enum) > 0 {
-			prop["enum"] = p.enum
+// compiled returns the parameter schema, compiled once.
+func (t *Tool) compiled() (*schema.Schema, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.validator != nil {
+		return t.validator, nil
+	}
+	validator, err := schema.New(t.ToProvider().Function.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema for tool %q: %w", t.name, err)
+	}
+	t.validator = validator
+	return validator, nil
+}
+
+func (t *Tool) resetValidator() {
+	t.mu.Lock()
+	t.validator = nil
+	t.mu.Unlock()
+}
+
+func (t *Tool) decode(argsJSON string, v any) error {
+	_, err := t.decodeJSON(argsJSON, v)
+	return err
+}
+
+// decodeJSON decodes argsJSON into v and returns the JSON decoded, which
+// differs from argsJSON when a lenient tool repaired it. Values decoded
+// into an interface keep their numbers as json.Number.
+func (t *Tool) decodeJSON(argsJSON string, v any) (string, error) {
+	err := unmarshal(argsJSON, v)
+	if err == nil {
+		return argsJSON, nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	if t.lenient && errors.As(err, &syntaxErr) {
+		if repaired, repairErr := RepairJSON(argsJSON); repairErr == nil {
+			err = unmarshal(repaired, v)
+			if err == nil {
+				return repaired, nil
+			}
 		}
-		if p.items != "" {
-			prop["items"] = map[string]any{"type": p.items}
+	}
+	return "", &ArgumentsError{Arguments: argsJSON, Err: err}
+}
+
+func unmarshal(data string, v any) error {
+	if _, ok := v.(*any); !ok || !json.Valid([]byte(data)) {
+		return json.Unmarshal([]byte(data), v)
+	}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func (t *Tool) ToProvider() provider.Tool {
+	if t.builtin != "" {
+		return provider.Tool{
+			Type:     t.builtin,
+			Function: provider.Function{Name: t.name, Description: t.description},
+			Options:  t.options,
 		}
-		properties[p.name] = prop
-		if p.required {
-			required = append(required, p.name)
+	}
+	if t.schema != nil {
+		return provider.Tool{
+			Type: "function",
+			Function: provider.Function{
+				Name:        t.name,
+				Description: t.description,
+				Parameters:  t.schema,
+			},
 		}
 	}
 
+	properties, required := objectSchema(t.params)
+
 	return provider.Tool{
 		Type: "function",
 		Function: provider.Function{
@@ -90,6 +342,19 @@ func (t *Tool) ToProvider() provider.Tool {
 	}
 }
 
+// objectSchema returns the properties and required names of params.
+func objectSchema(params []*ParamBuilder) (map[string]any, []string) {
+	properties := make(map[string]any)
+	var required []string
+	for _, p := range params {
+		properties[p.name] = p.schema()
+		if p.required {
+			required = append(required, p.name)
+		}
+	}
+	return properties, required
+}
+
 type ParamBuilder struct {
 	name        string
 	typ         string
@@ -97,6 +362,57 @@ type ParamBuilder struct {
 	required    bool
 	enum        []string
 	items       string
+	item        *ParamBuilder
+	props       []*ParamBuilder
+	def         any
+	min, max    *float64
+	pattern     string
+	minLength   *int
+	maxLength   *int
+}
+
+func (p *ParamBuilder) schema() map[string]any {
+	prop := map[string]any{}
+	if p.typ != "" {
+		prop["type"] = p.typ
+	}
+	if p.description != "" {
+		prop["description"] = p.description
+	}
+	if len(p.enum) > 0 {
+		prop["enum"] = p.enum
+	}
+	if p.def != nil {
+		prop["default"] = p.def
+	}
+	if p.min != nil {
+		prop["minimum"] = *p.min
+	}
+	if p.max != nil {
+		prop["maximum"] = *p.max
+	}
+	if p.pattern != "" {
+		prop["pattern"] = p.pattern
+	}
+	if p.minLength != nil {
+		prop["minLength"] = *p.minLength
+	}
+	if p.maxLength != nil {
+		prop["maxLength"] = *p.maxLength
+	}
+	if p.item != nil {
+		prop["items"] = p.item.schema()
+	} else if p.items != "" {
+		prop["items"] = map[string]any{"type": p.items}
+	}
+	if len(p.props) > 0 {
+		properties, required := objectSchema(p.props)
+		prop["properties"] = properties
+		if len(required) > 0 {
+			prop["required"] = required
+		}
+	}
+	return prop
 }
 
 func Param(name string) *ParamBuilder {
@@ -135,11 +451,28 @@ func (p *ParamBuilder) Array(itemType string) *ParamBuilder {
 	return p
 }
 
+// ArrayOf declares an array whose items are described by item, such as an
+// object with Props. The name of item is ignored.
+func (p *ParamBuilder) ArrayOf(item *ParamBuilder) *ParamBuilder {
+	p.typ = "array"
+	p.item = item
+	return p
+}
+
 func (p *ParamBuilder) Object() *ParamBuilder {
 	p.typ = "object"
 	return p
 }
 
+// Props declares the properties of an object parameter:
+//
+//	Param("address").Props(Param("city").String().Required(), Param("zip").String())
+func (p *ParamBuilder) Props(params ...*ParamBuilder) *ParamBuilder {
+	p.typ = "object"
+	p.props = params
+	return p
+}
+
 func (p *ParamBuilder) Required() *ParamBuilder {
 	p.required = true
 	return p
@@ -150,6 +483,57 @@ func (p *ParamBuilder) Desc(description string) *ParamBuilder {
 	return p
 }
 
+// Default is the value the handler receives when the model leaves the
+// parameter out.
+func (p *ParamBuilder) Default(v any) *ParamBuilder {
+	p.def = v
+	return p
+}
+
+// Min and Max bound a number or integer parameter, inclusively.
+func (p *ParamBuilder) Min(n float64) *ParamBuilder {
+	p.min = &n
+	return p
+}
+
+func (p *ParamBuilder) Max(n float64) *ParamBuilder {
+	p.max = &n
+	return p
+}
+
+// Pattern is a regular expression a string parameter must match.
+func (p *ParamBuilder) Pattern(re string) *ParamBuilder {
+	p.pattern = re
+	return p
+}
+
+// MinLength and MaxLength bound the number of characters of a string
+// parameter.
+func (p *ParamBuilder) MinLength(n int) *ParamBuilder {
+	p.minLength = &n
+	return p
+}
+
+func (p *ParamBuilder) MaxLength(n int) *ParamBuilder {
+	p.maxLength = &n
+	return p
+}
+
+// applyDefaults sets the defaults of params missing from args, recursing
+// into object parameters.
+func applyDefaults(params []*ParamBuilder, args map[string]any) {
+	for _, p := range params {
+		v, ok := args[p.name]
+		if !ok && p.def != nil {
+			args[p.name] = p.def
+			continue
+		}
+		if object, isObject := v.(map[string]any); isObject && len(p.props) > 0 {
+			applyDefaults(p.props, object)
+		}
+	}
+}
+
 type Args map[string]any
 
 func (a Args) String(key string) string {
@@ -0,0 +1,69 @@
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// migrations[v] upgrades a transcript from version v to v+1.
+var migrations = map[int]func(data []byte) ([]byte, error){
+	0: migrateV0,
+}
+
+// Migrate upgrades transcript data of an earlier version to the current
+// one. Data of the current version is returned as is.
+func Migrate(data []byte) ([]byte, error) {
+	v, err := version(data)
+	if err != nil {
+		return nil, err
+	}
+	if v > Version {
+		return nil, fmt.Errorf("transcript version %d is newer than the supported version %d", v, Version)
+	}
+	for ; v < Version; v++ {
+		migrate, ok := migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration from transcript version %d", v)
+		}
+		if data, err = migrate(data); err != nil {
+			return nil, fmt.Errorf("failed to migrate transcript from version %d: %w", v, err)
+		}
+	}
+	return data, nil
+}
+
+// migrateV0 wraps the messages in the versioned envelope and flattens the
+// tool calls, which version 0 nests under function like the OpenAI API.
+func migrateV0(data []byte) ([]byte, error) {
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		raw, ok := msg["tool_calls"]
+		if !ok {
+			continue
+		}
+		var calls []struct {
+			ID       string `json:"id"`
+			Type     string `json:"type"`
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"function"`
+		}
+		if err := json.Unmarshal(raw, &calls); err != nil {
+			return nil, err
+		}
+		flat := make([]toolCall, len(calls))
+		for i, tc := range calls {
+			flat[i] = toolCall{ID: tc.ID, Type: tc.Type, Name: tc.Function.Name, Arguments: tc.Function.Arguments}
+		}
+		raw, err := json.Marshal(flat)
+		if err != nil {
+			return nil, err
+		}
+		msg["tool_calls"] = raw
+	}
+	return json.Marshal(map[string]any{"version": 1, "messages": messages})
+}
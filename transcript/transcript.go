@@ -0,0 +1,244 @@
+// Package transcript serializes conversations to a versioned JSON format,
+// so that they can be stored, sent to other services and replayed:
+//
+//	data, err := transcript.Marshal(session.Messages())
+//	...
+//	messages, err := transcript.Unmarshal(data)
+//
+// The format is independent of the JSON encoding of provider.Message, and
+// documents written by earlier versions are migrated when read.
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alexisbouchez/ai/provider"
+	"github.com/alexisbouchez/ai/store"
+)
+
+// Version is the version of the format written by Marshal.
+const Version = 1
+
+type envelope struct {
+	Version  int       `json:"version"`
+	Messages []message `json:"messages"`
+}
+
+type message struct {
+	Role        string       `json:"role"`
+	Content     string       `json:"content,omitempty"`
+	Parts       []part       `json:"parts,omitempty"`
+	ToolCalls   []toolCall   `json:"tool_calls,omitempty"`
+	ToolCallID  string       `json:"tool_call_id,omitempty"`
+	Name        string       `json:"name,omitempty"`
+	Audio       *audio       `json:"audio,omitempty"`
+	HostedTools []hostedTool `json:"hosted_tools,omitempty"`
+}
+
+type part struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	JSON     json.RawMessage `json:"json,omitempty"`
+	Image    *image          `json:"image,omitempty"`
+	Audio    *audio          `json:"audio,omitempty"`
+	Document *document       `json:"document,omitempty"`
+}
+
+type image struct {
+	URL       string `json:"url,omitempty"`
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+}
+
+type audio struct {
+	ID         string `json:"id,omitempty"`
+	Data       string `json:"data,omitempty"`
+	Format     string `json:"format,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
+}
+
+type document struct {
+	Data      string `json:"data,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	FileID    string `json:"file_id,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Citations bool   `json:"citations,omitempty"`
+}
+
+// toolCall keeps the arguments as sent by the model, which may not be
+// valid JSON.
+type toolCall struct {
+	ID        string `json:"id"`
+	Type      string `json:"type,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type hostedTool struct {
+	ID     string          `json:"id,omitempty"`
+	Name   string          `json:"name"`
+	Input  json.RawMessage `json:"input,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Marshal encodes messages in the current version of the format.
+func Marshal(messages []provider.Message) ([]byte, error) {
+	doc := envelope{Version: Version, Messages: make([]message, len(messages))}
+	for i, msg := range messages {
+		doc.Messages[i] = fromProvider(msg)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal transcript: %w", err)
+	}
+	return data, nil
+}
+
+// Unmarshal decodes a transcript written by Marshal, of the current or an
+// earlier version.
+func Unmarshal(data []byte) ([]provider.Message, error) {
+	data, err := Migrate(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc envelope
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid transcript: %w", err)
+	}
+	messages := make([]provider.Message, len(doc.Messages))
+	for i, msg := range doc.Messages {
+		messages[i] = msg.toProvider()
+	}
+	return messages, nil
+}
+
+// Save stores messages under key.
+func Save(ctx context.Context, s store.Store, key string, messages []provider.Message) error {
+	data, err := Marshal(messages)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, key, data)
+}
+
+// Load returns the messages stored under key by Save.
+func Load(ctx context.Context, s store.Store, key string) ([]provider.Message, error) {
+	data, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(data)
+}
+
+// version returns the version of the transcript data. A bare array is the
+// JSON encoding of []provider.Message, written before the format existed.
+func version(data []byte) (int, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return 0, nil
+	}
+	var header struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, fmt.Errorf("invalid transcript: %w", err)
+	}
+	if header.Version == nil {
+		return 0, fmt.Errorf("invalid transcript: no version")
+	}
+	return *header.Version, nil
+}
+
+func fromProvider(msg provider.Message) message {
+	m := message{
+		Role:       string(msg.Role),
+		Content:    msg.Content,
+		ToolCallID: msg.ToolCallID,
+		Name:       msg.Name,
+		Audio:      fromAudio(msg.Audio),
+	}
+	for _, p := range msg.Parts {
+		wire := part{Type: string(p.Type), Text: p.Text, JSON: p.JSON, Audio: fromAudio(p.Audio)}
+		if p.Image != nil {
+			wire.Image = &image{URL: p.Image.URL, Data: p.Image.Data, MediaType: p.Image.MediaType}
+		}
+		if d := p.Document; d != nil {
+			wire.Document = &document{
+				Data:      d.Data,
+				MediaType: d.MediaType,
+				FileID:    d.FileID,
+				Filename:  d.Filename,
+				Title:     d.Title,
+				Citations: d.Citations,
+			}
+		}
+		m.Parts = append(m.Parts, wire)
+	}
+	for _, tc := range msg.ToolCalls {
+		m.ToolCalls = append(m.ToolCalls, toolCall{
+			ID:        tc.ID,
+			Type:      tc.Type,
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+	for _, h := range msg.HostedTools {
+		m.HostedTools = append(m.HostedTools, hostedTool{ID: h.ID, Name: h.Name, Input: h.Input, Result: h.Result})
+	}
+	return m
+}
+
+func (m message) toProvider() provider.Message {
+	msg := provider.Message{
+		Role:       provider.Role(m.Role),
+		Content:    m.Content,
+		ToolCallID: m.ToolCallID,
+		Name:       m.Name,
+		Audio:      m.Audio.toProvider(),
+	}
+	for _, p := range m.Parts {
+		part := provider.Part{Type: provider.PartType(p.Type), Text: p.Text, JSON: p.JSON, Audio: p.Audio.toProvider()}
+		if p.Image != nil {
+			part.Image = &provider.Image{URL: p.Image.URL, Data: p.Image.Data, MediaType: p.Image.MediaType}
+		}
+		if d := p.Document; d != nil {
+			part.Document = &provider.Document{
+				Data:      d.Data,
+				MediaType: d.MediaType,
+				FileID:    d.FileID,
+				Filename:  d.Filename,
+				Title:     d.Title,
+				Citations: d.Citations,
+			}
+		}
+		msg.Parts = append(msg.Parts, part)
+	}
+	for _, tc := range m.ToolCalls {
+		msg.ToolCalls = append(msg.ToolCalls, provider.ToolCall{
+			ID:       tc.ID,
+			Type:     tc.Type,
+			Function: provider.FunctionCall{Name: tc.Name, Arguments: tc.Arguments},
+		})
+	}
+	for _, h := range m.HostedTools {
+		msg.HostedTools = append(msg.HostedTools, provider.HostedToolUse{ID: h.ID, Name: h.Name, Input: h.Input, Result: h.Result})
+	}
+	return msg
+}
+
+func fromAudio(a *provider.Audio) *audio {
+	if a == nil {
+		return nil
+	}
+	return &audio{ID: a.ID, Data: a.Data, Format: a.Format, Transcript: a.Transcript}
+}
+
+func (a *audio) toProvider() *provider.Audio {
+	if a == nil {
+		return nil
+	}
+	return &provider.Audio{ID: a.ID, Data: a.Data, Format: a.Format, Transcript: a.Transcript}
+}